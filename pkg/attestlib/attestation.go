@@ -20,17 +20,88 @@ package attestlib
 // specific to the wire format. An Attestation can only be trusted after
 // successfully verifying its Signature.
 //
-// Each Attestation contains one signature. It can store signatures generated
-// by PGP or PKIX keys, or it can store an attestation represented as a JWT.
+// Each Attestation contains one signature, or several Signatures over the
+// same payload. It can store signatures generated by PGP or PKIX keys, or it
+// can store an attestation represented as a JWT.
 type Attestation struct {
 	// PublicKeyID is the ID of the public key that can verify the Attestation.
 	PublicKeyID string
-	// Signature stores the signature content for the Attestation. For PKIX,
-	// this is only the raw signature. For PGP, this is an attached signature,
-	// containing both the signature and message payload. For JWT, this is a
-	// signed and serialized JWT.
+	// Signature stores the signature content for the Attestation. For PKIX
+	// and Ed25519, this is only the raw signature. For PGP, this is an attached
+	// signature, containing both the signature and message payload. For JWT,
+	// this is a signed and serialized JWT.
 	Signature []byte
 	// SerializedPayload stores the payload over which the signature was
-	// signed. This field is only used for PKIX Attestations.
+	// signed. This field is only used for PKIX and Ed25519 Attestations, and
+	// for PGP and JWT Attestations with a DetachedSignature.
 	SerializedPayload []byte
+	// DetachedSignature indicates that the Signature of a PGP or JWT
+	// Attestation is detached from its payload, which is stored in
+	// SerializedPayload instead of being extracted from the Signature. For
+	// PGP, Signature is a detached signature, as generated by
+	// `gpg --detach-sign`. For JWT, Signature is a JWT with detached content,
+	// `header..signature`. Other key types always use detached signatures.
+	DetachedSignature bool
+	// SignatureEncoding indicates how Signature, and the Signature of each of
+	// Signatures, is encoded as text, if at all. The Verifier decodes them
+	// before verifying them. RawEncoding, the default, leaves them as is.
+	SignatureEncoding SignatureEncoding
+	// EnvelopeType indicates how Signature is wrapped. For Dsse, Signature
+	// stores a JSON encoded DSSE envelope containing the payload and one or
+	// more signatures, and SerializedPayload is unused. For Cms, Signature
+	// stores a CMS SignedData encapsulating the payload, or, with a
+	// DetachedSignature, signing SerializedPayload. For CoseSign1, Signature
+	// stores a COSE_Sign1 message carrying the payload or, with a
+	// DetachedSignature, signing SerializedPayload.
+	EnvelopeType EnvelopeType
+	// SignatureAlgorithm optionally declares the algorithm used to create
+	// Signature, e.g. to distinguish RSA PKCS#1 v1.5 from RSA-PSS signatures.
+	// If set, it must match the SignatureAlgorithm of the verifying public
+	// key. UnknownSigningAlgorithm leaves the algorithm to the public key.
+	SignatureAlgorithm SignatureAlgorithm
+	// SigstoreBundle optionally holds the signing certificate and Rekor entry
+	// of a keyless Attestation. If set, Signature is verified with the public
+	// key of the certificate instead of a public key of the Verifier, and
+	// PublicKeyID is ignored. It cannot be combined with an envelope.
+	SigstoreBundle *SigstoreBundle
+	// Signatures optionally holds several signatures over the payload, each
+	// naming its own public key, in place of PublicKeyID and Signature. The
+	// Attestation is verified if any of them is verified. It cannot be
+	// combined with an envelope or a SigstoreBundle.
+	Signatures []SignatureEntry
 }
+
+// SignatureEncoding specifies how the signatures of an Attestation are
+// encoded as text.
+type SignatureEncoding int
+
+// Enumeration of SignatureEncoding
+const (
+	// RawEncoding indicates that the signatures are stored as is.
+	RawEncoding SignatureEncoding = iota
+	// Base64Encoding indicates that the signatures are base64 encoded, with
+	// the standard or the URL-safe alphabet and with or without padding.
+	Base64Encoding
+	// HexEncoding indicates that the signatures are hex encoded, in upper or
+	// lower case.
+	HexEncoding
+)
+
+// EnvelopeType specifies how the signature of an Attestation is wrapped.
+type EnvelopeType int
+
+// Enumeration of EnvelopeType
+const (
+	// NoEnvelope indicates that the Signature is stored as described by the
+	// AuthenticatorType of the key that verifies it.
+	NoEnvelope EnvelopeType = iota
+	// Dsse indicates that the Signature is a Dead Simple Signing Envelope:
+	// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+	Dsse
+	// Cms indicates that the Signature is a DER or PEM encoded PKCS#7/CMS
+	// SignedData, defined in RFC 5652, that embeds the signer's certificates.
+	Cms
+	// CoseSign1 indicates that the Signature is a CBOR encoded COSE_Sign1
+	// message, defined in RFC 9052, such as a notation signature envelope.
+	CoseSign1
+)
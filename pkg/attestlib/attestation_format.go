@@ -0,0 +1,139 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// AttestationFormat specifies the wire format ParseAttestation decodes.
+type AttestationFormat int
+
+// Enumeration of AttestationFormat
+const (
+	UnknownAttestationFormat AttestationFormat = iota
+	// GrafeasFormat is the JSON encoding of a Grafeas v1beta1 ATTESTATION
+	// Occurrence, holding either a PgpSignedAttestation or a
+	// GenericSignedAttestation.
+	GrafeasFormat
+	// JSONFormat is the JSON encoding of an Attestation with the fields
+	// "publicKeyId", "signature" and "serializedPayload", where signature
+	// and serializedPayload are base64 encoded.
+	JSONFormat
+)
+
+// grafeasOccurrence is the subset of a Grafeas v1beta1 Occurrence that holds
+// an attestation.
+type grafeasOccurrence struct {
+	Attestation *struct {
+		Attestation *struct {
+			PgpSignedAttestation *struct {
+				Signature string `json:"signature"`
+				PgpKeyID  string `json:"pgpKeyId"`
+			} `json:"pgpSignedAttestation"`
+			GenericSignedAttestation *struct {
+				SerializedPayload []byte `json:"serializedPayload"`
+				Signatures        []struct {
+					Signature   []byte `json:"signature"`
+					PublicKeyID string `json:"publicKeyId"`
+				} `json:"signatures"`
+			} `json:"genericSignedAttestation"`
+		} `json:"attestation"`
+	} `json:"attestation"`
+}
+
+// jsonAttestation is the JSONFormat encoding of an Attestation.
+type jsonAttestation struct {
+	PublicKeyID       string `json:"publicKeyId"`
+	Signature         []byte `json:"signature"`
+	SerializedPayload []byte `json:"serializedPayload"`
+}
+
+// ParseAttestation decodes an Attestation from `data` in the given wire
+// format. A Grafeas GenericSignedAttestation with several signatures is
+// decoded into an Attestation with Signatures.
+func ParseAttestation(data []byte, format AttestationFormat) (*Attestation, error) {
+	switch format {
+	case GrafeasFormat:
+		return parseGrafeasAttestation(data)
+	case JSONFormat:
+		var att jsonAttestation
+		if err := json.Unmarshal(data, &att); err != nil {
+			return nil, errors.Wrap(err, "error unmarshaling attestation")
+		}
+		if len(att.Signature) == 0 {
+			return nil, errors.New("attestation has no signature")
+		}
+		return &Attestation{
+			PublicKeyID:       att.PublicKeyID,
+			Signature:         att.Signature,
+			SerializedPayload: att.SerializedPayload,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown attestation format %d", format)
+	}
+}
+
+func parseGrafeasAttestation(data []byte) (*Attestation, error) {
+	var occ grafeasOccurrence
+	if err := json.Unmarshal(data, &occ); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling Grafeas occurrence")
+	}
+	if occ.Attestation == nil || occ.Attestation.Attestation == nil {
+		return nil, errors.New("Grafeas occurrence has no attestation")
+	}
+	switch att := occ.Attestation.Attestation; {
+	case att.PgpSignedAttestation != nil:
+		if att.PgpSignedAttestation.Signature == "" {
+			return nil, errors.New("Grafeas PgpSignedAttestation has no signature")
+		}
+		return &Attestation{
+			PublicKeyID: att.PgpSignedAttestation.PgpKeyID,
+			Signature:   []byte(att.PgpSignedAttestation.Signature),
+		}, nil
+	case att.GenericSignedAttestation != nil:
+		gsa := att.GenericSignedAttestation
+		if len(gsa.Signatures) == 0 {
+			return nil, errors.New("Grafeas GenericSignedAttestation has no signatures")
+		}
+		for i, sig := range gsa.Signatures {
+			if len(sig.Signature) == 0 {
+				return nil, fmt.Errorf("Grafeas GenericSignedAttestation has an empty signature %d", i)
+			}
+		}
+		if len(gsa.Signatures) == 1 {
+			return &Attestation{
+				PublicKeyID:       gsa.Signatures[0].PublicKeyID,
+				Signature:         gsa.Signatures[0].Signature,
+				SerializedPayload: gsa.SerializedPayload,
+			}, nil
+		}
+		entries := make([]SignatureEntry, len(gsa.Signatures))
+		for i, sig := range gsa.Signatures {
+			entries[i] = SignatureEntry{PublicKeyID: sig.PublicKeyID, Signature: sig.Signature}
+		}
+		return &Attestation{
+			Signatures:        entries,
+			SerializedPayload: gsa.SerializedPayload,
+		}, nil
+	default:
+		return nil, errors.New("Grafeas attestation has no PgpSignedAttestation or GenericSignedAttestation")
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestParseAttestation(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	tcs := []struct {
+		name        string
+		data        string
+		format      AttestationFormat
+		expected    Attestation
+		expectedErr bool
+	}{
+		{
+			name: "Grafeas PgpSignedAttestation",
+			data: `{
+				"name": "projects/my-project/occurrences/1",
+				"kind": "ATTESTATION",
+				"attestation": {"attestation": {"pgpSignedAttestation": {
+					"signature": "-----BEGIN PGP MESSAGE-----",
+					"contentType": "SIMPLE_SIGNING_JSON",
+					"pgpKeyId": "ABCDEF"
+				}}}
+			}`,
+			format:   GrafeasFormat,
+			expected: Attestation{PublicKeyID: "ABCDEF", Signature: []byte("-----BEGIN PGP MESSAGE-----")},
+		},
+		{
+			name: "Grafeas GenericSignedAttestation",
+			data: fmt.Sprintf(`{
+				"kind": "ATTESTATION",
+				"attestation": {"attestation": {"genericSignedAttestation": {
+					"contentType": "SIMPLE_SIGNING_JSON",
+					"serializedPayload": %q,
+					"signatures": [{"signature": %q, "publicKeyId": "ni:///sha-256;key"}]
+				}}}
+			}`, b64([]byte("payload")), b64([]byte("signature"))),
+			format:   GrafeasFormat,
+			expected: Attestation{PublicKeyID: "ni:///sha-256;key", Signature: []byte("signature"), SerializedPayload: []byte("payload")},
+		},
+		{
+			name:     "raw JSON",
+			data:     fmt.Sprintf(`{"publicKeyId": "my-key", "signature": %q, "serializedPayload": %q}`, b64([]byte("signature")), b64([]byte("payload"))),
+			format:   JSONFormat,
+			expected: Attestation{PublicKeyID: "my-key", Signature: []byte("signature"), SerializedPayload: []byte("payload")},
+		},
+		{
+			name:        "malformed Grafeas occurrence",
+			data:        `{"attestation": {"attestation": `,
+			format:      GrafeasFormat,
+			expectedErr: true,
+		},
+		{
+			name:        "Grafeas occurrence without attestation",
+			data:        `{"kind": "VULNERABILITY", "vulnerability": {}}`,
+			format:      GrafeasFormat,
+			expectedErr: true,
+		},
+		{
+			name:        "Grafeas attestation without signature",
+			data:        `{"attestation": {"attestation": {"pgpSignedAttestation": {"pgpKeyId": "ABCDEF"}}}}`,
+			format:      GrafeasFormat,
+			expectedErr: true,
+		},
+		{
+			name: "Grafeas GenericSignedAttestation with several signatures",
+			data: fmt.Sprintf(`{"attestation": {"attestation": {"genericSignedAttestation": {
+				"serializedPayload": %q,
+				"signatures": [{"signature": %q, "publicKeyId": "a"}, {"signature": %q, "publicKeyId": "b"}]
+			}}}}`, b64([]byte("payload")), b64([]byte("signature a")), b64([]byte("signature b"))),
+			format: GrafeasFormat,
+			expected: Attestation{
+				Signatures:        []SignatureEntry{{PublicKeyID: "a", Signature: []byte("signature a")}, {PublicKeyID: "b", Signature: []byte("signature b")}},
+				SerializedPayload: []byte("payload"),
+			},
+		},
+		{
+			name: "Grafeas GenericSignedAttestation with an empty signature",
+			data: fmt.Sprintf(`{"attestation": {"attestation": {"genericSignedAttestation": {
+				"signatures": [{"signature": %q, "publicKeyId": "a"}, {"publicKeyId": "b"}]
+			}}}}`, b64([]byte("signature"))),
+			format:      GrafeasFormat,
+			expectedErr: true,
+		},
+		{
+			name:        "Grafeas GenericSignedAttestation without signatures",
+			data:        `{"attestation": {"attestation": {"genericSignedAttestation": {"signatures": []}}}}`,
+			format:      GrafeasFormat,
+			expectedErr: true,
+		},
+		{
+			name:        "raw JSON with invalid base64",
+			data:        `{"publicKeyId": "my-key", "signature": "not base64!"}`,
+			format:      JSONFormat,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown format",
+			data:        `{}`,
+			format:      UnknownAttestationFormat,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att, err := ParseAttestation([]byte(tc.data), tc.format)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("ParseAttestation(...) = %+v, expected error", att)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAttestation(...) = %v, expected nil", err)
+			}
+			if !reflect.DeepEqual(*att, tc.expected) {
+				t.Errorf("ParseAttestation(...) = %+v, expected %+v", *att, tc.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyParsedGrafeasAttestation(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	data := fmt.Sprintf(`{"attestation": {"attestation": {"genericSignedAttestation": {
+		"serializedPayload": %q,
+		"signatures": [{"signature": %q, "publicKeyId": "signing-key"}]
+	}}}}`, base64.StdEncoding.EncodeToString([]byte(validPayload)), base64.StdEncoding.EncodeToString(signature))
+	att, err := ParseAttestation([]byte(data), GrafeasFormat)
+	if err != nil {
+		t.Fatalf("ParseAttestation(...) = %v, expected nil", err)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+}
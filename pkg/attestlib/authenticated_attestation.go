@@ -17,8 +17,14 @@ limitations under the License.
 package attestlib
 
 import (
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 )
 
@@ -26,8 +32,8 @@ import (
 // conforms to Red Hat's Atomic Host attestation signature format defined here:
 // https://github.com/aweiteka/image/blob/e5a20d98fe698732df2b142846d007b45873627f/docs/signature.md
 type atomicContainerSig struct {
-	Critical critical          `json:"critical"`
-	Optional map[string]string `json:"optional,omitempty"`
+	Critical critical  `json:"critical"`
+	Optional *optional `json:"optional,omitempty"`
 }
 
 type critical struct {
@@ -36,6 +42,13 @@ type critical struct {
 	Type     string   `json:"type"`
 }
 
+type optional struct {
+	Creator string `json:"creator,omitempty"`
+	// Timestamp is the creation time of the signature, in seconds since the
+	// Unix epoch.
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
 type identity struct {
 	DockerRef string `json:"docker-reference"`
 }
@@ -44,6 +57,27 @@ type image struct {
 	Digest string `json:"docker-manifest-digest"`
 }
 
+// atomicContainerSigType is the value of critical.type in an Atomic Host
+// signature.
+const atomicContainerSigType = "atomic container signature"
+
+// newAtomicContainerPayload serializes an Atomic Host signature payload for
+// the image with the given name and digest, created at `timestamp`.
+func newAtomicContainerPayload(imageName string, imageDigest string, timestamp time.Time) ([]byte, error) {
+	payload, err := json.Marshal(atomicContainerSig{
+		Critical: critical{
+			Identity: identity{DockerRef: imageName},
+			Image:    image{Digest: imageDigest},
+			Type:     atomicContainerSigType,
+		},
+		Optional: &optional{Timestamp: timestamp.Unix()},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error serializing attestation payload")
+	}
+	return payload, nil
+}
+
 // TODO(https://github.com/grafeas/kritis/issues/503): Decide whether
 // AuthenticatedAttestation is a useful abstraction.
 // AuthenticatedAttestation contains data that is extracted from an Attestation
@@ -51,9 +85,29 @@ type image struct {
 // payload should never be analyzed directly, as it may or may not be verified.
 // Instead, these should be extracted into an AuthenticatedAttestation and
 // analyzed from there.
-type authenticatedAttestation struct {
-	ImageName   string
+type AuthenticatedAttestation struct {
+	// ImageName is the name of the image the payload describes. If empty,
+	// e.g. for payload formats that only contain a digest, the image name is
+	// not checked.
+	ImageName string
+	// ImageDigest is the digest of the image the payload describes.
 	ImageDigest string
+	// ImageTag is the tag of an image the payload references by tag rather
+	// than by digest. Such payloads have no ImageDigest, and are only
+	// accepted by verifiers with a DigestResolver.
+	ImageTag string
+	// PredicateType is the predicate type of an in-toto Statement. It is
+	// empty for Atomic Host signatures.
+	PredicateType string
+	// Predicate is the raw JSON predicate of an in-toto Statement. It is nil
+	// for Atomic Host signatures.
+	Predicate json.RawMessage
+	// SubjectDigests holds the digests of the subjects of an in-toto
+	// Statement. ImageName and ImageDigest are unused for in-toto Statements.
+	SubjectDigests []string
+	// Timestamp is the creation time of the payload. It is zero if the
+	// payload has no timestamp.
+	Timestamp time.Time
 }
 
 type authenticatedAttCheckerImpl struct{}
@@ -61,27 +115,224 @@ type authenticatedAttCheckerImpl struct{}
 // Check that the data within the Attestation payload matches what we expect.
 // NOTE: This is a simple comparison for plain attestations, but it is more
 // complex for rich attestations.
-func (c authenticatedAttCheckerImpl) checkAuthenticatedAttestation(payload []byte, imageName string, imageDigest string, convert convertFunc) error {
+// The payload's digest must match one of `imageDigests`, which are equivalent
+// digests of the image being verified. For in-toto Statements, only the
+// subject digests are checked: at least one subject must have an expected
+// digest.
+// The image name and the hex encoding of the digests, which the signer of the
+// payload controls, are compared with timingSafeEqual. Digest algorithms are
+// from a fixed set and are compared as usual.
+// Empty digests fail closed: an empty expected digest is an error, and a
+// payload without a digest is rejected, so that they never match each other.
+func (c authenticatedAttCheckerImpl) CheckAuthenticatedAttestation(payload []byte, imageName string, imageDigests []string, convert ConvertFunc) error {
 	authAtt, err := convert(payload)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if len(imageDigests) == 0 {
+		return errors.New("invalid image digest: no digest given")
+	}
+	if len(authAtt.SubjectDigests) == 0 && strings.TrimSpace(authAtt.ImageDigest) == "" {
+		return fmt.Errorf("%w: attestation payload has no image digest", ErrInvalidPayload)
+	}
+	expectedDigests := make([]parsedDigest, 0, len(imageDigests))
+	for _, imageDigest := range imageDigests {
+		if strings.TrimSpace(imageDigest) == "" {
+			return errors.New("invalid image digest: empty digest")
+		}
+		expectedDigest, err := parseDigest(imageDigest)
+		if err != nil {
+			return errors.Wrap(err, "invalid image digest")
+		}
+		expectedDigests = append(expectedDigests, expectedDigest)
+	}
+	if len(authAtt.SubjectDigests) != 0 {
+		subjectDigests := make([]parsedDigest, 0, len(authAtt.SubjectDigests))
+		for _, digest := range authAtt.SubjectDigests {
+			actualDigest, err := parseDigest(digest)
+			if err != nil {
+				return fmt.Errorf("%w: invalid in-toto subject digest: %v", ErrInvalidPayload, err)
+			}
+			subjectDigests = append(subjectDigests, actualDigest)
+		}
+		return matchDigests(expectedDigests, subjectDigests)
+	}
+	if authAtt.ImageName != "" && !timingSafeEqual(authAtt.ImageName, imageName) {
+		return fmt.Errorf("%w: incorrect image name in Attestation payload", ErrPayloadMismatch)
+	}
+	actualDigest, err := parseDigest(authAtt.ImageDigest)
+	if err != nil {
+		return fmt.Errorf("%w: invalid image digest in Attestation payload: %v", ErrInvalidPayload, err)
+	}
+	return matchDigests(expectedDigests, []parsedDigest{actualDigest})
+}
+
+// matchDigests checks that one of the `actual` digests found in a payload is
+// one of the `expected` digests. If none is, the error is a
+// *DigestMismatchError if an actual digest uses the algorithm of an expected
+// one, and a *DigestAlgorithmMismatchError otherwise.
+func matchDigests(expected []parsedDigest, actual []parsedDigest) error {
+	algorithmFound := false
+	for _, a := range actual {
+		for _, e := range expected {
+			if a.equal(e) {
+				return nil
+			}
+			if a.algorithm == e.algorithm {
+				algorithmFound = true
+			}
+		}
+	}
+	if !algorithmFound {
+		return &DigestAlgorithmMismatchError{Expected: joinDigestAlgorithms(expected), Actual: joinDigestAlgorithms(actual)}
+	}
+	return &DigestMismatchError{Expected: joinDigests(expected), Actual: joinDigests(actual)}
+}
+
+func joinDigests(digests []parsedDigest) string {
+	parts := make([]string, 0, len(digests))
+	for _, d := range digests {
+		parts = append(parts, d.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// joinDigestAlgorithms lists the distinct algorithms of `digests`.
+func joinDigestAlgorithms(digests []parsedDigest) string {
+	algorithms := []string{}
+	for _, d := range digests {
+		if !containsString(algorithms, d.algorithm) {
+			algorithms = append(algorithms, d.algorithm)
+		}
+	}
+	return strings.Join(algorithms, ", ")
+}
+
+// digestHexLengths maps the supported digest algorithms to the length of
+// their hex encoding.
+var digestHexLengths = map[string]int{
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// digestAlgorithms lists the supported digest algorithms in order of
+// preference.
+var digestAlgorithms = []string{"sha256", "sha384", "sha512"}
+
+// parsedDigest is a digest split into its algorithm and lowercase hex
+// encoding.
+type parsedDigest struct {
+	algorithm string
+	hex       string
+}
+
+// equal reports whether the digests are equal. The hex encodings are compared
+// with timingSafeEqual.
+func (d parsedDigest) equal(other parsedDigest) bool {
+	return d.algorithm == other.algorithm && timingSafeEqual(d.hex, other.hex)
+}
+
+// String returns the digest in the canonical form "<algorithm>:<hex>".
+func (d parsedDigest) String() string {
+	return d.algorithm + ":" + d.hex
+}
+
+// parseDigest parses `digest` of the form "<algorithm>:<hex>". A digest
+// without an algorithm prefix is assumed to be a sha256 digest. The algorithm
+// and hex encoding are case insensitive. Digests with an unsupported
+// algorithm, or a hex encoding of the wrong length for their algorithm, are
+// rejected.
+func parseDigest(digest string) (parsedDigest, error) {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if digest == "" {
+		return parsedDigest{}, errors.New("empty digest")
+	}
+	d := parsedDigest{algorithm: "sha256", hex: digest}
+	if parts := strings.SplitN(digest, ":", 2); len(parts) == 2 {
+		d = parsedDigest{algorithm: parts[0], hex: parts[1]}
+	}
+	length, ok := digestHexLengths[d.algorithm]
+	if !ok {
+		return parsedDigest{}, fmt.Errorf("unsupported digest algorithm %q", d.algorithm)
+	}
+	if len(d.hex) != length {
+		return parsedDigest{}, fmt.Errorf("expected %d hex characters in %s digest, got %d", length, d.algorithm, len(d.hex))
+	}
+	if _, err := hex.DecodeString(d.hex); err != nil {
+		return parsedDigest{}, fmt.Errorf("%s digest is not hex encoded", d.algorithm)
+	}
+	return d, nil
+}
+
+// parseImageName splits a fully qualified image name <image_name@digest> into
+// the repository name and the digest. Unlike name.NewDigest, it accepts
+// digests of every supported algorithm, which must be in canonical form.
+func parseImageName(image string) (string, string, error) {
+	parts := strings.Split(image, "@")
+	if len(parts) != 2 {
+		return "", "", errors.New("a digest must contain exactly one '@' separator (e.g. registry/repository@digest)")
+	}
+	if parts[1] == "" {
+		return "", "", errors.New("image digest is empty")
+	}
+	repository, err := name.NewRepository(parts[0], name.StrictValidation)
+	if err != nil {
+		return "", "", err
 	}
-	if authAtt.ImageName != imageName {
-		return errors.New("incorrect image name in Attestation payload")
+	digest, err := parseDigest(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	if digest.String() != parts[1] {
+		return "", "", fmt.Errorf("digest %q is not in canonical form %q", parts[1], digest.String())
 	}
-	if authAtt.ImageDigest != imageDigest {
-		return errors.New("incorrect image digest in Attestation payload")
+	return repository.Name(), digest.String(), nil
+}
+
+// timingSafeEqual reports whether `a` and `b` are equal in a time that
+// depends on their lengths, but not on their contents. It must be used to
+// compare authenticated fields that an attacker may influence, such as tokens
+// or nonces, with their expected values.
+func timingSafeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
 	}
-	return nil
+	return false
 }
 
-func convertAuthenticatedAttestation(payload []byte) (*authenticatedAttestation, error) {
+// convertAuthenticatedAttestation parses a verified payload in the Atomic
+// Host signature format into an AuthenticatedAttestation. The payload must
+// contain an image digest, or name the image by tag in its docker-reference.
+func convertAuthenticatedAttestation(payload []byte) (*AuthenticatedAttestation, error) {
 	atomicSig := &atomicContainerSig{}
 	if err := json.Unmarshal(payload, atomicSig); err != nil {
 		return nil, errors.Wrap(err, "error parsing attestation payload")
 	}
-	return &authenticatedAttestation{
+	if atomicSig.Critical.Identity.DockerRef == "" {
+		return nil, errors.New("attestation payload is missing critical.identity.docker-reference")
+	}
+	authAtt := &AuthenticatedAttestation{
 		ImageName:   atomicSig.Critical.Identity.DockerRef,
 		ImageDigest: atomicSig.Critical.Image.Digest,
-	}, nil
+	}
+	if authAtt.ImageDigest == "" {
+		// Without a digest, the docker-reference must name the image by tag.
+		tag, err := name.NewTag(authAtt.ImageName, name.StrictValidation)
+		if err != nil {
+			return nil, errors.New("attestation payload is missing critical.image.docker-manifest-digest")
+		}
+		authAtt.ImageName = tag.Repository.Name()
+		authAtt.ImageTag = tag.TagStr()
+	}
+	if atomicSig.Optional != nil && atomicSig.Optional.Timestamp != 0 {
+		authAtt.Timestamp = time.Unix(atomicSig.Optional.Timestamp, 0)
+	}
+	return authAtt, nil
 }
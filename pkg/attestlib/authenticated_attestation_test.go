@@ -16,7 +16,15 @@ limitations under the License.
 
 package attestlib
 
-import "testing"
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
 
 const validPayload = `{
     "critical": {
@@ -30,22 +38,74 @@ const validPayload = `{
     }
 }`
 
+const timestampPayload = `{
+    "critical": {
+        "identity": {
+            "docker-reference": "gcr.io/google-samples/hello-app"
+        },
+        "image": {
+            "docker-manifest-digest": "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"
+        },
+    "type": "Google cloud binauthz container signature"
+    },
+    "optional": {
+        "timestamp": 1590969600
+    }
+}`
+
 const invalidPayload = `{ invalid-json }`
 
+const missingDigestPayload = `{
+    "critical": {
+        "identity": {
+            "docker-reference": "gcr.io/google-samples/hello-app"
+        },
+        "image": {},
+    "type": "Google cloud binauthz container signature"
+    }
+}`
+
+const missingReferencePayload = `{
+    "critical": {
+        "identity": {},
+        "image": {
+            "docker-manifest-digest": "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"
+        },
+    "type": "Google cloud binauthz container signature"
+    }
+}`
+
+const wrongShapePayload = `{
+    "critical": {
+        "identity": "gcr.io/google-samples/hello-app",
+        "image": "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"
+    }
+}`
+
 func TestConvertAuthenticatedAttestation(t *testing.T) {
 	tcs := []struct {
 		name        string
 		payload     []byte
 		expectedErr bool
-		expected    authenticatedAttestation
+		expected    AuthenticatedAttestation
 	}{
 		{
 			name:        "correct authenticated attestation",
 			payload:     []byte(validPayload),
 			expectedErr: false,
-			expected: authenticatedAttestation{
+			expected: AuthenticatedAttestation{
+				ImageName:   "gcr.io/google-samples/hello-app",
+				ImageDigest: "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988",
+			},
+		},
+		{
+			name:        "authenticated attestation with timestamp",
+			payload:     []byte(timestampPayload),
+			expectedErr: false,
+			expected: AuthenticatedAttestation{
 				ImageName:   "gcr.io/google-samples/hello-app",
 				ImageDigest: "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988",
+				Timestamp:   time.Unix(1590969600, 0),
 			},
 		},
 		{
@@ -53,6 +113,31 @@ func TestConvertAuthenticatedAttestation(t *testing.T) {
 			payload:     []byte(invalidPayload),
 			expectedErr: true,
 		},
+		{
+			name:        "missing image digest",
+			payload:     []byte(missingDigestPayload),
+			expectedErr: true,
+		},
+		{
+			name:        "missing docker reference",
+			payload:     []byte(missingReferencePayload),
+			expectedErr: true,
+		},
+		{
+			name:        "unexpected payload structure",
+			payload:     []byte(wrongShapePayload),
+			expectedErr: true,
+		},
+		{
+			name:        "empty payload object",
+			payload:     []byte(`{}`),
+			expectedErr: true,
+		},
+		{
+			name:        "empty payload",
+			payload:     []byte{},
+			expectedErr: true,
+		},
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
@@ -65,7 +150,7 @@ func TestConvertAuthenticatedAttestation(t *testing.T) {
 				if err != nil {
 					t.Fatalf("convertAuthenticatedAttestation(%v) failed with error %v", tc.payload, err)
 				}
-				if actual == nil || *actual != tc.expected {
+				if actual == nil || !reflect.DeepEqual(*actual, tc.expected) {
 					t.Errorf("convertAuthenticatedAttestation(%v) = %v, want %v", tc.payload, actual, &tc.expected)
 				}
 			}
@@ -74,34 +159,132 @@ func TestConvertAuthenticatedAttestation(t *testing.T) {
 }
 
 // NOTE: This deserves its own test because the rules for checking an
-// authenticatedAttestation will become more complex (esp. with JWT).
+// AuthenticatedAttestation will become more complex (esp. with JWT).
 func TestCheckAuthenticatedAttestation(t *testing.T) {
 	tcs := []struct {
 		name        string
-		authAtt     authenticatedAttestation
+		authAtt     AuthenticatedAttestation
 		imageName   string
 		imageDigest string
 		expectedErr bool
 	}{
 		{
 			name:        "authenticated attestation satisfies requirements",
-			authAtt:     authenticatedAttestation{ImageName: "test-image", ImageDigest: "test-digest"},
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: helloAppDigest},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: false,
+		},
+		{
+			name:        "authenticated attestation without image name",
+			authAtt:     AuthenticatedAttestation{ImageDigest: helloAppDigest},
 			imageName:   "test-image",
-			imageDigest: "test-digest",
+			imageDigest: helloAppDigest,
 			expectedErr: false,
 		},
 		{
 			name:        "incorrect image name in authenticated attestation",
-			authAtt:     authenticatedAttestation{ImageName: "invalid", ImageDigest: "test-digest"},
+			authAtt:     AuthenticatedAttestation{ImageName: "invalid", ImageDigest: helloAppDigest},
 			imageName:   "test-image",
-			imageDigest: "test-digest",
+			imageDigest: helloAppDigest,
 			expectedErr: true,
 		},
 		{
 			name:        "incorrect image digest in authenticated attestation",
-			authAtt:     authenticatedAttestation{ImageName: "test-image", ImageDigest: "invalid"},
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: otherHelloAppDigest},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: true,
+		},
+		{
+			name:        "unprefixed digest in authenticated attestation",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: strings.TrimPrefix(helloAppDigest, "sha256:")},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: false,
+		},
+		{
+			name:        "unprefixed expected digest",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: helloAppDigest},
+			imageName:   "test-image",
+			imageDigest: strings.TrimPrefix(helloAppDigest, "sha256:"),
+			expectedErr: false,
+		},
+		{
+			name:        "uppercase hex in authenticated attestation",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: "sha256:" + strings.ToUpper(strings.TrimPrefix(helloAppDigest, "sha256:"))},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: false,
+		},
+		{
+			name:        "invalid length digest in authenticated attestation",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: helloAppDigest[:len(helloAppDigest)-2]},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest[:len(helloAppDigest)-2],
+			expectedErr: true,
+		},
+		{
+			name:        "non hex digest in authenticated attestation",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: "sha256:" + strings.Repeat("z", 64)},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: true,
+		},
+		{
+			name:        "sha512 digest",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: "sha512:" + strings.Repeat("ab", 64)},
+			imageName:   "test-image",
+			imageDigest: "sha512:" + strings.Repeat("ab", 64),
+			expectedErr: false,
+		},
+		{
+			name:        "incorrect sha512 digest",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: "sha512:" + strings.Repeat("cd", 64)},
+			imageName:   "test-image",
+			imageDigest: "sha512:" + strings.Repeat("ab", 64),
+			expectedErr: true,
+		},
+		{
+			name:        "sha256 digest for sha512 image",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: helloAppDigest},
+			imageName:   "test-image",
+			imageDigest: "sha512:" + strings.Repeat("ab", 64),
+			expectedErr: true,
+		},
+		{
+			name:        "unsupported digest algorithm",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: "md5:" + strings.Repeat("0", 32)},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: true,
+		},
+		{
+			name:        "empty digest in authenticated attestation",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image"},
+			imageName:   "test-image",
+			imageDigest: helloAppDigest,
+			expectedErr: true,
+		},
+		{
+			name:        "empty expected digest",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: helloAppDigest},
+			imageName:   "test-image",
+			imageDigest: "",
+			expectedErr: true,
+		},
+		{
+			name:        "empty expected and actual digests",
+			authAtt:     AuthenticatedAttestation{ImageName: "test-image", ImageDigest: " "},
+			imageName:   "test-image",
+			imageDigest: "",
+			expectedErr: true,
+		},
+		{
+			name:        "in-toto statement with empty subject digest",
+			authAtt:     AuthenticatedAttestation{SubjectDigests: []string{""}},
 			imageName:   "test-image",
-			imageDigest: "test-digest",
+			imageDigest: "",
 			expectedErr: true,
 		},
 	}
@@ -109,18 +292,261 @@ func TestCheckAuthenticatedAttestation(t *testing.T) {
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
 			mockConverter := mockConvertAuthAtt{tc.authAtt}
-			err := c.checkAuthenticatedAttestation([]byte("test-payload"), tc.imageName, tc.imageDigest, mockConverter.mockConvertAuthenticatedAttestation)
+			err := c.CheckAuthenticatedAttestation([]byte("test-payload"), tc.imageName, []string{tc.imageDigest}, mockConverter.mockConvertAuthenticatedAttestation)
 			if tc.expectedErr != (err != nil) {
-				t.Errorf("checkAuthenticatedAttestation(_) got %v, wanted error? = %v", err, tc.expectedErr)
+				t.Errorf("CheckAuthenticatedAttestation(_) got %v, wanted error? = %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCheckAuthenticatedAttestationAcceptableDigests(t *testing.T) {
+	sha512Digest := "sha512:" + strings.Repeat("ab", 64)
+	imageDigests := []string{otherHelloAppDigest, helloAppDigest, sha512Digest}
+	tcs := []struct {
+		name        string
+		authAtt     AuthenticatedAttestation
+		expectedErr error
+	}{
+		{
+			name:    "payload matches first digest",
+			authAtt: AuthenticatedAttestation{ImageDigest: otherHelloAppDigest},
+		},
+		{
+			name:    "payload matches second digest",
+			authAtt: AuthenticatedAttestation{ImageDigest: helloAppDigest},
+		},
+		{
+			name:    "payload matches digest of other algorithm",
+			authAtt: AuthenticatedAttestation{ImageDigest: sha512Digest},
+		},
+		{
+			name:    "subject matches second digest",
+			authAtt: AuthenticatedAttestation{SubjectDigests: []string{"sha256:" + strings.Repeat("1", 64), helloAppDigest}},
+		},
+		{
+			name:        "payload matches no digest",
+			authAtt:     AuthenticatedAttestation{ImageDigest: "sha256:" + strings.Repeat("1", 64)},
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "subjects match no digest",
+			authAtt:     AuthenticatedAttestation{SubjectDigests: []string{"sha256:" + strings.Repeat("1", 64), "sha512:" + strings.Repeat("cd", 64)}},
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	c := authenticatedAttCheckerImpl{}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mockConverter := mockConvertAuthAtt{tc.authAtt}
+			err := c.CheckAuthenticatedAttestation([]byte("test-payload"), "test-image", imageDigests, mockConverter.mockConvertAuthenticatedAttestation)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("CheckAuthenticatedAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("CheckAuthenticatedAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
 			}
 		})
 	}
 }
 
 type mockConvertAuthAtt struct {
-	authAtt authenticatedAttestation
+	authAtt AuthenticatedAttestation
 }
 
-func (m mockConvertAuthAtt) mockConvertAuthenticatedAttestation(payload []byte) (*authenticatedAttestation, error) {
+func (m mockConvertAuthAtt) mockConvertAuthenticatedAttestation(payload []byte) (*AuthenticatedAttestation, error) {
 	return &m.authAtt, nil
 }
+
+func TestParseDigest(t *testing.T) {
+	hexDigest := strings.TrimPrefix(helloAppDigest, "sha256:")
+	tcs := []struct {
+		name        string
+		digest      string
+		expected    string
+		expectedErr bool
+	}{
+		{name: "canonical digest", digest: helloAppDigest, expected: helloAppDigest},
+		{name: "unprefixed digest", digest: hexDigest, expected: helloAppDigest},
+		{name: "uppercase digest", digest: "SHA256:" + strings.ToUpper(hexDigest), expected: helloAppDigest},
+		{name: "sha384 digest", digest: "sha384:" + strings.Repeat("0", 96), expected: "sha384:" + strings.Repeat("0", 96)},
+		{name: "sha512 digest", digest: "sha512:" + strings.Repeat("A", 128), expected: "sha512:" + strings.Repeat("a", 128)},
+		{name: "sha256 length for sha512", digest: "sha512:" + hexDigest, expectedErr: true},
+		{name: "sha512 length for sha256", digest: "sha256:" + strings.Repeat("0", 128), expectedErr: true},
+		{name: "too short", digest: "sha256:" + hexDigest[1:], expectedErr: true},
+		{name: "too long", digest: hexDigest + "0", expectedErr: true},
+		{name: "not hex", digest: "sha256:" + strings.Repeat("g", 64), expectedErr: true},
+		{name: "unsupported algorithm", digest: "sha1:" + strings.Repeat("0", 40), expectedErr: true},
+		{name: "empty", digest: "", expectedErr: true},
+		{name: "whitespace", digest: "  ", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := parseDigest(tc.digest)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("parseDigest(%q) = %q, expected error", tc.digest, actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDigest(%q) = %v, expected nil", tc.digest, err)
+			}
+			if actual.String() != tc.expected {
+				t.Errorf("parseDigest(%q) = %q, want %q", tc.digest, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTimingSafeEqual(t *testing.T) {
+	tcs := []struct {
+		name     string
+		a, b     string
+		expected bool
+	}{
+		{"equal", "sha256:abc", "sha256:abc", true},
+		{"both empty", "", "", true},
+		{"different last byte", "sha256:abc", "sha256:abd", false},
+		{"different first byte", "sha256:abc", "tha256:abc", false},
+		{"prefix", "sha256:ab", "sha256:abc", false},
+		{"one empty", "", "sha256:abc", false},
+		{"different case", "gcr.io/image", "GCR.io/image", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := timingSafeEqual(tc.a, tc.b); got != tc.expected {
+				t.Errorf("timingSafeEqual(%q, %q) = %v, expected %v", tc.a, tc.b, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParsedDigestEqual(t *testing.T) {
+	sha256Digest := parsedDigest{algorithm: "sha256", hex: strings.Repeat("0", 64)}
+	tcs := []struct {
+		name     string
+		other    parsedDigest
+		expected bool
+	}{
+		{"equal", parsedDigest{algorithm: "sha256", hex: strings.Repeat("0", 64)}, true},
+		{"different hex", parsedDigest{algorithm: "sha256", hex: strings.Repeat("0", 63) + "1"}, false},
+		{"different algorithm", parsedDigest{algorithm: "sha512", hex: strings.Repeat("0", 64)}, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sha256Digest.equal(tc.other); got != tc.expected {
+				t.Errorf("%v.equal(%v) = %v, expected %v", sha256Digest, tc.other, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestParseImageName(t *testing.T) {
+	sha512Digest := "sha512:" + strings.Repeat("ab", 64)
+	tcs := []struct {
+		name           string
+		image          string
+		expectedName   string
+		expectedDigest string
+		expectedErr    bool
+	}{
+		{name: "sha256 digest", image: helloAppImage, expectedName: "gcr.io/google-samples/hello-app", expectedDigest: helloAppDigest},
+		{name: "sha512 digest", image: "gcr.io/google-samples/hello-app@" + sha512Digest, expectedName: "gcr.io/google-samples/hello-app", expectedDigest: sha512Digest},
+		{name: "no digest", image: "gcr.io/google-samples/hello-app:1.0", expectedErr: true},
+		{name: "unprefixed digest", image: "gcr.io/google-samples/hello-app@" + strings.TrimPrefix(helloAppDigest, "sha256:"), expectedErr: true},
+		{name: "uppercase digest", image: "gcr.io/google-samples/hello-app@" + strings.ToUpper(helloAppDigest), expectedErr: true},
+		{name: "invalid repository", image: "gcr.io/Hello-App@" + helloAppDigest, expectedErr: true},
+		{name: "empty digest", image: "gcr.io/google-samples/hello-app@", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			imageName, imageDigest, err := parseImageName(tc.image)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("parseImageName(%q) = nil, expected error", tc.image)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseImageName(%q) = %v, expected nil", tc.image, err)
+			}
+			if imageName != tc.expectedName || imageDigest != tc.expectedDigest {
+				t.Errorf("parseImageName(%q) = (%q, %q), want (%q, %q)", tc.image, imageName, imageDigest, tc.expectedName, tc.expectedDigest)
+			}
+		})
+	}
+}
+
+var errPredicateRejected = errors.New("predicate rejected")
+
+// provenanceChecker additionally requires SLSA provenance predicates.
+type provenanceChecker struct{}
+
+func (c provenanceChecker) CheckAuthenticatedAttestation(payload []byte, imageName string, imageDigests []string, convert ConvertFunc) error {
+	var authAtt *AuthenticatedAttestation
+	err := DefaultAuthenticatedAttChecker.CheckAuthenticatedAttestation(payload, imageName, imageDigests, func(payload []byte) (*AuthenticatedAttestation, error) {
+		var err error
+		authAtt, err = convert(payload)
+		return authAtt, err
+	})
+	if err != nil {
+		return err
+	}
+	if authAtt.PredicateType != "https://slsa.dev/provenance/v0.2" {
+		return fmt.Errorf("%w: predicate type %q", errPredicateRejected, authAtt.PredicateType)
+	}
+	return nil
+}
+
+func TestVerifyAttestationAuthenticatedAttChecker(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	tcs := []struct {
+		name        string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:    "provenance for the image",
+			payload: singleSubjectStatement,
+		},
+		{
+			name:        "other predicate for the image",
+			payload:     multiSubjectStatement,
+			expectedErr: errPredicateRejected,
+		},
+		{
+			name:        "atomic payload for the image",
+			payload:     validPayload,
+			expectedErr: errPredicateRejected,
+		},
+		{
+			name:        "provenance for another image",
+			payload:     otherSubjectStatement,
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithAuthenticatedAttChecker(provenanceChecker{}))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			result, err := v.VerifyAttestationWithResult(att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if result.PredicateType != "https://slsa.dev/provenance/v0.2" {
+				t.Errorf("PredicateType = %q, expected the provenance predicate type", result.PredicateType)
+			}
+		})
+	}
+}
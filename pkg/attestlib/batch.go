@@ -0,0 +1,113 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VerifyAttestations verifies each of `atts` with the verifier's key index.
+// Once `minVerified` distinct public keys have verified an Attestation, the
+// remaining Attestations are not verified and their results are
+// ErrVerificationSkipped. The returned error matches ErrQuorumNotMet if fewer
+// than `minVerified` distinct keys verified the Attestations. If `minVerified`
+// is zero or less, every Attestation is verified and the returned error is
+// nil. See Verifier for more details.
+func (v *verifier) VerifyAttestations(atts []*Attestation, minVerified int) ([]error, error) {
+	v = v.current()
+	return verifyAttestations(atts, minVerified, v.verifyKeyIDs)
+}
+
+// VerifyQuorum verifies `atts` until `threshold` distinct public key IDs have
+// verified an Attestation. Several Attestations verified by the same key ID
+// count once. If the threshold is not met, the returned error matches
+// ErrQuorumNotMet and lists the key IDs that verified an Attestation and why
+// the other Attestations failed. See Verifier for more details.
+func (v *verifier) VerifyQuorum(atts []*Attestation, threshold int) error {
+	v = v.current()
+	return verifyQuorum(atts, threshold, v.verifyKeyIDs)
+}
+
+// verifyKeyIDs verifies an Attestation and returns the IDs of the public keys
+// that verified its signatures.
+func (v *verifier) verifyKeyIDs(att *Attestation) ([]string, error) {
+	verified, err := v.verify(context.Background(), att, v.verifyAttestation)
+	if err != nil {
+		return nil, err
+	}
+	return verifiedKeyIDs(verified.publicKey.ID, verified.signatures), nil
+}
+
+// keyIDVerifyFunc verifies an Attestation and returns the IDs of the public
+// keys that verified its signatures.
+type keyIDVerifyFunc func(att *Attestation) ([]string, error)
+
+// verifyAttestations implements VerifyAttestations with `verify`.
+func verifyAttestations(atts []*Attestation, minVerified int, verify keyIDVerifyFunc) ([]error, error) {
+	results := make([]error, len(atts))
+	verifiedKeys := map[string]bool{}
+	for i, att := range atts {
+		if minVerified > 0 && len(verifiedKeys) >= minVerified {
+			results[i] = ErrVerificationSkipped
+			continue
+		}
+		keyIDs, err := verify(att)
+		results[i] = err
+		for _, keyID := range keyIDs {
+			verifiedKeys[keyID] = true
+		}
+	}
+	if len(verifiedKeys) < minVerified {
+		return results, fmt.Errorf("%w: %d of %d required keys verified", ErrQuorumNotMet, len(verifiedKeys), minVerified)
+	}
+	return results, nil
+}
+
+// verifyQuorum implements VerifyQuorum with `verify`.
+func verifyQuorum(atts []*Attestation, threshold int, verify keyIDVerifyFunc) error {
+	verifiedKeys := map[string]bool{}
+	var failures []string
+	for i, att := range atts {
+		if len(verifiedKeys) >= threshold {
+			return nil
+		}
+		keyIDs, err := verify(att)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("attestation %d: %v", i, err))
+			continue
+		}
+		for _, keyID := range keyIDs {
+			verifiedKeys[keyID] = true
+		}
+	}
+	if len(verifiedKeys) >= threshold {
+		return nil
+	}
+	keyIDs := make([]string, 0, len(verifiedKeys))
+	for id := range verifiedKeys {
+		keyIDs = append(keyIDs, fmt.Sprintf("%q", id))
+	}
+	sort.Strings(keyIDs)
+	err := fmt.Errorf("%w: %d of %d required keys verified, verified keys: [%s]", ErrQuorumNotMet, len(verifiedKeys), threshold, strings.Join(keyIDs, ", "))
+	if len(failures) > 0 {
+		err = fmt.Errorf("%w; %s", err, strings.Join(failures, "; "))
+	}
+	return err
+}
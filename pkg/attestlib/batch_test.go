@@ -0,0 +1,190 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAttestations(t *testing.T) {
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	keys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-b"},
+	}
+	validA := &Attestation{PublicKeyID: "key-a", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	validB := &Attestation{PublicKeyID: "key-b", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	invalid := &Attestation{PublicKeyID: "key-b", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	unknown := &Attestation{PublicKeyID: "key-c", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)}
+
+	tcs := []struct {
+		name            string
+		atts            []*Attestation
+		minVerified     int
+		expectedResults []error
+		expectedErr     bool
+	}{
+		{
+			name:            "partial success meets quorum",
+			atts:            []*Attestation{invalid, validA, unknown},
+			minVerified:     1,
+			expectedResults: []error{ErrSignatureInvalid, nil, ErrVerificationSkipped},
+			expectedErr:     false,
+		},
+		{
+			name:            "partial success does not meet quorum",
+			atts:            []*Attestation{invalid, validA, unknown},
+			minVerified:     2,
+			expectedResults: []error{ErrSignatureInvalid, nil, ErrNoMatchingKey},
+			expectedErr:     true,
+		},
+		{
+			name:            "distinct keys meet quorum",
+			atts:            []*Attestation{validA, invalid, validB},
+			minVerified:     2,
+			expectedResults: []error{nil, ErrSignatureInvalid, nil},
+			expectedErr:     false,
+		},
+		{
+			name:            "same key counts once",
+			atts:            []*Attestation{validA, validA},
+			minVerified:     2,
+			expectedResults: []error{nil, nil},
+			expectedErr:     true,
+		},
+		{
+			name:            "no quorum verifies every attestation",
+			atts:            []*Attestation{validA, validB, unknown},
+			minVerified:     0,
+			expectedResults: []error{nil, nil, ErrNoMatchingKey},
+			expectedErr:     false,
+		},
+		{
+			name:            "no attestations",
+			atts:            nil,
+			minVerified:     1,
+			expectedResults: []error{},
+			expectedErr:     true,
+		},
+	}
+	v, err := NewVerifier(helloAppImage, keys)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := v.VerifyAttestations(tc.atts, tc.minVerified)
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestations(_) got %v, wanted error? = %v", err, tc.expectedErr)
+			}
+			if tc.expectedErr && !errors.Is(err, ErrQuorumNotMet) {
+				t.Errorf("VerifyAttestations(_) = %v, want error matching %v", err, ErrQuorumNotMet)
+			}
+			if len(results) != len(tc.expectedResults) {
+				t.Fatalf("VerifyAttestations(_) returned %d results, want %d", len(results), len(tc.expectedResults))
+			}
+			for i, expected := range tc.expectedResults {
+				if !errors.Is(results[i], expected) {
+					t.Errorf("result %d = %v, want %v", i, results[i], expected)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyQuorum(t *testing.T) {
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	thirdPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-third-key-seed"))
+	keys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signer-a"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "signer-b"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: thirdPrivateKey.Public().(ed25519.PublicKey), ID: "signer-c"},
+	}
+	validA := &Attestation{PublicKeyID: "signer-a", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	validB := &Attestation{PublicKeyID: "signer-b", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	validC := &Attestation{PublicKeyID: "signer-c", Signature: ed25519.Sign(thirdPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	invalidC := &Attestation{PublicKeyID: "signer-c", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+
+	tcs := []struct {
+		name            string
+		atts            []*Attestation
+		threshold       int
+		expectedErr     bool
+		expectedSubstrs []string
+	}{
+		{
+			name:      "two of three signers",
+			atts:      []*Attestation{validA, invalidC, validB},
+			threshold: 2,
+		},
+		{
+			name:      "all signers",
+			atts:      []*Attestation{validC, validB, validA},
+			threshold: 3,
+		},
+		{
+			name:            "threshold not met",
+			atts:            []*Attestation{validA, invalidC},
+			threshold:       2,
+			expectedErr:     true,
+			expectedSubstrs: []string{"1 of 2", `verified keys: ["signer-a"]`, "attestation 1"},
+		},
+		{
+			name:            "duplicate attestations count once",
+			atts:            []*Attestation{validA, validA, validA},
+			threshold:       2,
+			expectedErr:     true,
+			expectedSubstrs: []string{"1 of 2", `verified keys: ["signer-a"]`},
+		},
+		{
+			name:            "no attestations",
+			threshold:       1,
+			expectedErr:     true,
+			expectedSubstrs: []string{"0 of 1", "verified keys: []"},
+		},
+		{
+			name:      "zero threshold",
+			threshold: 0,
+		},
+	}
+	v, err := NewVerifier(helloAppImage, keys)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.VerifyQuorum(tc.atts, tc.threshold)
+			if !tc.expectedErr {
+				if err != nil {
+					t.Errorf("VerifyQuorum(_) = %v, expected nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrQuorumNotMet) {
+				t.Fatalf("VerifyQuorum(_) = %v, want error matching %v", err, ErrQuorumNotMet)
+			}
+			for _, substr := range tc.expectedSubstrs {
+				if !strings.Contains(err.Error(), substr) {
+					t.Errorf("VerifyQuorum(_) = %v, expected error containing %q", err, substr)
+				}
+			}
+		})
+	}
+}
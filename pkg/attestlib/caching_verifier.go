@@ -0,0 +1,380 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultCacheSize is the default maximum number of cached results.
+	defaultCacheSize = 1024
+	// defaultPositiveCacheTTL is how long successful verifications are
+	// cached by default.
+	defaultPositiveCacheTTL = 5 * time.Minute
+	// defaultNegativeCacheTTL is how long failed verifications are cached by
+	// default.
+	defaultNegativeCacheTTL = 30 * time.Second
+)
+
+// CacheOption configures a Verifier created by WrapVerifier.
+type CacheOption func(*cachingVerifier)
+
+// WithCacheSize sets the maximum number of results cached by the Verifier.
+// Once it is reached, the least recently used result is evicted.
+func WithCacheSize(size int) CacheOption {
+	return func(v *cachingVerifier) {
+		v.size = size
+	}
+}
+
+// WithCacheTTL sets how long successful and failed verifications are cached.
+// Failures should be cached for a shorter time, since they may be caused by
+// keys that are not yet available. A TTL of zero or less disables caching of
+// that kind of result.
+func WithCacheTTL(positive, negative time.Duration) CacheOption {
+	return func(v *cachingVerifier) {
+		v.positiveTTL = positive
+		v.negativeTTL = negative
+	}
+}
+
+// cachingVerifier is a Verifier that caches the results of another Verifier
+// by a hash of the Attestation and the image digest.
+type cachingVerifier struct {
+	verifier    Verifier
+	imageDigest string
+	size        int
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	clock       Clock
+
+	mu sync.Mutex
+	// entries holds the cached results, most recently used first.
+	entries *list.List
+	// index maps the cache keys to their elements in entries.
+	index map[[sha256.Size]byte]*list.Element
+}
+
+// cacheMethod identifies the Verifier method whose result a cache entry holds.
+// The methods are cached separately, since they may treat the same
+// Attestation differently, e.g. only VerifyAttestationContext passes
+// Attestations without a matching key with WithSoftMissingKeys.
+type cacheMethod int64
+
+const (
+	cacheVerifyAttestation cacheMethod = iota
+	cacheVerifyAttestationWithResult
+)
+
+// cacheEntry is a cached verification result.
+type cacheEntry struct {
+	key [sha256.Size]byte
+	// generation is the key generation of the wrapped Verifier the result
+	// was verified with.
+	generation uint64
+	// result is nil for failed verifications, and for all results of
+	// VerifyAttestationContext, which does not return a result.
+	result *VerificationResult
+	err    error
+	expiry time.Time
+}
+
+// cacheAwareVerifier is implemented by the Verifiers created by NewVerifier
+// and NewUpdatableVerifier, so that their results are not cached for longer
+// than they are valid.
+type cacheAwareVerifier interface {
+	// keyGeneration returns a counter that changes whenever the public keys
+	// of the Verifier are replaced.
+	keyGeneration() uint64
+	// verifyAttestationUntil is like VerifyAttestationContext, but also
+	// returns the VerificationResult.ValidUntil time of a success.
+	verifyAttestationUntil(ctx context.Context, att *Attestation) (time.Time, error)
+}
+
+// WrapVerifier creates a Verifier that caches the results of `verifier`, which
+// must have been created for `image`, so that Attestations verified
+// repeatedly, e.g. by an admission webhook under load, are only verified once
+// per TTL. Results are cached by a hash of the Attestation and the digest of
+// `image`, separately for VerifyAttestationContext and
+// VerifyAttestationWithResult; errors due to a cancelled context,
+// ErrVerificationTimeout and ErrRetriesExhausted are not cached, since
+// verifying again may succeed. By default, up to 1024 results are cached,
+// successes for 5 minutes and failures for 30 seconds. The Verifier is safe
+// for concurrent use.
+//
+// A success is never cached past its VerificationResult.ValidUntil time, when
+// a key's NotAfter, the maximum age set by WithMaxAge or a JWT's expiration
+// passes. If `verifier` was created by NewUpdatableVerifier, every cached
+// result is invalidated by UpdateKeys, so that rotated or removed keys are not
+// trusted from the cache. Other time-based checks, such as the expiration of
+// PGP keys and certificates, are only bounded by the TTL, and so are the
+// results of Verifiers created otherwise, e.g. by NewMultiVerifier, if they
+// do not report ValidUntil.
+func WrapVerifier(verifier Verifier, image string, opts ...CacheOption) (Verifier, error) {
+	_, imageDigest, err := parseImageName(image)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid image name")
+	}
+	v := &cachingVerifier{
+		verifier:    verifier,
+		imageDigest: imageDigest,
+		size:        defaultCacheSize,
+		positiveTTL: defaultPositiveCacheTTL,
+		negativeTTL: defaultNegativeCacheTTL,
+		clock:       SystemClock,
+		entries:     list.New(),
+		index:       map[[sha256.Size]byte]*list.Element{},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// VerifyAttestation verifies an Attestation, or returns the cached result of
+// an earlier verification. See Verifier for more details.
+func (v *cachingVerifier) VerifyAttestation(att *Attestation) error {
+	return v.VerifyAttestationContext(context.Background(), att)
+}
+
+// VerifyAttestationContext verifies an Attestation, honoring cancellation of
+// `ctx`, or returns the cached result of an earlier verification. See
+// Verifier for more details.
+func (v *cachingVerifier) VerifyAttestationContext(ctx context.Context, att *Attestation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	key := v.cacheKey(att, cacheVerifyAttestation)
+	generation := v.keyGeneration()
+	if entry, ok := v.lookup(key, generation); ok {
+		return entry.err
+	}
+	var validUntil time.Time
+	var err error
+	if verifier, ok := v.verifier.(cacheAwareVerifier); ok {
+		validUntil, err = verifier.verifyAttestationUntil(ctx, att)
+	} else {
+		err = v.verifier.VerifyAttestationContext(ctx, att)
+	}
+	if ctx.Err() != nil {
+		// The error may be due to the context, even if it does not say so.
+		return err
+	}
+	v.store(key, generation, nil, err, validUntil)
+	return err
+}
+
+// VerifyAttestationWithResult verifies an Attestation, or returns the cached
+// result of an earlier verification. See Verifier for more details.
+func (v *cachingVerifier) VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error) {
+	key := v.cacheKey(att, cacheVerifyAttestationWithResult)
+	generation := v.keyGeneration()
+	if entry, ok := v.lookup(key, generation); ok {
+		if entry.err != nil {
+			return nil, entry.err
+		}
+		return copyResult(entry.result), nil
+	}
+	result, err := v.verifier.VerifyAttestationWithResult(att)
+	if err != nil {
+		v.store(key, generation, nil, err, time.Time{})
+		return nil, err
+	}
+	v.store(key, generation, copyResult(result), nil, result.ValidUntil)
+	return result, nil
+}
+
+// keyGeneration returns the key generation of the wrapped Verifier, which is
+// zero if its keys cannot be replaced.
+func (v *cachingVerifier) keyGeneration() uint64 {
+	if verifier, ok := v.verifier.(cacheAwareVerifier); ok {
+		return verifier.keyGeneration()
+	}
+	return 0
+}
+
+// VerifyAttestationStream verifies an Attestation whose payload is read from
+// `payload`. Its result is not cached, since the payload is only known once
+// it has been read. See Verifier for more details.
+func (v *cachingVerifier) VerifyAttestationStream(att *Attestation, payload io.Reader) (*VerificationResult, error) {
+	return v.verifier.VerifyAttestationStream(att, payload)
+}
+
+// VerifyOrExplain verifies an Attestation and explains a rejection. Its
+// result is not cached, since explanations are meant for debugging. See
+// Verifier for more details.
+func (v *cachingVerifier) VerifyOrExplain(att *Attestation) (bool, string) {
+	return v.verifier.VerifyOrExplain(att)
+}
+
+// copyResult returns a copy of `result` that shares no memory with it, so
+// that callers cannot modify cached results.
+func copyResult(result *VerificationResult) *VerificationResult {
+	copied := *result
+	if result.Signatures != nil {
+		copied.Signatures = append([]SignatureResult(nil), result.Signatures...)
+	}
+	return &copied
+}
+
+// VerifyAttestations verifies each of `atts`, using cached results where
+// possible. See Verifier for more details.
+func (v *cachingVerifier) VerifyAttestations(atts []*Attestation, minVerified int) ([]error, error) {
+	return verifyAttestations(atts, minVerified, v.verifyKeyIDs)
+}
+
+// VerifyQuorum verifies `atts` until `threshold` distinct public key IDs have
+// verified an Attestation, using cached results where possible. See Verifier
+// for more details.
+func (v *cachingVerifier) VerifyQuorum(atts []*Attestation, threshold int) error {
+	return verifyQuorum(atts, threshold, v.verifyKeyIDs)
+}
+
+// SelfTest runs the self-test of the wrapped Verifier. See Verifier for more
+// details.
+func (v *cachingVerifier) SelfTest(ctx context.Context) error {
+	return v.verifier.SelfTest(ctx)
+}
+
+// RegisteredKeys returns the public keys of the wrapped Verifier. See
+// Verifier for more details.
+func (v *cachingVerifier) RegisteredKeys() []KeyInfo {
+	return v.verifier.RegisteredKeys()
+}
+
+func (v *cachingVerifier) verifyKeyIDs(att *Attestation) ([]string, error) {
+	result, err := v.VerifyAttestationWithResult(att)
+	if err != nil {
+		return nil, err
+	}
+	return result.VerifiedKeyIDs(), nil
+}
+
+// cacheKey hashes `method`, the image digest and every field of `att` that
+// affects its verification.
+func (v *cachingVerifier) cacheKey(att *Attestation, method cacheMethod) [sha256.Size]byte {
+	h := sha256.New()
+	binary.Write(h, binary.BigEndian, int64(method))
+	writeCacheKeyField(h, []byte(v.imageDigest))
+	writeCacheKeyField(h, []byte(att.PublicKeyID))
+	writeCacheKeyField(h, att.Signature)
+	writeCacheKeyField(h, att.SerializedPayload)
+	binary.Write(h, binary.BigEndian, int64(att.EnvelopeType))
+	binary.Write(h, binary.BigEndian, att.DetachedSignature)
+	binary.Write(h, binary.BigEndian, int64(att.SignatureAlgorithm))
+	binary.Write(h, binary.BigEndian, int64(att.SignatureEncoding))
+	binary.Write(h, binary.BigEndian, uint64(len(att.Signatures)))
+	for _, entry := range att.Signatures {
+		writeCacheKeyField(h, []byte(entry.PublicKeyID))
+		writeCacheKeyField(h, entry.Signature)
+	}
+	binary.Write(h, binary.BigEndian, att.SigstoreBundle != nil)
+	if bundle := att.SigstoreBundle; bundle != nil {
+		writeCacheKeyField(h, bundle.Certificate)
+		writeCacheKeyField(h, bundle.RekorEntry.Body)
+		writeCacheKeyField(h, bundle.RekorEntry.SignedEntryTimestamp)
+		writeCacheKeyField(h, []byte(bundle.RekorEntry.LogID))
+		binary.Write(h, binary.BigEndian, bundle.RekorEntry.IntegratedTime)
+		binary.Write(h, binary.BigEndian, bundle.RekorEntry.LogIndex)
+		binary.Write(h, binary.BigEndian, bundle.RekorEntry.InclusionProof != nil)
+		if proof := bundle.RekorEntry.InclusionProof; proof != nil {
+			binary.Write(h, binary.BigEndian, proof.LogIndex)
+			binary.Write(h, binary.BigEndian, proof.TreeSize)
+			writeCacheKeyField(h, proof.RootHash)
+			binary.Write(h, binary.BigEndian, uint64(len(proof.Hashes)))
+			for _, hash := range proof.Hashes {
+				writeCacheKeyField(h, hash)
+			}
+			writeCacheKeyField(h, []byte(proof.Checkpoint))
+		}
+	}
+	var key [sha256.Size]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// writeCacheKeyField writes `field` prefixed with its length, so that
+// different Attestations cannot hash the same.
+func writeCacheKeyField(h hash.Hash, field []byte) {
+	binary.Write(h, binary.BigEndian, uint64(len(field)))
+	h.Write(field)
+}
+
+// lookup returns the unexpired cache entry for `key` that was verified with
+// the key generation `generation`.
+func (v *cachingVerifier) lookup(key [sha256.Size]byte, generation uint64) (cacheEntry, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	elem, ok := v.index[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if entry.generation != generation || !v.clock.Now().Before(entry.expiry) {
+		v.entries.Remove(elem)
+		delete(v.index, key)
+		return cacheEntry{}, false
+	}
+	v.entries.MoveToFront(elem)
+	return *entry, true
+}
+
+// store caches the result of a verification, evicting the least recently
+// used entry if the cache is full. A success is not cached past
+// `validUntil`, unless it is zero. Transient failures, see
+// isTransientFailure, are not cached.
+func (v *cachingVerifier) store(key [sha256.Size]byte, generation uint64, result *VerificationResult, err error, validUntil time.Time) {
+	ttl := v.positiveTTL
+	if err != nil {
+		ttl = v.negativeTTL
+	}
+	if ttl <= 0 || v.size <= 0 || isTransientFailure(err) {
+		return
+	}
+	now := v.clock.Now()
+	expiry := now.Add(ttl)
+	if !validUntil.IsZero() && validUntil.Before(expiry) {
+		expiry = validUntil
+	}
+	if !now.Before(expiry) {
+		return
+	}
+	entry := &cacheEntry{key: key, generation: generation, result: result, err: err, expiry: expiry}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if elem, ok := v.index[key]; ok {
+		elem.Value = entry
+		v.entries.MoveToFront(elem)
+		return
+	}
+	v.index[key] = v.entries.PushFront(entry)
+	for v.entries.Len() > v.size {
+		oldest := v.entries.Back()
+		v.entries.Remove(oldest)
+		delete(v.index, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,444 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingVerifier counts the Attestations verified by a Verifier.
+type countingVerifier struct {
+	Verifier
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (v *countingVerifier) count() int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.calls
+}
+
+func (v *countingVerifier) inc() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.calls++
+}
+
+func (v *countingVerifier) VerifyAttestationContext(ctx context.Context, att *Attestation) error {
+	v.inc()
+	return v.Verifier.VerifyAttestationContext(ctx, att)
+}
+
+func (v *countingVerifier) VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error) {
+	v.inc()
+	return v.Verifier.VerifyAttestationWithResult(att)
+}
+
+func newCountingVerifier(t *testing.T) *countingVerifier {
+	t.Helper()
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	return &countingVerifier{Verifier: v}
+}
+
+func ed25519Attestation(payload string) *Attestation {
+	return &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(payload)), SerializedPayload: []byte(payload)}
+}
+
+func TestCachingVerifierCacheHit(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage)
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	att := ed25519Attestation(validPayload)
+	for i := 0; i < 3; i++ {
+		if err := v.VerifyAttestation(att); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+		}
+	}
+	if got := underlying.count(); got != 1 {
+		t.Errorf("underlying verifier called %d times, expected 1", got)
+	}
+
+	// The first result was cached without a VerificationResult, so it is
+	// verified again once, and then served from the cache.
+	for i := 0; i < 2; i++ {
+		result, err := v.VerifyAttestationWithResult(att)
+		if err != nil {
+			t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+		}
+		if result.KeyID != "ed25519-key" {
+			t.Errorf("KeyID = %q, expected %q", result.KeyID, "ed25519-key")
+		}
+		result.KeyID = "modified"
+	}
+	if got := underlying.count(); got != 2 {
+		t.Errorf("underlying verifier called %d times, expected 2", got)
+	}
+
+	// A different Attestation is not a cache hit.
+	tampered := ed25519Attestation(validPayload)
+	tampered.PublicKeyID = "other-key"
+	if err := v.VerifyAttestation(tampered); err == nil {
+		t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+	}
+	if got := underlying.count(); got != 3 {
+		t.Errorf("underlying verifier called %d times, expected 3", got)
+	}
+
+	// Neither is an Attestation that differs in its Signatures.
+	multi := &Attestation{Signatures: []SignatureEntry{{PublicKeyID: "other-key", Signature: att.Signature}}, SerializedPayload: att.SerializedPayload}
+	if err := v.VerifyAttestation(multi); err == nil {
+		t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+	}
+	if got := underlying.count(); got != 4 {
+		t.Errorf("underlying verifier called %d times, expected 4", got)
+	}
+}
+
+func TestCachingVerifierTTL(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage, WithCacheTTL(time.Minute, 10*time.Second))
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	now := time.Now()
+	v.(*cachingVerifier).clock = ClockFunc(func() time.Time { return now })
+	valid := ed25519Attestation(validPayload)
+	invalid := ed25519Attestation(validPayload)
+	invalid.SerializedPayload = []byte(otherDigestPayload)
+
+	steps := []struct {
+		name          string
+		elapsed       time.Duration
+		expectedCalls int
+	}{
+		{name: "results are verified", expectedCalls: 2},
+		{name: "results are cached", elapsed: 5 * time.Second, expectedCalls: 2},
+		{name: "failure expires", elapsed: 10 * time.Second, expectedCalls: 3},
+		{name: "success outlives failure", elapsed: 15 * time.Second, expectedCalls: 4},
+		{name: "success expires", elapsed: 30 * time.Second, expectedCalls: 6},
+	}
+	for _, step := range steps {
+		now = now.Add(step.elapsed)
+		if err := v.VerifyAttestation(valid); err != nil {
+			t.Errorf("%s: VerifyAttestation(_) = %v, expected nil", step.name, err)
+		}
+		if err := v.VerifyAttestation(invalid); !errors.Is(err, ErrSignatureInvalid) {
+			t.Errorf("%s: VerifyAttestation(_) = %v, want error matching %v", step.name, err, ErrSignatureInvalid)
+		}
+		if got := underlying.count(); got != step.expectedCalls {
+			t.Errorf("%s: underlying verifier called %d times, expected %d", step.name, got, step.expectedCalls)
+		}
+	}
+}
+
+func TestCachingVerifierUpdateKeys(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	rotatedKey := publicKey
+	rotatedKey.KeyData = otherEd25519PubKey
+	underlying, err := NewUpdatableVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	v, err := WrapVerifier(underlying, helloAppImage)
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	att := ed25519Attestation(validPayload)
+
+	steps := []struct {
+		name        string
+		updateTo    []PublicKey
+		expectedErr error
+	}{
+		{name: "success is cached"},
+		{name: "rotated key invalidates the success", updateTo: []PublicKey{rotatedKey}, expectedErr: ErrSignatureInvalid},
+		{name: "restored key invalidates the failure", updateTo: []PublicKey{publicKey}},
+	}
+	for _, step := range steps {
+		if step.updateTo != nil {
+			if err := underlying.UpdateKeys(step.updateTo); err != nil {
+				t.Fatalf("%s: UpdateKeys(...) = %v, expected nil", step.name, err)
+			}
+		}
+		// Each result is verified once, then served from the cache.
+		for i := 0; i < 2; i++ {
+			err := v.VerifyAttestation(att)
+			_, resultErr := v.VerifyAttestationWithResult(att)
+			if step.expectedErr == nil && (err != nil || resultErr != nil) {
+				t.Errorf("%s: VerifyAttestation(_) = %v and VerifyAttestationWithResult(_) = %v, expected nil", step.name, err, resultErr)
+			}
+			if step.expectedErr != nil && (!errors.Is(err, step.expectedErr) || !errors.Is(resultErr, step.expectedErr)) {
+				t.Errorf("%s: VerifyAttestation(_) = %v and VerifyAttestationWithResult(_) = %v, want errors matching %v", step.name, err, resultErr, step.expectedErr)
+			}
+		}
+	}
+}
+
+func TestCachingVerifierValidUntil(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	clock := ClockFunc(func() time.Time { return now })
+	payload, err := newAtomicContainerPayload("gcr.io/google-samples/hello-app", helloAppDigest, now.Add(-50*time.Minute))
+	if err != nil {
+		t.Fatalf("error creating payload: %v", err)
+	}
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	expiringKey := publicKey
+	expiringKey.NotAfter = now.Add(2 * time.Minute)
+	tcs := []struct {
+		name               string
+		publicKey          PublicKey
+		opts               []VerifierOption
+		expectedValidUntil time.Time
+		expectedErr        error
+	}{
+		{
+			name:               "key validity period",
+			publicKey:          expiringKey,
+			expectedValidUntil: expiringKey.NotAfter,
+			expectedErr:        ErrKeyNotValid,
+		},
+		{
+			name:               "maximum age",
+			publicKey:          publicKey,
+			opts:               []VerifierOption{WithMaxAge(time.Hour)},
+			expectedValidUntil: now.Add(10 * time.Minute),
+			expectedErr:        ErrAttestationStale,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			start := now
+			defer func() { now = start }()
+			underlying, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, append(tc.opts, WithClock(clock))...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			v, err := WrapVerifier(underlying, helloAppImage, WithCacheTTL(time.Hour, time.Minute))
+			if err != nil {
+				t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+			}
+			v.(*cachingVerifier).clock = clock
+			att := ed25519Attestation(string(payload))
+			result, err := v.VerifyAttestationWithResult(att)
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if !result.ValidUntil.Equal(tc.expectedValidUntil) {
+				t.Errorf("VerifyAttestationWithResult(_) valid until %v, expected %v", result.ValidUntil, tc.expectedValidUntil)
+			}
+			if err := v.VerifyAttestationContext(context.Background(), att); err != nil {
+				t.Errorf("VerifyAttestationContext(_) = %v, expected nil", err)
+			}
+
+			// The cached successes expire with the verification, long before
+			// the positive TTL.
+			now = tc.expectedValidUntil.Add(time.Second)
+			if _, err := v.VerifyAttestationWithResult(att); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if err := v.VerifyAttestationContext(context.Background(), att); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestationContext(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCachingVerifierSize(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage, WithCacheSize(2))
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	atts := []*Attestation{ed25519Attestation(validPayload), ed25519Attestation(validPayload), ed25519Attestation(validPayload)}
+	atts[1].PublicKeyID = "other-key-1"
+	atts[2].PublicKeyID = "other-key-2"
+	for _, att := range atts {
+		v.VerifyAttestation(att)
+	}
+	// The first Attestation was evicted, the last one is still cached.
+	v.VerifyAttestation(atts[0])
+	v.VerifyAttestation(atts[2])
+	if got := underlying.count(); got != 4 {
+		t.Errorf("underlying verifier called %d times, expected 4", got)
+	}
+}
+
+func TestCachingVerifierContextErrorsNotCached(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage)
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	att := ed25519Attestation(validPayload)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := v.VerifyAttestationContext(ctx, att); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want error matching %v", err, context.Canceled)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+}
+
+func TestCachingVerifierTransientFailuresNotCached(t *testing.T) {
+	t.Run("timeout", func(t *testing.T) {
+		signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, kmsKeyName)
+		if err != nil {
+			t.Fatalf("error creating signer: %v", err)
+		}
+		att, err := CreateImageAttestation(signer, helloAppImage)
+		if err != nil {
+			t.Fatalf("error creating attestation: %v", err)
+		}
+		publicKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: kmsKeyName}
+		client := &slowKmsClient{key: ec256KmsKey(), delay: time.Minute}
+		underlying, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithKmsClient(client), WithTimeout(50*time.Millisecond))
+		if err != nil {
+			t.Fatalf("error creating verifier: %v", err)
+		}
+		v, err := WrapVerifier(underlying, helloAppImage)
+		if err != nil {
+			t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+		}
+		if err := v.VerifyAttestation(att); !errors.Is(err, ErrVerificationTimeout) {
+			t.Fatalf("VerifyAttestation(_) = %v, want error matching %v", err, ErrVerificationTimeout)
+		}
+		client.delay = 0
+		if err := v.VerifyAttestation(att); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil once the backend responds in time", err)
+		}
+	})
+	t.Run("retries exhausted", func(t *testing.T) {
+		publicKey := PublicKey{AuthenticatorType: Vault, SignatureAlgorithm: EddsaEd25519, KeyData: []byte(vaultKeyPath), ID: vaultKeyPath}
+		client := &flakyVaultClient{
+			client:   &fakeVaultClient{data: vaultTransitKeyData("ed25519", base64.StdEncoding.EncodeToString(ed25519PubKey))},
+			failures: 2,
+		}
+		underlying, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithVaultClient(client, time.Minute), WithKeyFetchRetry(2, time.Millisecond))
+		if err != nil {
+			t.Fatalf("error creating verifier: %v", err)
+		}
+		v, err := WrapVerifier(underlying, helloAppImage)
+		if err != nil {
+			t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+		}
+		att := &Attestation{PublicKeyID: vaultKeyPath, Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+		if _, err := v.VerifyAttestationWithResult(att); !errors.Is(err, ErrRetriesExhausted) {
+			t.Fatalf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, ErrRetriesExhausted)
+		}
+		if err := v.VerifyAttestation(att); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil once Vault is available", err)
+		}
+	})
+}
+
+func TestCachingVerifierSoftMissingKeys(t *testing.T) {
+	att := &Attestation{PublicKeyID: gpgPublicKeyID, Signature: []byte(gpgSignature)}
+	tcs := []struct {
+		name        string
+		resultFirst bool
+	}{
+		{name: "VerifyAttestation first"},
+		{name: "VerifyAttestationWithResult first", resultFirst: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			underlying, err := NewVerifier(helloAppImage, nil, WithSoftMissingKeys(Pgp))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			v, err := WrapVerifier(underlying, helloAppImage)
+			if err != nil {
+				t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+			}
+			for i := 0; i < 2; i++ {
+				if tc.resultFirst == (i == 0) {
+					if _, err := v.VerifyAttestationWithResult(att); !errors.Is(err, ErrNoMatchingKey) {
+						t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, ErrNoMatchingKey)
+					}
+				} else if err := v.VerifyAttestation(att); err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestCachingVerifierQuorum(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage)
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	atts := []*Attestation{ed25519Attestation(validPayload)}
+	for i := 0; i < 2; i++ {
+		if err := v.VerifyQuorum(atts, 1); err != nil {
+			t.Errorf("VerifyQuorum(...) = %v, expected nil", err)
+		}
+		if err := v.VerifyQuorum(atts, 2); !errors.Is(err, ErrQuorumNotMet) {
+			t.Errorf("VerifyQuorum(...) = %v, want error matching %v", err, ErrQuorumNotMet)
+		}
+	}
+	if got := underlying.count(); got != 1 {
+		t.Errorf("underlying verifier called %d times, expected 1", got)
+	}
+}
+
+func TestCachingVerifierConcurrent(t *testing.T) {
+	underlying := newCountingVerifier(t)
+	v, err := WrapVerifier(underlying, helloAppImage, WithCacheSize(4))
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+	att := ed25519Attestation(validPayload)
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			other := ed25519Attestation(validPayload)
+			other.PublicKeyID = string(rune('a' + i))
+			for j := 0; j < 20; j++ {
+				if err := v.VerifyAttestation(att); err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+				v.VerifyAttestation(other)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestWrapVerifierInvalidImage(t *testing.T) {
+	if _, err := WrapVerifier(NewAlwaysRejectingVerifier(nil), "gcr.io/google-samples/hello-app:latest"); err == nil {
+		t.Errorf("WrapVerifier(...) = nil, expected non nil")
+	}
+}
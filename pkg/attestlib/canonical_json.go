@@ -0,0 +1,247 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// Canonicalize serializes the JSON document `payload` according to the JSON
+// Canonicalization Scheme (JCS) of RFC 8785: object members are sorted by
+// the UTF-16 code units of their names, insignificant whitespace is removed,
+// and strings and numbers use the serialization of ECMAScript. Semantically
+// equal documents therefore canonicalize to the same bytes. Documents with
+// duplicate member names, or numbers that do not fit an IEEE 754 double, are
+// rejected.
+func Canonicalize(payload []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var buf bytes.Buffer
+	if err := writeCanonicalValue(&buf, dec); err != nil {
+		return nil, errors.Wrap(err, "error canonicalizing JSON")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("error canonicalizing JSON: unexpected data after top-level value")
+	}
+	return buf.Bytes(), nil
+}
+
+// canonicalizePayload canonicalizes `payload` if it is JSON. A payload that is
+// not JSON is returned as is, unless `rejectNonJSON` is set.
+func canonicalizePayload(payload []byte, rejectNonJSON bool) ([]byte, error) {
+	if !json.Valid(payload) {
+		if rejectNonJSON {
+			return nil, errors.New("payload is not JSON and cannot be canonicalized")
+		}
+		return payload, nil
+	}
+	return Canonicalize(payload)
+}
+
+// writeCanonicalValue reads the next JSON value from `dec` and writes its
+// canonical form to `buf`.
+func writeCanonicalValue(buf *bytes.Buffer, dec *json.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			return writeCanonicalObject(buf, dec)
+		case '[':
+			return writeCanonicalArray(buf, dec)
+		default:
+			return fmt.Errorf("unexpected delimiter %q", t)
+		}
+	case string:
+		writeCanonicalString(buf, t)
+	case json.Number:
+		number, err := canonicalNumber(t)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(number)
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("unexpected token %v", t)
+	}
+	return nil
+}
+
+func writeCanonicalObject(buf *bytes.Buffer, dec *json.Decoder) error {
+	members := map[string][]byte{}
+	names := []string{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected object member name %v", tok)
+		}
+		if _, ok := members[name]; ok {
+			return fmt.Errorf("duplicate object member %q", name)
+		}
+		var value bytes.Buffer
+		if err := writeCanonicalValue(&value, dec); err != nil {
+			return err
+		}
+		members[name] = value.Bytes()
+		names = append(names, name)
+	}
+	// Consume the closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return lessUTF16(names[i], names[j])
+	})
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeCanonicalString(buf, name)
+		buf.WriteByte(':')
+		buf.Write(members[name])
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func writeCanonicalArray(buf *bytes.Buffer, dec *json.Decoder) error {
+	buf.WriteByte('[')
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := writeCanonicalValue(buf, dec); err != nil {
+			return err
+		}
+	}
+	// Consume the closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	buf.WriteByte(']')
+	return nil
+}
+
+// lessUTF16 compares two strings by their UTF-16 code units, as required by
+// RFC 8785, section 3.2.3.
+func lessUTF16(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// writeCanonicalString writes `s` as a JSON string, escaping only the
+// characters that RFC 8785, section 3.2.2.2 requires to be escaped.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// canonicalNumber serializes a JSON number as ECMAScript's
+// Number.prototype.toString does for the nearest IEEE 754 double, see
+// RFC 8785, section 3.2.2.3.
+func canonicalNumber(number json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(number), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("number %s is not representable as an IEEE 754 double", number)
+	}
+	if f == 0 {
+		// Also covers negative zero.
+		return "0", nil
+	}
+	sign := ""
+	if f < 0 {
+		sign = "-"
+		f = -f
+	}
+	// The shortest decimal digits that round trip, and the exponent n such
+	// that the value is 0.digits * 10^n.
+	parts := strings.SplitN(strconv.FormatFloat(f, 'e', -1, 64), "e", 2)
+	digits := strings.Replace(parts[0], ".", "", 1)
+	e, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", err
+	}
+	n := e + 1
+	k := len(digits)
+	switch {
+	case k <= n && n <= 21:
+		return sign + digits + strings.Repeat("0", n-k), nil
+	case 0 < n && n <= 21:
+		return sign + digits[:n] + "." + digits[n:], nil
+	case -6 < n && n <= 0:
+		return sign + "0." + strings.Repeat("0", -n) + digits, nil
+	}
+	s := digits[:1]
+	if k > 1 {
+		s += "." + digits[1:]
+	}
+	if n-1 >= 0 {
+		return sign + s + "e+" + strconv.Itoa(n-1), nil
+	}
+	return sign + s + "e-" + strconv.Itoa(1-n), nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tcs := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "whitespace and member order",
+			input:    "{ \"b\" : [ 1, 2 ],\n\t\"a\": {\"d\": true, \"c\": null} }",
+			expected: `{"a":{"c":null,"d":true},"b":[1,2]}`,
+		},
+		{
+			// From RFC 8785, section 3.2.3.
+			name:     "members sorted by UTF-16 code units",
+			input:    `{"\u20ac": 1, "\r": 2, "\ufb33": 3, "1": 4, "\ud83d\ude00": 5, "\u0080": 6, "\u00f6": 7}`,
+			expected: "{\"\\r\":2,\"1\":4,\"\u0080\":6,\"\u00f6\":7,\"\u20ac\":1,\"\U0001F600\":5,\"\ufb33\":3}",
+		},
+		{
+			name:     "string escapes",
+			input:    `"\u20ac\/\u000f\n\"</script>"`,
+			expected: "\"\u20ac/\\u000f\\n\\\"</script>\"",
+		},
+		{
+			name:     "numbers",
+			input:    `[4.50, 2e-3, 1e-6, 1e-7, 1e21, 1e20, -0, 0.1, 333333333.3333333, 1E30, -5e-324, 123456789012345680000]`,
+			expected: `[4.5,0.002,0.000001,1e-7,1e+21,100000000000000000000,0,0.1,333333333.3333333,1e+30,-5e-324,123456789012345680000]`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Canonicalize([]byte(tc.input))
+			if err != nil {
+				t.Fatalf("Canonicalize(%q) = %v, expected nil", tc.input, err)
+			}
+			if string(actual) != tc.expected {
+				t.Errorf("Canonicalize(%q) = %s, expected %s", tc.input, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeEquivalentDocuments(t *testing.T) {
+	a := `{"critical": {"type": "atomic container signature", "image": {"docker-manifest-digest": "sha256:abc"}}, "optional": {"timestamp": 1.6e9}}`
+	b := `{
+		"optional": {"timestamp": 1600000000},
+		"critical": {
+			"image": {"docker-manifest-digest": "sha256:abc"},
+			"type": "atomic container signature"
+		}
+	}`
+	canonicalA, err := Canonicalize([]byte(a))
+	if err != nil {
+		t.Fatalf("Canonicalize(a) = %v, expected nil", err)
+	}
+	canonicalB, err := Canonicalize([]byte(b))
+	if err != nil {
+		t.Fatalf("Canonicalize(b) = %v, expected nil", err)
+	}
+	if string(canonicalA) != string(canonicalB) {
+		t.Errorf("Canonicalize(a) = %s, Canonicalize(b) = %s, expected them to be equal", canonicalA, canonicalB)
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	tcs := []struct {
+		name  string
+		input string
+	}{
+		{"duplicate member", `{"a": 1, "a": 2}`},
+		{"number out of range", `[1e400]`},
+		{"trailing data", `{} {}`},
+		{"not JSON", `not json`},
+		{"truncated", `{"a": [1, 2`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual, err := Canonicalize([]byte(tc.input)); err == nil {
+				t.Errorf("Canonicalize(%q) = %s, expected error", tc.input, actual)
+			}
+		})
+	}
+}
+
+func TestCanonicalizePayload(t *testing.T) {
+	payload := []byte("not json")
+	actual, err := canonicalizePayload(payload, false)
+	if err != nil || string(actual) != string(payload) {
+		t.Errorf("canonicalizePayload(_, false) = %q, %v, expected the payload to be passed through", actual, err)
+	}
+	if _, err := canonicalizePayload(payload, true); err == nil {
+		t.Errorf("canonicalizePayload(_, true) = nil, expected error")
+	}
+}
+
+func TestVerifyAttestationCanonicalPayloads(t *testing.T) {
+	pkixSigner, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "ec-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := NewCanonicalSigner(pkixSigner, true).CreateAttestation([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("CreateAttestation(_) = %v, expected nil", err)
+	}
+	canonical, err := Canonicalize([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("Canonicalize(_) = %v, expected nil", err)
+	}
+	if string(att.SerializedPayload) != string(canonical) {
+		t.Errorf("CreateAttestation(_) signed %s, expected %s", att.SerializedPayload, canonical)
+	}
+	// Deliver the payload in its original, non-canonical formatting.
+	att.SerializedPayload = []byte(validPayload)
+
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	tcs := []struct {
+		name        string
+		opts        []VerifierOption
+		expectedErr bool
+	}{
+		{
+			name: "canonical payloads",
+			opts: []VerifierOption{WithCanonicalPayloads(false)},
+		},
+		{
+			name:        "payloads verified as is",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestation(_) = %v, expected error: %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
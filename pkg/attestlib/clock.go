@@ -0,0 +1,39 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import "time"
+
+// Clock is the source of the current time for all time-dependent checks of a
+// Verifier: public key validity periods, attestation freshness, the exp and
+// nbf claims of JWTs, the expiry of COSE signatures and the validity of
+// certificates.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function returning the current time to a Clock.
+type ClockFunc func() time.Time
+
+// Now returns f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock that returns the real time. It is the default
+// Clock of a Verifier.
+var SystemClock Clock = ClockFunc(time.Now)
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedClock is a Clock that always returns the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestVerifyAttestationClockJwtExpiry(t *testing.T) {
+	exp := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	nbf := exp.Add(-time.Hour)
+	payload := fmt.Sprintf(`{"exp":%d,"nbf":%d,`, exp.Unix(), nbf.Unix()) + strings.TrimPrefix(validPayload, "{")
+	att := &Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: createJwt(t, validHeader, payload, ec256PrivateKey, EcdsaP256Sha256)}
+
+	tcs := []struct {
+		name        string
+		now         time.Time
+		expectedErr bool
+	}{
+		{"before nbf", nbf.Add(-time.Second), true},
+		{"at nbf", nbf, false},
+		{"just before exp", exp.Add(-time.Second), false},
+		{"at exp", exp, true},
+		{"after exp", exp.Add(time.Second), true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{ec256JwtPubKey}, WithClock(fixedClock(tc.now)))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr && err == nil {
+				t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestVerifierDefaultClock(t *testing.T) {
+	v, err := NewVerifier(helloAppImage, nil)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	before := time.Now()
+	now := v.(*verifier).currentTime()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("currentTime() = %v, expected the real time", now)
+	}
+}
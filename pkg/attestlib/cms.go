@@ -0,0 +1,400 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Object identifiers used by CMS, see RFC 5652 and RFC 5754.
+var (
+	oidCmsSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidCmsContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidCmsMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRsaPss           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+)
+
+// cmsDigestAlgorithms maps the supported CMS digest algorithm identifiers to
+// their hash functions.
+var cmsDigestAlgorithms = map[string]crypto.Hash{
+	"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+	"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+	"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+}
+
+// cmsContentInfo is the ASN.1 ContentInfo wrapping a CMS SignedData.
+type cmsContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type cmsSignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo cmsEncapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue   `asn1:"optional,tag:1"`
+	SignerInfos      []cmsSignerInfo `asn1:"set"`
+}
+
+type cmsEncapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"optional,explicit,tag:0"`
+}
+
+type cmsSignerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type cmsIssuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue
+}
+
+// parseCmsSignedData decodes a DER or PEM encoded CMS ContentInfo holding a
+// SignedData, and returns the SignedData and its embedded certificates.
+func parseCmsSignedData(data []byte) (*cmsSignedData, []*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	var info cmsContentInfo
+	if rest, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing CMS ContentInfo")
+	} else if len(rest) != 0 {
+		return nil, nil, errors.New("unexpected data after CMS ContentInfo")
+	}
+	if !info.ContentType.Equal(oidCmsSignedData) {
+		return nil, nil, fmt.Errorf("expected CMS SignedData, got content type %v", info.ContentType)
+	}
+	var sd cmsSignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &sd); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing CMS SignedData")
+	}
+	if len(sd.SignerInfos) == 0 {
+		return nil, nil, errors.New("CMS SignedData has no signers")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing CMS certificates")
+	}
+	return &sd, certs, nil
+}
+
+// verifyCms verifies an Attestation whose Signature is a CMS SignedData, and
+// returns the encapsulated payload and a public key for the certificate of
+// the first signer that verified it. The signer's certificate must be
+// embedded in the SignedData and chain to the verifier's CMS trust roots.
+// With strict key ID matching or key identity matching, the Attestation's
+// PublicKeyID must identify the signer's key, e.g. by its SPKI fingerprint.
+func (v *verifier) verifyCms(ctx context.Context, att *Attestation) ([]byte, PublicKey, error) {
+	sd, certs, err := parseCmsSignedData(att.Signature)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	payload := sd.EncapContentInfo.EContent
+	if att.DetachedSignature {
+		if payload != nil {
+			return nil, PublicKey{}, fmt.Errorf("%w: detached CMS SignedData encapsulates content", ErrSignatureInvalid)
+		}
+		payload = att.SerializedPayload
+	} else if payload == nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: CMS SignedData has no encapsulated content", ErrSignatureInvalid)
+	}
+	if v.cmsRoots == nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: attestation is a CMS SignedData, but no CMS trust roots are configured", ErrCertificateNotTrusted)
+	}
+	if v.strictKeyIDMatching && att.PublicKeyID == "" {
+		return nil, PublicKey{}, fmt.Errorf("%w: attestation has no public key ID", ErrKeyIDMismatch)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs {
+		intermediates.AddCert(cert)
+	}
+
+	var failures []string
+	untrusted := false
+	revoked := false
+	weak := false
+	mismatched := false
+	misidentified := false
+	for i, signer := range sd.SignerInfos {
+		if err := ctx.Err(); err != nil {
+			return nil, PublicKey{}, err
+		}
+		cert, err := signer.certificate(certs)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			continue
+		}
+		if err := v.checkCmsCertificate(cert, intermediates); err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			untrusted = true
+			continue
+		}
+		alg, err := cmsSignatureAlgorithm(cert.PublicKey, signer.DigestAlgorithm.Algorithm, signer.SignatureAlgorithm.Algorithm)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			continue
+		}
+		publicKey, err := newPkixPublicKey(cert.PublicKey, cert.RawSubjectPublicKeyInfo, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			continue
+		}
+		publicKey.SignatureAlgorithm = alg
+		if v.strictKeyIDMatching && !keyIdentifies(att.PublicKeyID, *publicKey) {
+			failures = append(failures, fmt.Sprintf("signer %d: key %q is not named by the attestation's public key ID %q", i, publicKey.ID, att.PublicKeyID))
+			mismatched = true
+			continue
+		}
+		if err := v.checkRevoked(*publicKey); err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			revoked = true
+			continue
+		}
+		if err := v.checkAlgorithm(att, *publicKey); err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			continue
+		}
+		if err := v.keyStrength.check(cert.PublicKey); err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			weak = true
+			continue
+		}
+		err = traceSignature(ctx, *publicKey, func(ctx context.Context) error {
+			return signer.verify(cert.PublicKey, alg, sd.EncapContentInfo.EContentType, payload)
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			continue
+		}
+		if err := v.checkKeyIdentity(att.PublicKeyID, *publicKey); err != nil {
+			failures = append(failures, fmt.Sprintf("signer %d: %v", i, err))
+			misidentified = true
+			continue
+		}
+		return payload, *publicKey, nil
+	}
+	if misidentified {
+		return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature was verified by the key the attestation names: %s", ErrKeyMismatch, strings.Join(failures, "; "))
+	}
+	if revoked {
+		return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature by a non-revoked key could be verified: %s", ErrKeyRevoked, strings.Join(failures, "; "))
+	}
+	if untrusted {
+		return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature by a trusted certificate could be verified: %s", ErrCertificateNotTrusted, strings.Join(failures, "; "))
+	}
+	if mismatched {
+		return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature by the named key could be verified: %s", ErrKeyIDMismatch, strings.Join(failures, "; "))
+	}
+	if weak {
+		return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature by a strong enough key could be verified: %s", ErrKeyTooWeak, strings.Join(failures, "; "))
+	}
+	return nil, PublicKey{}, fmt.Errorf("%w: no CMS signature could be verified: %s", ErrSignatureInvalid, strings.Join(failures, "; "))
+}
+
+// checkCmsCertificate checks that the certificate of a CMS signer may create
+// digital signatures, has one of the verifier's CMS extended key usages and
+// chains to its CMS trust roots.
+func (v *verifier) checkCmsCertificate(cert *x509.Certificate, intermediates *x509.CertPool) error {
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return errors.New("signing certificate does not allow digital signatures")
+	}
+	keyUsages := v.cmsKeyUsages
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	// x509.Certificate.Verify accepts a certificate without extended key
+	// usages for any usage, so the signing certificate is checked first.
+	if !hasExtKeyUsage(cert, keyUsages) {
+		return fmt.Errorf("signing certificate does not have any of the extended key usages %v", keyUsages)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         v.cmsRoots,
+		Intermediates: intermediates,
+		CurrentTime:   v.currentTime(),
+		KeyUsages:     keyUsages,
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return errors.Wrap(err, "signing certificate")
+	}
+	return nil
+}
+
+// hasExtKeyUsage reports whether `cert` has any of `keyUsages` as an extended
+// key usage.
+func hasExtKeyUsage(cert *x509.Certificate, keyUsages []x509.ExtKeyUsage) bool {
+	for _, usage := range cert.ExtKeyUsage {
+		for _, allowed := range keyUsages {
+			if usage == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// certificate returns the certificate in `certs` identified by the signer's
+// issuer and serial number or subject key identifier.
+func (s cmsSignerInfo) certificate(certs []*x509.Certificate) (*x509.Certificate, error) {
+	switch {
+	case s.SID.Class == asn1.ClassUniversal && s.SID.Tag == asn1.TagSequence:
+		var ias cmsIssuerAndSerialNumber
+		if _, err := asn1.Unmarshal(s.SID.FullBytes, &ias); err != nil {
+			return nil, errors.Wrap(err, "error parsing signer identifier")
+		}
+		for _, cert := range certs {
+			if bytes.Equal(cert.RawIssuer, ias.Issuer.FullBytes) && cert.SerialNumber.Cmp(ias.SerialNumber) == 0 {
+				return cert, nil
+			}
+		}
+	case s.SID.Class == asn1.ClassContextSpecific && s.SID.Tag == 0:
+		for _, cert := range certs {
+			if len(cert.SubjectKeyId) > 0 && bytes.Equal(cert.SubjectKeyId, s.SID.Bytes) {
+				return cert, nil
+			}
+		}
+	default:
+		return nil, errors.New("unknown signer identifier")
+	}
+	return nil, errors.New("signing certificate is not embedded in the CMS SignedData")
+}
+
+// verify checks the signature of the signer over `content`. If the signer has
+// signed attributes, the signature is over their DER encoding, and they must
+// contain the content type and the digest of `content`.
+func (s cmsSignerInfo) verify(pub crypto.PublicKey, alg SignatureAlgorithm, contentType asn1.ObjectIdentifier, content []byte) error {
+	if len(s.SignedAttrs.FullBytes) == 0 {
+		return verifyDetachedWithKey(s.Signature, pub, alg, content)
+	}
+	// The signed attributes are signed with their universal SET tag rather
+	// than the implicit tag they are stored with.
+	signed := append([]byte{}, s.SignedAttrs.FullBytes...)
+	signed[0] = asn1.TagSet | 0x20
+	var attrs []cmsAttribute
+	if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+		return errors.Wrap(err, "error parsing signed attributes")
+	}
+	hash := cmsDigestAlgorithms[s.DigestAlgorithm.Algorithm.String()]
+	digest := hash.New()
+	digest.Write(content)
+	var foundType, foundDigest bool
+	for _, attr := range attrs {
+		switch {
+		case attr.Type.Equal(oidCmsContentType):
+			var oid asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &oid); err != nil {
+				return errors.Wrap(err, "error parsing content type attribute")
+			}
+			if !oid.Equal(contentType) {
+				return fmt.Errorf("signed content type %v does not match content type %v", oid, contentType)
+			}
+			foundType = true
+		case attr.Type.Equal(oidCmsMessageDigest):
+			var value []byte
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &value); err != nil {
+				return errors.Wrap(err, "error parsing message digest attribute")
+			}
+			if !bytes.Equal(value, digest.Sum(nil)) {
+				return errors.New("message digest does not match content")
+			}
+			foundDigest = true
+		}
+	}
+	if !foundType || !foundDigest {
+		return errors.New("signed attributes lack the content type or message digest")
+	}
+	return verifyDetachedWithKey(s.Signature, pub, alg, signed)
+}
+
+// cmsRsaAlgorithms lists the SignatureAlgorithms of RSA keys by key size,
+// hash function and padding.
+var cmsRsaAlgorithms = []struct {
+	bits int
+	hash crypto.Hash
+	pss  bool
+	alg  SignatureAlgorithm
+}{
+	{2048, crypto.SHA256, false, RsaSignPkcs12048Sha256},
+	{3072, crypto.SHA256, false, RsaSignPkcs13072Sha256},
+	{4096, crypto.SHA256, false, RsaSignPkcs14096Sha256},
+	{4096, crypto.SHA384, false, RsaSignPkcs14096Sha384},
+	{4096, crypto.SHA512, false, RsaSignPkcs14096Sha512},
+	{2048, crypto.SHA256, true, RsaPss2048Sha256},
+	{3072, crypto.SHA256, true, RsaPss3072Sha256},
+	{4096, crypto.SHA256, true, RsaPss4096Sha256},
+	{4096, crypto.SHA512, true, RsaPss4096Sha512},
+}
+
+// cmsSignatureAlgorithm returns the SignatureAlgorithm of a CMS signer with
+// the public key `pub` and the given digest and signature algorithms.
+func cmsSignatureAlgorithm(pub crypto.PublicKey, digestAlg, sigAlg asn1.ObjectIdentifier) (SignatureAlgorithm, error) {
+	hash, ok := cmsDigestAlgorithms[digestAlg.String()]
+	if !ok {
+		return UnknownSigningAlgorithm, fmt.Errorf("unsupported CMS digest algorithm %v", digestAlg)
+	}
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return EddsaEd25519, nil
+	case *ecdsa.PublicKey:
+		for _, alg := range []SignatureAlgorithm{EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512} {
+			if ecdsaCurve(alg) != pub.Curve {
+				continue
+			}
+			if h, _ := signatureHash(alg); h != hash {
+				return UnknownSigningAlgorithm, fmt.Errorf("unsupported CMS digest algorithm %v for ECDSA curve %s", digestAlg, pub.Curve.Params().Name)
+			}
+			return alg, nil
+		}
+		return UnknownSigningAlgorithm, fmt.Errorf("unsupported elliptic curve %s", pub.Curve.Params().Name)
+	case *rsa.PublicKey:
+		pss := sigAlg.Equal(oidRsaPss)
+		for _, a := range cmsRsaAlgorithms {
+			if a.bits == pub.N.BitLen() && a.hash == hash && a.pss == pss {
+				return a.alg, nil
+			}
+		}
+		return UnknownSigningAlgorithm, fmt.Errorf("unsupported CMS digest algorithm %v for %d bit RSA key", digestAlg, pub.N.BitLen())
+	default:
+		return UnknownSigningAlgorithm, fmt.Errorf("unsupported CMS signer key type %T", pub)
+	}
+}
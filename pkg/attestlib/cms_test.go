@@ -0,0 +1,338 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	oidCmsData         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSha256          = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidEcdsaWithSha256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// cmsSigner creates CMS SignedData envelopes with an ECDSA P-256 key.
+type cmsSigner struct {
+	key   *ecdsa.PrivateKey
+	cert  *x509.Certificate
+	chain []*x509.Certificate
+	// noSignedAttrs signs the content directly instead of signed attributes.
+	noSignedAttrs bool
+}
+
+// newCmsCA creates a self-signed CA certificate.
+func newCmsCA(t *testing.T, name string) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	return newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+}
+
+// newCmsSigner creates a signer whose certificate is issued by the CA, with
+// the given extended key usages, or code signing if none are given.
+func newCmsSigner(t *testing.T, caKey *ecdsa.PrivateKey, caCert *x509.Certificate, extKeyUsages ...x509.ExtKeyUsage) cmsSigner {
+	t.Helper()
+	if len(extKeyUsages) == 0 {
+		extKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+	}
+	key, cert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "cms signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  extKeyUsages,
+	}, caCert, caKey)
+	return cmsSigner{key: key, cert: cert}
+}
+
+// sign returns a DER encoded CMS SignedData over `signedContent` that
+// encapsulates `content`, or no content if it is nil.
+func (s cmsSigner) sign(t *testing.T, content, signedContent []byte) []byte {
+	t.Helper()
+	mustMarshal := func(val interface{}, params string) []byte {
+		t.Helper()
+		der, err := asn1.MarshalWithParams(val, params)
+		if err != nil {
+			t.Fatalf("error marshaling %T: %v", val, err)
+		}
+		return der
+	}
+	attrValue := func(val interface{}) asn1.RawValue {
+		return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: mustMarshal(val, "")}
+	}
+
+	sid := mustMarshal(cmsIssuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: s.cert.RawIssuer}, SerialNumber: s.cert.SerialNumber}, "")
+	signer := cmsSignerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: oidSha256},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidEcdsaWithSha256},
+	}
+	signed := signedContent
+	if !s.noSignedAttrs {
+		digest := sha256.Sum256(signedContent)
+		attrs := []cmsAttribute{
+			{Type: oidCmsContentType, Values: attrValue(oidCmsData)},
+			{Type: oidCmsMessageDigest, Values: attrValue(digest[:])},
+		}
+		signed = mustMarshal(attrs, "set")
+		stored := append([]byte{}, signed...)
+		stored[0] = 0xa0
+		signer.SignedAttrs = asn1.RawValue{FullBytes: stored}
+	}
+	signature, err := ecSign(s.key, signed, EcdsaP256Sha256)
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	signer.Signature = signature
+
+	var certs []byte
+	for _, cert := range append([]*x509.Certificate{s.cert}, s.chain...) {
+		certs = append(certs, cert.Raw...)
+	}
+	sd := cmsSignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSha256}},
+		EncapContentInfo: cmsEncapsulatedContentInfo{EContentType: oidCmsData, EContent: content},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []cmsSignerInfo{signer},
+	}
+	// The content is explicitly tagged, which asn1.Marshal does not do for
+	// RawValues.
+	return mustMarshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: oidCmsSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: mustMarshal(sd, "")},
+	}, "")
+}
+
+func TestVerifyAttestationCms(t *testing.T) {
+	caKey, caCert := newCmsCA(t, "cms root")
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	signer := newCmsSigner(t, caKey, caCert)
+	publicKey, err := newPkixPublicKey(signer.cert.PublicKey, signer.cert.RawSubjectPublicKeyInfo, nil)
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+
+	intermediateKey, intermediateCert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(3),
+		Subject:               pkix.Name{CommonName: "cms intermediate"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, caCert, caKey)
+	chainedSigner := newCmsSigner(t, intermediateKey, intermediateCert)
+	chainedSigner.chain = []*x509.Certificate{intermediateCert}
+
+	untrustedKey, untrustedCert := newCmsCA(t, "untrusted root")
+	untrustedSigner := newCmsSigner(t, untrustedKey, untrustedCert)
+
+	noAttrsSigner := signer
+	noAttrsSigner.noSignedAttrs = true
+
+	serverAuthSigner := newCmsSigner(t, caKey, caCert, x509.ExtKeyUsageServerAuth)
+	var noExtKeyUsageSigner cmsSigner
+	noExtKeyUsageSigner.key, noExtKeyUsageSigner.cert = newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(4),
+		Subject:      pkix.Name{CommonName: "cms signer without extended key usages"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, caCert, caKey)
+
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			name: "valid signature over signed attributes",
+			att:  &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+		},
+		{
+			name: "valid signature over content",
+			att:  &Attestation{Signature: noAttrsSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+		},
+		{
+			name: "PEM encoded SignedData",
+			att: &Attestation{
+				Signature:    pem.EncodeToMemory(&pem.Block{Type: "CMS", Bytes: signer.sign(t, []byte(validPayload), []byte(validPayload))}),
+				EnvelopeType: Cms,
+			},
+		},
+		{
+			name: "detached signature",
+			att: &Attestation{
+				Signature:         signer.sign(t, nil, []byte(validPayload)),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+				EnvelopeType:      Cms,
+			},
+		},
+		{
+			name: "embedded intermediate certificate",
+			att:  &Attestation{Signature: chainedSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+		},
+		{
+			name:        "untrusted certificate",
+			att:         &Attestation{Signature: untrustedSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "no trust roots",
+			att:         &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts:        []VerifierOption{WithCmsRoots(nil)},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "certificate under the PKIX roots only",
+			att:         &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts:        []VerifierOption{WithCmsRoots(nil), WithRoots(roots)},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "certificate without the code signing key usage",
+			att:         &Attestation{Signature: serverAuthSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "certificate without extended key usages",
+			att:         &Attestation{Signature: noExtKeyUsageSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name: "certificate with a configured key usage",
+			att:  &Attestation{Signature: serverAuthSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts: []VerifierOption{WithCmsRoots(roots, x509.ExtKeyUsageServerAuth)},
+		},
+		{
+			name: "strict key ID matching with the signer's key ID",
+			att:  &Attestation{PublicKeyID: publicKey.ID, Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts: []VerifierOption{WithStrictKeyIDMatching()},
+		},
+		{
+			name:        "strict key ID matching without a key ID",
+			att:         &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts:        []VerifierOption{WithStrictKeyIDMatching()},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "strict key ID matching with another key ID",
+			att:         &Attestation{PublicKeyID: "other-key", Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts:        []VerifierOption{WithStrictKeyIDMatching()},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "tampered content with signed attributes",
+			att:         &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(otherDigestPayload)), EnvelopeType: Cms},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "tampered content",
+			att:         &Attestation{Signature: noAttrsSigner.sign(t, []byte(validPayload), []byte(otherDigestPayload)), EnvelopeType: Cms},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "detached signature without payload",
+			att:         &Attestation{Signature: signer.sign(t, nil, []byte(validPayload)), EnvelopeType: Cms},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "payload for another image",
+			att:         &Attestation{Signature: signer.sign(t, []byte(otherDigestPayload), []byte(otherDigestPayload)), EnvelopeType: Cms},
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "revoked signer",
+			att:         &Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms},
+			opts:        []VerifierOption{WithRevokedKeys(publicKey.ID)},
+			expectedErr: ErrKeyRevoked,
+		},
+		{
+			name:        "not a SignedData",
+			att:         &Attestation{Signature: []byte("not cms"), EnvelopeType: Cms},
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, nil, append([]VerifierOption{WithCmsRoots(roots)}, tc.opts...)...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			result, err := v.VerifyAttestationWithResult(tc.att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if result.KeyType != Pkix {
+				t.Errorf("KeyType = %v, expected %v", result.KeyType, Pkix)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationCmsKeyID(t *testing.T) {
+	caKey, caCert := newCmsCA(t, "cms root")
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	signer := newCmsSigner(t, caKey, caCert)
+	publicKey, err := newPkixPublicKey(signer.cert.PublicKey, signer.cert.RawSubjectPublicKeyInfo, nil)
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, nil, WithCmsRoots(roots))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	result, err := v.VerifyAttestationWithResult(&Attestation{Signature: signer.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms})
+	if err != nil {
+		t.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	if result.KeyID != publicKey.ID {
+		t.Errorf("KeyID = %q, expected %q", result.KeyID, publicKey.ID)
+	}
+}
@@ -0,0 +1,482 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Header labels and values of COSE_Sign1 messages, see RFC 9052 and RFC 9053,
+// and of notation signature envelopes, see
+// https://github.com/notaryproject/specifications/blob/main/specs/signature-envelope-cose.md
+const (
+	coseSign1Tag        = 18
+	coseEpochTimeTag    = 1
+	coseHeaderAlg       = 1
+	coseHeaderCrit      = 2
+	coseHeaderKid       = 4
+	coseSign1Context    = "Signature1"
+	notaryExpiry        = "io.cncf.notary.expiry"
+	notarySigningTime   = "io.cncf.notary.signingTime"
+	notarySigningScheme = "io.cncf.notary.signingScheme"
+	notaryAuthenticTime = "io.cncf.notary.authenticSigningTime"
+)
+
+// coseAlgorithms maps the supported COSE algorithm identifiers to the
+// signature algorithms of the public keys that may verify them.
+var coseAlgorithms = map[int64][]SignatureAlgorithm{
+	-7:  {EcdsaP256Sha256},
+	-35: {EcdsaP384Sha384},
+	-36: {EcdsaP521Sha512},
+	-37: {RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256},
+	-39: {RsaPss4096Sha512},
+	-8:  {EddsaEd25519},
+}
+
+// coseCriticalHeaders are the critical protected headers the verifier
+// understands. Messages marking any other header as critical are rejected.
+var coseCriticalHeaders = map[interface{}]bool{
+	int64(coseHeaderAlg): true,
+	int64(coseHeaderKid): true,
+	notaryExpiry:         true,
+	notarySigningTime:    true,
+	notarySigningScheme:  true,
+	notaryAuthenticTime:  true,
+}
+
+// coseSign1 is a decoded COSE_Sign1 message.
+type coseSign1 struct {
+	// protected is the serialized protected header map, as signed.
+	protected []byte
+	// headers is the decoded protected header map.
+	headers   map[interface{}]interface{}
+	payload   []byte
+	signature []byte
+}
+
+// notationPayload is the payload of a notation signature, which describes
+// the signed artifact by its OCI descriptor.
+type notationPayload struct {
+	TargetArtifact *struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"targetArtifact"`
+}
+
+// convertNotationPayload parses a verified notation payload into an
+// AuthenticatedAttestation holding the digest of its target artifact. Such
+// payloads do not contain the image name.
+func convertNotationPayload(payload []byte) (*AuthenticatedAttestation, error) {
+	var p notationPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, errors.Wrap(err, "error parsing notation payload")
+	}
+	if p.TargetArtifact == nil || p.TargetArtifact.Digest == "" {
+		return nil, errors.New("notation payload is missing targetArtifact.digest")
+	}
+	return &AuthenticatedAttestation{ImageDigest: p.TargetArtifact.Digest}, nil
+}
+
+// isNotationPayload reports whether `payload` is a notation payload, a JSON
+// object with a targetArtifact.
+func isNotationPayload(payload []byte) bool {
+	var p map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return false
+	}
+	_, ok := p["targetArtifact"]
+	return ok
+}
+
+// parseCoseSign1 decodes a tagged or untagged COSE_Sign1 message.
+func parseCoseSign1(data []byte) (*coseSign1, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding COSE_Sign1")
+	}
+	if d.off != len(data) {
+		return nil, errors.New("unexpected data after COSE_Sign1")
+	}
+	if tag, ok := value.(cborTag); ok {
+		if tag.number != coseSign1Tag {
+			return nil, fmt.Errorf("expected COSE_Sign1, got CBOR tag %d", tag.number)
+		}
+		value = tag.content
+	}
+	fields, ok := value.([]interface{})
+	if !ok || len(fields) != 4 {
+		return nil, errors.New("COSE_Sign1 is not an array of 4 elements")
+	}
+	protected, ok := fields[0].([]byte)
+	if !ok {
+		return nil, errors.New("COSE_Sign1 protected header is not a byte string")
+	}
+	if _, ok := fields[1].(map[interface{}]interface{}); !ok {
+		return nil, errors.New("COSE_Sign1 unprotected header is not a map")
+	}
+	msg := &coseSign1{protected: protected, headers: map[interface{}]interface{}{}}
+	if len(protected) > 0 {
+		d := &cborDecoder{data: protected}
+		headers, err := d.decode(0)
+		if err != nil {
+			return nil, errors.Wrap(err, "error decoding COSE_Sign1 protected header")
+		}
+		if msg.headers, ok = headers.(map[interface{}]interface{}); !ok || d.off != len(protected) {
+			return nil, errors.New("COSE_Sign1 protected header is not a map")
+		}
+	}
+	if fields[2] != nil {
+		if msg.payload, ok = fields[2].([]byte); !ok {
+			return nil, errors.New("COSE_Sign1 payload is not a byte string")
+		}
+	}
+	if msg.signature, ok = fields[3].([]byte); !ok {
+		return nil, errors.New("COSE_Sign1 signature is not a byte string")
+	}
+	return msg, nil
+}
+
+// sigStructure returns the Sig_structure that the signature of `msg` is
+// computed over, see RFC 9052, section 4.4.
+func (msg *coseSign1) sigStructure(payload []byte) []byte {
+	var buf bytes.Buffer
+	writeCborHead(&buf, 4, 4)
+	writeCborHead(&buf, 3, uint64(len(coseSign1Context)))
+	buf.WriteString(coseSign1Context)
+	writeCborHead(&buf, 2, uint64(len(msg.protected)))
+	buf.Write(msg.protected)
+	// No external additional authenticated data.
+	writeCborHead(&buf, 2, 0)
+	writeCborHead(&buf, 2, uint64(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+// checkHeaders checks that every critical protected header of `msg` is
+// understood, and that the signature has not expired at `now`. It returns the
+// message's COSE algorithm.
+func (msg *coseSign1) checkHeaders(now time.Time) (int64, error) {
+	alg, ok := msg.headers[int64(coseHeaderAlg)].(int64)
+	if !ok {
+		return 0, errors.New("COSE_Sign1 protected header has no algorithm")
+	}
+	if crit, ok := msg.headers[int64(coseHeaderCrit)]; ok {
+		labels, ok := crit.([]interface{})
+		if !ok || len(labels) == 0 {
+			return 0, errors.New("COSE_Sign1 critical header is not a non-empty array")
+		}
+		for _, label := range labels {
+			// Header labels are integers or text strings. Other values
+			// cannot be looked up in a map.
+			switch label.(type) {
+			case int64, string:
+			default:
+				return 0, errors.New("COSE_Sign1 critical header label is not an integer or text string")
+			}
+			if !coseCriticalHeaders[label] {
+				return 0, fmt.Errorf("COSE_Sign1 marks unsupported header %v as critical", label)
+			}
+			if _, ok := msg.headers[label]; !ok {
+				return 0, fmt.Errorf("COSE_Sign1 critical header %v is missing", label)
+			}
+		}
+	}
+	if expiry, ok := msg.headers[notaryExpiry]; ok {
+		tag, ok := expiry.(cborTag)
+		seconds, isInt := tag.content.(int64)
+		if !ok || tag.number != coseEpochTimeTag || !isInt {
+			return 0, fmt.Errorf("COSE_Sign1 header %s is not an epoch time", notaryExpiry)
+		}
+		if expiresAt := time.Unix(seconds, 0); !now.Before(expiresAt) {
+			return 0, fmt.Errorf("COSE_Sign1 signature expired at %v", expiresAt.UTC())
+		}
+	}
+	return alg, nil
+}
+
+// keyID returns the key identifier in the protected header of `msg`, if any.
+func (msg *coseSign1) keyID() string {
+	switch kid := msg.headers[int64(coseHeaderKid)].(type) {
+	case []byte:
+		return string(kid)
+	case string:
+		return kid
+	}
+	return ""
+}
+
+// checkCoseAlgorithm checks that the COSE algorithm `alg` is the signature
+// algorithm of `publicKey`, so that a message cannot choose how it is
+// verified.
+func checkCoseAlgorithm(alg int64, publicKey PublicKey) error {
+	algs, ok := coseAlgorithms[alg]
+	if !ok {
+		return fmt.Errorf("unsupported COSE algorithm %d", alg)
+	}
+	for _, a := range algs {
+		if a == publicKey.SignatureAlgorithm {
+			return nil
+		}
+	}
+	return fmt.Errorf("COSE algorithm %d does not match signature algorithm %v of key %q", alg, publicKey.SignatureAlgorithm, publicKey.ID)
+}
+
+// verifyCoseSign1 verifies an Attestation whose Signature is a COSE_Sign1
+// message, as used by notation, and returns its payload and the first public
+// key that verified it. The key is named by the Attestation's PublicKeyID, or,
+// if that is empty, by the message's kid header, which must identify the key
+// with key identity matching. The payload is taken from SerializedPayload if
+// the message has a detached payload.
+func (v *verifier) verifyCoseSign1(ctx context.Context, att *Attestation) ([]byte, PublicKey, error) {
+	msg, err := parseCoseSign1(att.Signature)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	payload := msg.payload
+	if att.DetachedSignature {
+		if payload != nil {
+			return nil, PublicKey{}, fmt.Errorf("%w: detached COSE_Sign1 carries a payload", ErrSignatureInvalid)
+		}
+		payload = att.SerializedPayload
+	} else if payload == nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: COSE_Sign1 has no payload", ErrSignatureInvalid)
+	}
+	alg, err := msg.checkHeaders(v.currentTime())
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+
+	keyID := att.PublicKeyID
+	if keyID == "" {
+		keyID = msg.keyID()
+	}
+	if v.strictKeyIDMatching && keyID == "" {
+		return nil, PublicKey{}, fmt.Errorf("%w: COSE_Sign1 names no public key", ErrKeyIDMismatch)
+	}
+	publicKeys := v.publicKeysByID(keyID)
+	if len(publicKeys) == 0 {
+		if v.strictKeyIDMatching {
+			return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found", ErrKeyIDMismatch, keyID)
+		}
+		return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found", ErrNoMatchingKey, keyID)
+	}
+	sigStructure := msg.sigStructure(payload)
+	var failures []string
+	for _, publicKey := range publicKeys {
+		if err := ctx.Err(); err != nil {
+			return nil, PublicKey{}, err
+		}
+		if err := v.checkRevoked(publicKey); err != nil {
+			return nil, PublicKey{}, err
+		}
+		if err := v.checkAlgorithm(att, publicKey); err != nil {
+			failures = append(failures, fmt.Sprintf("key %q: %v", publicKey.ID, err))
+			continue
+		}
+		err := traceSignature(ctx, publicKey, func(ctx context.Context) error {
+			return v.verifyCoseSignature(alg, msg.signature, sigStructure, publicKey)
+		})
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("key %q: %v", publicKey.ID, err))
+			continue
+		}
+		if err := v.checkKeyIdentity(keyID, publicKey); err != nil {
+			return nil, PublicKey{}, err
+		}
+		return payload, publicKey, nil
+	}
+	return nil, PublicKey{}, fmt.Errorf("%w: COSE_Sign1 signature could not be verified: %s", ErrSignatureInvalid, strings.Join(failures, "; "))
+}
+
+func (v *verifier) verifyCoseSignature(alg int64, signature, sigStructure []byte, publicKey PublicKey) error {
+	if err := checkCoseAlgorithm(alg, publicKey); err != nil {
+		return err
+	}
+	switch publicKey.AuthenticatorType {
+	case Pkix:
+		if err := v.checkCertificateChain(publicKey); err != nil {
+			return err
+		}
+		return v.verifyPkix(signature, sigStructure, publicKey)
+	case Ed25519:
+		return v.verifyEd25519(signature, sigStructure, publicKey)
+	default:
+		return errors.New("key type cannot verify COSE_Sign1 signatures")
+	}
+}
+
+// cborTag is a decoded CBOR tag.
+type cborTag struct {
+	number  uint64
+	content interface{}
+}
+
+// cborMaxDepth bounds the nesting of decoded CBOR data items.
+const cborMaxDepth = 16
+
+// cborDecoder decodes the subset of CBOR, defined in RFC 8949, used by COSE:
+// integers, byte and text strings, arrays, maps and tags of definite length,
+// and the simple values false, true and null. Integers are decoded as int64,
+// and maps as map[interface{}]interface{}.
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+func (d *cborDecoder) decode(depth int) (interface{}, error) {
+	if depth > cborMaxDepth {
+		return nil, errors.New("CBOR data is nested too deeply")
+	}
+	major, arg, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("CBOR integer overflows int64")
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, errors.New("CBOR integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case 2, 3:
+		if arg > uint64(len(d.data)-d.off) {
+			return nil, errors.New("truncated CBOR string")
+		}
+		s := d.data[d.off : d.off+int(arg)]
+		d.off += int(arg)
+		if major == 3 {
+			return string(s), nil
+		}
+		return append([]byte{}, s...), nil
+	case 4:
+		// Every element takes at least one byte.
+		if arg > uint64(len(d.data)-d.off) {
+			return nil, errors.New("truncated CBOR array")
+		}
+		array := make([]interface{}, 0, int(arg))
+		for i := uint64(0); i < arg; i++ {
+			elem, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, elem)
+		}
+		return array, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.off) {
+			return nil, errors.New("truncated CBOR map")
+		}
+		m := map[interface{}]interface{}{}
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, errors.New("CBOR map key is not an integer or text string")
+			}
+			if _, ok := m[key]; ok {
+				return nil, fmt.Errorf("duplicate CBOR map key %v", key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case 6:
+		content, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTag{number: arg, content: content}, nil
+	default:
+		switch arg {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unsupported CBOR simple value %d", arg)
+	}
+}
+
+// head decodes the initial byte and argument of a CBOR data item.
+func (d *cborDecoder) head() (byte, uint64, error) {
+	if d.off >= len(d.data) {
+		return 0, 0, errors.New("truncated CBOR data")
+	}
+	major, info := d.data[d.off]>>5, d.data[d.off]&0x1f
+	d.off++
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, errors.New("indefinite length or reserved CBOR data is not supported")
+	}
+	if major == 7 && info > 24 {
+		return 0, 0, errors.New("CBOR floating point values are not supported")
+	}
+	size := 1 << (info - 24)
+	if len(d.data)-d.off < size {
+		return 0, 0, errors.New("truncated CBOR data")
+	}
+	var buf [8]byte
+	copy(buf[8-size:], d.data[d.off:d.off+size])
+	d.off += size
+	return major, binary.BigEndian.Uint64(buf[:]), nil
+}
+
+// writeCborHead writes the initial byte and argument of a CBOR data item of
+// the given major type in its shortest form.
+func writeCborHead(buf *bytes.Buffer, major byte, arg uint64) {
+	switch {
+	case arg < 24:
+		buf.WriteByte(major<<5 | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.WriteByte(major<<5 | 24)
+		buf.WriteByte(byte(arg))
+	case arg <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(arg))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(arg))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, arg)
+	}
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cborPair is a map entry for encodeTestCbor, which keeps the order of map
+// entries so that tests control the serialized protected header.
+type cborPair struct {
+	key, value interface{}
+}
+
+func encodeTestCbor(t *testing.T, buf *bytes.Buffer, value interface{}) {
+	t.Helper()
+	switch v := value.(type) {
+	case int:
+		if v < 0 {
+			writeCborHead(buf, 1, uint64(-1-v))
+		} else {
+			writeCborHead(buf, 0, uint64(v))
+		}
+	case []byte:
+		writeCborHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeCborHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []interface{}:
+		writeCborHead(buf, 4, uint64(len(v)))
+		for _, elem := range v {
+			encodeTestCbor(t, buf, elem)
+		}
+	case []cborPair:
+		writeCborHead(buf, 5, uint64(len(v)))
+		for _, pair := range v {
+			encodeTestCbor(t, buf, pair.key)
+			encodeTestCbor(t, buf, pair.value)
+		}
+	case cborTag:
+		writeCborHead(buf, 6, v.number)
+		encodeTestCbor(t, buf, v.content)
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		t.Fatalf("cannot encode %T as CBOR", value)
+	}
+}
+
+func testCbor(t *testing.T, value interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encodeTestCbor(t, &buf, value)
+	return buf.Bytes()
+}
+
+// coseByteStringCritLabel is an untagged COSE_Sign1 message whose protected
+// header marks the byte string h'00' as critical.
+var coseByteStringCritLabel = []byte{0x84, 0x47, 0xa2, 0x01, 0x26, 0x02, 0x81, 0x41, 0x00, 0xa0, 0x41, 0x7b, 0x40}
+
+// notationTestPayload returns a notation payload for the artifact with
+// digest `digest`.
+func notationTestPayload(digest string) []byte {
+	return []byte(fmt.Sprintf(`{"targetArtifact":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":%q,"size":528}}`, digest))
+}
+
+// notationTestHeaders returns the protected headers of a notation signature
+// signed with ES256 at 2021-08-01, expiring at `expiry`.
+func notationTestHeaders(expiry time.Time) []cborPair {
+	return []cborPair{
+		{coseHeaderAlg, -7},
+		{coseHeaderCrit, []interface{}{notarySigningScheme, notaryExpiry}},
+		{3, "application/vnd.cncf.notary.payload.v1+json"},
+		{notarySigningScheme, "notary.x509"},
+		{notarySigningTime, cborTag{number: coseEpochTimeTag, content: 1627776000}},
+		{notaryExpiry, cborTag{number: coseEpochTimeTag, content: int(expiry.Unix())}},
+	}
+}
+
+// signCoseSign1 returns a tagged COSE_Sign1 message signing `payload` under
+// `protected` with the EC test key. If `detached` is set, the payload is
+// not embedded.
+func signCoseSign1(t *testing.T, protected []byte, payload []byte, detached bool) []byte {
+	t.Helper()
+	key, err := parsePkixPrivateKeyPem([]byte(ec256PrivateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	msg := &coseSign1{protected: protected}
+	der, err := ecSign(key.(*ecdsa.PrivateKey), msg.sigStructure(payload), EcdsaP256Sha256)
+	if err != nil {
+		t.Fatalf("error creating ecdsa signature: %v", err)
+	}
+	var sigStruct struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &sigStruct); err != nil {
+		t.Fatalf("error decoding ecdsa signature: %v", err)
+	}
+	signature := make([]byte, 64)
+	sigStruct.R.FillBytes(signature[:32])
+	sigStruct.S.FillBytes(signature[32:])
+	var embedded interface{} = payload
+	if detached {
+		embedded = nil
+	}
+	return testCbor(t, cborTag{number: coseSign1Tag, content: []interface{}{protected, []cborPair{}, embedded, signature}})
+}
+
+func TestVerifyAttestationCoseSign1(t *testing.T) {
+	now := time.Date(2021, 8, 2, 0, 0, 0, 0, time.UTC)
+	expiry := now.Add(24 * time.Hour)
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "notation-key"}
+	payload := notationTestPayload(helloAppDigest)
+	protected := testCbor(t, notationTestHeaders(expiry))
+	message := signCoseSign1(t, protected, payload, false)
+
+	withKid := testCbor(t, append(notationTestHeaders(expiry), cborPair{coseHeaderKid, []byte("notation-key")}))
+	// The same headers with a later expiry, keeping the original signature.
+	tamperedProtected := testCbor(t, notationTestHeaders(expiry.Add(365*24*time.Hour)))
+	tampered := bytes.Replace(message, protected, tamperedProtected, 1)
+	untagged := testCbor(t, []interface{}{protected, []cborPair{}, payload, message[len(message)-64:]})
+	es384 := notationTestHeaders(expiry)
+	es384[0] = cborPair{coseHeaderAlg, -35}
+	unknownCrit := notationTestHeaders(expiry)
+	unknownCrit[1] = cborPair{coseHeaderCrit, []interface{}{"io.cncf.notary.verificationPlugin"}}
+	unknownCrit = append(unknownCrit, cborPair{"io.cncf.notary.verificationPlugin", "plugin"})
+
+	tcs := []struct {
+		name              string
+		keyID             string
+		signature         []byte
+		detached          bool
+		serializedPayload []byte
+		expectedErr       error
+	}{
+		{
+			name:      "valid notation signature",
+			keyID:     "notation-key",
+			signature: message,
+		},
+		{
+			name:      "untagged COSE_Sign1",
+			keyID:     "notation-key",
+			signature: untagged,
+		},
+		{
+			name:      "key named by kid header",
+			signature: signCoseSign1(t, withKid, payload, false),
+		},
+		{
+			name:              "detached payload",
+			keyID:             "notation-key",
+			signature:         signCoseSign1(t, protected, payload, true),
+			detached:          true,
+			serializedPayload: payload,
+		},
+		{
+			name:        "tampered protected header",
+			keyID:       "notation-key",
+			signature:   tampered,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "subject digest of another image",
+			keyID:       "notation-key",
+			signature:   signCoseSign1(t, protected, notationTestPayload("sha256:"+strings.Repeat("0", 64)), false),
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "expired signature",
+			keyID:       "notation-key",
+			signature:   signCoseSign1(t, testCbor(t, notationTestHeaders(now.Add(-time.Hour))), payload, false),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "algorithm does not match key",
+			keyID:       "notation-key",
+			signature:   signCoseSign1(t, testCbor(t, es384), payload, false),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unsupported critical header",
+			keyID:       "notation-key",
+			signature:   signCoseSign1(t, testCbor(t, unknownCrit), payload, false),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			// Labels that cannot be map keys must not crash the verifier.
+			name:        "byte string critical header label",
+			keyID:       "notation-key",
+			signature:   coseByteStringCritLabel,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "array critical header label",
+			keyID:       "notation-key",
+			signature:   signCoseSign1(t, testCbor(t, []cborPair{{coseHeaderAlg, -7}, {coseHeaderCrit, []interface{}{[]interface{}{}}}}), payload, false),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unknown key",
+			keyID:       "other-key",
+			signature:   message,
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "not a COSE_Sign1",
+			keyID:       "notation-key",
+			signature:   testCbor(t, cborTag{number: 98, content: []interface{}{}}),
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithClock(ClockFunc(func() time.Time { return now })))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{
+				PublicKeyID:       tc.keyID,
+				Signature:         tc.signature,
+				EnvelopeType:      CoseSign1,
+				DetachedSignature: tc.detached,
+				SerializedPayload: tc.serializedPayload,
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationCoseSign1Ed25519(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	payload := notationTestPayload(helloAppDigest)
+	protected := testCbor(t, []cborPair{{coseHeaderAlg, -8}})
+	msg := &coseSign1{protected: protected}
+	signature := ed25519.Sign(ed25519PrivateKey, msg.sigStructure(payload))
+	att := &Attestation{
+		PublicKeyID:  "ed25519-key",
+		Signature:    testCbor(t, []interface{}{protected, []cborPair{}, payload, signature}),
+		EnvelopeType: CoseSign1,
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+}
+
+func TestCborDecoder(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x81}, cborMaxDepth+1)
+	tcs := []struct {
+		name        string
+		data        []byte
+		expected    interface{}
+		expectedErr bool
+	}{
+		{name: "unsigned integer", data: []byte{0x19, 0x01, 0xf4}, expected: int64(500)},
+		{name: "negative integer", data: []byte{0x38, 0x22}, expected: int64(-35)},
+		{name: "text string", data: []byte{0x62, 'o', 'k'}, expected: "ok"},
+		{name: "null", data: []byte{0xf6}, expected: nil},
+		{name: "truncated string", data: []byte{0x45, 0x01}, expectedErr: true},
+		{name: "truncated argument", data: []byte{0x1a, 0x01}, expectedErr: true},
+		{name: "huge array length", data: []byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, expectedErr: true},
+		{name: "indefinite length", data: []byte{0x9f, 0x01, 0xff}, expectedErr: true},
+		{name: "floating point", data: []byte{0xf9, 0x3c, 0x00}, expectedErr: true},
+		{name: "duplicate map key", data: []byte{0xa2, 0x01, 0x01, 0x01, 0x02}, expectedErr: true},
+		{name: "byte string map key", data: []byte{0xa1, 0x41, 0x00, 0x01}, expectedErr: true},
+		{name: "too deeply nested", data: append(nested, 0x80), expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &cborDecoder{data: tc.data}
+			got, err := d.decode(0)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("decode(%x) = %v, expected error", tc.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decode(%x) = %v, expected nil", tc.data, err)
+			}
+			if got != tc.expected {
+				t.Errorf("decode(%x) = %v, expected %v", tc.data, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestConvertNotationPayload(t *testing.T) {
+	authAtt, err := convertNotationPayload(notationTestPayload(helloAppDigest))
+	if err != nil {
+		t.Fatalf("convertNotationPayload(_) = %v, expected nil", err)
+	}
+	if authAtt.ImageDigest != helloAppDigest || authAtt.ImageName != "" {
+		t.Errorf("convertNotationPayload(_) = %+v, expected digest %q and no image name", authAtt, helloAppDigest)
+	}
+	if _, err := convertNotationPayload([]byte(`{"targetArtifact":{}}`)); err == nil {
+		t.Errorf("convertNotationPayload(_) = nil, expected error for a payload without digest")
+	}
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// cosignContainerSigType is the value of critical.type in a cosign simple
+// signing payload.
+const cosignContainerSigType = "cosign container image signature"
+
+// cosignSimpleSigning is the simple signing payload that cosign signs for a
+// container image, see
+// https://github.com/sigstore/cosign/blob/main/specs/SIGNATURE_SPEC.md. It
+// shares the critical section of the Atomic Host signature format, but its
+// optional section holds arbitrary annotations.
+type cosignSimpleSigning struct {
+	Critical critical               `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// convertCosignPayload parses a verified cosign simple signing payload into
+// an AuthenticatedAttestation. The payload must be of the cosign type and
+// contain an image digest.
+func convertCosignPayload(payload []byte) (*AuthenticatedAttestation, error) {
+	sig := &cosignSimpleSigning{}
+	if err := json.Unmarshal(payload, sig); err != nil {
+		return nil, errors.Wrap(err, "error parsing cosign payload")
+	}
+	if sig.Critical.Type != cosignContainerSigType {
+		return nil, errors.Errorf("cosign payload has critical.type %q, expected %q", sig.Critical.Type, cosignContainerSigType)
+	}
+	if sig.Critical.Image.Digest == "" {
+		return nil, errors.New("cosign payload is missing critical.image.docker-manifest-digest")
+	}
+	if sig.Critical.Identity.DockerRef == "" {
+		return nil, errors.New("cosign payload is missing critical.identity.docker-reference")
+	}
+	return &AuthenticatedAttestation{
+		ImageName:   sig.Critical.Identity.DockerRef,
+		ImageDigest: sig.Critical.Image.Digest,
+	}, nil
+}
+
+// isCosignPayload reports whether `payload` declares itself a cosign simple
+// signing payload.
+func isCosignPayload(payload []byte) bool {
+	var sig struct {
+		Critical struct {
+			Type string `json:"type"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &sig); err != nil {
+		return false
+	}
+	return sig.Critical.Type == cosignContainerSigType
+}
+
+// convertCosignCompatiblePayload parses a verified payload, which is either a
+// cosign simple signing payload, an in-toto Statement or an Atomic Host
+// signature, into an AuthenticatedAttestation.
+func convertCosignCompatiblePayload(payload []byte) (*AuthenticatedAttestation, error) {
+	if isCosignPayload(payload) {
+		return convertCosignPayload(payload)
+	}
+	return convertPayload(payload)
+}
+
+// decodeCosignSignature returns the raw signature of a cosign signature,
+// which cosign stores base64 encoded. Signatures that are not valid base64
+// are returned as is, so that raw signatures keep verifying.
+func decodeCosignSignature(signature []byte) []byte {
+	trimmed := bytes.TrimSpace(signature)
+	decoded := make([]byte, base64.StdEncoding.DecodedLen(len(trimmed)))
+	n, err := base64.StdEncoding.Decode(decoded, trimmed)
+	if err != nil || n == 0 {
+		return signature
+	}
+	return decoded[:n]
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// cosignPayload is a simple signing payload as serialized by `cosign sign`
+// for helloAppImage, with the annotations git-sha and ref.
+const cosignPayload = `{"critical":{"identity":{"docker-reference":"gcr.io/google-samples/hello-app"},"image":{"docker-manifest-digest":"sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"},"type":"cosign container image signature"},"optional":{"git-sha":"5e1b4c6","ref":"v1.0"}}`
+
+// cosignSignature is the base64 encoded signature of cosignPayload by
+// ec256PrivateKey, as stored by cosign.
+const cosignSignature = "MEYCIQDKpHIXXNLOZarZWo+nqed6e/oAENUxoinU2+WbPR73zwIhAIGMBUoY7FfrkfyXHtYn9p6F/HQrz2zevMWEqpp/nTrD"
+
+func TestConvertCosignPayload(t *testing.T) {
+	tcs := []struct {
+		name           string
+		payload        string
+		expectedDigest string
+		expectedErr    bool
+	}{
+		{
+			name:           "cosign payload",
+			payload:        cosignPayload,
+			expectedDigest: helloAppDigest,
+		},
+		{
+			name:           "no annotations",
+			payload:        `{"critical":{"identity":{"docker-reference":"gcr.io/google-samples/hello-app"},"image":{"docker-manifest-digest":"` + helloAppDigest + `"},"type":"cosign container image signature"},"optional":null}`,
+			expectedDigest: helloAppDigest,
+		},
+		{
+			name:        "atomic payload",
+			payload:     validPayload,
+			expectedErr: true,
+		},
+		{
+			name:        "missing digest",
+			payload:     `{"critical":{"identity":{"docker-reference":"gcr.io/google-samples/hello-app"},"image":{},"type":"cosign container image signature"}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "missing docker reference",
+			payload:     `{"critical":{"identity":{},"image":{"docker-manifest-digest":"` + helloAppDigest + `"},"type":"cosign container image signature"}}`,
+			expectedErr: true,
+		},
+		{
+			name:        "invalid json",
+			payload:     invalidPayload,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			authAtt, err := CosignPayloadParser.Parse([]byte(tc.payload))
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("Parse(_) = %v, expected error", authAtt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(_) = %v, expected nil", err)
+			}
+			if authAtt.ImageDigest != tc.expectedDigest {
+				t.Errorf("ImageDigest = %q, expected %q", authAtt.ImageDigest, tc.expectedDigest)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationCosignCompatibility(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "cosign-key"}
+	rawSignature, err := base64.StdEncoding.DecodeString(cosignSignature)
+	if err != nil {
+		t.Fatalf("error decoding signature: %v", err)
+	}
+	tamperedPayload := strings.Replace(cosignPayload, `"ref":"v1.0"`, `"ref":"v9.9"`, 1)
+	tcs := []struct {
+		name        string
+		opts        []VerifierOption
+		signature   []byte
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:      "base64 signature",
+			opts:      []VerifierOption{WithCosignCompatibility()},
+			signature: []byte(cosignSignature),
+			payload:   cosignPayload,
+		},
+		{
+			name:      "base64 signature with trailing newline",
+			opts:      []VerifierOption{WithCosignCompatibility()},
+			signature: []byte(cosignSignature + "\n"),
+			payload:   cosignPayload,
+		},
+		{
+			name:      "raw signature",
+			opts:      []VerifierOption{WithCosignCompatibility()},
+			signature: rawSignature,
+			payload:   cosignPayload,
+		},
+		{
+			name:        "tampered payload",
+			opts:        []VerifierOption{WithCosignCompatibility()},
+			signature:   []byte(cosignSignature),
+			payload:     tamperedPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "base64 signature without cosign compatibility",
+			signature:   []byte(cosignSignature),
+			payload:     cosignPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:      "cosign payload parser without cosign compatibility",
+			opts:      []VerifierOption{WithPayloadParser(CosignPayloadParser)},
+			signature: rawSignature,
+			payload:   cosignPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "cosign-key", Signature: tc.signature, SerializedPayload: []byte(tc.payload)}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationCosignOtherImage(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "cosign-key"}
+	otherImage := "gcr.io/google-samples/hello-app@" + otherHelloAppDigest
+	v, err := NewVerifier(otherImage, []PublicKey{publicKey}, WithCosignCompatibility())
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "cosign-key", Signature: []byte(cosignSignature), SerializedPayload: []byte(cosignPayload)}
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrPayloadMismatch)
+	}
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+)
+
+// DigestResolver resolves an image tag to the digest it points to, e.g. with
+// a registry client.
+type DigestResolver interface {
+	// ResolveDigest returns the digest, of the form "<algorithm>:<hex>", of
+	// the image `tag`, which is of the form <repository>:<tag>.
+	ResolveDigest(ctx context.Context, tag string) (string, error)
+}
+
+// resolveImageTag resolves the image tag of `authAtt` to a digest with the
+// verifier's DigestResolver.
+func (v *verifier) resolveImageTag(ctx context.Context, authAtt *AuthenticatedAttestation) (string, error) {
+	tag := authAtt.ImageName + ":" + authAtt.ImageTag
+	var digest string
+	err := callBackend(ctx, func(ctx context.Context) error {
+		var err error
+		digest, err = v.digestResolver.ResolveDigest(ctx, tag)
+		return err
+	})
+	if err != nil {
+		if isContextError(err) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %q: %v", ErrDigestResolutionFailed, tag, err)
+	}
+	if _, err := parseDigest(digest); err != nil {
+		return "", fmt.Errorf("%w: %q resolved to an invalid digest: %v", ErrDigestResolutionFailed, tag, err)
+	}
+	return digest, nil
+}
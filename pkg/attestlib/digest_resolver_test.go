@@ -0,0 +1,141 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakeDigestResolver resolves the tags in `digests`, and fails for others.
+type fakeDigestResolver struct {
+	digests map[string]string
+	tags    []string
+}
+
+func (r *fakeDigestResolver) ResolveDigest(ctx context.Context, tag string) (string, error) {
+	r.tags = append(r.tags, tag)
+	digest, ok := r.digests[tag]
+	if !ok {
+		return "", fmt.Errorf("manifest unknown: %s", tag)
+	}
+	return digest, nil
+}
+
+// taggedPayload returns an Atomic Host signature payload that references the
+// image `dockerRef` without a digest.
+func taggedPayload(dockerRef string) string {
+	return fmt.Sprintf(`{"critical": {"identity": {"docker-reference": %q}, "image": {}, "type": "Google cloud binauthz container signature"}}`, dockerRef)
+}
+
+func TestVerifyAttestationDigestResolver(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	resolver := &fakeDigestResolver{digests: map[string]string{
+		"gcr.io/google-samples/hello-app:1.0": helloAppDigest,
+		"gcr.io/google-samples/hello-app:2.0": otherHelloAppDigest,
+		"gcr.io/google-samples/hello-app:bad": "sha256:1234",
+		"gcr.io/google-samples/other-app:1.0": helloAppDigest,
+	}}
+	tcs := []struct {
+		name        string
+		payload     string
+		resolver    DigestResolver
+		expectedErr error
+		expectedTag string
+	}{
+		{
+			name:        "tag resolves to image digest",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app:1.0"),
+			resolver:    resolver,
+			expectedTag: "gcr.io/google-samples/hello-app:1.0",
+		},
+		{
+			name:        "tag resolves to other digest",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app:2.0"),
+			resolver:    resolver,
+			expectedErr: ErrPayloadMismatch,
+			expectedTag: "gcr.io/google-samples/hello-app:2.0",
+		},
+		{
+			name:        "tag of other image",
+			payload:     taggedPayload("gcr.io/google-samples/other-app:1.0"),
+			resolver:    resolver,
+			expectedErr: ErrPayloadMismatch,
+			expectedTag: "gcr.io/google-samples/other-app:1.0",
+		},
+		{
+			name:        "unknown tag",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app:3.0"),
+			resolver:    resolver,
+			expectedErr: ErrDigestResolutionFailed,
+			expectedTag: "gcr.io/google-samples/hello-app:3.0",
+		},
+		{
+			name:        "tag resolves to invalid digest",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app:bad"),
+			resolver:    resolver,
+			expectedErr: ErrDigestResolutionFailed,
+			expectedTag: "gcr.io/google-samples/hello-app:bad",
+		},
+		{
+			name:     "payload with digest is not resolved",
+			payload:  validPayload,
+			resolver: resolver,
+		},
+		{
+			name:        "tag without resolver",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app:1.0"),
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "reference without tag or digest",
+			payload:     taggedPayload("gcr.io/google-samples/hello-app"),
+			resolver:    resolver,
+			expectedErr: ErrInvalidPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver.tags = nil
+			opts := []VerifierOption{}
+			if tc.resolver != nil {
+				opts = append(opts, WithDigestResolver(tc.resolver))
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if tc.expectedTag == "" && len(resolver.tags) != 0 {
+				t.Errorf("resolved %v, expected no resolution", resolver.tags)
+			}
+			if tc.expectedTag != "" && (len(resolver.tags) != 1 || resolver.tags[0] != tc.expectedTag) {
+				t.Errorf("resolved %v, expected [%s]", resolver.tags, tc.expectedTag)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// InTotoPayloadType is the DSSE payloadType of in-toto Statements, e.g. the
+// SLSA provenance emitted by Tekton Chains.
+const InTotoPayloadType = "application/vnd.in-toto+json"
+
+// dsseEnvelope is the JSON encoding of a DSSE envelope, defined here:
+// https://github.com/secure-systems-lab/dsse/blob/master/envelope.md
+type dsseEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"`
+	Signatures  []dsseSignature `json:"signatures"`
+}
+
+type dsseSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// dssePae returns the DSSE pre-authentication encoding of a payload, which is
+// the message each signature in the envelope is computed over.
+func dssePae(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// decodeDsseBase64 decodes a base64 field of a DSSE envelope. The
+// specification requires standard encoding, but URL-safe encoding is accepted
+// as well, with or without padding.
+func decodeDsseBase64(s string) ([]byte, error) {
+	if strings.ContainsAny(s, "-_") {
+		return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	}
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// verifyDsse verifies an Attestation whose Signature is a DSSE envelope and
+// returns the payload stored in the envelope, its payloadType and the first
+// public key that verified one of its signatures. At least one of the
+// envelope's signatures must be verified by the public key matching its
+// keyid. Signatures without a keyid are matched against `att.PublicKeyID`.
+// With strict key ID matching, signatures whose keyid is empty or unknown are
+// rejected, and with key identity matching, so are signatures whose keyid does
+// not identify the key that verified them. The payload of an envelope with InTotoPayloadType must be an
+// in-toto Statement.
+func (v *verifier) verifyDsse(ctx context.Context, att *Attestation) ([]byte, string, PublicKey, error) {
+	envelope := dsseEnvelope{}
+	if err := json.Unmarshal(att.Signature, &envelope); err != nil {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: error parsing DSSE envelope: %v", ErrSignatureInvalid, err)
+	}
+	payload, err := decodeDsseBase64(envelope.Payload)
+	if err != nil {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: error decoding DSSE payload: %v", ErrSignatureInvalid, err)
+	}
+	if len(envelope.Signatures) == 0 {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: DSSE envelope contains no signatures", ErrSignatureInvalid)
+	}
+
+	pae := dssePae(envelope.PayloadType, payload)
+	var failures []string
+	keyFound := false
+	revoked := false
+	misidentified := false
+	for _, signature := range envelope.Signatures {
+		if err := ctx.Err(); err != nil {
+			return nil, "", PublicKey{}, err
+		}
+		keyID := signature.KeyID
+		if keyID == "" {
+			keyID = att.PublicKeyID
+		}
+		if v.strictKeyIDMatching && keyID == "" {
+			failures = append(failures, "signature has no key ID")
+			continue
+		}
+		publicKeys := v.publicKeysByID(keyID)
+		if len(publicKeys) == 0 {
+			failures = append(failures, fmt.Sprintf("key %q: no public key with matching ID found", keyID))
+			continue
+		}
+		keyFound = true
+		for _, publicKey := range publicKeys {
+			if err := v.checkRevoked(publicKey); err != nil {
+				failures = append(failures, fmt.Sprintf("key %q: %v", keyID, err))
+				revoked = true
+				continue
+			}
+			if err := v.checkAlgorithm(att, publicKey); err != nil {
+				failures = append(failures, fmt.Sprintf("key %q: %v", keyID, err))
+				continue
+			}
+			err := traceSignature(ctx, publicKey, func(ctx context.Context) error {
+				return v.verifyDsseSignature(ctx, signature, publicKey, pae)
+			})
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("key %q: %v", keyID, err))
+				continue
+			}
+			if err := v.checkKeyIdentity(keyID, publicKey); err != nil {
+				failures = append(failures, err.Error())
+				misidentified = true
+				continue
+			}
+			if envelope.PayloadType == InTotoPayloadType && !isInTotoStatement(payload) {
+				return nil, "", PublicKey{}, fmt.Errorf("%w: DSSE payloadType is %q, but the payload is not an in-toto Statement", ErrInvalidPayload, InTotoPayloadType)
+			}
+			return payload, envelope.PayloadType, publicKey, nil
+		}
+	}
+	if !keyFound && v.strictKeyIDMatching {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: %s", ErrKeyIDMismatch, strings.Join(failures, "; "))
+	}
+	if !keyFound {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: %s", ErrNoMatchingKey, strings.Join(failures, "; "))
+	}
+	if misidentified {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: no DSSE signature was verified by the key its key ID names: %s", ErrKeyMismatch, strings.Join(failures, "; "))
+	}
+	if revoked {
+		return nil, "", PublicKey{}, fmt.Errorf("%w: no DSSE signature by a non-revoked key could be verified: %s", ErrKeyRevoked, strings.Join(failures, "; "))
+	}
+	return nil, "", PublicKey{}, fmt.Errorf("%w: no DSSE signature could be verified: %s", ErrSignatureInvalid, strings.Join(failures, "; "))
+}
+
+func (v *verifier) verifyDsseSignature(ctx context.Context, signature dsseSignature, publicKey PublicKey, pae []byte) error {
+	sig, err := decodeDsseBase64(signature.Sig)
+	if err != nil {
+		return errors.Wrap(err, "error decoding signature")
+	}
+	switch publicKey.AuthenticatorType {
+	case Pkix:
+		if err := v.checkCertificateChain(publicKey); err != nil {
+			return err
+		}
+		return v.verifyPkix(sig, pae, publicKey)
+	case Ed25519:
+		return v.verifyEd25519(sig, pae, publicKey)
+	case Ed448:
+		return verifyEd448(sig, pae, publicKey)
+	case Hmac:
+		return verifyHmac(sig, pae, publicKey)
+	case Kms:
+		if v.kmsVerifier == nil {
+			return errors.New("no Cloud KMS client is configured")
+		}
+		return v.verifyKms(ctx, sig, pae, publicKey)
+	case Vault:
+		if v.vaultVerifier == nil {
+			return errors.New("no Vault client is configured")
+		}
+		return v.verifyVault(ctx, sig, pae, publicKey)
+	default:
+		return errors.New("key type cannot verify DSSE signatures")
+	}
+}
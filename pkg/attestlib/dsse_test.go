@@ -0,0 +1,273 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const dssePayloadType = "application/vnd.dev.kritis.atomic+json"
+
+func TestDssePae(t *testing.T) {
+	// Example from the DSSE protocol specification.
+	got := string(dssePae("http://example.com/HelloWorld", []byte("hello world")))
+	want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got != want {
+		t.Errorf("dssePae(...) = %q, want %q", got, want)
+	}
+}
+
+// createDsseEnvelope signs `payload` with each of `signers` and returns the
+// JSON encoded envelope.
+func createDsseEnvelope(t *testing.T, payloadType string, payload []byte, signers map[string]ed25519.PrivateKey) []byte {
+	t.Helper()
+	envelope := dsseEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+	}
+	for keyID, privateKey := range signers {
+		sig := ed25519.Sign(privateKey, dssePae(payloadType, payload))
+		envelope.Signatures = append(envelope.Signatures, dsseSignature{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)})
+	}
+	serialized, err := json.Marshal(envelope)
+	if err != nil {
+		t.Fatalf("error marshaling envelope: %v", err)
+	}
+	return serialized
+}
+
+func TestVerifyDsseAttestation(t *testing.T) {
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	publicKey, err := NewPublicKey(Ed25519, EddsaEd25519, ed25519PubKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	pkixKey, err := NewPublicKey(Pkix, EcdsaP256Sha256, []byte(ec256PubKey), "ec-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "ec-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	ecAtt, err := signer.CreateAttestation(dssePae(dssePayloadType, []byte(validPayload)))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	ecEnvelope, err := json.Marshal(dsseEnvelope{
+		PayloadType: dssePayloadType,
+		Payload:     base64.StdEncoding.EncodeToString([]byte(validPayload)),
+		Signatures:  []dsseSignature{{KeyID: "ec-key", Sig: base64.RawURLEncoding.EncodeToString(ecAtt.Signature)}},
+	})
+	if err != nil {
+		t.Fatalf("error marshaling envelope: %v", err)
+	}
+
+	validEnvelope := createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"ed25519-key": ed25519PrivateKey})
+	tamperedEnvelope := dsseEnvelope{}
+	if err := json.Unmarshal(validEnvelope, &tamperedEnvelope); err != nil {
+		t.Fatalf("error unmarshaling envelope: %v", err)
+	}
+	tamperedEnvelope.PayloadType = InTotoPayloadType
+	tamperedType, _ := json.Marshal(tamperedEnvelope)
+	tamperedEnvelope.PayloadType = dssePayloadType
+	tamperedEnvelope.Payload = base64.StdEncoding.EncodeToString([]byte(missingDigestPayload))
+	tamperedPayload, _ := json.Marshal(tamperedEnvelope)
+
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		expectedErr bool
+	}{
+		{
+			name:        "valid envelope",
+			att:         &Attestation{Signature: validEnvelope, EnvelopeType: Dsse},
+			expectedErr: false,
+		},
+		{
+			name:        "valid envelope with PKIX signature",
+			att:         &Attestation{Signature: ecEnvelope, EnvelopeType: Dsse},
+			expectedErr: false,
+		},
+		{
+			name: "one of multiple signatures valid",
+			att: &Attestation{
+				Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{
+					"ed25519-key": ed25519PrivateKey,
+					"unknown-key": otherPrivateKey,
+				}),
+				EnvelopeType: Dsse,
+			},
+			expectedErr: false,
+		},
+		{
+			name:        "signature without keyid uses PublicKeyID",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"": ed25519PrivateKey}), EnvelopeType: Dsse},
+			expectedErr: false,
+		},
+		{
+			name:        "signature by wrong key",
+			att:         &Attestation{Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"ed25519-key": otherPrivateKey}), EnvelopeType: Dsse},
+			expectedErr: true,
+		},
+		{
+			name:        "tampered payload type",
+			att:         &Attestation{Signature: tamperedType, EnvelopeType: Dsse},
+			expectedErr: true,
+		},
+		{
+			name:        "tampered payload",
+			att:         &Attestation{Signature: tamperedPayload, EnvelopeType: Dsse},
+			expectedErr: true,
+		},
+		{
+			name:        "no signatures",
+			att:         &Attestation{Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), nil), EnvelopeType: Dsse},
+			expectedErr: true,
+		},
+		{
+			name:        "malformed envelope",
+			att:         &Attestation{Signature: []byte("not json"), EnvelopeType: Dsse},
+			expectedErr: true,
+		},
+		{
+			name:        "envelope as bare signature",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: validEnvelope, SerializedPayload: []byte(validPayload)},
+			expectedErr: true,
+		},
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey, *pkixKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.VerifyAttestation(tc.att)
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestation(_) got %v, wanted error? = %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// tektonChainsProvenance is a SLSA v0.2 provenance as emitted by Tekton Chains
+// for a TaskRun that built the hello-app image.
+const tektonChainsProvenance = `{
+    "_type": "https://in-toto.io/Statement/v0.1",
+    "predicateType": "https://slsa.dev/provenance/v0.2",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/hello-app",
+            "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+        }
+    ],
+    "predicate": {
+        "builder": {"id": "https://tekton.dev/chains/v2"},
+        "buildType": "tekton.dev/v1beta1/TaskRun",
+        "invocation": {
+            "configSource": {},
+            "parameters": {"IMAGE": "gcr.io/google-samples/hello-app"}
+        },
+        "buildConfig": {
+            "steps": [
+                {
+                    "entryPoint": "/kaniko/executor",
+                    "arguments": ["--dockerfile=Dockerfile", "--destination=gcr.io/google-samples/hello-app"],
+                    "environment": {"container": "build-and-push", "image": "gcr.io/kaniko-project/executor@sha256:0000000000000000000000000000000000000000000000000000000000000000"}
+                }
+            ]
+        },
+        "metadata": {
+            "buildStartedOn": "2022-01-01T00:00:00Z",
+            "buildFinishedOn": "2022-01-01T00:01:00Z",
+            "completeness": {"parameters": false, "environment": false, "materials": false},
+            "reproducible": false
+        },
+        "materials": [
+            {"uri": "git+https://github.com/GoogleCloudPlatform/kubernetes-engine-samples.git", "digest": {"sha1": "0000000000000000000000000000000000000000"}}
+        ]
+    }
+}`
+
+func TestVerifyDsseTektonChainsProvenance(t *testing.T) {
+	publicKey, err := NewPublicKey(Ed25519, EddsaEd25519, ed25519PubKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	signers := map[string]ed25519.PrivateKey{"ed25519-key": ed25519PrivateKey}
+
+	att := &Attestation{Signature: createDsseEnvelope(t, InTotoPayloadType, []byte(tektonChainsProvenance), signers), EnvelopeType: Dsse}
+	result, err := v.VerifyAttestationWithResult(att)
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.PayloadType != InTotoPayloadType {
+		t.Errorf("PayloadType = %q, expected %q", result.PayloadType, InTotoPayloadType)
+	}
+	if result.PredicateType != "https://slsa.dev/provenance/v0.2" {
+		t.Errorf("PredicateType = %q, expected %q", result.PredicateType, "https://slsa.dev/provenance/v0.2")
+	}
+	provenance := struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		BuildType string `json:"buildType"`
+	}{}
+	if err := result.UnmarshalPredicate(&provenance); err != nil {
+		t.Fatalf("UnmarshalPredicate(_) = %v, expected nil", err)
+	}
+	if provenance.Builder.ID != "https://tekton.dev/chains/v2" || provenance.BuildType != "tekton.dev/v1beta1/TaskRun" {
+		t.Errorf("UnmarshalPredicate(_) decoded builder %q and buildType %q", provenance.Builder.ID, provenance.BuildType)
+	}
+
+	tcs := []struct {
+		name        string
+		payloadType string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:        "in-toto payloadType with Atomic payload",
+			payloadType: InTotoPayloadType,
+			payload:     validPayload,
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "provenance for another image",
+			payloadType: InTotoPayloadType,
+			payload:     strings.Replace(tektonChainsProvenance, "bedb3feb", "00000000", 1),
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{Signature: createDsseEnvelope(t, tc.payloadType, []byte(tc.payload), signers), EnvelopeType: Dsse}
+			if err := v.VerifyAttestation(att); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+type ed25519VerifierImpl struct{}
+
+// verifyEd25519 verifies an Ed25519 signature over `payload`.
+// `publicKey.KeyData` is the raw 32 byte Ed25519 public key.
+func (v ed25519VerifierImpl) verifyEd25519(signature []byte, payload []byte, publicKey PublicKey) error {
+	key, err := ed25519Key(publicKey)
+	if err != nil {
+		return err
+	}
+	if len(signature) != ed25519.SignatureSize {
+		return fmt.Errorf("expected %d byte Ed25519 signature, got %d bytes", ed25519.SignatureSize, len(signature))
+	}
+	if !ed25519.Verify(key, payload, signature) {
+		return errors.New("failed to verify Ed25519 signature")
+	}
+	return nil
+}
+
+// parseEd25519PublicKey validates a raw Ed25519 public key.
+func parseEd25519PublicKey(keyData []byte) (ed25519.PublicKey, error) {
+	if len(keyData) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("expected %d byte Ed25519 public key, got %d bytes", ed25519.PublicKeySize, len(keyData))
+	}
+	return ed25519.PublicKey(keyData), nil
+}
+
+// ed25519Key returns the parsed form of an Ed25519 PublicKey, parsing
+// KeyData if the Verifier has not already done so.
+func ed25519Key(publicKey PublicKey) (ed25519.PublicKey, error) {
+	if key, ok := publicKey.parsedKey.(ed25519.PublicKey); ok {
+		return key, nil
+	}
+	return parseEd25519PublicKey(publicKey.KeyData)
+}
+
+type ed25519Signer struct {
+	privateKey  ed25519.PrivateKey
+	publicKeyID string
+}
+
+// NewEd25519Signer creates a Signer interface for Ed25519 Attestations.
+// `privateKey` contains either the raw 64 byte Ed25519 private key or its 32
+// byte seed. `publicKeyID` is the ID of the public key that can verify the
+// Attestation signature. If left empty, it is generated from the DER encoding
+// of the public key.
+func NewEd25519Signer(privateKey []byte, publicKeyID string) (Signer, error) {
+	var key ed25519.PrivateKey
+	switch len(privateKey) {
+	case ed25519.PrivateKeySize:
+		key = ed25519.PrivateKey(privateKey)
+	case ed25519.SeedSize:
+		key = ed25519.NewKeyFromSeed(privateKey)
+	default:
+		return nil, fmt.Errorf("expected %d byte Ed25519 private key or %d byte seed, got %d bytes", ed25519.PrivateKeySize, ed25519.SeedSize, len(privateKey))
+	}
+
+	if len(publicKeyID) == 0 {
+		id, err := generatePkixPublicKeyId(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "error generating public key id")
+		}
+		publicKeyID = id
+	}
+	return &ed25519Signer{
+		privateKey:  key,
+		publicKeyID: publicKeyID,
+	}, nil
+}
+
+// CreateAttestation creates a signed Ed25519 Attestation. See Signer for more
+// details.
+func (s *ed25519Signer) CreateAttestation(payload []byte) (*Attestation, error) {
+	return &Attestation{
+		PublicKeyID:        s.publicKeyID,
+		Signature:          ed25519.Sign(s.privateKey, payload),
+		SerializedPayload:  payload,
+		SignatureAlgorithm: EddsaEd25519,
+	}, nil
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"testing"
+)
+
+// The Ed25519 test keys are derived from fixed seeds so that signatures are
+// reproducible.
+var ed25519PrivateKey = ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-test-key-seed!"))
+var ed25519PubKey = ed25519PrivateKey.Public().(ed25519.PublicKey)
+var otherEd25519PubKey = ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed")).Public().(ed25519.PublicKey)
+
+func TestVerifyEd25519(t *testing.T) {
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(payload))
+	corruptedSignature := append([]byte{}, signature...)
+	corruptedSignature[0] ^= 0xff
+
+	tcs := []struct {
+		name          string
+		signature     []byte
+		payload       []byte
+		publicKey     []byte
+		expectedError bool
+	}{
+		{
+			name:          "valid signature",
+			signature:     signature,
+			payload:       []byte(payload),
+			publicKey:     ed25519PubKey,
+			expectedError: false,
+		},
+		{
+			name:          "invalid signature",
+			signature:     corruptedSignature,
+			payload:       []byte(payload),
+			publicKey:     ed25519PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "truncated signature",
+			signature:     signature[:ed25519.SignatureSize-1],
+			payload:       []byte(payload),
+			publicKey:     ed25519PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "tampered payload",
+			signature:     signature,
+			payload:       []byte("tampered payload"),
+			publicKey:     ed25519PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "signed by another key",
+			signature:     signature,
+			payload:       []byte(payload),
+			publicKey:     otherEd25519PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "corrupted key",
+			signature:     signature,
+			payload:       []byte(payload),
+			publicKey:     ed25519PubKey[:ed25519.PublicKeySize-1],
+			expectedError: true,
+		},
+		{
+			name:          "PEM encoded key",
+			signature:     signature,
+			payload:       []byte(payload),
+			publicKey:     []byte(ec256PubKey),
+			expectedError: true,
+		},
+	}
+	v := ed25519VerifierImpl{}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.verifyEd25519(tc.signature, tc.payload, PublicKey{AuthenticatorType: Ed25519, KeyData: tc.publicKey})
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("verifyEd25519(...) = nil, expected non nil")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("verifyEd25519(...) = %v, expected nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEd25519Attestation(t *testing.T) {
+	publicKey, err := NewPublicKey(Ed25519, EddsaEd25519, ed25519PubKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{
+		PublicKeyID:       "ed25519-key",
+		Signature:         ed25519.Sign(ed25519PrivateKey, []byte(validPayload)),
+		SerializedPayload: []byte(validPayload),
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	att.SerializedPayload = []byte(missingDigestPayload)
+	if err := v.VerifyAttestation(att); err == nil {
+		t.Errorf("VerifyAttestation(_) = nil for tampered payload, expected non nil")
+	}
+}
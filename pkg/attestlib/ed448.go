@@ -0,0 +1,74 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+
+	"github.com/cloudflare/circl/ecc/goldilocks"
+	"github.com/cloudflare/circl/sign/ed448"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ed448PublicKeySize is the size of an encoded Ed448 public key.
+	ed448PublicKeySize = ed448.PublicKeySize
+	// ed448SignatureSize is the size of an Ed448 signature.
+	ed448SignatureSize = ed448.SignatureSize
+)
+
+// parseEd448PublicKey validates a raw Ed448 public key, which must encode a
+// point on the curve, see RFC 8032, section 5.2.3.
+func parseEd448PublicKey(keyData []byte) (ed448.PublicKey, error) {
+	if len(keyData) != ed448PublicKeySize {
+		return nil, fmt.Errorf("expected %d byte Ed448 public key, got %d bytes", ed448PublicKeySize, len(keyData))
+	}
+	// Only the top bit of the last byte, the sign of x, may be set.
+	if keyData[ed448PublicKeySize-1]&0x7f != 0 {
+		return nil, errors.New("invalid Ed448 public key: unused bits set")
+	}
+	if _, err := goldilocks.FromBytes(keyData); err != nil {
+		return nil, errors.Wrap(err, "invalid Ed448 public key")
+	}
+	return ed448.PublicKey(append([]byte(nil), keyData...)), nil
+}
+
+// ed448Key returns the parsed form of an Ed448 PublicKey, parsing KeyData if
+// the Verifier has not already done so.
+func ed448Key(publicKey PublicKey) (ed448.PublicKey, error) {
+	if key, ok := publicKey.parsedKey.(ed448.PublicKey); ok {
+		return key, nil
+	}
+	return parseEd448PublicKey(publicKey.KeyData)
+}
+
+// verifyEd448 verifies a pure Ed448 signature without a context over
+// `payload`, as specified in RFC 8032, section 5.2.7. `publicKey.KeyData` is
+// the raw 57 byte Ed448 public key.
+func verifyEd448(signature []byte, payload []byte, publicKey PublicKey) error {
+	key, err := ed448Key(publicKey)
+	if err != nil {
+		return err
+	}
+	if len(signature) != ed448SignatureSize {
+		return fmt.Errorf("expected %d byte Ed448 signature, got %d bytes", ed448SignatureSize, len(signature))
+	}
+	if !ed448.Verify(key, payload, signature, "") {
+		return errors.New("failed to verify Ed448 signature")
+	}
+	return nil
+}
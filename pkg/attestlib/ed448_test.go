@@ -0,0 +1,179 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// The Ed448 test keys and signatures were created with OpenSSL:
+// `openssl genpkey -algorithm ed448 -out ed448.pem` and
+// `openssl pkeyutl -sign -inkey ed448.pem -rawin -in validPayload`.
+var (
+	ed448PubKey         = mustDecodeHex("3264be6382a68e16ed014367b28325b2a5be867b3c34eba51005b7a937e185f603fc2bfe70f326b04b8f3046618d8abb15f7bc46eb1269f900")
+	ed448Signature      = mustDecodeHex("93487952a6c38bbcc591f1d5928071823b7c141028e592f500e757f6daf2aae1b43304b995107e4ead130b5faf953aa285aaa7e0075105a9000db75ee73882be0dab175c20799f5a6fb65de7530451e2f1e63f94ce5c9e7a21d868dfca88ecd4e08c5d336b56997b39de635825ecf2ef1100")
+	otherEd448PubKey    = mustDecodeHex("0fab6f1236151719fb3a40827c34e3a12fbc56d0c94df596d9ccc4dbd2f81486218d305fb925871d9d717ee82e9d75a76abe6559bc76713900")
+	otherEd448Signature = mustDecodeHex("338c30e1d5c52f202831a794f5940e5257f188d25b4e2c87565c5466b41e3d99f67076db0d0a4fb4518faf9b25f418d59b7acafef5739e168054300c9f157f3943ff9cffa024716a5b9646707ede623103eed514d1843c5a463514ea4c4e163bc293226e3604e940ddeb197b06e0d9f81700")
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestVerifyEd448(t *testing.T) {
+	corruptedSignature := append([]byte{}, ed448Signature...)
+	corruptedSignature[0] ^= 0xff
+	// S must be smaller than the order of the base point.
+	largeScalarSignature := append([]byte{}, ed448Signature...)
+	for i := ed448PublicKeySize; i < ed448SignatureSize-1; i++ {
+		largeScalarSignature[i] = 0xff
+	}
+
+	tcs := []struct {
+		name          string
+		signature     []byte
+		payload       []byte
+		publicKey     []byte
+		expectedError bool
+	}{
+		{
+			name:      "valid signature",
+			signature: ed448Signature,
+			payload:   []byte(validPayload),
+			publicKey: ed448PubKey,
+		},
+		{
+			name:      "valid signature by another key",
+			signature: otherEd448Signature,
+			payload:   []byte(validPayload),
+			publicKey: otherEd448PubKey,
+		},
+		{
+			name:          "invalid signature",
+			signature:     corruptedSignature,
+			payload:       []byte(validPayload),
+			publicKey:     ed448PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "scalar out of range",
+			signature:     largeScalarSignature,
+			payload:       []byte(validPayload),
+			publicKey:     ed448PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "truncated signature",
+			signature:     ed448Signature[:ed448SignatureSize-1],
+			payload:       []byte(validPayload),
+			publicKey:     ed448PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "tampered payload",
+			signature:     ed448Signature,
+			payload:       []byte(missingDigestPayload),
+			publicKey:     ed448PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "signed by another key",
+			signature:     otherEd448Signature,
+			payload:       []byte(validPayload),
+			publicKey:     ed448PubKey,
+			expectedError: true,
+		},
+		{
+			name:          "Ed25519 key",
+			signature:     ed448Signature,
+			payload:       []byte(validPayload),
+			publicKey:     ed25519PubKey,
+			expectedError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyEd448(tc.signature, tc.payload, PublicKey{AuthenticatorType: Ed448, KeyData: tc.publicKey})
+			if tc.expectedError {
+				if err == nil {
+					t.Errorf("verifyEd448(...) = nil, expected non nil")
+				}
+			} else {
+				if err != nil {
+					t.Errorf("verifyEd448(...) = %v, expected nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyEd448Attestation(t *testing.T) {
+	publicKey, err := NewPublicKey(Ed448, EddsaEd448, ed448PubKey, "ed448-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{
+		PublicKeyID:       "ed448-key",
+		Signature:         ed448Signature,
+		SerializedPayload: []byte(validPayload),
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	att.Signature = otherEd448Signature
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("VerifyAttestation(_) = %v for a signature by another key, want error matching %v", err, ErrSignatureInvalid)
+	}
+}
+
+func TestNewVerifierMalformedEd448Key(t *testing.T) {
+	unusedBitsKey := append([]byte{}, ed448PubKey...)
+	unusedBitsKey[ed448PublicKeySize-1] |= 0x01
+	// y = 2 is not the y coordinate of a point on the curve.
+	offCurveKey := make([]byte, ed448PublicKeySize)
+	offCurveKey[0] = 2
+
+	tcs := []struct {
+		name      string
+		keyData   []byte
+		algorithm SignatureAlgorithm
+	}{
+		{"truncated key", ed448PubKey[:ed448PublicKeySize-1], EddsaEd448},
+		{"Ed25519 key", ed25519PubKey, EddsaEd448},
+		{"unused bits set", unusedBitsKey, EddsaEd448},
+		{"point not on the curve", offCurveKey, EddsaEd448},
+		{"Ed25519 signature algorithm", ed448PubKey, EddsaEd25519},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey := PublicKey{AuthenticatorType: Ed448, SignatureAlgorithm: tc.algorithm, KeyData: tc.keyData, ID: "ed448-key"}
+			if _, err := NewVerifier(helloAppImage, []PublicKey{publicKey}); !errors.Is(err, ErrInvalidPublicKey) {
+				t.Errorf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+			}
+		})
+	}
+}
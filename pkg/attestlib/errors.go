@@ -0,0 +1,248 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors returned by VerifyAttestation. Callers should test for them with
+// errors.Is, since they are usually wrapped with more details.
+var (
+	// ErrNoMatchingKey indicates that none of the verifier's public keys
+	// matches the Attestation.
+	ErrNoMatchingKey = errors.New("no matching public key")
+	// ErrSignatureInvalid indicates that the Attestation's signature could not
+	// be verified by the matching public key.
+	ErrSignatureInvalid = errors.New("invalid signature")
+	// ErrInvalidPayload indicates that the verified payload could not be
+	// parsed.
+	ErrInvalidPayload = errors.New("invalid attestation payload")
+	// ErrPayloadMismatch indicates that the verified payload does not describe
+	// the image being verified. Digest mismatches are reported as a
+	// *DigestMismatchError, or a *DigestAlgorithmMismatchError if the digests
+	// use different algorithms; both match ErrPayloadMismatch.
+	ErrPayloadMismatch = errors.New("attestation payload does not match image")
+	// ErrUnsupportedKeyType indicates that the matching public key has a type
+	// the verifier cannot handle.
+	ErrUnsupportedKeyType = errors.New("unsupported key type")
+	// ErrUnknownKeyType indicates that the matching public key has an
+	// AuthenticatorType the verifier does not know, usually because of a
+	// typo in its configuration. It matches ErrUnsupportedKeyType.
+	ErrUnknownKeyType = fmt.Errorf("%w: unknown", ErrUnsupportedKeyType)
+	// ErrKeyTypeNotImplemented indicates that the matching public key has a
+	// known AuthenticatorType that the verifier cannot verify as configured,
+	// e.g. a Kms key while no Cloud KMS client is configured. It matches
+	// ErrUnsupportedKeyType.
+	ErrKeyTypeNotImplemented = fmt.Errorf("%w: not implemented", ErrUnsupportedKeyType)
+	// ErrKeyNotValid indicates that the public key verified the Attestation's
+	// signature, but the verification time is outside the key's validity
+	// period.
+	ErrKeyNotValid = errors.New("public key is not valid at this time")
+	// ErrPgpKeyExpired indicates that the Attestation was signed by a PGP key
+	// or subkey that has expired.
+	ErrPgpKeyExpired = errors.New("PGP key has expired")
+	// ErrPgpSignatureExpired indicates that the Attestation's PGP signature
+	// carries an expiration time that has passed.
+	ErrPgpSignatureExpired = errors.New("PGP signature has expired")
+	// ErrCertificateNotTrusted indicates that a PKIX public key given as a
+	// certificate does not chain to a trusted root, has expired, or may not
+	// be used for digital signatures.
+	ErrCertificateNotTrusted = errors.New("certificate is not trusted")
+	// ErrSpiffeIDNotAllowed indicates that a PKIX public key given as an
+	// X.509 SVID has a SPIFFE ID that the verifier does not allow. It matches
+	// ErrCertificateNotTrusted.
+	ErrSpiffeIDNotAllowed = fmt.Errorf("%w: SPIFFE ID not allowed", ErrCertificateNotTrusted)
+	// ErrAlgorithmNotAllowed indicates that the Attestation's signature
+	// algorithm is not in the verifier's allow-list.
+	ErrAlgorithmNotAllowed = errors.New("signature algorithm not allowed")
+	// ErrKeyTooWeak indicates that the matching public key is an RSA key with
+	// a smaller modulus, or an ECDSA key on a smaller curve, than the
+	// verifier's minimum. It is returned before the signature is checked.
+	ErrKeyTooWeak = errors.New("public key is too weak")
+	// ErrKeyRevoked indicates that the Attestation was signed by, or names, a
+	// public key that has been revoked. It is returned before the signature
+	// is checked.
+	ErrKeyRevoked = errors.New("public key has been revoked")
+	// ErrAttestationStale indicates that the verified payload is older than
+	// the verifier's maximum age, or has no timestamp while a maximum age is
+	// set.
+	ErrAttestationStale = errors.New("attestation is stale")
+	// ErrKeyIDMismatch indicates that a verifier with strict key ID matching
+	// rejected an Attestation whose PublicKeyID is empty or is not the ID of
+	// any of its public keys.
+	ErrKeyIDMismatch = errors.New("attestation's public key ID does not match a registered key")
+	// ErrKeyMismatch indicates that a verifier with key identity matching
+	// verified an Attestation with a public key that its PublicKeyID does not
+	// identify, e.g. during key trial or through a key alias.
+	ErrKeyMismatch = errors.New("verifying public key does not match the attestation's public key ID")
+	// ErrTransparencyLogInvalid indicates that the Rekor entry of an
+	// Attestation's SigstoreBundle is not signed by the trusted log, is not
+	// included in it, or does not record the Attestation's signature.
+	ErrTransparencyLogInvalid = errors.New("transparency log entry is not valid")
+	// ErrDigestResolutionFailed indicates that the verified payload
+	// references the image by tag, and the verifier's DigestResolver could
+	// not resolve the tag to a digest.
+	ErrDigestResolutionFailed = errors.New("image tag could not be resolved to a digest")
+	// ErrVerificationTimeout indicates that a call to a remote backend, such
+	// as Cloud KMS, Vault or a JWKS endpoint, did not complete within the
+	// verifier's timeout.
+	ErrVerificationTimeout = errors.New("verification timed out")
+	// ErrRetriesExhausted indicates that a public key could not be fetched
+	// from Cloud KMS, Vault or a JWKS endpoint because every attempt failed
+	// with an error that may not recur, e.g. an unavailable server.
+	ErrRetriesExhausted = errors.New("key fetch retries exhausted")
+	// ErrInputTooLarge indicates that the Attestation's signature or payload,
+	// or a payload decoded from its signature, exceeds the verifier's size
+	// limits. It is returned before the oversized input is decoded or parsed.
+	ErrInputTooLarge = errors.New("attestation input too large")
+	// ErrPolicyDenied indicates that the verifier's PolicyEvaluator denied
+	// the verified payload, or could not evaluate it.
+	ErrPolicyDenied = errors.New("attestation denied by policy")
+)
+
+// Errors returned by NewVerifier.
+var (
+	// ErrInvalidPublicKey indicates that the key material of one or more
+	// public keys could not be parsed, or does not match their declared
+	// AuthenticatorType or SignatureAlgorithm.
+	ErrInvalidPublicKey = errors.New("invalid public key")
+)
+
+// Errors returned by VerifyAttestations.
+var (
+	// ErrQuorumNotMet indicates that fewer distinct public keys than required
+	// verified the Attestations.
+	ErrQuorumNotMet = errors.New("not enough distinct keys verified the attestations")
+	// ErrVerificationSkipped is the result of an Attestation that was not
+	// verified because enough distinct keys had already verified others.
+	ErrVerificationSkipped = errors.New("attestation not verified: quorum already met")
+	// ErrSelfTestFailed is returned by SelfTest when some public keys or key
+	// backends of a Verifier cannot be used.
+	ErrSelfTestFailed = errors.New("verifier self-test failed")
+)
+
+// DigestMismatchError is returned when the image digest in a verified payload
+// differs from the digest of the image being verified.
+type DigestMismatchError struct {
+	// Expected is the digest of the image being verified.
+	Expected string
+	// Actual is the digest found in the Attestation payload.
+	Actual string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%v: expected image digest %q, got %q", ErrPayloadMismatch, e.Expected, e.Actual)
+}
+
+// Is reports whether the error matches ErrPayloadMismatch.
+func (e *DigestMismatchError) Is(target error) bool {
+	return target == ErrPayloadMismatch
+}
+
+// DigestAlgorithmMismatchError is returned when the image digest in a verified
+// payload uses a different algorithm than the digest of the image being
+// verified, so the digests cannot be compared.
+type DigestAlgorithmMismatchError struct {
+	// Expected is the algorithm of the digest of the image being verified.
+	Expected string
+	// Actual is the algorithm of the digest found in the Attestation payload.
+	// For in-toto Statements, it lists the algorithms of the subject digests.
+	Actual string
+}
+
+func (e *DigestAlgorithmMismatchError) Error() string {
+	return fmt.Sprintf("%v: expected a %s image digest, got %s", ErrPayloadMismatch, e.Expected, e.Actual)
+}
+
+// Is reports whether the error matches ErrPayloadMismatch.
+func (e *DigestAlgorithmMismatchError) Is(target error) bool {
+	return target == ErrPayloadMismatch
+}
+
+// MultiVerifierError is returned when the sub-verifiers of a Verifier created
+// with NewMultiVerifier rejected an Attestation.
+type MultiVerifierError struct {
+	// Mode is the mode of the Verifier.
+	Mode MultiVerifierMode
+	// Errors holds the outcome of each sub-verifier that was run, in order:
+	// the error of a sub-verifier that rejected the Attestation, or nil.
+	Errors []error
+}
+
+func (e *MultiVerifierError) Error() string {
+	var failures []string
+	for i, err := range e.Errors {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("verifier %d: %v", i, err))
+		}
+	}
+	if e.Mode == RequireAll {
+		return fmt.Sprintf("attestation rejected by %d of %d required verifiers: %s", len(failures), len(e.Errors), strings.Join(failures, "; "))
+	}
+	return fmt.Sprintf("attestation rejected by all %d verifiers: %s", len(failures), strings.Join(failures, "; "))
+}
+
+// Is reports whether the error of any sub-verifier matches `target`.
+func (e *MultiVerifierError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if err != nil && errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPgpExpirationError reports whether `err` is due to an expired PGP key or
+// signature.
+func isPgpExpirationError(err error) bool {
+	return errors.Is(err, ErrPgpKeyExpired) || errors.Is(err, ErrPgpSignatureExpired)
+}
+
+// isKeyTooWeak reports whether `err` is due to a public key that is weaker than
+// the verifier's minimum key size.
+func isKeyTooWeak(err error) bool {
+	return errors.Is(err, ErrKeyTooWeak)
+}
+
+// isInputTooLarge reports whether `err` is due to an input that exceeds the
+// verifier's size limits.
+func isInputTooLarge(err error) bool {
+	return errors.Is(err, ErrInputTooLarge)
+}
+
+// isRetriesExhausted reports whether `err` is due to a key fetch that failed
+// with transient errors until the retries were exhausted.
+func isRetriesExhausted(err error) bool {
+	return errors.Is(err, ErrRetriesExhausted)
+}
+
+// isTransientFailure reports whether `err` is due to a cancelled context, an
+// exceeded deadline or timeout, or a key fetch that exhausted its retries,
+// so that verifying again may succeed.
+func isTransientFailure(err error) bool {
+	return isContextError(err) || errors.Is(err, ErrVerificationTimeout) || isRetriesExhausted(err)
+}
+
+// isContextError reports whether `err` is due to a cancelled context or an
+// exceeded deadline.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
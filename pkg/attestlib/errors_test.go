@@ -0,0 +1,208 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const otherDigestPayload = `{
+    "critical": {
+        "identity": {
+            "docker-reference": "gcr.io/google-samples/hello-app"
+        },
+        "image": {
+            "docker-manifest-digest": "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+        },
+    "type": "Google cloud binauthz container signature"
+    }
+}`
+
+func TestVerifyAttestationErrors(t *testing.T) {
+	pkixKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte("key-data"), ID: "pkix-key"}
+	unknownKey := PublicKey{AuthenticatorType: UnknownAuthenticatorType, KeyData: []byte("key-data"), ID: "unknown-key"}
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		verifyErr   bool
+		expectedErr error
+	}{
+		{
+			name:        "no matching key",
+			att:         &Attestation{PublicKeyID: "other-key", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)},
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "signature invalid",
+			att:         &Attestation{PublicKeyID: "pkix-key", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)},
+			verifyErr:   true,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unsupported key type",
+			att:         &Attestation{PublicKeyID: "unknown-key", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)},
+			expectedErr: ErrUnsupportedKeyType,
+		},
+		{
+			name:        "invalid payload",
+			att:         &Attestation{PublicKeyID: "pkix-key", Signature: []byte("signature"), SerializedPayload: []byte(invalidPayload)},
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "digest mismatch",
+			att:         &Attestation{PublicKeyID: "pkix-key", Signature: []byte("signature"), SerializedPayload: []byte(otherDigestPayload)},
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := verifier{
+				ImageName:               "gcr.io/google-samples/hello-app",
+				ImageDigest:             "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988",
+				PublicKeys:              indexPublicKeysByID([]PublicKey{pkixKey, unknownKey}, nopLogger{}),
+				pkixVerifier:            mockPkixVerifier{shouldErr: tc.verifyErr},
+				AuthenticatedAttChecker: authenticatedAttCheckerImpl{},
+			}
+			err := v.VerifyAttestation(tc.att)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationKeyTypeErrors(t *testing.T) {
+	tcs := []struct {
+		name        string
+		publicKey   PublicKey
+		expectedErr error
+		otherErr    error
+	}{
+		{
+			name:        "unknown key type",
+			publicKey:   PublicKey{AuthenticatorType: UnknownAuthenticatorType, KeyData: []byte("key-data"), ID: "key"},
+			expectedErr: ErrUnknownKeyType,
+			otherErr:    ErrKeyTypeNotImplemented,
+		},
+		{
+			name:        "out of range key type",
+			publicKey:   PublicKey{AuthenticatorType: AuthenticatorType(42), KeyData: []byte("key-data"), ID: "key"},
+			expectedErr: ErrUnknownKeyType,
+			otherErr:    ErrKeyTypeNotImplemented,
+		},
+		{
+			name:        "kms key without client",
+			publicKey:   PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: "key"},
+			expectedErr: ErrKeyTypeNotImplemented,
+			otherErr:    ErrUnknownKeyType,
+		},
+		{
+			name:        "vault key without client",
+			publicKey:   PublicKey{AuthenticatorType: Vault, SignatureAlgorithm: EddsaEd25519, KeyData: []byte(vaultKeyPath), ID: "key"},
+			expectedErr: ErrKeyTypeNotImplemented,
+			otherErr:    ErrUnknownKeyType,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey})
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: "key", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if !errors.Is(err, ErrUnsupportedKeyType) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrUnsupportedKeyType)
+			}
+			if errors.Is(err, tc.otherErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error not matching %v", err, tc.otherErr)
+			}
+		})
+	}
+}
+
+func TestDigestMismatchError(t *testing.T) {
+	c := authenticatedAttCheckerImpl{}
+	err := c.CheckAuthenticatedAttestation([]byte(otherDigestPayload), "gcr.io/google-samples/hello-app", []string{"sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}, convertAuthenticatedAttestation)
+	var mismatch *DigestMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("CheckAuthenticatedAttestation(_) = %v, want *DigestMismatchError", err)
+	}
+	if mismatch.Expected != "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988" {
+		t.Errorf("Expected = %q, want the verifier's digest", mismatch.Expected)
+	}
+	if mismatch.Actual != "sha256:0000000000000000000000000000000000000000000000000000000000000000" {
+		t.Errorf("Actual = %q, want the payload's digest", mismatch.Actual)
+	}
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("errors.Is(%v, ErrPayloadMismatch) = false, want true", err)
+	}
+}
+
+func TestDigestAlgorithmMismatchError(t *testing.T) {
+	c := authenticatedAttCheckerImpl{}
+	err := c.CheckAuthenticatedAttestation([]byte(validPayload), "gcr.io/google-samples/hello-app", []string{"sha512:" + strings.Repeat("ab", 64)}, convertAuthenticatedAttestation)
+	var mismatch *DigestAlgorithmMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("CheckAuthenticatedAttestation(_) = %v, want *DigestAlgorithmMismatchError", err)
+	}
+	if mismatch.Expected != "sha512" || mismatch.Actual != "sha256" {
+		t.Errorf("DigestAlgorithmMismatchError = %+v, want Expected sha512 and Actual sha256", mismatch)
+	}
+	var digestMismatch *DigestMismatchError
+	if errors.As(err, &digestMismatch) {
+		t.Errorf("CheckAuthenticatedAttestation(_) = %v, want an error distinct from *DigestMismatchError", err)
+	}
+	if !errors.Is(err, ErrPayloadMismatch) {
+		t.Errorf("errors.Is(%v, ErrPayloadMismatch) = false, want true", err)
+	}
+}
+
+func TestDsseErrors(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v := verifier{PublicKeys: indexPublicKeysByID([]PublicKey{publicKey}, nopLogger{}), ed25519Verifier: ed25519VerifierImpl{}}
+	tcs := []struct {
+		name        string
+		signature   []byte
+		expectedErr error
+	}{
+		{
+			name:        "unknown key",
+			signature:   createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"other-key": ed25519PrivateKey}),
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "malformed envelope",
+			signature:   []byte("not json"),
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, _, err := v.verifyDsse(context.Background(), &Attestation{Signature: tc.signature, EnvelopeType: Dsse})
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("verifyDsse(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
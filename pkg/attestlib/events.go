@@ -0,0 +1,77 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// VerificationEvent describes a completed verification of an Attestation,
+// e.g. for an external audit log. Callbacks set with OnVerify receive one
+// after every verification.
+type VerificationEvent struct {
+	// AttestationID identifies the Attestation: it is the hex encoded SHA-256
+	// digest of its public key IDs, signatures and serialized payload. It is
+	// empty if the Attestation is nil.
+	AttestationID string
+	// KeyID is the ID of the public key that verified the Attestation. If
+	// verification failed, it is the PublicKeyID of the Attestation.
+	KeyID string
+	// KeyType is the type of the public key that verified the Attestation,
+	// or of the first public key with its PublicKeyID if verification failed.
+	KeyType AuthenticatorType
+	// Outcome categorizes the result, as reported to the MetricsRecorder.
+	Outcome VerificationOutcome
+	// Duration is how long the verification took.
+	Duration time.Duration
+	// Err is the error the verification failed with, or nil on success.
+	Err error
+}
+
+// attestationID returns the AttestationID of `att` reported in
+// VerificationEvents.
+func attestationID(att *Attestation) string {
+	if att == nil {
+		return ""
+	}
+	h := sha256.New()
+	writeCacheKeyField(h, []byte(att.PublicKeyID))
+	writeCacheKeyField(h, att.Signature)
+	for _, entry := range att.Signatures {
+		writeCacheKeyField(h, []byte(entry.PublicKeyID))
+		writeCacheKeyField(h, entry.Signature)
+	}
+	writeCacheKeyField(h, att.SerializedPayload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// emitEvent calls the OnVerify callbacks of the verifier with `event`. A
+// callback that panics is logged and does not affect the verification.
+func (v *verifier) emitEvent(event VerificationEvent) {
+	for _, callback := range v.onVerify {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					v.log().Warningf("OnVerify callback panicked: %v", r)
+				}
+			}()
+			callback(event)
+		}()
+	}
+}
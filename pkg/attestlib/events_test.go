@@ -0,0 +1,122 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestOnVerify(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+
+	tcs := []struct {
+		name            string
+		att             *Attestation
+		expectedKeyID   string
+		expectedOutcome VerificationOutcome
+		expectedErr     error
+	}{
+		{
+			name:            "verified",
+			att:             &Attestation{PublicKeyID: "ed25519-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expectedKeyID:   "ed25519-key",
+			expectedOutcome: OutcomeSuccess,
+		},
+		{
+			name:            "bad signature",
+			att:             &Attestation{PublicKeyID: "ed25519-key", Signature: signature, SerializedPayload: []byte(otherDigestPayload)},
+			expectedKeyID:   "ed25519-key",
+			expectedOutcome: OutcomeBadSignature,
+			expectedErr:     ErrSignatureInvalid,
+		},
+		{
+			name:            "unknown key",
+			att:             &Attestation{PublicKeyID: "other-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expectedKeyID:   "other-key",
+			expectedOutcome: OutcomeNoKey,
+			expectedErr:     ErrNoMatchingKey,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var events []VerificationEvent
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, OnVerify(func(event VerificationEvent) {
+				events = append(events, event)
+			}))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if len(events) != 1 {
+				t.Fatalf("OnVerify callback called %d times, expected 1", len(events))
+			}
+			event := events[0]
+			if event.AttestationID != attestationID(tc.att) || event.AttestationID == "" {
+				t.Errorf("event.AttestationID = %q, expected %q", event.AttestationID, attestationID(tc.att))
+			}
+			if event.KeyID != tc.expectedKeyID {
+				t.Errorf("event.KeyID = %q, expected %q", event.KeyID, tc.expectedKeyID)
+			}
+			if event.Outcome != tc.expectedOutcome {
+				t.Errorf("event.Outcome = %q, expected %q", event.Outcome, tc.expectedOutcome)
+			}
+			if event.Err != err {
+				t.Errorf("event.Err = %v, expected %v", event.Err, err)
+			}
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+				if event.KeyType != Ed25519 {
+					t.Errorf("event.KeyType = %v, expected %v", event.KeyType, Ed25519)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestOnVerifyCannotAlterResult(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	logger := &capturingLogger{}
+	calls := 0
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithLogger(logger),
+		OnVerify(func(event VerificationEvent) {
+			calls++
+			panic("audit log unavailable")
+		}),
+		OnVerify(func(event VerificationEvent) {
+			calls++
+		}))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	if calls != 2 {
+		t.Errorf("OnVerify callbacks called %d times, expected 2", calls)
+	}
+	if len(logger.warnings) != 1 {
+		t.Errorf("got warnings %q, expected one about the panicking callback", logger.warnings)
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// explainedErrors are the errors whose message VerifyOrExplain reports as the
+// reason of a rejection, most specific first. Wrapped details are left out,
+// since they may quote the payload.
+var explainedErrors = []error{
+	ErrKeyRevoked,
+	ErrKeyIDMismatch,
+	ErrKeyMismatch,
+	ErrNoMatchingKey,
+	ErrUnknownKeyType,
+	ErrKeyTypeNotImplemented,
+	ErrUnsupportedKeyType,
+	ErrAlgorithmNotAllowed,
+	ErrKeyTooWeak,
+	ErrSpiffeIDNotAllowed,
+	ErrCertificateNotTrusted,
+	ErrTransparencyLogInvalid,
+	ErrPgpKeyExpired,
+	ErrPgpSignatureExpired,
+	ErrSignatureInvalid,
+	ErrKeyNotValid,
+	ErrDigestResolutionFailed,
+	ErrInvalidPayload,
+	ErrPayloadMismatch,
+	ErrAttestationStale,
+	ErrVerificationTimeout,
+	ErrInputTooLarge,
+	ErrPolicyDenied,
+	context.Canceled,
+	context.DeadlineExceeded,
+}
+
+// VerifyOrExplain verifies an Attestation like VerifyAttestation. If the
+// Attestation is rejected, it explains why, one line per step: whether a
+// public key was found, which key types were tried, whether the signature
+// decoded and verified, and whether the payload matched the image digest. See
+// Verifier for more details.
+func (v *verifier) VerifyOrExplain(att *Attestation) (bool, string) {
+	v = v.current()
+	verified, err := v.verify(context.Background(), att, v.verifyAttestation)
+	if err == nil {
+		return true, fmt.Sprintf("attestation verified by public key %q (%v)", verified.publicKey.ID, verified.publicKey.AuthenticatorType)
+	}
+	lines := []string{"attestation rejected: " + explainReason(err)}
+	if att == nil || errors.Is(err, ErrInputTooLarge) {
+		return false, lines[0]
+	}
+	decoded, decodeErr := decodeSignatureEncoding(att)
+	if decodeErr != nil {
+		lines = append(lines,
+			"signature decoded: no, "+strings.TrimPrefix(decodeErr.Error(), ErrSignatureInvalid.Error()+": "),
+			"signature verified: not checked")
+	} else {
+		lines = append(lines, v.explainSignature(decoded, err)...)
+	}
+	lines = append(lines, "image digest matched: "+explainImageDigest(err))
+	return false, strings.Join(lines, "\n")
+}
+
+// explainReason returns the message of the most specific error in
+// explainedErrors that `err` matches.
+func explainReason(err error) string {
+	for _, explained := range explainedErrors {
+		if errors.Is(err, explained) {
+			return explained.Error()
+		}
+	}
+	return "verification failed"
+}
+
+// explainSignature explains which public keys were tried on the signature of
+// `att`, and whether the signature decoded and verified. The signature of an
+// Attestation that is not a bare signature is checked by its envelope, bundle
+// or signature list, so only its outcome is reported.
+func (v *verifier) explainSignature(att *Attestation, err error) []string {
+	verified := explainSignatureVerified(err)
+	var kind string
+	switch {
+	case att.EnvelopeType == Dsse:
+		kind = "DSSE envelope"
+	case att.EnvelopeType == Cms:
+		kind = "CMS SignedData"
+	case att.EnvelopeType == CoseSign1:
+		kind = "COSE_Sign1 message"
+	case att.EnvelopeType != NoEnvelope:
+		kind = "envelope"
+	case att.SigstoreBundle != nil:
+		kind = "sigstore bundle"
+	case len(att.Signatures) > 0:
+		kind = "signature list"
+	}
+	if kind != "" {
+		return []string{
+			fmt.Sprintf("key found: determined by the %s", kind),
+			fmt.Sprintf("key types tried: determined by the %s", kind),
+			fmt.Sprintf("signature decoded: determined by the %s", kind),
+			"signature verified: " + verified,
+		}
+	}
+
+	var lines []string
+	publicKeys := v.publicKeysByID(att.PublicKeyID)
+	switch {
+	case len(publicKeys) > 0:
+		lines = append(lines, fmt.Sprintf("key found: yes, %d public key(s) with ID %q", len(publicKeys), att.PublicKeyID))
+	case v.jwksSource != nil && att.PublicKeyID != "":
+		lines = append(lines, fmt.Sprintf("key found: no configured public key with ID %q; the JWKS source was queried", att.PublicKeyID))
+	case v.keyTrialLimit > 0 && !v.strictKeyIDMatching:
+		publicKeys = candidateKeys(v.PublicKeys, att)
+		if len(publicKeys) > v.keyTrialLimit {
+			publicKeys = publicKeys[:v.keyTrialLimit]
+		}
+		lines = append(lines, fmt.Sprintf("key found: no public key with ID %q; key trial tried %d candidate key(s)", att.PublicKeyID, len(publicKeys)))
+	default:
+		lines = append(lines, fmt.Sprintf("key found: no public key with ID %q", att.PublicKeyID))
+	}
+	if len(publicKeys) == 0 {
+		return append(lines,
+			"key types tried: none",
+			"signature decoded: not checked",
+			"signature verified: "+verified)
+	}
+
+	var keyTypes []string
+	var decodeFailures []string
+	decoded, checked := false, false
+	for _, publicKey := range publicKeys {
+		if keyType := publicKey.AuthenticatorType.String(); !containsString(keyTypes, keyType) {
+			keyTypes = append(keyTypes, keyType)
+		}
+		ok, decodeErr := v.decodeSignature(att, publicKey)
+		if !ok {
+			continue
+		}
+		checked = true
+		if decodeErr == nil {
+			decoded = true
+		} else {
+			decodeFailures = append(decodeFailures, fmt.Sprintf("key %q: %v", publicKey.ID, decodeErr))
+		}
+	}
+	lines = append(lines, "key types tried: "+strings.Join(keyTypes, ", "))
+	switch {
+	case decoded:
+		lines = append(lines, "signature decoded: yes")
+	case checked:
+		lines = append(lines, "signature decoded: no, "+strings.Join(decodeFailures, "; "))
+	default:
+		lines = append(lines, "signature decoded: not checked locally for these key types")
+	}
+	if checked && !decoded && verified == "no" {
+		verified = "not checked, the signature did not decode"
+	}
+	return append(lines, "signature verified: "+verified)
+}
+
+// explainSignatureVerified explains whether the signature of an Attestation
+// rejected with `err` verified.
+func explainSignatureVerified(err error) string {
+	switch {
+	case errors.Is(err, ErrSignatureInvalid):
+		return "no"
+	case isPgpExpirationError(err), errors.Is(err, ErrKeyNotValid), errors.Is(err, ErrInvalidPayload),
+		errors.Is(err, ErrPayloadMismatch), errors.Is(err, ErrAttestationStale), errors.Is(err, ErrDigestResolutionFailed):
+		return "yes"
+	default:
+		return "not checked"
+	}
+}
+
+// explainImageDigest explains whether the payload of an Attestation rejected
+// with `err` matched the image digest. The payload is checked only once its
+// signature verified.
+func explainImageDigest(err error) string {
+	var mismatch *DigestMismatchError
+	var algorithmMismatch *DigestAlgorithmMismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		return fmt.Sprintf("no, expected %q, the payload names %q", mismatch.Expected, mismatch.Actual)
+	case errors.As(err, &algorithmMismatch):
+		return fmt.Sprintf("no, expected a %s digest, the payload names %s", algorithmMismatch.Expected, algorithmMismatch.Actual)
+	case errors.Is(err, ErrPayloadMismatch):
+		return "no, the payload does not describe the image"
+	case errors.Is(err, ErrInvalidPayload):
+		return "not checked, the verified payload could not be parsed"
+	case errors.Is(err, ErrDigestResolutionFailed):
+		return "not checked, the image tag in the payload could not be resolved"
+	case errors.Is(err, ErrAttestationStale):
+		return "yes"
+	default:
+		return "not checked"
+	}
+}
+
+// decodeSignature checks that the bare signature of `att` is encoded as
+// `publicKey` expects, without verifying it. It reports false if the
+// signature is only decoded by a remote service, as for Kms and Vault keys.
+func (v *verifier) decodeSignature(att *Attestation, publicKey PublicKey) (bool, error) {
+	signature := att.Signature
+	if v.cosignCompatibility {
+		signature = decodeCosignSignature(signature)
+	}
+	switch publicKey.AuthenticatorType {
+	case Ed25519:
+		if len(signature) != ed25519.SignatureSize {
+			return true, fmt.Errorf("expected a %d byte Ed25519 signature, got %d bytes", ed25519.SignatureSize, len(signature))
+		}
+		return true, nil
+	case Ed448:
+		if len(signature) != ed448SignatureSize {
+			return true, fmt.Errorf("expected a %d byte Ed448 signature, got %d bytes", ed448SignatureSize, len(signature))
+		}
+		return true, nil
+	case Hmac:
+		if len(signature) != hmacSha256Size {
+			return true, fmt.Errorf("expected a %d byte HMAC-SHA256, got %d bytes", hmacSha256Size, len(signature))
+		}
+		return true, nil
+	case Pkix:
+		return true, decodePkixSignature(signature, publicKey)
+	case Pgp:
+		reader, err := dearmorPgp(att.Signature)
+		if err != nil {
+			return true, errors.New("invalid ASCII armor")
+		}
+		if _, err := packet.Read(reader); err != nil {
+			return true, errors.New("not an OpenPGP message")
+		}
+		return true, nil
+	case Jwt:
+		parts := bytes.Split(att.Signature, []byte("."))
+		if len(parts) != 3 {
+			return true, errors.New("not a JWS compact serialization")
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(string(parts[2])); err != nil {
+			return true, errors.New("JWS signature is not base64url encoded")
+		}
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// decodePkixSignature checks that `signature` has the encoding of the
+// SignatureAlgorithm of the Pkix `publicKey`.
+func decodePkixSignature(signature []byte, publicKey PublicKey) error {
+	pub, err := pkixKey(publicKey)
+	if err != nil {
+		return errors.New("the public key could not be parsed")
+	}
+	alg := baseSignatureAlgorithm(publicKey.SignatureAlgorithm)
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if len(signature) != key.Size() {
+			return fmt.Errorf("expected a %d byte RSA signature, got %d bytes", key.Size(), len(signature))
+		}
+	case *ecdsa.PublicKey:
+		if _, _, err := decodeDerEcdsaSignature(signature); err == nil {
+			return nil
+		}
+		if _, _, err := decodeRawEcdsaSignature(signature, alg); err != nil {
+			return fmt.Errorf("expected a DER or %d byte r||s ECDSA signature, got %d bytes that are neither", 2*ecdsaSignatureSize(alg), len(signature))
+		}
+	case ed25519.PublicKey:
+		if len(signature) != ed25519.SignatureSize {
+			return fmt.Errorf("expected a %d byte Ed25519 signature, got %d bytes", ed25519.SignatureSize, len(signature))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestVerifyOrExplain(t *testing.T) {
+	edKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed-key"}
+	otherEdKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "shared-key"}
+	ecKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "shared-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	att := func(keyID string, signature []byte) *Attestation {
+		return &Attestation{PublicKeyID: keyID, Signature: signature, SerializedPayload: []byte(validPayload)}
+	}
+
+	tcs := []struct {
+		name             string
+		image            string
+		publicKeys       []PublicKey
+		opts             []VerifierOption
+		att              *Attestation
+		expectedVerified bool
+		expectedLines    []string
+	}{
+		{
+			name:             "verified",
+			image:            helloAppImage,
+			publicKeys:       []PublicKey{edKey},
+			att:              att("ed-key", signature),
+			expectedVerified: true,
+			expectedLines:    []string{`attestation verified by public key "ed-key" (ed25519)`},
+		},
+		{
+			name:       "no key found",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{edKey},
+			att:        att("rotated-key", signature),
+			expectedLines: []string{
+				"attestation rejected: no matching public key",
+				`key found: no public key with ID "rotated-key"`,
+				"key types tried: none",
+				"signature decoded: not checked",
+				"signature verified: not checked",
+				"image digest matched: not checked",
+			},
+		},
+		{
+			name:       "no key found with key trial",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{otherEdKey},
+			opts:       []VerifierOption{WithKeyTrial(5)},
+			att:        att("rotated-key", signature),
+			expectedLines: []string{
+				"attestation rejected: invalid signature",
+				`key found: no public key with ID "rotated-key"; key trial tried 1 candidate key(s)`,
+				"key types tried: ed25519",
+				"signature decoded: yes",
+				"signature verified: no",
+			},
+		},
+		{
+			name:       "signature not decoded",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{edKey},
+			att:        att("ed-key", signature[:10]),
+			expectedLines: []string{
+				"attestation rejected: invalid signature",
+				`key found: yes, 1 public key(s) with ID "ed-key"`,
+				"key types tried: ed25519",
+				`signature decoded: no, key "ed-key": expected a 64 byte Ed25519 signature, got 10 bytes`,
+				"signature verified: not checked, the signature did not decode",
+				"image digest matched: not checked",
+			},
+		},
+		{
+			name:       "signature not verified by any key type",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{otherEdKey, ecKey},
+			att:        att("shared-key", signature),
+			expectedLines: []string{
+				"attestation rejected: invalid signature",
+				`key found: yes, 2 public key(s) with ID "shared-key"`,
+				"key types tried: ed25519, pkix",
+				"signature decoded: yes",
+				"signature verified: no",
+				"image digest matched: not checked",
+			},
+		},
+		{
+			name:       "image digest mismatch",
+			image:      "gcr.io/google-samples/hello-app@sha256:" + strings.Repeat("0", 64),
+			publicKeys: []PublicKey{edKey},
+			att:        att("ed-key", signature),
+			expectedLines: []string{
+				"attestation rejected: attestation payload does not match image",
+				"signature decoded: yes",
+				"signature verified: yes",
+				`image digest matched: no, expected "sha256:0000000000000000000000000000000000000000000000000000000000000000", the payload names "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"`,
+			},
+		},
+		{
+			name:       "image name mismatch",
+			image:      qualifiedImage,
+			publicKeys: []PublicKey{edKey},
+			att:        att("ed-key", signature),
+			expectedLines: []string{
+				"attestation rejected: attestation payload does not match image",
+				"signature verified: yes",
+				"image digest matched: no, the payload does not describe the image",
+			},
+		},
+		{
+			name:       "signature encoding not decoded",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{edKey},
+			att:        &Attestation{PublicKeyID: "ed-key", Signature: []byte("0g"), SignatureEncoding: HexEncoding, SerializedPayload: []byte(validPayload)},
+			expectedLines: []string{
+				"attestation rejected: invalid signature",
+				"signature decoded: no, signature is not valid hex: encoding/hex: invalid byte: U+0067 'g'",
+				"signature verified: not checked",
+			},
+		},
+		{
+			name:       "revoked key",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{edKey},
+			opts:       []VerifierOption{WithRevokedKeys("ed-key")},
+			att:        att("ed-key", signature),
+			expectedLines: []string{
+				"attestation rejected: public key has been revoked",
+				"signature verified: not checked",
+			},
+		},
+		{
+			name:       "DSSE envelope",
+			image:      helloAppImage,
+			publicKeys: []PublicKey{edKey},
+			att:        &Attestation{PublicKeyID: "ed-key", Signature: []byte("{}"), EnvelopeType: Dsse},
+			expectedLines: []string{
+				"key found: determined by the DSSE envelope",
+				"signature decoded: determined by the DSSE envelope",
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(tc.image, tc.publicKeys, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			verified, explanation := v.VerifyOrExplain(tc.att)
+			if verified != tc.expectedVerified {
+				t.Errorf("VerifyOrExplain(_) = %v, expected %v", verified, tc.expectedVerified)
+			}
+			lines := strings.Split(explanation, "\n")
+			for _, expected := range tc.expectedLines {
+				if !containsString(lines, expected) {
+					t.Errorf("VerifyOrExplain(_) explanation is missing %q:\n%s", expected, explanation)
+				}
+			}
+			// The explanation must not leak key material, the signature or the
+			// payload.
+			secrets := []string{validPayload, base64.StdEncoding.EncodeToString(tc.att.Signature), string(tc.att.Signature)}
+			for _, publicKey := range tc.publicKeys {
+				secrets = append(secrets, string(publicKey.KeyData), base64.StdEncoding.EncodeToString(publicKey.KeyData))
+			}
+			for _, secret := range secrets {
+				if len(secret) > 4 && strings.Contains(explanation, secret) {
+					t.Errorf("VerifyOrExplain(_) explanation leaks %q:\n%s", secret, explanation)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyOrExplainPkixSignatureEncoding(t *testing.T) {
+	ecKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{ecKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	verified, explanation := v.VerifyOrExplain(&Attestation{PublicKeyID: "ec-key", Signature: []byte("not a signature"), SerializedPayload: []byte(validPayload)})
+	if verified {
+		t.Errorf("VerifyOrExplain(_) = true, expected false")
+	}
+	expected := `signature decoded: no, key "ec-key": expected a DER or 64 byte r||s ECDSA signature, got 15 bytes that are neither`
+	if !strings.Contains(explanation, expected) {
+		t.Errorf("VerifyOrExplain(_) explanation is missing %q:\n%s", expected, explanation)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ExtractingVerifier verifies Attestations for an image whose digest is not
+// known in advance.
+type ExtractingVerifier interface {
+	// VerifyAndExtract verifies the signature of an Attestation like
+	// VerifyAttestation, and returns the contents of its verified payload.
+	// The image name and digest in the payload are not compared with an
+	// expected image, so the caller must compare them. The payload is only
+	// returned once its signature has been verified.
+	VerifyAndExtract(att *Attestation) (*AuthenticatedAttestation, error)
+}
+
+// NewExtractingVerifier creates an ExtractingVerifier that verifies
+// Attestations with the public keys in `publicKeySet`. `opts` are the
+// VerifierOptions of NewVerifier, except for WithAcceptableDigests and
+// WithImageIndex, which need an image digest.
+func NewExtractingVerifier(publicKeySet []PublicKey, opts ...VerifierOption) (ExtractingVerifier, error) {
+	return newVerifier("", "", publicKeySet, opts...)
+}
+
+// VerifyAndExtract verifies an Attestation and returns its verified payload.
+// See ExtractingVerifier for more details.
+func (v *verifier) VerifyAndExtract(att *Attestation) (*AuthenticatedAttestation, error) {
+	v = v.current()
+	if !v.extractOnly {
+		return nil, errors.New("VerifyAndExtract needs a verifier created by NewExtractingVerifier")
+	}
+	verified, err := v.verify(context.Background(), att, v.verifyAttestation)
+	if err != nil {
+		return nil, err
+	}
+	return verified.authAtt, nil
+}
+
+// checkExtractedPayload checks that `payload`, which is converted with
+// `convert`, contains well-formed image digests, without comparing them with
+// an expected digest. Like CheckAuthenticatedAttestation, it rejects payloads
+// without a digest.
+func checkExtractedPayload(payload []byte, convert ConvertFunc) error {
+	authAtt, err := convert(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+	}
+	if len(authAtt.SubjectDigests) == 0 && strings.TrimSpace(authAtt.ImageDigest) == "" {
+		return fmt.Errorf("%w: attestation payload has no image digest", ErrInvalidPayload)
+	}
+	for _, digest := range authAtt.SubjectDigests {
+		if _, err := parseDigest(digest); err != nil {
+			return fmt.Errorf("%w: invalid in-toto subject digest: %v", ErrInvalidPayload, err)
+		}
+	}
+	if len(authAtt.SubjectDigests) == 0 {
+		if _, err := parseDigest(authAtt.ImageDigest); err != nil {
+			return fmt.Errorf("%w: invalid image digest in Attestation payload: %v", ErrInvalidPayload, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestVerifyAndExtract(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	newAttestation := func(payload, signed string) *Attestation {
+		return &Attestation{
+			PublicKeyID:       "ed25519-key",
+			Signature:         ed25519.Sign(ed25519PrivateKey, []byte(signed)),
+			SerializedPayload: []byte(payload),
+		}
+	}
+	tcs := []struct {
+		name           string
+		att            *Attestation
+		expectedDigest string
+		expectedErr    error
+	}{
+		{
+			name:           "hello-app digest",
+			att:            newAttestation(validPayload, validPayload),
+			expectedDigest: helloAppDigest,
+		},
+		{
+			name:           "any digest is extracted",
+			att:            newAttestation(otherDigestPayload, otherDigestPayload),
+			expectedDigest: otherHelloAppDigest,
+		},
+		{
+			name:        "invalid signature",
+			att:         newAttestation(otherDigestPayload, validPayload),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unknown key",
+			att:         &Attestation{PublicKeyID: "other-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "payload without digest",
+			att:         newAttestation(missingDigestPayload, missingDigestPayload),
+			expectedErr: ErrInvalidPayload,
+		},
+	}
+	v, err := NewExtractingVerifier([]PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			authAtt, err := v.VerifyAndExtract(tc.att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAndExtract(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				if authAtt != nil {
+					t.Errorf("VerifyAndExtract(_) returned %+v along with an error, expected nil", authAtt)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAndExtract(_) = %v, expected nil", err)
+			}
+			if authAtt.ImageDigest != tc.expectedDigest {
+				t.Errorf("ImageDigest = %q, expected %q", authAtt.ImageDigest, tc.expectedDigest)
+			}
+			if authAtt.ImageName != "gcr.io/google-samples/hello-app" {
+				t.Errorf("ImageName = %q, expected %q", authAtt.ImageName, "gcr.io/google-samples/hello-app")
+			}
+		})
+	}
+}
+
+func TestNewExtractingVerifierRejectsDigestOptions(t *testing.T) {
+	for _, opt := range []VerifierOption{WithAcceptableDigests(helloAppDigest), WithImageIndex(helloAppDigest)} {
+		if _, err := NewExtractingVerifier(nil, opt); err == nil {
+			t.Errorf("NewExtractingVerifier(...) = nil, expected non nil")
+		}
+	}
+}
+
+func TestVerifyAndExtractNeedsExtractingVerifier(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	if _, err := v.(ExtractingVerifier).VerifyAndExtract(att); err == nil {
+		t.Errorf("VerifyAndExtract(_) = nil, expected non nil")
+	}
+}
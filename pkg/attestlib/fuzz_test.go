@@ -0,0 +1,103 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"testing"
+	"time"
+)
+
+// The fuzz targets below feed arbitrary signatures, keys and payloads to the
+// verifiers. None of the seeds is signed by the private key of the public
+// key it is verified with, so every input must fail verification, and no
+// input may cause a panic. Run them with e.g.
+// `go test ./pkg/attestlib -fuzz FuzzVerifyPgp`.
+
+// fuzzSignatureAlgorithm maps a fuzzed byte to a SignatureAlgorithm.
+func fuzzSignatureAlgorithm(alg uint8) SignatureAlgorithm {
+	return SignatureAlgorithm(int(alg) % (int(HmacSha256) + 1))
+}
+
+func FuzzVerifyPkix(f *testing.F) {
+	f.Add([]byte("signature"), []byte(validPayload), []byte(ec256PubKey), uint8(EcdsaP256Sha256))
+	f.Add([]byte{}, []byte{}, []byte(rsa2048PubKey), uint8(RsaPss2048Sha256))
+	f.Add(make([]byte, 64), []byte(validPayload), []byte(ec256PubKey), uint8(RsaSignPkcs12048Sha256))
+	f.Add([]byte("signature"), []byte(validPayload), []byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----"), uint8(EcdsaP384Sha384))
+	f.Add([]byte("signature"), []byte(validPayload), []byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----"), uint8(EcdsaP256Sha256))
+	f.Fuzz(func(t *testing.T, signature, payload, keyData []byte, alg uint8) {
+		publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: fuzzSignatureAlgorithm(alg), KeyData: keyData, ID: "fuzz-key"}
+		if err := (pkixVerifierImpl{}).verifyPkix(signature, payload, publicKey); err == nil {
+			t.Errorf("verifyPkix(%q, %q, %q) = nil, expected error", signature, payload, keyData)
+		}
+	})
+}
+
+func FuzzVerifyPgp(f *testing.F) {
+	f.Add([]byte(gpgSignature[:len(gpgSignature)/2]), []byte(gpgPublicKey), []byte(testPayload))
+	f.Add([]byte(gpgSignature), []byte(expiringPublicKey), []byte(testPayload))
+	f.Add([]byte("-----BEGIN PGP SIGNATURE-----\n\nAAAA\n-----END PGP SIGNATURE-----"), []byte(gpgPublicKey), []byte(testPayload))
+	f.Add([]byte{0x88, 0x01, 0x00}, []byte{0x99, 0x00}, []byte{})
+	f.Add([]byte{}, []byte{}, []byte{})
+	f.Fuzz(func(t *testing.T, signature, keyData, payload []byte) {
+		publicKey := PublicKey{AuthenticatorType: Pgp, KeyData: keyData, ID: gpgPublicKeyID}
+		v := pgpVerifierImpl{}
+		if _, _, err := v.verifyPgp(signature, publicKey, gpgSignatureTime); err == nil && string(signature) != gpgSignature {
+			t.Errorf("verifyPgp(%q, %q) = nil, expected error", signature, keyData)
+		}
+		if _, err := v.verifyPgpDetached(signature, payload, publicKey, gpgSignatureTime); err == nil {
+			t.Errorf("verifyPgpDetached(%q, %q, %q) = nil, expected error", signature, payload, keyData)
+		}
+	})
+}
+
+func FuzzVerifyJwt(f *testing.F) {
+	f.Add([]byte(goodJwt), []byte(ec256PubKey), uint8(EcdsaP256Sha256))
+	f.Add([]byte(jwtWithCrit), []byte(ec256PubKey), uint8(EcdsaP256Sha256))
+	f.Add([]byte("eyJhbGciOiJFUzI1NiIsInR5cCI6IkpXVCJ9.e30."), []byte(ec256PubKey), uint8(EcdsaP256Sha256))
+	f.Add([]byte("eyJhbGciOiJFZERTQSIsInR5cCI6IkpXVCJ9.e30.AAAA"), []byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----"), uint8(EddsaEd25519))
+	f.Add([]byte(".."), []byte{}, uint8(0))
+	f.Fuzz(func(t *testing.T, token, keyData []byte, alg uint8) {
+		publicKey := PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: fuzzSignatureAlgorithm(alg), KeyData: keyData, ID: "my-signing-key"}
+		v := jwtVerifierImpl{}
+		if _, err := v.verifyJwt(token, publicKey, time.Now()); err == nil {
+			t.Errorf("verifyJwt(%q, %q) = nil, expected error", token, keyData)
+		}
+		if err := v.verifyJwtDetached(token, []byte(validPayload), publicKey, time.Now()); err == nil {
+			t.Errorf("verifyJwtDetached(%q, %q) = nil, expected error", token, keyData)
+		}
+	})
+}
+
+func FuzzVerifyCoseSign1(f *testing.F) {
+	f.Add(coseByteStringCritLabel)
+	// A critical header label that is an array.
+	f.Add([]byte{0x84, 0x46, 0xa2, 0x01, 0x26, 0x02, 0x81, 0x80, 0xa0, 0x41, 0x7b, 0x40})
+	// A tagged COSE_Sign1 without protected header, payload or signature.
+	f.Add([]byte{0xd2, 0x84, 0x40, 0xa0, 0xf6, 0x40})
+	f.Add([]byte{})
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "notation-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		f.Fatalf("error creating verifier: %v", err)
+	}
+	f.Fuzz(func(t *testing.T, message []byte) {
+		att := &Attestation{PublicKeyID: "notation-key", Signature: message, EnvelopeType: CoseSign1}
+		if err := v.VerifyAttestation(att); err == nil {
+			t.Errorf("VerifyAttestation(%q) = nil, expected error", message)
+		}
+	})
+}
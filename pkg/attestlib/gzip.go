@@ -0,0 +1,58 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+// defaultMaxGzipPayloadSize is the size limit of decompressed payloads used
+// when WithGzipPayloads is given no limit.
+const defaultMaxGzipPayloadSize = 4 << 20
+
+// gzipMagic starts every gzip stream, see RFC 1952, section 2.3.1.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompressPayload returns the decompressed contents of `payload` if the
+// verifier accepts gzip payloads and `payload` is gzip compressed. Otherwise,
+// `payload` is returned unchanged. Payloads that decompress to more than the
+// size limit of the verifier are rejected, so that a small signed payload
+// cannot exhaust memory.
+func (v *verifier) decompressPayload(payload []byte) ([]byte, error) {
+	if v.maxGzipPayloadSize == 0 || !bytes.HasPrefix(payload, gzipMagic) {
+		return payload, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decompressing gzip payload")
+	}
+	defer r.Close()
+	decompressed, err := ioutil.ReadAll(io.LimitReader(r, v.maxGzipPayloadSize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decompressing gzip payload")
+	}
+	if int64(len(decompressed)) > v.maxGzipPayloadSize {
+		return nil, fmt.Errorf("decompressed gzip payload exceeds the limit of %d bytes", v.maxGzipPayloadSize)
+	}
+	return decompressed, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func gzipPayload(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("error compressing payload: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error compressing payload: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyAttestationGzipPayload(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	// The payload decompresses to 10 MB of zeros.
+	bomb := gzipPayload(t, make([]byte, 10<<20))
+
+	tcs := []struct {
+		name        string
+		payload     []byte
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			name:    "gzip payload",
+			payload: gzipPayload(t, []byte(validPayload)),
+			opts:    []VerifierOption{WithGzipPayloads(0)},
+		},
+		{
+			name:    "plain payload",
+			payload: []byte(validPayload),
+			opts:    []VerifierOption{WithGzipPayloads(0)},
+		},
+		{
+			name:        "gzip payload without the option",
+			payload:     gzipPayload(t, []byte(validPayload)),
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "gzip payload exceeding the size limit",
+			payload:     gzipPayload(t, []byte(validPayload)),
+			opts:        []VerifierOption{WithGzipPayloads(int64(len(validPayload) - 1))},
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:    "gzip payload at the size limit",
+			payload: gzipPayload(t, []byte(validPayload)),
+			opts:    []VerifierOption{WithGzipPayloads(int64(len(validPayload)))},
+		},
+		{
+			name:        "decompression bomb",
+			payload:     bomb,
+			opts:        []VerifierOption{WithGzipPayloads(0)},
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "corrupt gzip payload",
+			payload:     append([]byte{0x1f, 0x8b}, "not gzip"...),
+			opts:        []VerifierOption{WithGzipPayloads(0)},
+			expectedErr: ErrInvalidPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{
+				PublicKeyID:       "ed25519-key",
+				Signature:         ed25519.Sign(ed25519PrivateKey, tc.payload),
+				SerializedPayload: tc.payload,
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// hmacSha256Size is the size of an HMAC-SHA256 in bytes.
+const hmacSha256Size = sha256.Size
+
+// hmacSecret is the parsed form of the shared secret of an Hmac PublicKey.
+type hmacSecret []byte
+
+// verifyHmac verifies an HMAC-SHA256 `mac` over `payload`.
+// `publicKey.KeyData` is the shared secret. Anyone holding the secret can
+// create a valid HMAC, so Hmac keys only authenticate Attestations within a
+// pipeline whose every holder of the secret is trusted.
+func verifyHmac(mac []byte, payload []byte, publicKey PublicKey) error {
+	secret, err := hmacKey(publicKey)
+	if err != nil {
+		return err
+	}
+	if len(mac) != hmacSha256Size {
+		return fmt.Errorf("expected %d byte HMAC-SHA256, got %d bytes", hmacSha256Size, len(mac))
+	}
+	h := hmac.New(sha256.New, secret)
+	h.Write(payload)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return errors.New("failed to verify HMAC-SHA256")
+	}
+	return nil
+}
+
+// parseHmacSecret validates the shared secret of an Hmac PublicKey.
+func parseHmacSecret(keyData []byte) (hmacSecret, error) {
+	if len(keyData) == 0 {
+		return nil, errors.New("expected non-empty HMAC secret")
+	}
+	return hmacSecret(keyData), nil
+}
+
+// hmacKey returns the parsed form of an Hmac PublicKey, parsing KeyData if
+// the Verifier has not already done so.
+func hmacKey(publicKey PublicKey) (hmacSecret, error) {
+	if secret, ok := publicKey.parsedKey.(hmacSecret); ok {
+		return secret, nil
+	}
+	return parseHmacSecret(publicKey.KeyData)
+}
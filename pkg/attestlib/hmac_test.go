@@ -0,0 +1,144 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+var hmacSecretKey = []byte("attestlib-hmac-test-shared-secret")
+
+func createHmac(secret []byte, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func TestVerifyHmacAttestation(t *testing.T) {
+	publicKey, err := NewPublicKey(Hmac, HmacSha256, hmacSecretKey, "hmac-key")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	validMac := createHmac(hmacSecretKey, validPayload)
+	corruptedMac := append([]byte{}, validMac...)
+	corruptedMac[0] ^= 0xff
+
+	tcs := []struct {
+		name        string
+		mac         []byte
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:    "valid MAC",
+			mac:     validMac,
+			payload: validPayload,
+		},
+		{
+			name:        "MAC by another secret",
+			mac:         createHmac([]byte("attestlib-hmac-other-shared-secret"), validPayload),
+			payload:     validPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "corrupted MAC",
+			mac:         corruptedMac,
+			payload:     validPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "MAC over another payload",
+			mac:         validMac,
+			payload:     otherDigestPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "truncated MAC",
+			mac:         validMac[:hmacSha256Size/2],
+			payload:     validPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "empty MAC",
+			mac:         []byte{},
+			payload:     validPayload,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "valid MAC for another digest",
+			mac:         createHmac(hmacSecretKey, otherDigestPayload),
+			payload:     otherDigestPayload,
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: "hmac-key", Signature: tc.mac, SerializedPayload: []byte(tc.payload)}
+			err := v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewPublicKeyHmac(t *testing.T) {
+	tcs := []struct {
+		name      string
+		algorithm SignatureAlgorithm
+		keyID     string
+	}{
+		{"missing key ID", HmacSha256, ""},
+		{"Ed25519 signature algorithm", EddsaEd25519, "hmac-key"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewPublicKey(Hmac, tc.algorithm, hmacSecretKey, tc.keyID); err == nil {
+				t.Errorf("NewPublicKey(...) = nil, expected non nil")
+			}
+		})
+	}
+}
+
+func TestNewVerifierMalformedHmacKey(t *testing.T) {
+	tcs := []struct {
+		name      string
+		keyData   []byte
+		algorithm SignatureAlgorithm
+	}{
+		{"empty secret", nil, HmacSha256},
+		{"Ed25519 signature algorithm", hmacSecretKey, EddsaEd25519},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey := PublicKey{AuthenticatorType: Hmac, SignatureAlgorithm: tc.algorithm, KeyData: tc.keyData, ID: "hmac-key"}
+			if _, err := NewVerifier(helloAppImage, []PublicKey{publicKey}); !errors.Is(err, ErrInvalidPublicKey) {
+				t.Errorf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+			}
+		})
+	}
+}
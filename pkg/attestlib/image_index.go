@@ -0,0 +1,66 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// imageIndex is a multi-arch image index, or manifest list, and the digests
+// of the per-platform images it lists.
+type imageIndex struct {
+	digest       string
+	childDigests []string
+}
+
+// addImageIndexDigests adds the digests of the image index of the verifier and
+// of its children to the acceptable digests, so that a payload may contain
+// any of them. The image digest must be the index digest or one of the child
+// digests.
+func (v *verifier) addImageIndexDigests() error {
+	digests := append([]string{v.imageIndex.digest}, v.imageIndex.childDigests...)
+	for i, digest := range digests {
+		parsedDigest, err := parseDigest(digest)
+		if err != nil {
+			return errors.Wrapf(err, "invalid image index digest %q", digest)
+		}
+		digests[i] = parsedDigest.String()
+	}
+	found := false
+	for _, digest := range digests {
+		if digest == v.ImageDigest {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("image digest %s is neither the image index digest %s nor one of its children", v.ImageDigest, digests[0])
+	}
+	seen := map[string]bool{v.ImageDigest: true}
+	for _, digest := range v.acceptableDigests {
+		seen[digest] = true
+	}
+	for _, digest := range digests {
+		if !seen[digest] {
+			seen[digest] = true
+			v.acceptableDigests = append(v.acceptableDigests, digest)
+		}
+	}
+	return nil
+}
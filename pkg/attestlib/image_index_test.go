@@ -0,0 +1,106 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAttestationImageIndex(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	// The payload holds otherHelloAppDigest.
+	att := &Attestation{
+		PublicKeyID:       "ed25519-key",
+		Signature:         ed25519.Sign(ed25519PrivateKey, []byte(otherDigestPayload)),
+		SerializedPayload: []byte(otherDigestPayload),
+	}
+	indexDigest := "sha256:" + strings.Repeat("1", 64)
+	childDigest := "sha256:" + strings.Repeat("2", 64)
+
+	tcs := []struct {
+		name         string
+		image        string
+		indexDigest  string
+		childDigests []string
+		expectedErr  error
+	}{
+		{
+			name:         "child image, payload matches index",
+			image:        helloAppImage,
+			indexDigest:  otherHelloAppDigest,
+			childDigests: []string{helloAppDigest, childDigest},
+		},
+		{
+			name:         "index image, payload matches child",
+			image:        "gcr.io/google-samples/hello-app@" + indexDigest,
+			indexDigest:  indexDigest,
+			childDigests: []string{childDigest, otherHelloAppDigest},
+		},
+		{
+			name:         "child image, payload matches other child",
+			image:        helloAppImage,
+			indexDigest:  indexDigest,
+			childDigests: []string{helloAppDigest, otherHelloAppDigest},
+		},
+		{
+			name:         "payload matches neither index nor children",
+			image:        helloAppImage,
+			indexDigest:  indexDigest,
+			childDigests: []string{helloAppDigest, childDigest},
+			expectedErr:  ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(tc.image, []PublicKey{publicKey}, WithImageIndex(tc.indexDigest, tc.childDigests...))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierInvalidImageIndex(t *testing.T) {
+	tcs := []struct {
+		name         string
+		indexDigest  string
+		childDigests []string
+	}{
+		{"image not in index", otherHelloAppDigest, []string{"sha256:" + strings.Repeat("2", 64)}},
+		{"invalid index digest", "sha256:1234", []string{helloAppDigest}},
+		{"invalid child digest", otherHelloAppDigest, []string{helloAppDigest, "sha256:1234"}},
+		{"empty index digest", "", []string{helloAppDigest}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewVerifier(helloAppImage, nil, WithImageIndex(tc.indexDigest, tc.childDigests...)); err == nil {
+				t.Errorf("NewVerifier(...) = nil, expected non nil")
+			}
+		})
+	}
+}
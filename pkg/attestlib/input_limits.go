@@ -0,0 +1,101 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+	"io"
+)
+
+// Default size limits of a Verifier, which WithMaxSignatureSize,
+// WithMaxPayloadSize, WithMaxDecodedPayloadSize and
+// WithMaxStreamedPayloadSize replace. Signatures are allowed as much as
+// payloads, since PGP and JWT signatures and envelopes embed their payload.
+// Streamed payloads are hashed as they are read rather than held in memory,
+// so they may be much larger.
+const (
+	defaultMaxSignatureSize       = 4 << 20
+	defaultMaxPayloadSize         = 4 << 20
+	defaultMaxDecodedPayloadSize  = 4 << 20
+	defaultMaxStreamedPayloadSize = 1 << 30
+)
+
+// checkAttestationSize checks the Signature, the Signature of each of
+// Signatures and the SerializedPayload of `att` against the size limits of
+// the verifier, before they are decoded.
+func (v *verifier) checkAttestationSize(att *Attestation) error {
+	if att == nil {
+		return nil
+	}
+	if err := checkInputSize("signature", len(att.Signature), v.maxSignatureSize); err != nil {
+		return err
+	}
+	for i, entry := range att.Signatures {
+		if err := checkInputSize(fmt.Sprintf("signature %d", i), len(entry.Signature), v.maxSignatureSize); err != nil {
+			return err
+		}
+	}
+	return checkInputSize("serialized payload", len(att.SerializedPayload), v.maxPayloadSize)
+}
+
+// checkDecodedPayloadSize checks a payload whose signature has been verified,
+// e.g. one extracted from a PGP signature, JWT or envelope, against the size
+// limit of the verifier, before it is parsed.
+func (v *verifier) checkDecodedPayloadSize(payload []byte) error {
+	return checkInputSize("decoded payload", len(payload), v.maxDecodedPayloadSize)
+}
+
+// sizeLimitedReader reads from `r` and fails with ErrInputTooLarge once more
+// than `maxSize` bytes have been read from it, and from then on.
+type sizeLimitedReader struct {
+	r         io.Reader
+	input     string
+	maxSize   int64
+	remaining int64
+}
+
+func newSizeLimitedReader(r io.Reader, input string, maxSize int64) *sizeLimitedReader {
+	return &sizeLimitedReader{r: r, input: input, maxSize: maxSize, remaining: maxSize}
+}
+
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, r.err()
+	}
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n, r.err()
+	}
+	return n, err
+}
+
+func (r *sizeLimitedReader) err() error {
+	return fmt.Errorf("%w: %s exceeds the limit of %d bytes", ErrInputTooLarge, r.input, r.maxSize)
+}
+
+// checkInputSize returns ErrInputTooLarge if `size` exceeds `maxSize`. A
+// `maxSize` of zero or less is no limit.
+func checkInputSize(input string, size int, maxSize int64) error {
+	if maxSize > 0 && int64(size) > maxSize {
+		return fmt.Errorf("%w: %s has %d bytes, more than the limit of %d bytes", ErrInputTooLarge, input, size, maxSize)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestVerifyAttestationSizeLimits(t *testing.T) {
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	// The default limits accept a payload of 4 MiB, but not one more byte.
+	paddedPayload := func(size int) []byte {
+		return append([]byte(validPayload[:len(validPayload)-1]+strings.Repeat(" ", size-len(validPayload))), '}')
+	}
+	largePayload := paddedPayload(defaultMaxPayloadSize)
+	oversizedPayload := paddedPayload(defaultMaxPayloadSize + 1)
+	pgpKey := PublicKey{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(gpgPublicKey), ID: gpgPublicKeyID}
+	pgpClock := WithClock(ClockFunc(func() time.Time { return gpgSignatureTime }))
+	// An unsigned, compressed PGP message whose payload decompresses to 64
+	// times the decoded payload limit, while the message itself is within the
+	// limits. It must be rejected for its size before it is read to its end.
+	pgpBomb := compressPgpMessage(t, pgpLiteralMessage(t, paddedPayload(64*defaultMaxDecodedPayloadSize)))
+
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		publicKey   PublicKey
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			name:      "within the limits",
+			att:       &Attestation{PublicKeyID: "ed25519-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			publicKey: ed25519Key,
+			opts:      []VerifierOption{WithMaxSignatureSize(int64(len(signature))), WithMaxPayloadSize(int64(len(validPayload))), WithMaxDecodedPayloadSize(int64(len(validPayload)))},
+		},
+		{
+			name:      "payload at the default limit",
+			att:       &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, largePayload), SerializedPayload: largePayload},
+			publicKey: ed25519Key,
+		},
+		{
+			name:        "payload over the default limit",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, oversizedPayload), SerializedPayload: oversizedPayload},
+			publicKey:   ed25519Key,
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:      "payload over the default limit without a limit",
+			att:       &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, oversizedPayload), SerializedPayload: oversizedPayload},
+			publicKey: ed25519Key,
+			opts:      []VerifierOption{WithMaxPayloadSize(0), WithMaxDecodedPayloadSize(0)},
+		},
+		{
+			name:        "signature over the limit",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			publicKey:   ed25519Key,
+			opts:        []VerifierOption{WithMaxSignatureSize(int64(len(signature) - 1))},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "encoded signature over the limit",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: []byte(strings.Repeat("A", defaultMaxSignatureSize+1)), SerializedPayload: []byte(validPayload), SignatureEncoding: Base64Encoding},
+			publicKey:   ed25519Key,
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name: "one of several signatures over the limit",
+			att: &Attestation{
+				Signatures: []SignatureEntry{
+					{PublicKeyID: "ed25519-key", Signature: signature},
+					{PublicKeyID: "other-key", Signature: bytes.Repeat([]byte{0}, 2*len(signature))},
+				},
+				SerializedPayload: []byte(validPayload),
+			},
+			publicKey:   ed25519Key,
+			opts:        []VerifierOption{WithMaxSignatureSize(int64(len(signature)))},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "serialized payload over the limit",
+			att:         &Attestation{PublicKeyID: "ed25519-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			publicKey:   ed25519Key,
+			opts:        []VerifierOption{WithMaxPayloadSize(int64(len(validPayload) - 1))},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:      "payload decoded from a JWT within the limit",
+			att:       &Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256)},
+			publicKey: ec256JwtPubKey,
+			opts:      []VerifierOption{WithMaxDecodedPayloadSize(int64(len(validPayload)))},
+		},
+		{
+			name:      "compressed PGP payload within the limit",
+			att:       &Attestation{PublicKeyID: gpgPublicKeyID, Signature: compressPgpMessage(t, newGpgSignatureWithHash(t, validPayload, crypto.SHA256, false))},
+			publicKey: pgpKey,
+			opts:      []VerifierOption{pgpClock, WithMaxDecodedPayloadSize(int64(len(validPayload)))},
+		},
+		{
+			name:        "compressed PGP payload over the limit",
+			att:         &Attestation{PublicKeyID: gpgPublicKeyID, Signature: pgpBomb},
+			publicKey:   pgpKey,
+			opts:        []VerifierOption{pgpClock},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "payload decoded from a JWT over the limit",
+			att:         &Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256)},
+			publicKey:   ec256JwtPubKey,
+			opts:        []VerifierOption{WithMaxDecodedPayloadSize(int64(len(validPayload) - 1))},
+			expectedErr: ErrInputTooLarge,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// pgpLiteralMessage returns an unsigned PGP message holding `payload`.
+func pgpLiteralMessage(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	var message bytes.Buffer
+	w, err := packet.SerializeLiteral(nopWriteCloser{&message}, true, "", 0)
+	if err != nil {
+		t.Fatalf("error serializing PGP message: %v", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("error serializing PGP message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error serializing PGP message: %v", err)
+	}
+	return message.Bytes()
+}
+
+// compressPgpMessage wraps the PGP message `message` in a compressed data
+// packet.
+func compressPgpMessage(t *testing.T, message []byte) []byte {
+	t.Helper()
+	var compressed bytes.Buffer
+	w, err := packet.SerializeCompressed(nopWriteCloser{&compressed}, packet.CompressionZLIB, nil)
+	if err != nil {
+		t.Fatalf("error compressing PGP message: %v", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		t.Fatalf("error compressing PGP message: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error compressing PGP message: %v", err)
+	}
+	return compressed.Bytes()
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
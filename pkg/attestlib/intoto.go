@@ -0,0 +1,128 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// inTotoStatementTypePrefix starts the _type of every version of the in-toto
+// Statement format.
+const inTotoStatementTypePrefix = "https://in-toto.io/Statement/"
+
+// inTotoStatement represents a JSON-encoded in-toto Statement, defined here:
+// https://github.com/in-toto/attestation/blob/main/spec/README.md#statement
+// The predicate is kept as raw JSON.
+type inTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []inTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate"`
+}
+
+type inTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// isInTotoStatement reports whether `payload` is an in-toto Statement rather
+// than an Atomic Host signature.
+func isInTotoStatement(payload []byte) bool {
+	statement := struct {
+		Type string `json:"_type"`
+	}{}
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return false
+	}
+	return strings.HasPrefix(statement.Type, inTotoStatementTypePrefix)
+}
+
+// convertInTotoAttestation parses a verified in-toto Statement into an
+// AuthenticatedAttestation holding the digests of its subjects in every
+// supported algorithm.
+func convertInTotoAttestation(payload []byte) (*AuthenticatedAttestation, error) {
+	return parseInTotoStatement(payload, nil)
+}
+
+// parseInTotoStatement parses a verified in-toto Statement like
+// convertInTotoAttestation. If `predicateDigests` is not nil, it returns
+// further digest sets found in the predicate, which are added to the subject
+// digests.
+func parseInTotoStatement(payload []byte, predicateDigests func(predicateType string, predicate json.RawMessage) ([]map[string]string, error)) (*AuthenticatedAttestation, error) {
+	statement := &inTotoStatement{}
+	if err := json.Unmarshal(payload, statement); err != nil {
+		return nil, errors.Wrap(err, "error parsing in-toto statement")
+	}
+	if !strings.HasPrefix(statement.Type, inTotoStatementTypePrefix) {
+		return nil, errors.Errorf("unexpected in-toto statement type %q", statement.Type)
+	}
+	if statement.PredicateType == "" {
+		return nil, errors.New("in-toto statement is missing predicateType")
+	}
+	authAtt := &AuthenticatedAttestation{PredicateType: statement.PredicateType, Predicate: statement.Predicate}
+	for _, subject := range statement.Subject {
+		authAtt.SubjectDigests = appendDigestSet(authAtt.SubjectDigests, subject.Digest)
+	}
+	if predicateDigests != nil {
+		digestSets, err := predicateDigests(statement.PredicateType, statement.Predicate)
+		if err != nil {
+			return nil, err
+		}
+		for _, digestSet := range digestSets {
+			authAtt.SubjectDigests = appendDigestSet(authAtt.SubjectDigests, digestSet)
+		}
+	}
+	if len(authAtt.SubjectDigests) == 0 {
+		return nil, errors.New("in-toto statement has no subject with a supported digest")
+	}
+	return authAtt, nil
+}
+
+// appendDigestSet appends the digests of `digestSet`, a map from digest
+// algorithms to digest values as in in-toto subjects, in every supported
+// algorithm to `digests`.
+func appendDigestSet(digests []string, digestSet map[string]string) []string {
+	for _, algorithm := range digestAlgorithms {
+		digest, ok := digestSet[algorithm]
+		if !ok {
+			continue
+		}
+		// Some producers include the algorithm in the digest value, which
+		// parseDigest accepts as well.
+		if !strings.Contains(digest, ":") {
+			digest = algorithm + ":" + digest
+		}
+		digests = append(digests, digest)
+	}
+	return digests
+}
+
+// convertPayload parses a verified payload, which is either an in-toto
+// Statement, a notation payload or an Atomic Host signature, into an
+// AuthenticatedAttestation.
+func convertPayload(payload []byte) (*AuthenticatedAttestation, error) {
+	if isInTotoStatement(payload) {
+		return convertInTotoAttestation(payload)
+	}
+	if isNotationPayload(payload) {
+		return convertNotationPayload(payload)
+	}
+	return convertAuthenticatedAttestation(payload)
+}
@@ -0,0 +1,340 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const helloAppDigest = "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"
+
+const singleSubjectStatement = `{
+    "_type": "https://in-toto.io/Statement/v0.1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/hello-app",
+            "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v0.2",
+    "predicate": {}
+}`
+
+const multiSubjectStatement = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/other-app",
+            "digest": {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}
+        },
+        {
+            "name": "gcr.io/google-samples/hello-app",
+            "digest": {"sha256": "sha256:BEDB3FEB23E81D162E33976FD7B245ADFF00379F4755C0213E84405E5B1E0988"}
+        }
+    ],
+    "predicateType": "https://example.com/predicate/v1"
+}`
+
+const otherSubjectStatement = `{
+    "_type": "https://in-toto.io/Statement/v0.1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/other-app",
+            "digest": {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v0.2"
+}`
+
+func TestConvertInTotoAttestation(t *testing.T) {
+	tcs := []struct {
+		name        string
+		payload     string
+		expected    AuthenticatedAttestation
+		expectedErr bool
+	}{
+		{
+			name:    "single subject",
+			payload: singleSubjectStatement,
+			expected: AuthenticatedAttestation{
+				PredicateType:  "https://slsa.dev/provenance/v0.2",
+				Predicate:      json.RawMessage(`{}`),
+				SubjectDigests: []string{helloAppDigest},
+			},
+		},
+		{
+			name:    "multiple subjects with prefixed uppercase digest",
+			payload: multiSubjectStatement,
+			expected: AuthenticatedAttestation{
+				PredicateType:  "https://example.com/predicate/v1",
+				SubjectDigests: []string{"sha256:0000000000000000000000000000000000000000000000000000000000000000", "sha256:BEDB3FEB23E81D162E33976FD7B245ADFF00379F4755C0213E84405E5B1E0988"},
+			},
+		},
+		{
+			name:    "subject with sha256 and sha512 digests",
+			payload: `{"_type": "https://in-toto.io/Statement/v1", "subject": [{"digest": {"sha512": "` + strings.Repeat("ab", 64) + `", "sha256": "` + strings.TrimPrefix(helloAppDigest, "sha256:") + `"}}], "predicateType": "p"}`,
+			expected: AuthenticatedAttestation{
+				PredicateType:  "p",
+				SubjectDigests: []string{helloAppDigest, "sha512:" + strings.Repeat("ab", 64)},
+			},
+		},
+		{
+			name:        "missing predicate type",
+			payload:     `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"digest": {"sha256": "abcd"}}]}`,
+			expectedErr: true,
+		},
+		{
+			name:        "no subject with a supported digest",
+			payload:     `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"digest": {"sha1": "abcd"}}], "predicateType": "p"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "no subjects",
+			payload:     `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [], "predicateType": "p"}`,
+			expectedErr: true,
+		},
+		{
+			name:        "wrong statement type",
+			payload:     `{"_type": "https://example.com/Statement", "subject": [{"digest": {"sha256": "abcd"}}], "predicateType": "p"}`,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := convertInTotoAttestation([]byte(tc.payload))
+			if tc.expectedErr {
+				if err == nil {
+					t.Fatalf("convertInTotoAttestation(_) = %v, expected error", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertInTotoAttestation(_) = %v, expected nil", err)
+			}
+			if !reflect.DeepEqual(*actual, tc.expected) {
+				t.Errorf("convertInTotoAttestation(_) = %+v, want %+v", *actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCheckInTotoAttestation(t *testing.T) {
+	tcs := []struct {
+		name        string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:    "single matching subject",
+			payload: singleSubjectStatement,
+		},
+		{
+			name:    "one of several subjects matches",
+			payload: multiSubjectStatement,
+		},
+		{
+			name:        "no subject matches",
+			payload:     otherSubjectStatement,
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "malformed subject digest",
+			payload:     `{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"digest": {"sha256": "abcd"}}], "predicateType": "p"}`,
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:    "atomic host payload",
+			payload: validPayload,
+		},
+	}
+	c := authenticatedAttCheckerImpl{}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.CheckAuthenticatedAttestation([]byte(tc.payload), "gcr.io/google-samples/hello-app", []string{helloAppDigest}, convertPayload)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("CheckAuthenticatedAttestation(...) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("CheckAuthenticatedAttestation(...) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyInTotoAttestation(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, payload := range []string{singleSubjectStatement, multiSubjectStatement} {
+		att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(payload)), SerializedPayload: []byte(payload)}
+		if err := v.VerifyAttestation(att); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+		}
+	}
+	att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(otherSubjectStatement)), SerializedPayload: []byte(otherSubjectStatement)}
+	var mismatch *DigestMismatchError
+	if err := v.VerifyAttestation(att); !errors.As(err, &mismatch) {
+		t.Errorf("VerifyAttestation(_) = %v, want *DigestMismatchError", err)
+	}
+}
+
+func TestVerifyAttestationWithResultPredicate(t *testing.T) {
+	const scanStatement = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/hello-app",
+            "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+        }
+    ],
+    "predicateType": "https://example.com/vulnerability-scan/v1",
+    "predicate": {"scanner": "scanner-1", "critical": 0}
+}`
+	type scanPredicate struct {
+		Scanner  string `json:"scanner"`
+		Critical int    `json:"critical"`
+	}
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	sign := func(payload string) *Attestation {
+		return &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(payload)), SerializedPayload: []byte(payload)}
+	}
+
+	result, err := v.VerifyAttestationWithResult(sign(scanStatement))
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.PredicateType != "https://example.com/vulnerability-scan/v1" {
+		t.Errorf("PredicateType = %q, want the statement's predicate type", result.PredicateType)
+	}
+	var predicate scanPredicate
+	if err := result.UnmarshalPredicate(&predicate); err != nil {
+		t.Fatalf("UnmarshalPredicate(_) = %v, expected nil", err)
+	}
+	if predicate != (scanPredicate{Scanner: "scanner-1", Critical: 0}) {
+		t.Errorf("UnmarshalPredicate(_) = %+v, want the statement's predicate", predicate)
+	}
+	raw := result.Predicate()
+	copy(raw, "xxxx")
+	if err := result.UnmarshalPredicate(&predicate); err != nil {
+		t.Errorf("UnmarshalPredicate(_) = %v after modifying Predicate(), expected nil", err)
+	}
+
+	// Attestations that fail verification expose no result, and hence no
+	// predicate.
+	tampered := sign(scanStatement)
+	tampered.SerializedPayload = []byte(strings.Replace(scanStatement, `"critical": 0`, `"critical": 9`, 1))
+	if result, err := v.VerifyAttestationWithResult(tampered); err == nil || result != nil {
+		t.Errorf("VerifyAttestationWithResult(_) = (%+v, %v), expected no result for a tampered payload", result, err)
+	}
+	if result, err := v.VerifyAttestationWithResult(sign(otherSubjectStatement)); err == nil || result != nil {
+		t.Errorf("VerifyAttestationWithResult(_) = (%+v, %v), expected no result for another image", result, err)
+	}
+
+	// Atomic Host signatures have no predicate.
+	result, err = v.VerifyAttestationWithResult(sign(validPayload))
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.Predicate() != nil {
+		t.Errorf("Predicate() = %s, expected nil", result.Predicate())
+	}
+	if err := result.UnmarshalPredicate(&predicate); err == nil {
+		t.Errorf("UnmarshalPredicate(_) = nil, expected non nil")
+	}
+}
+
+func TestVerifyAttestationWithResultSubjectDigests(t *testing.T) {
+	const otherSubjectsStatement = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/other-app",
+            "digest": {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}
+        },
+        {
+            "name": "gcr.io/google-samples/third-app",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://example.com/predicate/v1"
+}`
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+
+	tcs := []struct {
+		name                   string
+		payload                string
+		expectedSubjectDigests []string
+		expectedErr            error
+	}{
+		{
+			name:    "image among several subjects",
+			payload: multiSubjectStatement,
+			expectedSubjectDigests: []string{
+				"sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"sha256:BEDB3FEB23E81D162E33976FD7B245ADFF00379F4755C0213E84405E5B1E0988",
+			},
+		},
+		{
+			name:                   "image as the only subject",
+			payload:                singleSubjectStatement,
+			expectedSubjectDigests: []string{helloAppDigest},
+		},
+		{
+			name:        "image not among several subjects",
+			payload:     otherSubjectsStatement,
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:    "Atomic Host signature",
+			payload: validPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			result, err := v.VerifyAttestationWithResult(att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) || result != nil {
+					t.Errorf("VerifyAttestationWithResult(_) = (%+v, %v), want no result and error matching %v", result, err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if !reflect.DeepEqual(result.SubjectDigests, tc.expectedSubjectDigests) {
+				t.Errorf("SubjectDigests = %v, expected %v", result.SubjectDigests, tc.expectedSubjectDigests)
+			}
+		})
+	}
+}
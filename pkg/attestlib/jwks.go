@@ -0,0 +1,195 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// jwkSet is a JSON Web Key Set, see RFC 7517 section 5.
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is a JSON Web Key, see RFC 7517 section 4. Only the members needed to
+// verify signatures are parsed.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// Crv, X and Y hold EC and OKP keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// N and E hold RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+}
+
+// jwkRsaAlgorithms maps JWS algorithm names and RSA key sizes to the
+// SignatureAlgorithm they denote.
+var jwkRsaAlgorithms = map[string]map[int]SignatureAlgorithm{
+	"RS256": {2048: RsaSignPkcs12048Sha256, 3072: RsaSignPkcs13072Sha256, 4096: RsaSignPkcs14096Sha256},
+	"RS384": {4096: RsaSignPkcs14096Sha384},
+	"RS512": {4096: RsaSignPkcs14096Sha512},
+	"PS256": {2048: RsaPss2048Sha256, 3072: RsaPss3072Sha256, 4096: RsaPss4096Sha256},
+	"PS512": {4096: RsaPss4096Sha512},
+}
+
+// jwkCurves maps JWK curve names to the elliptic curve and the
+// SignatureAlgorithm of ECDSA keys on that curve.
+var jwkCurves = map[string]struct {
+	curve elliptic.Curve
+	alg   SignatureAlgorithm
+}{
+	"P-256": {elliptic.P256(), EcdsaP256Sha256},
+	"P-384": {elliptic.P384(), EcdsaP384Sha384},
+	"P-521": {elliptic.P521(), EcdsaP521Sha512},
+}
+
+// ParseJwks parses a JSON Web Key Set into PublicKeys of the Jwt KeyType that
+// verify JWTs signed by its keys. The ID of each PublicKey is the kid of its
+// JWK, so the Verifier matches it against the kid of a token. RSA, EC and OKP
+// (Ed25519) keys are supported. RSA keys without an alg member are assumed to
+// sign with RS256. Keys that cannot be used, e.g. because they have an
+// unsupported kty, no kid, or are meant for encryption, are skipped, and a
+// warning is returned for each of them. An error is only returned if `data`
+// is not a JSON Web Key Set.
+func ParseJwks(data []byte) ([]PublicKey, []string, error) {
+	set := jwkSet{}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing JWKS")
+	}
+	var publicKeys []PublicKey
+	var warnings []string
+	for i, key := range set.Keys {
+		publicKey, err := key.publicKey()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("skipping key %d (kid %q): %v", i, key.Kid, err))
+			continue
+		}
+		publicKeys = append(publicKeys, *publicKey)
+	}
+	return publicKeys, warnings, nil
+}
+
+// publicKey converts the JWK to a Jwt PublicKey holding the PEM encoding of
+// the key.
+func (k jwk) publicKey() (*PublicKey, error) {
+	if k.Kid == "" {
+		return nil, errors.New("missing kid")
+	}
+	if k.Use != "" && k.Use != "sig" {
+		return nil, fmt.Errorf("unsupported use %q", k.Use)
+	}
+	var pub crypto.PublicKey
+	var alg SignatureAlgorithm
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJwkInt(k.N)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid n")
+		}
+		e, err := decodeJwkInt(k.E)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid e")
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e is too large")
+		}
+		name := k.Alg
+		if name == "" {
+			name = "RS256"
+		}
+		algs, ok := jwkRsaAlgorithms[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported alg %q for RSA key", name)
+		}
+		if alg, ok = algs[n.BitLen()]; !ok {
+			return nil, fmt.Errorf("unsupported %d bit RSA key for alg %q", n.BitLen(), name)
+		}
+		pub = &rsa.PublicKey{N: n, E: int(e.Int64())}
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported crv %q for EC key", k.Crv)
+		}
+		if k.Alg != "" && k.Alg != getAlgName(curve.alg) {
+			return nil, fmt.Errorf("unsupported alg %q for crv %q", k.Alg, k.Crv)
+		}
+		x, err := decodeJwkInt(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid x")
+		}
+		y, err := decodeJwkInt(k.Y)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid y")
+		}
+		if !curve.curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		pub, alg = &ecdsa.PublicKey{Curve: curve.curve, X: x, Y: y}, curve.alg
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported crv %q for OKP key", k.Crv)
+		}
+		if k.Alg != "" && k.Alg != "EdDSA" {
+			return nil, fmt.Errorf("unsupported alg %q for OKP key", k.Alg)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid x")
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("expected %d byte Ed25519 public key, got %d bytes", ed25519.PublicKeySize, len(x))
+		}
+		pub, alg = ed25519.PublicKey(x), EddsaEd25519
+	default:
+		return nil, fmt.Errorf("unsupported kty %q", k.Kty)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding public key")
+	}
+	keyData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return NewPublicKey(Jwt, alg, keyData, k.Kid)
+}
+
+// decodeJwkInt decodes a base64url-encoded big-endian integer.
+func decodeJwkInt(value string) (*big.Int, error) {
+	if value == "" {
+		return nil, errors.New("missing value")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultJwksTTL is how long a fetched JWKS is cached when the response has
+// no Cache-Control max-age directive.
+const defaultJwksTTL = 5 * time.Minute
+
+// maxJwksSize is the maximum size of a fetched JWKS document.
+const maxJwksSize = 1 << 20
+
+// JwksSource provides the Jwt PublicKeys of a JSON Web Key Set served at an
+// HTTPS URL, such as the jwks_uri of an OpenID Connect provider. The key set
+// is cached for as long as the Cache-Control header of the response allows,
+// and is fetched again when a JWT names a kid that is not in the cached set,
+// so that rotated keys are picked up without waiting for the cache to expire.
+// A JwksSource is safe for concurrent use.
+type JwksSource struct {
+	url    string
+	client *http.Client
+	clock  Clock
+
+	mu sync.Mutex
+	// keys caches the fetched public keys by ID.
+	keys map[string][]PublicKey
+	// expiry is the time at which the cached keys must be fetched again.
+	expiry time.Time
+}
+
+// NewJwksSource creates a JwksSource that fetches the JWKS at `jwksURL`, which
+// must be an HTTPS URL, with `client`. If `client` is nil,
+// http.DefaultClient is used.
+func NewJwksSource(jwksURL string, client *http.Client) (*JwksSource, error) {
+	u, err := url.Parse(jwksURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid JWKS URL")
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("JWKS URL %q is not an HTTPS URL", jwksURL)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &JwksSource{
+		url:    jwksURL,
+		client: client,
+		clock:  SystemClock,
+	}, nil
+}
+
+// publicKeys returns the public keys with ID `kid`. The cached key set is
+// fetched if it has expired, and fetched again at most once if it does not
+// contain `kid`. Fetches that fail with network errors or server errors are
+// retried according to `retry`.
+func (s *JwksSource) publicKeys(ctx context.Context, kid string, retry retryPolicy) ([]PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refreshed := false
+	if s.keys == nil || !s.clock.Now().Before(s.expiry) {
+		if err := s.refresh(ctx, retry); err != nil {
+			return nil, err
+		}
+		refreshed = true
+	}
+	if keys := s.keys[kid]; len(keys) > 0 || refreshed {
+		return keys, nil
+	}
+	if err := s.refresh(ctx, retry); err != nil {
+		return nil, err
+	}
+	return s.keys[kid], nil
+}
+
+// check fetches and parses the JWKS, even if the cached key set has not
+// expired.
+func (s *JwksSource) check(ctx context.Context, retry retryPolicy) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refresh(ctx, retry)
+}
+
+// refresh fetches and parses the JWKS, replacing the cached keys. Keys that
+// ParseJwks skips are left out of the cache. Callers must hold s.mu.
+func (s *JwksSource) refresh(ctx context.Context, retry retryPolicy) error {
+	var data []byte
+	var header http.Header
+	attempts, err := retry.do(ctx, isTransientError, func() error {
+		var err error
+		data, header, err = s.fetch(ctx)
+		return err
+	})
+	if isTransientError(err) {
+		return fmt.Errorf("%w: %v after %d attempts", ErrRetriesExhausted, err, attempts)
+	}
+	if err != nil {
+		return err
+	}
+	publicKeys, _, err := ParseJwks(data)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing JWKS from %q", s.url)
+	}
+
+	keys := map[string][]PublicKey{}
+	for _, publicKey := range publicKeys {
+		parsedKey, err := parseKeyData(publicKey)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing public key %q of JWKS %q", publicKey.ID, s.url)
+		}
+		publicKey.parsedKey = parsedKey
+		keys[publicKey.ID] = append(keys[publicKey.ID], publicKey)
+	}
+	s.keys = keys
+	s.expiry = s.clock.Now().Add(jwksCacheTTL(header.Get("Cache-Control")))
+	return nil
+}
+
+// fetch requests the JWKS and returns its body and response headers. Network
+// errors and server errors are returned as transientErrors.
+func (s *JwksSource) fetch(ctx context.Context) ([]byte, http.Header, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating JWKS request")
+	}
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		return nil, nil, transientError{errors.Wrapf(err, "error fetching JWKS from %q", s.url)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("error fetching JWKS from %q: %s", s.url, resp.Status)
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, nil, transientError{err}
+		}
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJwksSize))
+	if err != nil {
+		return nil, nil, transientError{errors.Wrapf(err, "error reading JWKS from %q", s.url)}
+	}
+	return data, resp.Header, nil
+}
+
+// jwksCacheTTL returns how long a JWKS may be cached according to the
+// Cache-Control header `cacheControl`. The no-cache and no-store directives
+// disable caching; without a max-age directive, defaultJwksTTL is used.
+func jwksCacheTTL(cacheControl string) time.Duration {
+	ttl := defaultJwksTTL
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err == nil && seconds >= 0 {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return ttl
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ecdsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// jwksServer is a fake JWKS endpoint that counts its requests and whose key
+// set can be rotated.
+type jwksServer struct {
+	*httptest.Server
+	cacheControl string
+
+	mu       sync.Mutex
+	jwks     string
+	requests int
+}
+
+func newJwksServer(jwks string, cacheControl string) *jwksServer {
+	s := &jwksServer{jwks: jwks, cacheControl: cacheControl}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests++
+		w.Header().Set("Cache-Control", s.cacheControl)
+		fmt.Fprint(w, s.jwks)
+	}))
+	return s
+}
+
+func (s *jwksServer) rotate(jwks string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jwks = jwks
+}
+
+func (s *jwksServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ecJwks returns a JWKS containing the EC test key with ID `kid`.
+func ecJwks(t *testing.T, kid string) string {
+	t.Helper()
+	ecKey, err := parsePkixPublicKey([]byte(ec256PubKey))
+	if err != nil {
+		t.Fatalf("error parsing public key: %v", err)
+	}
+	x := ecKey.(*ecdsa.PublicKey).X.FillBytes(make([]byte, 32))
+	y := ecKey.(*ecdsa.PublicKey).Y.FillBytes(make([]byte, 32))
+	return fmt.Sprintf(`{"keys": [{"kty": "EC", "kid": %q, "crv": "P-256", "x": %q, "y": %q}]}`,
+		kid, base64.RawURLEncoding.EncodeToString(x), base64.RawURLEncoding.EncodeToString(y))
+}
+
+func ecJwtAttestation(t *testing.T, kid string) *Attestation {
+	t.Helper()
+	header := fmt.Sprintf(`{"alg":"ES256","typ":"JWT","kid":%q}`, kid)
+	return &Attestation{PublicKeyID: kid, Signature: createJwt(t, header, validPayload, ec256PrivateKey, EcdsaP256Sha256)}
+}
+
+func TestVerifyAttestationJwksSourceRotation(t *testing.T) {
+	server := newJwksServer(ecJwks(t, "key-1"), "max-age=3600")
+	defer server.Close()
+	source, err := NewJwksSource(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewJwksSource(...) = %v, expected nil", err)
+	}
+	v, err := NewVerifier(helloAppImage, nil, WithJwksSource(source))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+
+	steps := []struct {
+		name             string
+		rotateTo         string
+		keyID            string
+		expectedErr      error
+		expectedRequests int
+	}{
+		{
+			name:             "first verification fetches the key set",
+			keyID:            "key-1",
+			expectedRequests: 1,
+		},
+		{
+			name:             "cached key set is reused",
+			keyID:            "key-1",
+			expectedRequests: 1,
+		},
+		{
+			name:             "unknown kid refreshes the key set",
+			rotateTo:         ecJwks(t, "key-2"),
+			keyID:            "key-2",
+			expectedRequests: 2,
+		},
+		{
+			name:             "rotated out key is unknown after refresh",
+			keyID:            "key-1",
+			expectedErr:      ErrNoMatchingKey,
+			expectedRequests: 3,
+		},
+		{
+			name:             "missing kid refreshes at most once",
+			keyID:            "key-3",
+			expectedErr:      ErrNoMatchingKey,
+			expectedRequests: 4,
+		},
+	}
+	for _, step := range steps {
+		if step.rotateTo != "" {
+			server.rotate(step.rotateTo)
+		}
+		err := v.VerifyAttestation(ecJwtAttestation(t, step.keyID))
+		if step.expectedErr == nil && err != nil {
+			t.Errorf("%s: VerifyAttestation(_) = %v, expected nil", step.name, err)
+		}
+		if step.expectedErr != nil && !errors.Is(err, step.expectedErr) {
+			t.Errorf("%s: VerifyAttestation(_) = %v, want error matching %v", step.name, err, step.expectedErr)
+		}
+		if got := server.requestCount(); got != step.expectedRequests {
+			t.Errorf("%s: JWKS fetched %d times, expected %d", step.name, got, step.expectedRequests)
+		}
+	}
+}
+
+func TestJwksSourceCacheExpiry(t *testing.T) {
+	server := newJwksServer(ecJwks(t, "key-1"), "public, max-age=60")
+	defer server.Close()
+	source, err := NewJwksSource(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewJwksSource(...) = %v, expected nil", err)
+	}
+	now := time.Now()
+	source.clock = ClockFunc(func() time.Time { return now })
+	v, err := NewVerifier(helloAppImage, nil, WithJwksSource(source))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+
+	for _, elapsed := range []time.Duration{0, 30 * time.Second, 61 * time.Second} {
+		now = now.Add(elapsed)
+		if err := v.VerifyAttestation(ecJwtAttestation(t, "key-1")); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+		}
+	}
+	if got := server.requestCount(); got != 2 {
+		t.Errorf("JWKS fetched %d times, expected 2", got)
+	}
+}
+
+func TestJwksSourceFetchError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	source, err := NewJwksSource(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewJwksSource(...) = %v, expected nil", err)
+	}
+	v, err := NewVerifier(helloAppImage, nil, WithJwksSource(source))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(ecJwtAttestation(t, "key-1")); err == nil {
+		t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+	}
+}
+
+func TestNewJwksSourceRequiresHTTPS(t *testing.T) {
+	if _, err := NewJwksSource("http://example.com/jwks.json", nil); err == nil {
+		t.Errorf("NewJwksSource(...) = nil, expected non nil")
+	}
+}
+
+func TestJwksCacheTTL(t *testing.T) {
+	tcs := []struct {
+		name         string
+		cacheControl string
+		expected     time.Duration
+	}{
+		{"no header", "", defaultJwksTTL},
+		{"max-age", "max-age=600", 10 * time.Minute},
+		{"max-age with other directives", "public, Max-Age=30, must-revalidate", 30 * time.Second},
+		{"invalid max-age", "max-age=soon", defaultJwksTTL},
+		{"no-cache", "max-age=600, no-cache", 0},
+		{"no-store", "no-store", 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := jwksCacheTTL(tc.cacheControl); got != tc.expected {
+				t.Errorf("jwksCacheTTL(%q) = %v, expected %v", tc.cacheControl, got, tc.expected)
+			}
+		})
+	}
+}
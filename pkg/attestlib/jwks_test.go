@@ -0,0 +1,172 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// testJwks returns a JWKS containing the RSA, EC and Ed25519 test keys, and
+// keys that ParseJwks must skip.
+func testJwks(t *testing.T) string {
+	t.Helper()
+	rsaKey, err := parsePkixPublicKey([]byte(rsa2048PubKey))
+	if err != nil {
+		t.Fatalf("error parsing public key: %v", err)
+	}
+	ecKey, err := parsePkixPublicKey([]byte(ec256PubKey))
+	if err != nil {
+		t.Fatalf("error parsing public key: %v", err)
+	}
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	n := rsaKey.(*rsa.PublicKey).N.Bytes()
+	e := big.NewInt(int64(rsaKey.(*rsa.PublicKey).E)).Bytes()
+	x := ecKey.(*ecdsa.PublicKey).X.FillBytes(make([]byte, 32))
+	y := ecKey.(*ecdsa.PublicKey).Y.FillBytes(make([]byte, 32))
+	return fmt.Sprintf(`{"keys": [
+		{"kty": "RSA", "kid": "rsa-key", "use": "sig", "n": %q, "e": %q},
+		{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "OKP", "kid": "ed25519-key", "crv": "Ed25519", "alg": "EdDSA", "x": %q},
+		{"kty": "oct", "kid": "hmac-key", "k": "c2VjcmV0"},
+		{"kty": "EC", "crv": "P-256", "x": %q, "y": %q},
+		{"kty": "RSA", "kid": "encryption-key", "use": "enc", "n": %q, "e": %q}
+	]}`, b64(n), b64(e), b64(x), b64(y), b64(ed25519PubKey), b64(x), b64(y), b64(n), b64(e))
+}
+
+func TestParseJwks(t *testing.T) {
+	publicKeys, warnings, err := ParseJwks([]byte(testJwks(t)))
+	if err != nil {
+		t.Fatalf("ParseJwks(...) = %v, expected nil", err)
+	}
+	expected := map[string]SignatureAlgorithm{
+		"rsa-key":     RsaSignPkcs12048Sha256,
+		"ec-key":      EcdsaP256Sha256,
+		"ed25519-key": EddsaEd25519,
+	}
+	if len(publicKeys) != len(expected) {
+		t.Fatalf("ParseJwks(...) returned %d keys, expected %d", len(publicKeys), len(expected))
+	}
+	for _, publicKey := range publicKeys {
+		if publicKey.AuthenticatorType != Jwt {
+			t.Errorf("key %q has AuthenticatorType %v, expected Jwt", publicKey.ID, publicKey.AuthenticatorType)
+		}
+		if alg, ok := expected[publicKey.ID]; !ok || publicKey.SignatureAlgorithm != alg {
+			t.Errorf("key %q has SignatureAlgorithm %v, expected %v", publicKey.ID, publicKey.SignatureAlgorithm, alg)
+		}
+	}
+	if len(warnings) != 3 {
+		t.Fatalf("ParseJwks(...) returned warnings %q, expected 3", warnings)
+	}
+	for i, substr := range []string{`unsupported kty "oct"`, "missing kid", `unsupported use "enc"`} {
+		if !strings.Contains(warnings[i], substr) {
+			t.Errorf("warning %q does not contain %q", warnings[i], substr)
+		}
+	}
+}
+
+func TestParseJwksInvalidKeys(t *testing.T) {
+	tcs := []struct {
+		name string
+		jwks string
+	}{
+		{
+			name: "EC point not on curve",
+			jwks: `{"keys": [{"kty": "EC", "kid": "ec-key", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		},
+		{
+			name: "unsupported curve",
+			jwks: `{"keys": [{"kty": "EC", "kid": "ec-key", "crv": "secp256k1", "x": "AQ", "y": "AQ"}]}`,
+		},
+		{
+			name: "short Ed25519 key",
+			jwks: `{"keys": [{"kty": "OKP", "kid": "ed25519-key", "crv": "Ed25519", "x": "AQ"}]}`,
+		},
+		{
+			name: "RSA key without modulus",
+			jwks: `{"keys": [{"kty": "RSA", "kid": "rsa-key", "e": "AQAB"}]}`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKeys, warnings, err := ParseJwks([]byte(tc.jwks))
+			if err != nil {
+				t.Fatalf("ParseJwks(...) = %v, expected nil", err)
+			}
+			if len(publicKeys) != 0 || len(warnings) != 1 {
+				t.Errorf("ParseJwks(...) returned %d keys and warnings %q, expected the key to be skipped", len(publicKeys), warnings)
+			}
+		})
+	}
+	if _, _, err := ParseJwks([]byte("not json")); err == nil {
+		t.Errorf("ParseJwks(...) = nil, expected non nil")
+	}
+}
+
+func TestVerifyJwtWithJwks(t *testing.T) {
+	publicKeys, _, err := ParseJwks([]byte(testJwks(t)))
+	if err != nil {
+		t.Fatalf("ParseJwks(...) = %v, expected nil", err)
+	}
+	v, err := NewVerifier(helloAppImage, publicKeys)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ed25519PrivateKey)
+	if err != nil {
+		t.Fatalf("error marshaling private key: %v", err)
+	}
+	ed25519PrivateKeyPem := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	tcs := []struct {
+		name        string
+		keyID       string
+		jwt         []byte
+		expectedErr bool
+	}{
+		{
+			name:  "ES256 token",
+			keyID: "ec-key",
+			jwt:   createJwt(t, `{"alg":"ES256","typ":"JWT","kid":"ec-key"}`, validPayload, ec256PrivateKey, EcdsaP256Sha256),
+		},
+		{
+			name:  "EdDSA token",
+			keyID: "ed25519-key",
+			jwt:   createJwt(t, `{"alg":"EdDSA","typ":"JWT","kid":"ed25519-key"}`, validPayload, ed25519PrivateKeyPem, EddsaEd25519),
+		},
+		{
+			name:        "token signed by another key",
+			keyID:       "rsa-key",
+			jwt:         createJwt(t, `{"alg":"RS256","typ":"JWT","kid":"rsa-key"}`, validPayload, rsa3072PrivateKey, RsaSignPkcs13072Sha256),
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.VerifyAttestation(&Attestation{PublicKeyID: tc.keyID, Signature: tc.jwt})
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestation(_) = %v, expected error: %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -18,8 +18,15 @@ package attestlib
 
 import (
 	"bytes"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+
 	"github.com/pkg/errors"
 )
 
@@ -31,6 +38,8 @@ func getAlgName(alg SignatureAlgorithm) string {
 		return "PS512"
 	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256:
 		return "RS256"
+	case RsaSignPkcs14096Sha384:
+		return "RS384"
 	case RsaSignPkcs14096Sha512:
 		return "RS512"
 	case EcdsaP256Sha256:
@@ -39,6 +48,8 @@ func getAlgName(alg SignatureAlgorithm) string {
 		return "ES384"
 	case EcdsaP521Sha512:
 		return "ES512"
+	case EddsaEd25519:
+		return "EdDSA"
 	default:
 		return "Algorithm Not Supported"
 
@@ -54,6 +65,9 @@ func checkHeader(headerIn []byte, publicKey PublicKey) error {
 	if err != nil {
 		return errors.Wrap(err, "error unmarshaling json")
 	}
+	if strings.EqualFold(jsonHeader.Alg, "none") {
+		return errors.New("unsigned JWTs (alg none) are not supported")
+	}
 	if jsonHeader.Crit != "" {
 		return errors.New("crit field not supported")
 	}
@@ -63,7 +77,8 @@ func checkHeader(headerIn []byte, publicKey PublicKey) error {
 	if jsonHeader.Alg != getAlgName(publicKey.SignatureAlgorithm) {
 		return errors.New("alg field does not match the algorithm of the public key")
 	}
-	if jsonHeader.Kid != publicKey.ID {
+	// kid is optional, but it must identify the public key when present.
+	if jsonHeader.Kid != "" && jsonHeader.Kid != publicKey.ID {
 		return errors.New("kid field does not match the public key ID")
 	}
 
@@ -71,9 +86,144 @@ func checkHeader(headerIn []byte, publicKey PublicKey) error {
 
 }
 
-type jwtVerifierImpl struct{}
+// checkClaims validates the registered time-based claims of a JWT payload.
+// `exp` and `nbf` are optional, but if present `now` must fall within them.
+func checkClaims(payload []byte, now time.Time) error {
+	var claims struct {
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return errors.Wrap(err, "error unmarshaling claims")
+	}
+	if claims.Exp != nil && !now.Before(numericDate(*claims.Exp)) {
+		return errors.New("token has expired")
+	}
+	if claims.Nbf != nil && now.Before(numericDate(*claims.Nbf)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// jwtExpiry returns the time of the exp claim of a JWT payload, or the zero
+// time if it has none.
+func jwtExpiry(payload []byte) time.Time {
+	var claims struct {
+		Exp *float64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == nil {
+		return time.Time{}
+	}
+	return numericDate(*claims.Exp)
+}
+
+// checkIssuerAudience validates the iss and aud claims of a JWT payload.
+// If `issuer` is not empty, iss must equal it, and if `audience` is not empty,
+// aud must be or contain it. Required claims that are missing fail the check.
+func checkIssuerAudience(payload []byte, issuer, audience string) error {
+	if issuer == "" && audience == "" {
+		return nil
+	}
+	var claims struct {
+		Iss *string         `json:"iss"`
+		Aud json.RawMessage `json:"aud"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return errors.Wrap(err, "error unmarshaling claims")
+	}
+	if issuer != "" {
+		if claims.Iss == nil {
+			return errors.New("token has no iss claim")
+		}
+		if *claims.Iss != issuer {
+			return fmt.Errorf("token issuer %q does not match %q", *claims.Iss, issuer)
+		}
+	}
+	if audience != "" {
+		if len(claims.Aud) == 0 || string(claims.Aud) == "null" {
+			return errors.New("token has no aud claim")
+		}
+		// aud is either a single string or an array of strings, see RFC 7519
+		// section 4.1.3.
+		var audiences []string
+		var single string
+		if err := json.Unmarshal(claims.Aud, &single); err == nil {
+			audiences = []string{single}
+		} else if err := json.Unmarshal(claims.Aud, &audiences); err != nil {
+			return errors.Wrap(err, "invalid aud claim")
+		}
+		for _, aud := range audiences {
+			if aud == audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("token audience %q does not include %q", audiences, audience)
+	}
+	return nil
+}
+
+// numericDate converts a JWT NumericDate, the number of seconds since the
+// epoch, to a time.Time.
+func numericDate(seconds float64) time.Time {
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second)))
+}
 
-func (v jwtVerifierImpl) verifyJwt(signature []byte, publicKey PublicKey) ([]byte, error) {
+// convertJwsSignature converts a JWS signature to the form expected by
+// verifyDetached. JWS encodes ECDSA signatures as the fixed-width
+// concatenation r||s rather than ASN.1, see RFC 7518 section 3.4.
+func convertJwsSignature(signature []byte, alg SignatureAlgorithm) ([]byte, error) {
+	switch alg {
+	case EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512:
+		r, s, err := decodeRawEcdsaSignature(signature, alg)
+		if err != nil {
+			return nil, err
+		}
+		var sigStruct struct {
+			R, S *big.Int
+		}
+		sigStruct.R, sigStruct.S = r, s
+		return asn1.Marshal(sigStruct)
+	default:
+		return signature, nil
+	}
+}
+
+type jwtVerifierImpl struct {
+	// issuer is the iss claim that tokens must have. If empty, iss is not
+	// checked.
+	issuer string
+	// audience is the aud claim that tokens must have or include. If empty,
+	// aud is not checked.
+	audience string
+	// keyStrength is the minimum strength of the public keys.
+	keyStrength keyStrengthPolicy
+}
+
+// verifyJwt verifies a JWS compact serialized JWT and outputs its payload.
+// `signature` is the serialized token, `header.payload.signature`, and
+// `publicKey` must match the token's algorithm and key ID. The exp and nbf
+// claims are checked at `now`.
+func (v jwtVerifierImpl) verifyJwt(signature []byte, publicKey PublicKey, now time.Time) ([]byte, error) {
+	return v.verifyJws(signature, nil, publicKey, now)
+}
+
+// verifyJwtDetached verifies a JWT with detached content, see RFC 7515
+// appendix F. `signature` is the serialized token with an empty payload,
+// `header..signature`, and `payload` is the unencoded payload it signs.
+func (v jwtVerifierImpl) verifyJwtDetached(signature []byte, payload []byte, publicKey PublicKey, now time.Time) error {
+	if payload == nil {
+		payload = []byte{}
+	}
+	_, err := v.verifyJws(signature, payload, publicKey, now)
+	return err
+}
+
+// verifyJws verifies a JWS compact serialized JWT. If `detachedPayload` is
+// not nil, the token's payload must be empty and `detachedPayload` is
+// verified in its place. Keys weaker than `v.keyStrength` are rejected with
+// ErrKeyTooWeak.
+func (v jwtVerifierImpl) verifyJws(signature []byte, detachedPayload []byte, publicKey PublicKey, now time.Time) ([]byte, error) {
 	parts := bytes.Split(signature, []byte("."))
 	if len(parts) != 3 {
 		return nil, errors.New("invalid JWT")
@@ -86,10 +236,45 @@ func (v jwtVerifierImpl) verifyJwt(signature []byte, publicKey PublicKey) ([]byt
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid header")
 	}
-	// Decode and return payload once verifyDetached is implimented.
+	var payload []byte
+	// The signing input is the encoded header and payload, joined by a ".".
+	var signingInput []byte
+	if detachedPayload != nil {
+		if len(parts[1]) != 0 {
+			return nil, errors.New("JWT with detached content has a payload")
+		}
+		payload = detachedPayload
+		signingInput = []byte(string(parts[0]) + "." + base64.RawURLEncoding.EncodeToString(payload))
+	} else {
+		payload, err = base64.RawURLEncoding.DecodeString(string(parts[1]))
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot decode payload")
+		}
+		signingInput = signature[:len(parts[0])+1+len(parts[1])]
+	}
+	rawSignature, err := base64.RawURLEncoding.DecodeString(string(parts[2]))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode signature")
+	}
+	rawSignature, err = convertJwsSignature(rawSignature, publicKey.SignatureAlgorithm)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+	pub, err := pkixKey(publicKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot decode payload")
+		return nil, errors.Wrap(err, "error parsing public key")
+	}
+	if err := v.keyStrength.check(pub); err != nil {
+		return nil, fmt.Errorf("%w: key %q: %v", ErrKeyTooWeak, publicKey.ID, err)
+	}
+	if err := verifyDetachedWithKey(rawSignature, pub, publicKey.SignatureAlgorithm, signingInput); err != nil {
+		return nil, errors.Wrap(err, "error verifying JWT signature")
+	}
+	if err := checkClaims(payload, now); err != nil {
+		return nil, errors.Wrap(err, "invalid claims")
+	}
+	if err := checkIssuerAudience(payload, v.issuer, v.audience); err != nil {
+		return nil, errors.Wrap(err, "invalid claims")
 	}
-	verifyDetached(parts[2], publicKey.KeyData, publicKey.SignatureAlgorithm, append(parts[0], parts[1]...))
-	return nil, errors.New("unimplemented")
+	return payload, nil
 }
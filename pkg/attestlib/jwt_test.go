@@ -17,13 +17,46 @@ limitations under the License.
 package attestlib
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 )
 
 const goodJwt = "eyJhbGciOiAiRVMyNTYiLCAidHlwIjogIkpXVCIsICJraWQiOiAibXktc2lnbmluZy1rZXkiIH0K.eyAic3ViIjogImNvbnRhaW5lcjpkaWdlc3Q6c2hhMjU2OmZha2UtZGlnZXN0IiwgImF1ZCI6ICIvL2JpbmFyeWF1dGhvcml6YXRpb24uZ29vZ2xlYXBpcy5jb20iLCAiYXR0ZXN0YXRpb25UeXBlIjogIlRCRCIsICJhdHRlc3RhdGlvbiI6ICIiIH0K.somesignature"
 const jwtWithInvalidHeaderTYP = "eyAgImFsZyI6ICJFUzI1NiIsICJ0eXAiOiAiQkFEVFlQRSIsICJraWQiOiAibXktc2lnbmluZy1rZXkiIH0K.eyAic3ViIjogImNvbnRhaW5lcjpkaWdlc3Q6c2hhMjU2OmZha2UtZGlnZXN0IiwgImF1ZCI6ICIvL2JpbmFyeWF1dGhvcml6YXRpb24uZ29vZ2xlYXBpcy5jb20iLCAiYXR0ZXN0YXRpb25UeXBlIjogIlRCRCIsICJhdHRlc3RhdGlvbiI6ICIiIH0K.somesignature"
 const jwtWithCrit = "eyJhbGciOiJFUzI1NiIsICJ0eXAiOiJKV1QiLCAia2lkIjoibXktc2lnbmluZy1rZXkiLCAiY3JpdCI6ICJsaXN0LW9mLWZpZWxkcyJ9Cg.eyAic3ViIjogImNvbnRhaW5lcjpkaWdlc3Q6c2hhMjU2OmZha2UtZGlnZXN0IiwgImF1ZCI6ICIvL2JpbmFyeWF1dGhvcml6YXRpb24uZ29vZ2xlYXBpcy5jb20iLCAiYXR0ZXN0YXRpb25UeXBlIjogIlRCRCIsICJhdHRlc3RhdGlvbiI6ICIiIH0K.someisgnature"
 
+const validHeader = `{"alg":"ES256","typ":"JWT","kid":"my-signing-key"}`
+const validClaims = `{"sub":"container:digest:sha256:fake-digest","aud":"//binaryauthorization.googleapis.com"}`
+
+// This key was generated using the following command: openssl ecparam -name prime256v1 -genkey -noout -out key.pem
+const otherEc256PubKey = `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEeYO5lrb4zyFHk7gbFyI02Fb7WxKw
+4hp3HrfMOQlWSsPSsPk7cT/pf+r3UQCEPpvarlu7w3XeUfzAWdwN3nz2Mg==
+-----END PUBLIC KEY-----`
+
+var ec256JwtPubKey = PublicKey{
+	AuthenticatorType:  Jwt,
+	SignatureAlgorithm: EcdsaP256Sha256,
+	ID:                 "my-signing-key",
+	KeyData:            []byte(ec256PubKey),
+}
+
+var rsa2048JwtPubKey = PublicKey{
+	AuthenticatorType:  Jwt,
+	SignatureAlgorithm: RsaSignPkcs12048Sha256,
+	ID:                 "rsa-signing-key",
+	KeyData:            []byte(rsa2048PubKey),
+}
+
 var goodPubKey = PublicKey{
 	AuthenticatorType:  Jwt,
 	SignatureAlgorithm: EcdsaP256Sha256,
@@ -40,9 +73,59 @@ func TestVerifyJWT(t *testing.T) {
 	}{
 		{
 			name:          "valid JWT and Public Key",
+			jwt:           createJwt(t, validHeader, validClaims, ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        ec256JwtPubKey,
+			expectedError: false,
+		}, {
+			name:          "valid RS256 JWT",
+			jwt:           createJwt(t, `{"alg":"RS256","typ":"JWT","kid":"rsa-signing-key"}`, validClaims, rsa2048PrivateKey, RsaSignPkcs12048Sha256),
+			pubkey:        rsa2048JwtPubKey,
+			expectedError: false,
+		}, {
+			name:          "valid PS256 JWT",
+			jwt:           createJwt(t, `{"alg":"PS256","typ":"JWT","kid":"pss-signing-key"}`, validClaims, rsa2048PrivateKey, RsaPss2048Sha256),
+			pubkey:        PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: RsaPss2048Sha256, ID: "pss-signing-key", KeyData: []byte(rsa2048PubKey)},
+			expectedError: false,
+		}, {
+			name:          "valid JWT without kid",
+			jwt:           createJwt(t, `{"alg":"ES256","typ":"JWT"}`, validClaims, ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        ec256JwtPubKey,
+			expectedError: false,
+		}, {
+			name:          "valid JWT with unexpired claims",
+			jwt:           createJwt(t, validHeader, fmt.Sprintf(`{"exp":%d,"nbf":%d}`, time.Now().Add(time.Hour).Unix(), time.Now().Add(-time.Hour).Unix()), ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        ec256JwtPubKey,
+			expectedError: false,
+		}, {
+			name:          "expired JWT",
+			jwt:           createJwt(t, validHeader, fmt.Sprintf(`{"exp":%d}`, time.Now().Add(-time.Hour).Unix()), ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        ec256JwtPubKey,
+			expectedError: true,
+		}, {
+			name:          "JWT not valid yet",
+			jwt:           createJwt(t, validHeader, fmt.Sprintf(`{"nbf":%d}`, time.Now().Add(time.Hour).Unix()), ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        ec256JwtPubKey,
+			expectedError: true,
+		}, {
+			name:          "alg none JWT",
+			jwt:           []byte(encodeSegment(`{"alg":"none","typ":"JWT","kid":"my-signing-key"}`) + "." + encodeSegment(validClaims) + "."),
+			pubkey:        ec256JwtPubKey,
+			expectedError: true,
+		}, {
+			name:          "JWT with tampered payload",
+			jwt:           tamperJwtPayload(createJwt(t, validHeader, validClaims, ec256PrivateKey, EcdsaP256Sha256), `{"sub":"container:digest:sha256:other-digest"}`),
+			pubkey:        ec256JwtPubKey,
+			expectedError: true,
+		}, {
+			name:          "JWT signed by another key",
+			jwt:           createJwt(t, validHeader, validClaims, ec256PrivateKey, EcdsaP256Sha256),
+			pubkey:        PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: EcdsaP256Sha256, ID: "my-signing-key", KeyData: []byte(otherEc256PubKey)},
+			expectedError: true,
+		}, {
+			name:          "JWT with invalid signature",
 			jwt:           []byte(goodJwt),
 			pubkey:        goodPubKey,
-			expectedError: true, // change once verifyDetached is implimented.
+			expectedError: true,
 		}, {
 			name:          "invalid JWT length",
 			jwt:           []byte("too.many.parts.here"),
@@ -89,7 +172,7 @@ func TestVerifyJWT(t *testing.T) {
 	v := jwtVerifierImpl{}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := v.verifyJwt(tc.jwt, tc.pubkey)
+			_, err := v.verifyJwt(tc.jwt, tc.pubkey, time.Now())
 			if tc.expectedError {
 				if err == nil {
 					t.Errorf("Passed when failure expected")
@@ -103,3 +186,283 @@ func TestVerifyJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyJwtIssuerAudience(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+	const audience = "//binaryauthorization.googleapis.com"
+	tcs := []struct {
+		name          string
+		claims        string
+		issuer        string
+		audience      string
+		expectedError bool
+	}{
+		{
+			name:     "matching claims",
+			claims:   `{"iss":"https://issuer.example.com","aud":"//binaryauthorization.googleapis.com"}`,
+			issuer:   issuer,
+			audience: audience,
+		}, {
+			name:     "audience listed in array",
+			claims:   `{"iss":"https://issuer.example.com","aud":["other","//binaryauthorization.googleapis.com"]}`,
+			issuer:   issuer,
+			audience: audience,
+		}, {
+			name:   "unchecked claims",
+			claims: `{"iss":"https://other.example.com"}`,
+		}, {
+			name:          "wrong issuer",
+			claims:        `{"iss":"https://other.example.com","aud":"//binaryauthorization.googleapis.com"}`,
+			issuer:        issuer,
+			audience:      audience,
+			expectedError: true,
+		}, {
+			name:          "wrong audience",
+			claims:        `{"iss":"https://issuer.example.com","aud":["other"]}`,
+			issuer:        issuer,
+			audience:      audience,
+			expectedError: true,
+		}, {
+			name:          "missing issuer",
+			claims:        `{"aud":"//binaryauthorization.googleapis.com"}`,
+			issuer:        issuer,
+			expectedError: true,
+		}, {
+			name:          "missing audience",
+			claims:        `{"iss":"https://issuer.example.com"}`,
+			audience:      audience,
+			expectedError: true,
+		}, {
+			name:          "invalid audience",
+			claims:        `{"aud":42}`,
+			audience:      audience,
+			expectedError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := jwtVerifierImpl{issuer: tc.issuer, audience: tc.audience}
+			_, err := v.verifyJwt(createJwt(t, validHeader, tc.claims, ec256PrivateKey, EcdsaP256Sha256), ec256JwtPubKey, time.Now())
+			if tc.expectedError != (err != nil) {
+				t.Errorf("verifyJwt(...) = %v, expected error: %v", err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationJwtClaims(t *testing.T) {
+	v, err := NewVerifier(helloAppImage, []PublicKey{ec256JwtPubKey}, WithJwtClaims("https://issuer.example.com", "kritis"))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	tcs := []struct {
+		name          string
+		claims        string
+		expectedError bool
+	}{
+		{
+			name:   "matching claims",
+			claims: `"iss":"https://issuer.example.com","aud":"kritis",`,
+		}, {
+			name:          "wrong issuer",
+			claims:        `"iss":"https://other.example.com","aud":"kritis",`,
+			expectedError: true,
+		}, {
+			name:          "absent claims",
+			expectedError: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			// Add the claims to the atomic container signature payload.
+			payload := "{" + tc.claims + strings.TrimPrefix(validPayload, "{")
+			att := &Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: createJwt(t, validHeader, payload, ec256PrivateKey, EcdsaP256Sha256)}
+			err := v.VerifyAttestation(att)
+			if tc.expectedError != (err != nil) {
+				t.Errorf("VerifyAttestation(_) = %v, expected error: %v", err, tc.expectedError)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationJwtKeyStrength(t *testing.T) {
+	jwtKey := func(keyData string, alg SignatureAlgorithm) PublicKey {
+		return PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: alg, KeyData: []byte(keyData), ID: "my-signing-key"}
+	}
+	const rsaHeader = `{"alg":"RS256","typ":"JWT","kid":"my-signing-key"}`
+	tcs := []struct {
+		name        string
+		publicKey   PublicKey
+		signature   []byte
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			name:        "1024 bit RSA key",
+			publicKey:   jwtKey(rsa1024PubKey, RsaSignPkcs12048Sha256),
+			signature:   createJwt(t, rsaHeader, validPayload, rsa1024PrivateKey, RsaSignPkcs12048Sha256),
+			expectedErr: ErrKeyTooWeak,
+		},
+		{
+			name:      "2048 bit RSA key",
+			publicKey: jwtKey(rsa2048PubKey, RsaSignPkcs12048Sha256),
+			signature: createJwt(t, rsaHeader, validPayload, rsa2048PrivateKey, RsaSignPkcs12048Sha256),
+		},
+		{
+			name:      "1024 bit RSA key without minimum",
+			publicKey: jwtKey(rsa1024PubKey, RsaSignPkcs12048Sha256),
+			signature: createJwt(t, rsaHeader, validPayload, rsa1024PrivateKey, RsaSignPkcs12048Sha256),
+			opts:      []VerifierOption{WithMinimumKeySize(0, 0)},
+		},
+		{
+			name:        "P-256 key below minimum curve size",
+			publicKey:   ec256JwtPubKey,
+			signature:   createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256),
+			opts:        []VerifierOption{WithMinimumKeySize(2048, 384)},
+			expectedErr: ErrKeyTooWeak,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: tc.publicKey.ID, Signature: tc.signature})
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerificationResultJwtClaims(t *testing.T) {
+	v, err := NewVerifier(helloAppImage, []PublicKey{ec256JwtPubKey}, WithJwtClaims("https://issuer.example.com", ""))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	// Add the claims to the atomic container signature payload.
+	withClaims := func(claims string) string {
+		return "{" + claims + strings.TrimPrefix(validPayload, "{")
+	}
+	verifiedJwt := createJwt(t, validHeader, withClaims(`"iss":"https://issuer.example.com","tenant":"payments","level":3,`), ec256PrivateKey, EcdsaP256Sha256)
+
+	tcs := []struct {
+		name      string
+		signature []byte
+	}{
+		{
+			name:      "tampered custom claim",
+			signature: tamperJwtPayload(verifiedJwt, withClaims(`"iss":"https://issuer.example.com","tenant":"billing","level":3,`)),
+		},
+		{
+			name:      "expired token",
+			signature: createJwt(t, validHeader, withClaims(`"iss":"https://issuer.example.com","tenant":"payments","exp":1,`), ec256PrivateKey, EcdsaP256Sha256),
+		},
+		{
+			name:      "wrong issuer",
+			signature: createJwt(t, validHeader, withClaims(`"iss":"https://other.example.com","tenant":"payments",`), ec256PrivateKey, EcdsaP256Sha256),
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: tc.signature}
+			if result, err := v.VerifyAttestationWithResult(att); err == nil {
+				t.Errorf("VerifyAttestationWithResult(_) = %v, expected error", result.Claims())
+			}
+		})
+	}
+
+	result, err := v.VerifyAttestationWithResult(&Attestation{PublicKeyID: ec256JwtPubKey.ID, Signature: verifiedJwt})
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	claims := result.Claims()
+	if claims["tenant"] != "payments" || claims["level"] != float64(3) || claims["iss"] != "https://issuer.example.com" {
+		t.Errorf("Claims() = %v, expected the custom and registered claims", claims)
+	}
+	claims["tenant"] = "billing"
+	if got := result.Claims()["tenant"]; got != "payments" {
+		t.Errorf("Claims() after modifying an earlier result = %v, expected payments", got)
+	}
+	var custom struct {
+		Tenant string `json:"tenant"`
+		Level  int    `json:"level"`
+	}
+	if err := result.UnmarshalClaims(&custom); err != nil || custom.Tenant != "payments" || custom.Level != 3 {
+		t.Errorf("UnmarshalClaims(_) = %v, %+v, expected tenant payments and level 3", err, custom)
+	}
+}
+
+func TestVerificationResultClaimsWithoutJwt(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	result, err := v.VerifyAttestationWithResult(att)
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if claims := result.Claims(); claims != nil {
+		t.Errorf("Claims() = %v, expected nil", claims)
+	}
+	var claims map[string]interface{}
+	if err := result.UnmarshalClaims(&claims); err == nil {
+		t.Errorf("UnmarshalClaims(_) = nil, expected error")
+	}
+}
+
+func encodeSegment(segment string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(segment))
+}
+
+// createJwt creates a JWS compact serialized JWT signed by `privateKey`.
+func createJwt(t *testing.T, header, claims, privateKey string, alg SignatureAlgorithm) []byte {
+	t.Helper()
+	key, err := parsePkixPrivateKeyPem([]byte(privateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	signingInput := encodeSegment(header) + "." + encodeSegment(claims)
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsaSign(k, []byte(signingInput), alg)
+		if err != nil {
+			t.Fatalf("error creating rsa signature: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		der, err := ecSign(k, []byte(signingInput), alg)
+		if err != nil {
+			t.Fatalf("error creating ecdsa signature: %v", err)
+		}
+		var sigStruct struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(der, &sigStruct); err != nil {
+			t.Fatalf("error decoding ecdsa signature: %v", err)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		sigStruct.R.FillBytes(signature[:size])
+		sigStruct.S.FillBytes(signature[size:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(k, []byte(signingInput))
+	default:
+		t.Fatalf("unexpected key type %T", key)
+	}
+	return []byte(signingInput + "." + base64.RawURLEncoding.EncodeToString(signature))
+}
+
+// tamperJwtPayload replaces the payload of a serialized JWT, keeping its
+// original header and signature.
+func tamperJwtPayload(jwt []byte, claims string) []byte {
+	parts := strings.Split(string(jwt), ".")
+	parts[1] = encodeSegment(claims)
+	return []byte(strings.Join(parts, "."))
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkKeyIdentity checks, if the verifier requires key identity matching,
+// that `keyID`, the public key ID named by an Attestation or one of its
+// signatures, identifies `publicKey`, the key that verified the signature.
+func (v *verifier) checkKeyIdentity(keyID string, publicKey PublicKey) error {
+	if !v.keyIdentityMatching || keyIdentifies(keyID, publicKey) {
+		return nil
+	}
+	if keyID == "" {
+		return fmt.Errorf("%w: attestation names no public key, but was verified by key %q", ErrKeyMismatch, publicKey.ID)
+	}
+	return fmt.Errorf("%w: attestation names public key %q, but was verified by key %q", ErrKeyMismatch, keyID, publicKey.ID)
+}
+
+// keyIdentifies reports whether `keyID` identifies `publicKey`: it must be
+// the ID of the key, its fingerprint in either case for a Pgp key, or the
+// SPKI fingerprint of the key material of a Pkix or Jwt key.
+func keyIdentifies(keyID string, publicKey PublicKey) bool {
+	if keyID == "" {
+		return false
+	}
+	if keyID == publicKey.ID {
+		return true
+	}
+	switch publicKey.AuthenticatorType {
+	case Pgp:
+		return strings.EqualFold(keyID, publicKey.ID)
+	case Pkix, Jwt:
+		fingerprint, ok := parseSPKIFingerprint(keyID)
+		if !ok {
+			return false
+		}
+		actual, err := SPKIFingerprint(publicKey.KeyData)
+		return err == nil && actual == fingerprint
+	default:
+		return false
+	}
+}
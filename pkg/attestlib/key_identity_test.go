@@ -0,0 +1,267 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyAttestationKeyIdentityMatching(t *testing.T) {
+	pkixKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "pkix-key"}
+	pkixSigner, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "pkix-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	pkixAtt, err := pkixSigner.CreateAttestation([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	pkixFingerprint, err := SPKIFingerprint([]byte(ec256PubKey))
+	if err != nil {
+		t.Fatalf("error computing SPKI fingerprint: %v", err)
+	}
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	pgpKey := PublicKey{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(gpgPublicKey), ID: gpgPublicKeyID}
+
+	tcs := []struct {
+		name        string
+		publicKey   PublicKey
+		keyID       string
+		signature   []byte
+		payload     []byte
+		expectedErr error
+	}{
+		{
+			name:      "pkix key ID",
+			publicKey: pkixKey,
+			keyID:     "pkix-key",
+			signature: pkixAtt.Signature,
+			payload:   pkixAtt.SerializedPayload,
+		},
+		{
+			name:      "pkix SPKI fingerprint",
+			publicKey: pkixKey,
+			keyID:     strings.ToUpper(pkixFingerprint),
+			signature: pkixAtt.Signature,
+			payload:   pkixAtt.SerializedPayload,
+		},
+		{
+			name:        "pkix mismatched ID",
+			publicKey:   pkixKey,
+			keyID:       "other-key",
+			signature:   pkixAtt.Signature,
+			payload:     pkixAtt.SerializedPayload,
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:        "pkix empty ID",
+			publicKey:   pkixKey,
+			signature:   pkixAtt.Signature,
+			payload:     pkixAtt.SerializedPayload,
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:      "ed25519 key ID",
+			publicKey: ed25519Key,
+			keyID:     "ed25519-key",
+			signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)),
+			payload:   []byte(validPayload),
+		},
+		{
+			name:        "ed25519 mismatched ID",
+			publicKey:   ed25519Key,
+			keyID:       "other-key",
+			signature:   ed25519.Sign(ed25519PrivateKey, []byte(validPayload)),
+			payload:     []byte(validPayload),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:      "jwt key ID",
+			publicKey: ec256JwtPubKey,
+			keyID:     ec256JwtPubKey.ID,
+			signature: createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256),
+		},
+		{
+			name:        "jwt mismatched ID",
+			publicKey:   ec256JwtPubKey,
+			keyID:       "other-key",
+			signature:   createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:      "pgp fingerprint in lower case",
+			publicKey: pgpKey,
+			keyID:     strings.ToLower(gpgPublicKeyID),
+			signature: newGpgSignatureWithHash(t, validPayload, crypto.SHA256, false),
+		},
+		{
+			name:        "pgp mismatched ID",
+			publicKey:   pgpKey,
+			keyID:       "0000000000000000000000000000000000000000",
+			signature:   newGpgSignatureWithHash(t, validPayload, crypto.SHA256, false),
+			expectedErr: ErrKeyMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: tc.keyID, Signature: tc.signature, SerializedPayload: tc.payload}
+			// Key trial finds the key that verifies the signature even if
+			// the Attestation does not name it.
+			opts := []VerifierOption{WithKeyTrial(10), WithClock(ClockFunc(func() time.Time { return gpgSignatureTime }))}
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			if err := v.VerifyAttestation(att); err != nil {
+				t.Fatalf("VerifyAttestation(_) = %v without key identity matching, expected nil", err)
+			}
+			v, err = NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, append(opts, WithKeyIdentityMatching())...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationKeyIdentityMatchingEnvelopes(t *testing.T) {
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	coseSign1 := func(keyID string) *Attestation {
+		payload := notationTestPayload(helloAppDigest)
+		protected := testCbor(t, []cborPair{{coseHeaderAlg, -8}})
+		msg := &coseSign1{protected: protected}
+		signature := ed25519.Sign(ed25519PrivateKey, msg.sigStructure(payload))
+		return &Attestation{
+			PublicKeyID:  keyID,
+			Signature:    testCbor(t, []interface{}{protected, []cborPair{}, payload, signature}),
+			EnvelopeType: CoseSign1,
+		}
+	}
+	caKey, caCert := newCmsCA(t, "cms root")
+	cmsRoots := x509.NewCertPool()
+	cmsRoots.AddCert(caCert)
+	cmsSigner := newCmsSigner(t, caKey, caCert)
+	cmsFingerprint, err := SPKIFingerprint(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cmsSigner.cert.Raw}))
+	if err != nil {
+		t.Fatalf("error computing SPKI fingerprint: %v", err)
+	}
+	cms := func(keyID string) *Attestation {
+		return &Attestation{PublicKeyID: keyID, Signature: cmsSigner.sign(t, []byte(validPayload), []byte(validPayload)), EnvelopeType: Cms}
+	}
+	f := newSigstoreFixture(t)
+	sigstore := func(keyID string) *Attestation {
+		att := f.attestation(validPayload, "signer@example.com")
+		att.PublicKeyID = keyID
+		return att
+	}
+
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		expectedErr error
+	}{
+		{
+			name: "dsse keyid",
+			att:  &Attestation{Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"ed25519-key": ed25519PrivateKey}), EnvelopeType: Dsse},
+		},
+		{
+			name:        "dsse keyid of an alias",
+			att:         &Attestation{Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"release-key": ed25519PrivateKey}), EnvelopeType: Dsse},
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:        "dsse PublicKeyID of an alias",
+			att:         &Attestation{PublicKeyID: "release-key", Signature: createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"": ed25519PrivateKey}), EnvelopeType: Dsse},
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name: "cose key ID",
+			att:  coseSign1("ed25519-key"),
+		},
+		{
+			name:        "cose key ID of an alias",
+			att:         coseSign1("release-key"),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name: "cms SPKI fingerprint",
+			att:  cms(cmsFingerprint),
+		},
+		{
+			name:        "cms without key ID",
+			att:         cms(""),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:        "cms mismatched key ID",
+			att:         cms("ed25519-key"),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name: "sigstore identity",
+			att:  sigstore("signer@example.com"),
+		},
+		{
+			name:        "sigstore without key ID",
+			att:         sigstore(""),
+			expectedErr: ErrKeyMismatch,
+		},
+		{
+			name:        "sigstore mismatched identity",
+			att:         sigstore("other@example.com"),
+			expectedErr: ErrKeyMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := []VerifierOption{WithKeyAlias("release-key", "ed25519-key"), WithCmsRoots(cmsRoots), WithSigstore(f.roots(), f.rekorPem, testOidcIssuer, "signer@example.com")}
+			v, err := NewVerifier(helloAppImage, []PublicKey{ed25519Key}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			if err := v.VerifyAttestation(tc.att); err != nil {
+				t.Fatalf("VerifyAttestation(_) = %v without key identity matching, expected nil", err)
+			}
+			v, err = NewVerifier(helloAppImage, []PublicKey{ed25519Key}, append(opts, WithKeyIdentityMatching())...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
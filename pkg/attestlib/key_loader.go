@@ -0,0 +1,168 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// errNoPublicKey is returned by LoadPublicKeyFromFile for files that do not
+// contain a public key.
+var errNoPublicKey = errors.New("file does not contain a public key")
+
+// pgpPublicKeyArmorPrefix starts an ASCII-armored PGP public key.
+var pgpPublicKeyArmorPrefix = []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----")
+
+// LoadPublicKeysFromDir loads the public key in each file of the directory
+// `dir`, see LoadPublicKeyFromFile. Subdirectories and files that do not
+// contain a public key are skipped. The keys of all the files that could be
+// loaded are returned; if any file could not be loaded, the returned error
+// describes each such file.
+func LoadPublicKeysFromDir(dir string) ([]PublicKey, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key directory")
+	}
+	var publicKeys []PublicKey
+	var failures []string
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		publicKey, err := LoadPublicKeyFromFile(path)
+		if err == errNoPublicKey {
+			continue
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		publicKeys = append(publicKeys, *publicKey)
+	}
+	if len(failures) != 0 {
+		return publicKeys, fmt.Errorf("error loading %d key files: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return publicKeys, nil
+}
+
+// LoadPublicKeyFromFile loads the public key in the file at `path`. The
+// KeyType is inferred from the file contents:
+//   - an ASCII-armored PGP public key is a Pgp key whose ID is its
+//     fingerprint.
+//   - a PEM-encoded PKIX public key or certificate chain is a Pkix key, or an
+//     Ed25519 key for Ed25519 public keys. Its ID is generated from the
+//     SHA-256 digest of its SubjectPublicKeyInfo.
+//
+// The SignatureAlgorithm of PKIX keys is inferred from the key: the curve
+// determines it for ECDSA keys, and RSA keys are assumed to sign with
+// RSASSA-PKCS1-v1_5 and a SHA256 digest. Set SignatureAlgorithm on the
+// returned key if it signs with another algorithm.
+func LoadPublicKeyFromFile(path string) (*PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key file")
+	}
+	return parsePublicKeyData(data)
+}
+
+// parsePublicKeyData parses the public key in `data`, inferring its KeyType
+// as LoadPublicKeyFromFile does. It returns errNoPublicKey if `data` does
+// not contain a public key.
+func parsePublicKeyData(data []byte) (*PublicKey, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), pgpPublicKeyArmorPrefix) {
+		return NewPublicKey(Pgp, PGPUnused, data, "")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errNoPublicKey
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing PKIX public key")
+		}
+		return newPkixPublicKey(pub, block.Bytes, pem.EncodeToMemory(block))
+	case "CERTIFICATE":
+		chain, err := parsePkixCertificateChain(data)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := chain.leaf.PublicKey.(ed25519.PublicKey); ok {
+			return nil, errors.New("Ed25519 certificates are not supported")
+		}
+		return newPkixPublicKey(chain.leaf.PublicKey, chain.leaf.RawSubjectPublicKeyInfo, data)
+	default:
+		return nil, errNoPublicKey
+	}
+}
+
+// newPkixPublicKey creates the PublicKey for the parsed PKIX public key
+// `pub`, whose DER encoded SubjectPublicKeyInfo is `spki`. `keyData` is the
+// PEM encoding of the key or certificate chain.
+func newPkixPublicKey(pub crypto.PublicKey, spki []byte, keyData []byte) (*PublicKey, error) {
+	dgst := sha256.Sum256(spki)
+	keyID := fmt.Sprintf("ni:///sha-256;%s", base64.RawURLEncoding.EncodeToString(dgst[:]))
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return NewPublicKey(Ed25519, EddsaEd25519, pub, keyID)
+	case *ecdsa.PublicKey:
+		var alg SignatureAlgorithm
+		switch pub.Curve {
+		case elliptic.P256():
+			alg = EcdsaP256Sha256
+		case elliptic.P384():
+			alg = EcdsaP384Sha384
+		case elliptic.P521():
+			alg = EcdsaP521Sha512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", pub.Curve.Params().Name)
+		}
+		return NewPublicKey(Pkix, alg, keyData, keyID)
+	case *rsa.PublicKey:
+		var alg SignatureAlgorithm
+		switch pub.N.BitLen() {
+		case 2048:
+			alg = RsaSignPkcs12048Sha256
+		case 3072:
+			alg = RsaSignPkcs13072Sha256
+		case 4096:
+			alg = RsaSignPkcs14096Sha256
+		default:
+			return nil, fmt.Errorf("unsupported RSA key size %d", pub.N.BitLen())
+		}
+		return NewPublicKey(Pkix, alg, keyData, keyID)
+	default:
+		return nil, fmt.Errorf("unsupported PKIX public key type %T", pub)
+	}
+}
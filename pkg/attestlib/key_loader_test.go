@@ -0,0 +1,178 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// spkiKeyID returns the ID generated for a PEM-encoded PKIX public key.
+func spkiKeyID(t *testing.T, publicKey string) string {
+	t.Helper()
+	block, _ := pem.Decode([]byte(publicKey))
+	if block == nil {
+		t.Fatalf("error decoding PEM public key")
+	}
+	dgst := sha256.Sum256(block.Bytes)
+	return "ni:///sha-256;" + base64.RawURLEncoding.EncodeToString(dgst[:])
+}
+
+// writeKeyFiles writes `files`, mapping file names to contents, to a new
+// temporary directory.
+func writeKeyFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "attestlib-keys")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, contents := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600); err != nil {
+			t.Fatalf("error writing %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadPublicKeyFromFile(t *testing.T) {
+	ed25519Der, err := x509.MarshalPKIXPublicKey(ed25519PubKey)
+	if err != nil {
+		t.Fatalf("error marshaling public key: %v", err)
+	}
+	ed25519Pem := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ed25519Der}))
+	tcs := []struct {
+		name              string
+		contents          string
+		expectedErr       bool
+		expectedType      AuthenticatorType
+		expectedAlgorithm SignatureAlgorithm
+		expectedID        string
+	}{
+		{
+			name:              "pgp public key",
+			contents:          gpgPublicKey,
+			expectedType:      Pgp,
+			expectedAlgorithm: PGPUnused,
+			expectedID:        gpgPublicKeyID,
+		},
+		{
+			name:              "ecdsa public key",
+			contents:          ec256PubKey,
+			expectedType:      Pkix,
+			expectedAlgorithm: EcdsaP256Sha256,
+			expectedID:        spkiKeyID(t, ec256PubKey),
+		},
+		{
+			name:              "rsa public key",
+			contents:          rsa3072PubKey,
+			expectedType:      Pkix,
+			expectedAlgorithm: RsaSignPkcs13072Sha256,
+			expectedID:        spkiKeyID(t, rsa3072PubKey),
+		},
+		{
+			name:              "ed25519 public key",
+			contents:          ed25519Pem,
+			expectedType:      Ed25519,
+			expectedAlgorithm: EddsaEd25519,
+			expectedID:        ed25519PubKeyID(t),
+		},
+		{
+			name:        "corrupt public key",
+			contents:    "-----BEGIN PUBLIC KEY-----\naW52YWxpZA==\n-----END PUBLIC KEY-----\n",
+			expectedErr: true,
+		},
+		{
+			name:        "not a key",
+			contents:    "not a key",
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := writeKeyFiles(t, map[string]string{"key.pem": tc.contents})
+			publicKey, err := LoadPublicKeyFromFile(filepath.Join(dir, "key.pem"))
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("LoadPublicKeyFromFile(...) = nil, expected non nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadPublicKeyFromFile(...) = %v, expected nil", err)
+			}
+			if publicKey.AuthenticatorType != tc.expectedType || publicKey.SignatureAlgorithm != tc.expectedAlgorithm || publicKey.ID != tc.expectedID {
+				t.Errorf("LoadPublicKeyFromFile(...) = {%v, %v, %q}, expected {%v, %v, %q}", publicKey.AuthenticatorType, publicKey.SignatureAlgorithm, publicKey.ID, tc.expectedType, tc.expectedAlgorithm, tc.expectedID)
+			}
+		})
+	}
+}
+
+func TestLoadPublicKeysFromDir(t *testing.T) {
+	dir := writeKeyFiles(t, map[string]string{
+		"pkix.pem": ec256PubKey,
+		"pgp.pub":  gpgPublicKey,
+		"README":   "These are our trusted keys.",
+	})
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0700); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	publicKeys, err := LoadPublicKeysFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadPublicKeysFromDir(...) = %v, expected nil", err)
+	}
+	ids := map[string]AuthenticatorType{}
+	for _, publicKey := range publicKeys {
+		ids[publicKey.ID] = publicKey.AuthenticatorType
+	}
+	if len(publicKeys) != 2 || ids[gpgPublicKeyID] != Pgp || ids[spkiKeyID(t, ec256PubKey)] != Pkix {
+		t.Errorf("LoadPublicKeysFromDir(...) loaded keys %v, expected a PGP and a PKIX key", ids)
+	}
+	if _, err := NewVerifier(helloAppImage, publicKeys); err != nil {
+		t.Errorf("NewVerifier(...) = %v, expected nil", err)
+	}
+}
+
+func TestLoadPublicKeysFromDirErrors(t *testing.T) {
+	dir := writeKeyFiles(t, map[string]string{
+		"pkix.pem":    ec256PubKey,
+		"corrupt.pem": "-----BEGIN PUBLIC KEY-----\naW52YWxpZA==\n-----END PUBLIC KEY-----\n",
+		"corrupt.asc": "-----BEGIN PGP PUBLIC KEY BLOCK-----\n\naW52YWxpZA==\n-----END PGP PUBLIC KEY BLOCK-----\n",
+	})
+	publicKeys, err := LoadPublicKeysFromDir(dir)
+	if err == nil {
+		t.Fatalf("LoadPublicKeysFromDir(...) = nil, expected non nil")
+	}
+	for _, name := range []string{"corrupt.pem", "corrupt.asc"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("LoadPublicKeysFromDir(...) = %v, expected error naming %s", err, name)
+		}
+	}
+	if len(publicKeys) != 1 || publicKeys[0].AuthenticatorType != Pkix {
+		t.Errorf("LoadPublicKeysFromDir(...) loaded %d keys, expected the PKIX key", len(publicKeys))
+	}
+	if _, err := LoadPublicKeysFromDir(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("LoadPublicKeysFromDir(...) = nil, expected non nil for a missing directory")
+	}
+}
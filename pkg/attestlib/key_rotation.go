@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// UpdatableVerifier is a Verifier whose public keys can be replaced while it
+// is in use, e.g. to rotate or remove keys without creating a new Verifier.
+type UpdatableVerifier interface {
+	Verifier
+	// UpdateKeys replaces the public keys of the Verifier with
+	// `publicKeySet`, which are parsed and validated as by NewVerifier. If a
+	// key is invalid, the Verifier keeps its current keys. Verifications that
+	// are in progress complete with the keys they started with; each
+	// verification, and each call of VerifyAttestations or VerifyQuorum, uses
+	// either the old or the new keys, never a mix. Results cached by
+	// WrapVerifier for the Verifier are invalidated.
+	UpdateKeys(publicKeySet []PublicKey) error
+}
+
+// NewUpdatableVerifier creates an UpdatableVerifier, whose arguments are
+// those of NewVerifier.
+func NewUpdatableVerifier(image string, publicKeySet []PublicKey, opts ...VerifierOption) (UpdatableVerifier, error) {
+	imageName, imageDigest, err := parseImageName(image)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid image name")
+	}
+	v, err := newVerifier(imageName, imageDigest, publicKeySet, opts...)
+	if err != nil {
+		return nil, err
+	}
+	v.keyUpdates = &keyUpdates{}
+	return v, nil
+}
+
+// keyUpdates holds the public keys of the last UpdateKeys of a verifier.
+type keyUpdates struct {
+	mu sync.RWMutex
+	// updated is set once UpdateKeys has replaced the public keys of the
+	// verifier.
+	updated    bool
+	publicKeys map[string][]PublicKey
+	keyGroups  map[string][]string
+	// generation counts the calls of UpdateKeys that replaced the keys.
+	generation uint64
+}
+
+// UpdateKeys replaces the public keys of the verifier. See
+// UpdatableVerifier for more details.
+func (v *verifier) UpdateKeys(publicKeySet []PublicKey) error {
+	if v.keyUpdates == nil {
+		return errors.New("UpdateKeys needs a verifier created by NewUpdatableVerifier")
+	}
+	parsedKeySet, err := parsePublicKeySet(publicKeySet)
+	if err != nil {
+		return err
+	}
+	v.warnWeakKeys(parsedKeySet)
+	publicKeys, keyGroups, err := v.indexPublicKeys(parsedKeySet)
+	if err != nil {
+		return err
+	}
+	v.keyUpdates.mu.Lock()
+	defer v.keyUpdates.mu.Unlock()
+	v.keyUpdates.updated = true
+	v.keyUpdates.publicKeys = publicKeys
+	v.keyUpdates.keyGroups = keyGroups
+	v.keyUpdates.generation++
+	return nil
+}
+
+// keyGeneration returns a counter that changes whenever UpdateKeys replaces
+// the public keys of the verifier, so that results verified with other keys
+// can be told apart.
+func (v *verifier) keyGeneration() uint64 {
+	if v.keyUpdates == nil {
+		return 0
+	}
+	v.keyUpdates.mu.RLock()
+	defer v.keyUpdates.mu.RUnlock()
+	return v.keyUpdates.generation
+}
+
+// current returns the verifier with its current public keys. Verifications
+// must use the returned verifier throughout, so that they see a consistent
+// set of keys even if UpdateKeys is called concurrently.
+func (v *verifier) current() *verifier {
+	if v.keyUpdates == nil {
+		return v
+	}
+	v.keyUpdates.mu.RLock()
+	defer v.keyUpdates.mu.RUnlock()
+	if !v.keyUpdates.updated {
+		return v
+	}
+	snapshot := *v
+	snapshot.PublicKeys = v.keyUpdates.publicKeys
+	snapshot.keyGroups = v.keyUpdates.keyGroups
+	return &snapshot
+}
@@ -0,0 +1,169 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestUpdateKeys(t *testing.T) {
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	keyA := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"}
+	keyB := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-b"}
+	attA := &Attestation{PublicKeyID: "key-a", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	attB := &Attestation{PublicKeyID: "key-b", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+
+	v, err := NewUpdatableVerifier(helloAppImage, []PublicKey{keyA})
+	if err != nil {
+		t.Fatalf("NewUpdatableVerifier(...) = %v, expected nil", err)
+	}
+
+	steps := []struct {
+		name          string
+		keys          []PublicKey
+		expectedErr   error
+		expectedAErr  error
+		expectedBErr  error
+		expectedCount int
+	}{
+		{
+			name:          "initial keys",
+			expectedBErr:  ErrNoMatchingKey,
+			expectedCount: 1,
+		},
+		{
+			name:          "rotate to another key",
+			keys:          []PublicKey{keyB},
+			expectedAErr:  ErrNoMatchingKey,
+			expectedCount: 1,
+		},
+		{
+			name:          "invalid key keeps the current keys",
+			keys:          []PublicKey{keyA, {AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: []byte("invalid"), ID: "key-c"}},
+			expectedErr:   ErrInvalidPublicKey,
+			expectedAErr:  ErrNoMatchingKey,
+			expectedCount: 1,
+		},
+		{
+			name:          "add a key",
+			keys:          []PublicKey{keyA, keyB},
+			expectedCount: 2,
+		},
+		{
+			name:          "remove all keys",
+			keys:          []PublicKey{},
+			expectedAErr:  ErrNoMatchingKey,
+			expectedBErr:  ErrNoMatchingKey,
+			expectedCount: 0,
+		},
+	}
+	for _, step := range steps {
+		if step.keys != nil {
+			err := v.UpdateKeys(step.keys)
+			if step.expectedErr == nil && err != nil {
+				t.Errorf("%s: UpdateKeys(_) = %v, expected nil", step.name, err)
+			}
+			if step.expectedErr != nil && !errors.Is(err, step.expectedErr) {
+				t.Errorf("%s: UpdateKeys(_) = %v, want error matching %v", step.name, err, step.expectedErr)
+			}
+		}
+		for _, check := range []struct {
+			att         *Attestation
+			expectedErr error
+		}{{attA, step.expectedAErr}, {attB, step.expectedBErr}} {
+			err := v.VerifyAttestation(check.att)
+			if check.expectedErr == nil && err != nil {
+				t.Errorf("%s: VerifyAttestation(%s) = %v, expected nil", step.name, check.att.PublicKeyID, err)
+			}
+			if check.expectedErr != nil && !errors.Is(err, check.expectedErr) {
+				t.Errorf("%s: VerifyAttestation(%s) = %v, want error matching %v", step.name, check.att.PublicKeyID, err, check.expectedErr)
+			}
+		}
+		if got := len(v.RegisteredKeys()); got != step.expectedCount {
+			t.Errorf("%s: RegisteredKeys() has %d keys, expected %d", step.name, got, step.expectedCount)
+		}
+	}
+}
+
+func TestUpdateKeysNotUpdatable(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.(*verifier).UpdateKeys([]PublicKey{publicKey}); err == nil {
+		t.Errorf("UpdateKeys(_) = nil, expected non nil")
+	}
+}
+
+func TestUpdateKeysConcurrentRotation(t *testing.T) {
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	keysA := []PublicKey{{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"}}
+	keysB := []PublicKey{{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-b"}}
+	atts := []*Attestation{
+		{PublicKeyID: "key-a", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+		{PublicKeyID: "key-b", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+	}
+	v, err := NewUpdatableVerifier(helloAppImage, keysA)
+	if err != nil {
+		t.Fatalf("NewUpdatableVerifier(...) = %v, expected nil", err)
+	}
+
+	const verifications = 200
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < verifications; j++ {
+				// Exactly one of the attestations verifies with either key
+				// set; both or neither would mean a mix of the two sets.
+				results, err := v.VerifyAttestations(atts, 1)
+				if err != nil {
+					t.Errorf("VerifyAttestations(_, 1) = %v, expected nil", err)
+					return
+				}
+				if (results[0] == nil) == (results[1] == nil) {
+					t.Errorf("VerifyAttestations(_, 1) = %v, expected exactly one nil result", results)
+					return
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for i := 0; ; i++ {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		keys := keysB
+		if i%2 == 1 {
+			keys = keysA
+		}
+		if err := v.UpdateKeys(keys); err != nil {
+			t.Errorf("UpdateKeys(_) = %v, expected nil", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+)
+
+// keyStrengthPolicy holds the minimum strength of RSA and ECDSA public keys
+// that may verify Attestations. A minimum of zero disables the check.
+type keyStrengthPolicy struct {
+	// minRsaBits is the minimum size of the modulus of RSA keys.
+	minRsaBits int
+	// minEcdsaBits is the minimum size of the curve of ECDSA keys.
+	minEcdsaBits int
+}
+
+// defaultKeyStrength rejects RSA keys smaller than 2048 bits and ECDSA keys
+// on curves smaller than P-256.
+var defaultKeyStrength = keyStrengthPolicy{minRsaBits: 2048, minEcdsaBits: 256}
+
+// check checks that the parsed public key `pub` is at least as strong as the
+// policy requires, and describes the key otherwise. Other keys than RSA and
+// ECDSA keys are not checked.
+func (p keyStrengthPolicy) check(pub crypto.PublicKey) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < p.minRsaBits {
+			return fmt.Errorf("%d bit RSA key, the minimum is %d bits", bits, p.minRsaBits)
+		}
+	case *ecdsa.PublicKey:
+		if bits := key.Curve.Params().BitSize; bits < p.minEcdsaBits {
+			return fmt.Errorf("ECDSA key on %d bit curve %s, the minimum is %d bits", bits, key.Curve.Params().Name, p.minEcdsaBits)
+		}
+	}
+	return nil
+}
+
+// checkPublicKey checks the strength of a Pkix or Jwt public key. Key material that
+// cannot be parsed is left to verifyPkix to report.
+func (p keyStrengthPolicy) checkPublicKey(publicKey PublicKey) error {
+	pub, err := pkixKey(publicKey)
+	if err != nil {
+		return nil
+	}
+	if err := p.check(pub); err != nil {
+		return fmt.Errorf("%w: key %q: %v", ErrKeyTooWeak, publicKey.ID, err)
+	}
+	return nil
+}
+
+// warnWeakKeys logs a warning for each Pkix or Jwt public key of the verifier
+// that is too weak to verify Attestations.
+func (v *verifier) warnWeakKeys(publicKeys []PublicKey) {
+	for _, publicKey := range publicKeys {
+		if publicKey.AuthenticatorType != Pkix && publicKey.AuthenticatorType != Jwt {
+			continue
+		}
+		if err := v.keyStrength.checkPublicKey(publicKey); err != nil {
+			v.log().Warningf("Attestations signed by key %q will be rejected: %v", publicKey.ID, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"sync"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"github.com/pkg/errors"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// KmsClient is the part of the Cloud KMS API used to fetch public keys. It is
+// satisfied by *kms.KeyManagementClient from cloud.google.com/go/kms/apiv1.
+type KmsClient interface {
+	GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error)
+}
+
+// kmsAlgorithms maps the Cloud KMS signing algorithms to SignatureAlgorithms.
+var kmsAlgorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]SignatureAlgorithm{
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:   RsaPss2048Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:   RsaPss3072Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256:   RsaPss4096Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512:   RsaPss4096Sha512,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: RsaSignPkcs12048Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: RsaSignPkcs13072Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: RsaSignPkcs14096Sha256,
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: RsaSignPkcs14096Sha512,
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256:        EcdsaP256Sha256,
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:        EcdsaP384Sha384,
+}
+
+// isKmsSignatureAlgorithm reports whether Cloud KMS keys can use `alg`.
+func isKmsSignatureAlgorithm(alg SignatureAlgorithm) bool {
+	for _, kmsAlg := range kmsAlgorithms {
+		if kmsAlg == alg {
+			return true
+		}
+	}
+	return false
+}
+
+type kmsVerifierImpl struct {
+	client KmsClient
+	// retry controls how transient errors fetching public keys are retried.
+	retry retryPolicy
+	// keyStrength is the minimum strength of the public keys.
+	keyStrength keyStrengthPolicy
+
+	mu sync.Mutex
+	// keys caches the public keys fetched from Cloud KMS by resource name.
+	keys map[string]crypto.PublicKey
+}
+
+func newKmsVerifier(client KmsClient) *kmsVerifierImpl {
+	return &kmsVerifierImpl{
+		client:      client,
+		retry:       defaultRetryPolicy,
+		keyStrength: defaultKeyStrength,
+		keys:        map[string]crypto.PublicKey{},
+	}
+}
+
+// verifyKms verifies a detached signature over `payload` with a public key
+// held in Cloud KMS. `publicKey.KeyData` is the resource name of the
+// CryptoKeyVersion. The public key is fetched once and then cached. Keys
+// weaker than `v.keyStrength` are rejected with ErrKeyTooWeak.
+func (v *kmsVerifierImpl) verifyKms(ctx context.Context, signature []byte, payload []byte, publicKey PublicKey) error {
+	pub, err := v.publicKey(ctx, publicKey)
+	if err != nil {
+		return err
+	}
+	if err := v.keyStrength.check(pub); err != nil {
+		return fmt.Errorf("%w: Cloud KMS key %q: %v", ErrKeyTooWeak, publicKey.ID, err)
+	}
+	if err := verifyDetachedWithKey(signature, pub, publicKey.SignatureAlgorithm, payload); err != nil {
+		return errors.Wrapf(err, "error verifying signature with Cloud KMS key %q", publicKey.ID)
+	}
+	return nil
+}
+
+// publicKey returns the cached public key for `publicKey`, fetching it from
+// Cloud KMS if necessary.
+func (v *kmsVerifierImpl) publicKey(ctx context.Context, publicKey PublicKey) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	pub, ok := v.keys[string(publicKey.KeyData)]
+	v.mu.Unlock()
+	if ok {
+		return pub, nil
+	}
+	return v.loadPublicKey(ctx, publicKey)
+}
+
+// checkKey fetches the public key for `publicKey` from Cloud KMS, even if it
+// is cached.
+func (v *kmsVerifierImpl) checkKey(ctx context.Context, publicKey PublicKey) error {
+	_, err := v.loadPublicKey(ctx, publicKey)
+	return err
+}
+
+// loadPublicKey fetches the public key for `publicKey` from Cloud KMS, checks
+// its algorithm and caches it.
+func (v *kmsVerifierImpl) loadPublicKey(ctx context.Context, publicKey PublicKey) (crypto.PublicKey, error) {
+	name := string(publicKey.KeyData)
+	kmsKey, err := v.fetchPublicKey(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	alg, ok := kmsAlgorithms[kmsKey.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("Cloud KMS key %q uses unsupported algorithm %v", name, kmsKey.Algorithm)
+	}
+	if alg != publicKey.SignatureAlgorithm {
+		return nil, fmt.Errorf("Cloud KMS key %q uses algorithm %v, but public key %q expects %v", name, kmsKey.Algorithm, publicKey.ID, publicKey.SignatureAlgorithm)
+	}
+	pub, err := parsePkixPublicKey([]byte(kmsKey.Pem))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing public key of Cloud KMS key %q", name)
+	}
+
+	v.mu.Lock()
+	v.keys[name] = pub
+	v.mu.Unlock()
+	return pub, nil
+}
+
+// fetchPublicKey requests a public key from Cloud KMS, retrying transient
+// errors with exponential backoff.
+func (v *kmsVerifierImpl) fetchPublicKey(ctx context.Context, name string) (*kmspb.PublicKey, error) {
+	var kmsKey *kmspb.PublicKey
+	attempts, err := v.retry.do(ctx, isTransientKmsError, func() error {
+		var err error
+		kmsKey, err = v.client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{Name: name})
+		return err
+	})
+	switch {
+	case err == nil:
+		return kmsKey, nil
+	case err == ctx.Err():
+		return nil, err
+	case isTransientKmsError(err):
+		return nil, fmt.Errorf("%w: error fetching public key of Cloud KMS key %q after %d attempts: %v", ErrRetriesExhausted, name, attempts, err)
+	default:
+		return nil, errors.Wrapf(err, "error fetching public key of Cloud KMS key %q", name)
+	}
+}
+
+// isTransientKmsError reports whether a Cloud KMS request that failed with
+// `err` may succeed when retried.
+func isTransientKmsError(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const kmsKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+
+// fakeKmsClient returns the errors in `errs` in order, and then `key`.
+type fakeKmsClient struct {
+	key   *kmspb.PublicKey
+	errs  []error
+	calls int
+}
+
+func (c *fakeKmsClient) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error) {
+	c.calls++
+	if req.Name != kmsKeyName {
+		return nil, status.Errorf(codes.NotFound, "key %q not found", req.Name)
+	}
+	if len(c.errs) != 0 {
+		err := c.errs[0]
+		c.errs = c.errs[1:]
+		return nil, err
+	}
+	return c.key, nil
+}
+
+func ec256KmsKey() *kmspb.PublicKey {
+	return &kmspb.PublicKey{Pem: ec256PubKey, Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256}
+}
+
+func TestVerifyKms(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "try again")
+	tcs := []struct {
+		name          string
+		keyName       string
+		kmsKey        *kmspb.PublicKey
+		errs          []error
+		expectedCalls int
+		expectedErr   bool
+	}{
+		{
+			name:          "key fetched",
+			keyName:       kmsKeyName,
+			kmsKey:        ec256KmsKey(),
+			expectedCalls: 1,
+		},
+		{
+			name:          "transient errors retried",
+			keyName:       kmsKeyName,
+			kmsKey:        ec256KmsKey(),
+			errs:          []error{unavailable, status.Error(codes.DeadlineExceeded, "slow")},
+			expectedCalls: 3,
+		},
+		{
+			name:          "transient errors exhaust attempts",
+			keyName:       kmsKeyName,
+			kmsKey:        ec256KmsKey(),
+			errs:          []error{unavailable, unavailable, unavailable},
+			expectedCalls: defaultKeyFetchAttempts,
+			expectedErr:   true,
+		},
+		{
+			name:          "permanent error not retried",
+			keyName:       kmsKeyName,
+			kmsKey:        ec256KmsKey(),
+			errs:          []error{status.Error(codes.PermissionDenied, "denied")},
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+		{
+			name:          "key not found",
+			keyName:       "projects/p/locations/global/keyRings/r/cryptoKeys/other/cryptoKeyVersions/1",
+			kmsKey:        ec256KmsKey(),
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+		{
+			name:          "algorithm mismatch",
+			keyName:       kmsKeyName,
+			kmsKey:        &kmspb.PublicKey{Pem: ec256PubKey, Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384},
+			expectedCalls: 1,
+			expectedErr:   true,
+		},
+	}
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "kms-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := signer.CreateAttestation([]byte(payload))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &fakeKmsClient{key: tc.kmsKey, errs: tc.errs}
+			v := newKmsVerifier(client)
+			var sleeps []time.Duration
+			v.retry.sleep = func(ctx context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			}
+			publicKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(tc.keyName), ID: "kms-key"}
+			err := v.verifyKms(context.Background(), att.Signature, att.SerializedPayload, publicKey)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("verifyKms(...) = nil, expected non nil")
+				}
+			} else if err != nil {
+				t.Errorf("verifyKms(...) = %v, expected nil", err)
+			}
+			if client.calls != tc.expectedCalls {
+				t.Errorf("GetPublicKey called %d times, want %d", client.calls, tc.expectedCalls)
+			}
+			for i := 1; i < len(sleeps); i++ {
+				if sleeps[i] <= sleeps[i-1] {
+					t.Errorf("backoff %v after %v, want increasing backoff", sleeps[i], sleeps[i-1])
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyKmsKeyStrength(t *testing.T) {
+	signer, err := NewPkixSigner([]byte(rsa1024PrivateKey), RsaSignPkcs12048Sha256, "kms-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := signer.CreateAttestation([]byte(payload))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	client := &fakeKmsClient{key: &kmspb.PublicKey{Pem: rsa1024PubKey, Algorithm: kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256}}
+	publicKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte(kmsKeyName), ID: "kms-key"}
+	v := newKmsVerifier(client)
+	if err := v.verifyKms(context.Background(), att.Signature, att.SerializedPayload, publicKey); !errors.Is(err, ErrKeyTooWeak) {
+		t.Errorf("verifyKms(...) = %v, want error matching %v", err, ErrKeyTooWeak)
+	}
+	v.keyStrength = keyStrengthPolicy{}
+	if err := v.verifyKms(context.Background(), att.Signature, att.SerializedPayload, publicKey); err != nil {
+		t.Errorf("verifyKms(...) = %v, expected nil", err)
+	}
+}
+
+func TestVerifyKmsCachesKey(t *testing.T) {
+	client := &fakeKmsClient{key: ec256KmsKey()}
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, kmsKeyName)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := CreateImageAttestation(signer, helloAppImage)
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	publicKey, err := NewPublicKey(Kms, EcdsaP256Sha256, []byte(kmsKeyName), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithKmsClient(client))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := v.VerifyAttestation(att); err != nil {
+			t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+		}
+	}
+	if client.calls != 1 {
+		t.Errorf("GetPublicKey called %d times, want 1", client.calls)
+	}
+
+	att.SerializedPayload = []byte(otherDigestPayload)
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrSignatureInvalid)
+	}
+}
+
+func TestVerifyKmsWithoutClient(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: "kms-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	err = v.VerifyAttestation(&Attestation{PublicKeyID: "kms-key", Signature: []byte("signature"), SerializedPayload: []byte(validPayload)})
+	if !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrUnsupportedKeyType)
+	}
+}
+
+func TestNewKmsPublicKey(t *testing.T) {
+	tcs := []struct {
+		name        string
+		keyData     []byte
+		keyID       string
+		alg         SignatureAlgorithm
+		expectedID  string
+		expectedErr bool
+	}{
+		{
+			name:       "default ID",
+			keyData:    []byte(kmsKeyName),
+			alg:        EcdsaP256Sha256,
+			expectedID: kmsKeyName,
+		},
+		{
+			name:       "explicit ID",
+			keyData:    []byte(kmsKeyName),
+			keyID:      "kms-key",
+			alg:        RsaPss2048Sha256,
+			expectedID: "kms-key",
+		},
+		{
+			name:        "missing resource name",
+			alg:         EcdsaP256Sha256,
+			expectedErr: true,
+		},
+		{
+			name:        "algorithm not supported by Cloud KMS",
+			keyData:     []byte(kmsKeyName),
+			alg:         EddsaEd25519,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey, err := NewPublicKey(Kms, tc.alg, tc.keyData, tc.keyID)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("NewPublicKey(...) = %v, expected error", publicKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewPublicKey(...) = %v, expected nil", err)
+			}
+			if publicKey.ID != tc.expectedID {
+				t.Errorf("NewPublicKey(...).ID = %q, want %q", publicKey.ID, tc.expectedID)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+// Logger receives the diagnostic messages of a Verifier. Adapters for other
+// logging libraries, such as glog, zap or logr, only need to implement these
+// two methods.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+// nopLogger is a Logger that discards all messages.
+type nopLogger struct{}
+
+func (nopLogger) Infof(format string, args ...interface{}) {}
+
+func (nopLogger) Warningf(format string, args ...interface{}) {}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"errors"
+	"time"
+)
+
+// VerificationOutcome categorizes the result of verifying an Attestation.
+type VerificationOutcome string
+
+// Enumeration of VerificationOutcome
+const (
+	// OutcomeSuccess indicates that the Attestation was verified.
+	OutcomeSuccess VerificationOutcome = "success"
+	// OutcomeNoKey indicates that no public key matched the Attestation.
+	OutcomeNoKey VerificationOutcome = "no-key"
+	// OutcomeBadSignature indicates that the Attestation's signature could not
+	// be verified.
+	OutcomeBadSignature VerificationOutcome = "bad-signature"
+	// OutcomePayloadMismatch indicates that the verified payload could not be
+	// parsed or does not describe the image being verified.
+	OutcomePayloadMismatch VerificationOutcome = "payload-mismatch"
+	// OutcomeError indicates any other failure, such as a revoked key or a
+	// stale Attestation.
+	OutcomeError VerificationOutcome = "error"
+	// OutcomeSoftPass indicates that the Attestation was accepted without
+	// verifying it, since its public key is not registered and its key type
+	// is soft, see WithSoftMissingKeys.
+	OutcomeSoftPass VerificationOutcome = "soft-pass"
+)
+
+// MetricsRecorder receives the outcome and latency of every Attestation
+// verification, e.g. to back Prometheus counters and histograms. Its methods
+// must be safe for concurrent use.
+type MetricsRecorder interface {
+	// IncVerification counts a verification. `keyType` is the type of the
+	// public key that verified the Attestation or, if verification failed, of
+	// the public key matching its PublicKeyID. It is UnknownAuthenticatorType
+	// if no such key exists.
+	IncVerification(keyType AuthenticatorType, outcome VerificationOutcome)
+	// ObserveLatency records how long a verification took.
+	ObserveLatency(d time.Duration)
+}
+
+// nopMetricsRecorder is a MetricsRecorder that discards all metrics.
+type nopMetricsRecorder struct{}
+
+func (nopMetricsRecorder) IncVerification(keyType AuthenticatorType, outcome VerificationOutcome) {}
+
+func (nopMetricsRecorder) ObserveLatency(d time.Duration) {}
+
+// verificationOutcome categorizes the error returned by verifying an
+// Attestation.
+func verificationOutcome(err error) VerificationOutcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case err == errSoftPassed:
+		return OutcomeSoftPass
+	case errors.Is(err, ErrNoMatchingKey):
+		return OutcomeNoKey
+	case errors.Is(err, ErrSignatureInvalid):
+		return OutcomeBadSignature
+	case errors.Is(err, ErrPayloadMismatch), errors.Is(err, ErrInvalidPayload):
+		return OutcomePayloadMismatch
+	default:
+		return OutcomeError
+	}
+}
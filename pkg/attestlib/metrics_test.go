@@ -0,0 +1,94 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type verificationLabels struct {
+	keyType AuthenticatorType
+	outcome VerificationOutcome
+}
+
+type fakeMetricsRecorder struct {
+	verifications []verificationLabels
+	latencies     []time.Duration
+}
+
+func (r *fakeMetricsRecorder) IncVerification(keyType AuthenticatorType, outcome VerificationOutcome) {
+	r.verifications = append(r.verifications, verificationLabels{keyType: keyType, outcome: outcome})
+}
+
+func (r *fakeMetricsRecorder) ObserveLatency(d time.Duration) {
+	r.latencies = append(r.latencies, d)
+}
+
+func TestVerifyAttestationMetrics(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	tcs := []struct {
+		name     string
+		att      *Attestation
+		expected verificationLabels
+	}{
+		{
+			name:     "success",
+			att:      &Attestation{PublicKeyID: "signing-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expected: verificationLabels{keyType: Ed25519, outcome: OutcomeSuccess},
+		},
+		{
+			name:     "no matching key",
+			att:      &Attestation{PublicKeyID: "unknown-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expected: verificationLabels{keyType: UnknownAuthenticatorType, outcome: OutcomeNoKey},
+		},
+		{
+			name:     "bad signature",
+			att:      &Attestation{PublicKeyID: "signing-key", Signature: []byte("invalid-signature"), SerializedPayload: []byte(validPayload)},
+			expected: verificationLabels{keyType: Ed25519, outcome: OutcomeBadSignature},
+		},
+		{
+			name:     "payload mismatch",
+			att:      &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(otherDigestPayload)), SerializedPayload: []byte(otherDigestPayload)},
+			expected: verificationLabels{keyType: Ed25519, outcome: OutcomePayloadMismatch},
+		},
+		{
+			name:     "invalid payload",
+			att:      &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(invalidPayload)), SerializedPayload: []byte(invalidPayload)},
+			expected: verificationLabels{keyType: Ed25519, outcome: OutcomePayloadMismatch},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &fakeMetricsRecorder{}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithMetricsRecorder(recorder))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			v.VerifyAttestation(tc.att)
+			if expected := []verificationLabels{tc.expected}; !reflect.DeepEqual(recorder.verifications, expected) {
+				t.Errorf("recorded verifications %v, expected %v", recorder.verifications, expected)
+			}
+			if len(recorder.latencies) != 1 {
+				t.Errorf("recorded %d latencies, expected 1", len(recorder.latencies))
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MultiVerifierMode specifies how a Verifier created with NewMultiVerifier
+// combines the outcomes of its sub-verifiers.
+type MultiVerifierMode int
+
+// Enumeration of MultiVerifierMode
+const (
+	// RequireAny accepts an Attestation if any sub-verifier accepts it. The
+	// sub-verifiers are tried in order until one accepts it.
+	RequireAny MultiVerifierMode = iota
+	// RequireAll accepts an Attestation only if every sub-verifier accepts
+	// it. Every sub-verifier is run, so that all rejections are reported.
+	RequireAll
+)
+
+// errNoSubVerifiers is the error of a Verifier created with NewMultiVerifier
+// without sub-verifiers.
+var errNoSubVerifiers = errors.New("attestation rejected by a multi verifier without sub-verifiers")
+
+// multiVerifier is a Verifier that combines the outcomes of several
+// sub-verifiers, e.g. with different public keys, according to its mode.
+type multiVerifier struct {
+	mode      MultiVerifierMode
+	verifiers []Verifier
+}
+
+// NewMultiVerifier creates a Verifier that verifies Attestations with each of
+// `verifiers`, which may hold different public keys or options, and accepts
+// them according to `mode`. If some sub-verifiers reject an Attestation, the
+// error is a *MultiVerifierError holding each of their errors. A Verifier
+// without sub-verifiers, or with an unknown mode, rejects every Attestation,
+// even with RequireAll.
+func NewMultiVerifier(mode MultiVerifierMode, verifiers ...Verifier) Verifier {
+	if len(verifiers) == 0 {
+		return NewAlwaysRejectingVerifier(errNoSubVerifiers)
+	}
+	if mode != RequireAny && mode != RequireAll {
+		return NewAlwaysRejectingVerifier(fmt.Errorf("attestation rejected by a multi verifier with unknown mode %d", mode))
+	}
+	return &multiVerifier{mode: mode, verifiers: append([]Verifier(nil), verifiers...)}
+}
+
+// VerifyAttestation verifies an Attestation with the sub-verifiers. See
+// Verifier for more details.
+func (v *multiVerifier) VerifyAttestation(att *Attestation) error {
+	return v.VerifyAttestationContext(context.Background(), att)
+}
+
+// VerifyAttestationContext verifies an Attestation with the sub-verifiers,
+// passing `ctx` to each of them. See Verifier for more details.
+func (v *multiVerifier) VerifyAttestationContext(ctx context.Context, att *Attestation) error {
+	_, err := v.run(ctx, func(sub Verifier) (*VerificationResult, error) {
+		return nil, sub.VerifyAttestationContext(ctx, att)
+	})
+	return err
+}
+
+// VerifyAttestationWithResult verifies an Attestation with the sub-verifiers.
+// With RequireAny, the result is the one of the sub-verifier that accepted
+// the Attestation; with RequireAll, it is the one of the first sub-verifier.
+// See Verifier for more details.
+func (v *multiVerifier) VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error) {
+	results, err := v.run(context.Background(), func(sub Verifier) (*VerificationResult, error) {
+		return sub.VerifyAttestationWithResult(att)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// VerifyAttestationStream verifies an Attestation whose payload is read from
+// `payload` with the sub-verifiers. Since each of them reads the payload, it
+// is buffered unless there is a single sub-verifier. See Verifier for more
+// details.
+func (v *multiVerifier) VerifyAttestationStream(att *Attestation, payload io.Reader) (*VerificationResult, error) {
+	if len(v.verifiers) == 1 {
+		return v.verifiers[0].VerifyAttestationStream(att, payload)
+	}
+	buffered, err := ioutil.ReadAll(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading payload")
+	}
+	results, err := v.run(context.Background(), func(sub Verifier) (*VerificationResult, error) {
+		return sub.VerifyAttestationStream(att, bytes.NewReader(buffered))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// VerifyOrExplain verifies an Attestation with the sub-verifiers, and
+// explains the outcome of each sub-verifier that was run, in order. See
+// Verifier for more details.
+func (v *multiVerifier) VerifyOrExplain(att *Attestation) (bool, string) {
+	var explanations []string
+	verifiedCount := 0
+	for i, sub := range v.verifiers {
+		verified, explanation := sub.VerifyOrExplain(att)
+		explanations = append(explanations, fmt.Sprintf("verifier %d: %s", i, strings.Replace(explanation, "\n", "\n  ", -1)))
+		if verified {
+			verifiedCount++
+			if v.mode == RequireAny {
+				return true, explanations[len(explanations)-1]
+			}
+		}
+	}
+	verified := v.mode == RequireAll && verifiedCount == len(v.verifiers)
+	return verified, strings.Join(explanations, "\n")
+}
+
+// VerifyAttestations verifies each of `atts` with the sub-verifiers. The
+// public keys that verified an Attestation are those reported by the
+// sub-verifiers that accepted it. See Verifier for more details.
+func (v *multiVerifier) VerifyAttestations(atts []*Attestation, minVerified int) ([]error, error) {
+	return verifyAttestations(atts, minVerified, v.verifyKeyIDs)
+}
+
+// VerifyQuorum verifies `atts` with the sub-verifiers until `threshold`
+// distinct public key IDs have verified an Attestation. See Verifier for more
+// details.
+func (v *multiVerifier) VerifyQuorum(atts []*Attestation, threshold int) error {
+	return verifyQuorum(atts, threshold, v.verifyKeyIDs)
+}
+
+// SelfTest runs the self-test of every sub-verifier, regardless of the mode,
+// and lists the failures of each. See Verifier for more details.
+func (v *multiVerifier) SelfTest(ctx context.Context) error {
+	var failures []string
+	for i, sub := range v.verifiers {
+		if err := sub.SelfTest(ctx); err != nil {
+			if isContextError(err) {
+				return err
+			}
+			// Avoid repeating the sentinel of the sub-verifier's error.
+			msg := strings.TrimPrefix(err.Error(), ErrSelfTestFailed.Error()+": ")
+			failures = append(failures, fmt.Sprintf("verifier %d: %s", i, msg))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %s", ErrSelfTestFailed, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// RegisteredKeys returns the public keys of every sub-verifier, in the order
+// of the sub-verifiers. A key held by several sub-verifiers is listed for
+// each of them. See Verifier for more details.
+func (v *multiVerifier) RegisteredKeys() []KeyInfo {
+	var keys []KeyInfo
+	for _, sub := range v.verifiers {
+		keys = append(keys, sub.RegisteredKeys()...)
+	}
+	return keys
+}
+
+// verifyKeyIDs verifies an Attestation with the sub-verifiers and returns the
+// IDs of the public keys that verified it.
+func (v *multiVerifier) verifyKeyIDs(att *Attestation) ([]string, error) {
+	results, err := v.run(context.Background(), func(sub Verifier) (*VerificationResult, error) {
+		return sub.VerifyAttestationWithResult(att)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var keyIDs []string
+	for _, result := range results {
+		for _, keyID := range result.VerifiedKeyIDs() {
+			if !containsString(keyIDs, keyID) {
+				keyIDs = append(keyIDs, keyID)
+			}
+		}
+	}
+	return keyIDs, nil
+}
+
+// run verifies with `verify` for the sub-verifiers according to the mode, and
+// returns the results of the sub-verifiers that accepted the Attestation, or
+// a *MultiVerifierError. The context error is returned as is once `ctx` is
+// done.
+func (v *multiVerifier) run(ctx context.Context, verify func(Verifier) (*VerificationResult, error)) ([]*VerificationResult, error) {
+	var results []*VerificationResult
+	errs := make([]error, 0, len(v.verifiers))
+	rejected := false
+	for _, sub := range v.verifiers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		result, err := verify(sub)
+		errs = append(errs, err)
+		if err != nil {
+			if isContextError(err) {
+				return nil, err
+			}
+			rejected = true
+			continue
+		}
+		results = append(results, result)
+		if v.mode == RequireAny {
+			return results, nil
+		}
+	}
+	if rejected {
+		return nil, &MultiVerifierError{Mode: v.mode, Errors: errs}
+	}
+	return results, nil
+}
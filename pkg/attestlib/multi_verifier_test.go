@@ -0,0 +1,204 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// newMultiVerifierTestVerifiers returns a Verifier with the Ed25519 test key
+// under ID "signer", and one with another key under the same ID.
+func newMultiVerifierTestVerifiers(t *testing.T) (Verifier, Verifier) {
+	t.Helper()
+	signingVerifier, err := NewVerifier(helloAppImage, []PublicKey{{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signer"}})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	otherVerifier, err := NewVerifier(helloAppImage, []PublicKey{{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "signer"}})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	return signingVerifier, otherVerifier
+}
+
+func TestMultiVerifier(t *testing.T) {
+	signingVerifier, otherVerifier := newMultiVerifierTestVerifiers(t)
+	att := &Attestation{PublicKeyID: "signer", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+
+	tcs := []struct {
+		name           string
+		mode           MultiVerifierMode
+		verifiers      []Verifier
+		expectErr      bool
+		expectedErrors []error
+	}{
+		{
+			name:      "any with one passing",
+			mode:      RequireAny,
+			verifiers: []Verifier{otherVerifier, signingVerifier},
+		},
+		{
+			name:      "any with first passing",
+			mode:      RequireAny,
+			verifiers: []Verifier{signingVerifier, otherVerifier},
+		},
+		{
+			name:           "any with none passing",
+			mode:           RequireAny,
+			verifiers:      []Verifier{otherVerifier, otherVerifier},
+			expectErr:      true,
+			expectedErrors: []error{ErrSignatureInvalid, ErrSignatureInvalid},
+		},
+		{
+			name:      "all passing",
+			mode:      RequireAll,
+			verifiers: []Verifier{signingVerifier, signingVerifier},
+		},
+		{
+			name:           "all with one failing",
+			mode:           RequireAll,
+			verifiers:      []Verifier{signingVerifier, otherVerifier, signingVerifier},
+			expectErr:      true,
+			expectedErrors: []error{nil, ErrSignatureInvalid, nil},
+		},
+		{
+			name:      "any without sub-verifiers",
+			mode:      RequireAny,
+			expectErr: true,
+		},
+		{
+			name:      "all without sub-verifiers",
+			mode:      RequireAll,
+			expectErr: true,
+		},
+		{
+			name:      "unknown mode",
+			mode:      MultiVerifierMode(42),
+			verifiers: []Verifier{signingVerifier},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewMultiVerifier(tc.mode, tc.verifiers...)
+			err := v.VerifyAttestation(att)
+			if !tc.expectErr {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if err == nil {
+				t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+			}
+			if verified, explanation := v.VerifyOrExplain(att); verified != !tc.expectErr {
+				t.Errorf("VerifyOrExplain(_) = %v, %q, expected %v", verified, explanation, !tc.expectErr)
+			}
+			if tc.expectedErrors == nil {
+				return
+			}
+			var multiErr *MultiVerifierError
+			if !errors.As(err, &multiErr) {
+				t.Fatalf("VerifyAttestation(_) = %v, expected a *MultiVerifierError", err)
+			}
+			if len(multiErr.Errors) != len(tc.expectedErrors) {
+				t.Fatalf("VerifyAttestation(_) = %v, expected %d sub-verifier results", err, len(tc.expectedErrors))
+			}
+			for i, expected := range tc.expectedErrors {
+				if expected == nil && multiErr.Errors[i] != nil {
+					t.Errorf("sub-verifier %d: got %v, expected nil", i, multiErr.Errors[i])
+				}
+				if expected != nil && !errors.Is(multiErr.Errors[i], expected) {
+					t.Errorf("sub-verifier %d: got %v, want error matching %v", i, multiErr.Errors[i], expected)
+				}
+			}
+			if !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestMultiVerifierResult(t *testing.T) {
+	signingVerifier, otherVerifier := newMultiVerifierTestVerifiers(t)
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	v := NewMultiVerifier(RequireAny, otherVerifier, signingVerifier)
+
+	result, err := v.VerifyAttestationWithResult(&Attestation{PublicKeyID: "signer", Signature: signature, SerializedPayload: []byte(validPayload)})
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.KeyID != "signer" || result.KeyType != Ed25519 {
+		t.Errorf("VerifyAttestationWithResult(_) = %+v, expected the result of the passing sub-verifier", result)
+	}
+
+	result, err = v.VerifyAttestationStream(&Attestation{PublicKeyID: "signer", Signature: signature}, bytes.NewReader([]byte(validPayload)))
+	if err != nil {
+		t.Fatalf("VerifyAttestationStream(_) = %v, expected nil", err)
+	}
+	if result.KeyID != "signer" {
+		t.Errorf("VerifyAttestationStream(_) verified with key %q, expected %q", result.KeyID, "signer")
+	}
+
+	verified, explanation := v.VerifyOrExplain(&Attestation{PublicKeyID: "signer", Signature: signature[:10], SerializedPayload: []byte(validPayload)})
+	if verified {
+		t.Errorf("VerifyOrExplain(_) = true, expected false")
+	}
+	for _, expected := range []string{"verifier 0: attestation rejected", "verifier 1: attestation rejected", "\n  signature decoded: no"} {
+		if !strings.Contains(explanation, expected) {
+			t.Errorf("VerifyOrExplain(_) explanation is missing %q:\n%s", expected, explanation)
+		}
+	}
+}
+
+func TestMultiVerifierQuorum(t *testing.T) {
+	keyA := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"}
+	keyB := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-b"}
+	verifierA, err := NewVerifier(helloAppImage, []PublicKey{keyA})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	verifierB, err := NewVerifier(helloAppImage, []PublicKey{keyB})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+	atts := []*Attestation{
+		{PublicKeyID: "key-a", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+		{PublicKeyID: "key-b", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+	}
+
+	// Each key source verifies one of the attestations, so together they
+	// meet a quorum of two.
+	if err := NewMultiVerifier(RequireAny, verifierA, verifierB).VerifyQuorum(atts, 2); err != nil {
+		t.Errorf("VerifyQuorum(_, 2) = %v, expected nil", err)
+	}
+	if err := verifierA.VerifyQuorum(atts, 2); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("VerifyQuorum(_, 2) = %v, want error matching %v", err, ErrQuorumNotMet)
+	}
+	results, err := NewMultiVerifier(RequireAll, verifierA, verifierB).VerifyAttestations(atts, 1)
+	if !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("VerifyAttestations(_, 1) = %v, want error matching %v", err, ErrQuorumNotMet)
+	}
+	for i, result := range results {
+		if !errors.Is(result, ErrNoMatchingKey) {
+			t.Errorf("VerifyAttestations(_, 1)[%d] = %v, want error matching %v", i, result, ErrNoMatchingKey)
+		}
+	}
+}
@@ -0,0 +1,550 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/x509"
+	"strings"
+	"time"
+)
+
+// VerifierOption configures optional behavior of a Verifier created by
+// NewVerifier.
+type VerifierOption func(*verifier)
+
+// WithKeyTrial enables verifying Attestations whose PublicKeyID is empty or
+// does not match any public key. Instead of failing, the Verifier tries up to
+// `limit` public keys of a type that could verify the Attestation, and
+// succeeds with the first one that verifies it.
+func WithKeyTrial(limit int) VerifierOption {
+	return func(v *verifier) {
+		v.keyTrialLimit = limit
+	}
+}
+
+// WithParallelKeyTrial makes key trial, see WithKeyTrial, try up to `workers`
+// candidate keys concurrently, which speeds up trials over many RSA keys.
+// Once a key verifies the Attestation, keys after it are no longer tried. If
+// several keys verify it, the first candidate key is reported, as in a serial
+// trial. The Logger of the Verifier must be safe for concurrent use.
+func WithParallelKeyTrial(workers int) VerifierOption {
+	return func(v *verifier) {
+		v.keyTrialWorkers = workers
+	}
+}
+
+// WithClock sets the Clock the Verifier uses to get the current time when
+// checking public key validity periods, attestation freshness, JWT claims and
+// certificate validity. It defaults to SystemClock.
+func WithClock(clock Clock) VerifierOption {
+	return func(v *verifier) {
+		v.clock = clock
+	}
+}
+
+// WithRoots sets the trust roots used to validate PKIX public keys that are
+// given as certificates. They cannot verify Attestations unless roots are
+// configured. The roots do not apply to Cms Attestations, see WithCmsRoots.
+func WithRoots(roots *x509.CertPool) VerifierOption {
+	return func(v *verifier) {
+		v.roots = roots
+	}
+}
+
+// WithCmsRoots sets the trust roots of the signing certificates embedded in
+// Cms Attestations, which cannot be verified unless roots are configured. Any
+// certificate that chains to `roots` is trusted as a signer, so the roots
+// should be dedicated to signing Attestations. The signing certificate must
+// have one of `keyUsages` as an extended key usage, by default
+// x509.ExtKeyUsageCodeSigning.
+func WithCmsRoots(roots *x509.CertPool, keyUsages ...x509.ExtKeyUsage) VerifierOption {
+	return func(v *verifier) {
+		v.cmsRoots = roots
+		v.cmsKeyUsages = append([]x509.ExtKeyUsage(nil), keyUsages...)
+	}
+}
+
+// WithSpiffe makes the Verifier treat PKIX public keys given as certificates
+// as X.509 SVIDs of SPIFFE workloads. An SVID must chain to `bundle`, the
+// SPIFFE trust bundle, and have exactly one URI SAN, its SPIFFE ID. If
+// `spiffeIDs` are given, the SPIFFE ID must be one of them; an ID without a
+// path, e.g. "spiffe://example.org", allows every workload of the trust
+// domain. The trust bundle replaces the roots set with WithRoots.
+func WithSpiffe(bundle *x509.CertPool, spiffeIDs ...string) VerifierOption {
+	return func(v *verifier) {
+		v.spiffe = &spiffeConfig{
+			bundle: bundle,
+			ids:    append([]string(nil), spiffeIDs...),
+		}
+	}
+}
+
+// WithSigstore enables verifying keyless Attestations that carry a
+// SigstoreBundle. Their signing certificate must chain to one of
+// `fulcioRoots` at the time the signature was logged, and their Rekor entry
+// and its inclusion proof must be signed by `rekorPublicKey`, a PEM or DER
+// encoded PKIX public key. The certificate must record `issuer`, e.g.
+// "https://token.actions.githubusercontent.com", as the OIDC issuer that
+// authenticated the signer, and have one of `identities` as an email address
+// or URI. NewVerifier fails if `issuer` is empty or no identity is given,
+// unless WithInsecureAnySigstoreIdentity is set.
+func WithSigstore(fulcioRoots *x509.CertPool, rekorPublicKey []byte, issuer string, identities ...string) VerifierOption {
+	return func(v *verifier) {
+		v.sigstore = &sigstoreConfig{
+			fulcioRoots:    fulcioRoots,
+			rekorPublicKey: rekorPublicKey,
+			issuer:         issuer,
+			identities:     identities,
+		}
+	}
+}
+
+// WithInsecureAnySigstoreIdentity makes a Verifier created WithSigstore
+// without identities accept Attestations signed by any identity the OIDC
+// issuer authenticated. Since anyone can obtain a Fulcio certificate from a
+// public issuer, it must never be used to enforce a policy.
+func WithInsecureAnySigstoreIdentity() VerifierOption {
+	return func(v *verifier) {
+		v.anySigstoreIdentity = true
+	}
+}
+
+// WithAllowedAlgorithms restricts the Verifier to the given signature
+// algorithms. Attestations whose public key uses any other algorithm are
+// rejected before their signature is checked. PGP keys use PGPUnused.
+func WithAllowedAlgorithms(algs ...SignatureAlgorithm) VerifierOption {
+	return func(v *verifier) {
+		v.allowedAlgorithms = map[SignatureAlgorithm]bool{}
+		for _, alg := range algs {
+			v.allowedAlgorithms[alg] = true
+		}
+	}
+}
+
+// WithStrictKeyIDs makes NewVerifier fail if several public keys share an ID.
+// By default, such keys are all tried when verifying an Attestation with that
+// PublicKeyID.
+func WithStrictKeyIDs() VerifierOption {
+	return func(v *verifier) {
+		v.strictKeyIDs = true
+	}
+}
+
+// WithStrictKeyIDMatching makes the Verifier reject Attestations whose
+// PublicKeyID is empty or is not exactly the ID of one of its public keys with
+// ErrKeyIDMismatch, rather than verifying them with other keys. It takes
+// precedence over key trial. In DSSE envelopes, every signature must name a
+// public key by its keyid or the Attestation's PublicKeyID.
+func WithStrictKeyIDMatching() VerifierOption {
+	return func(v *verifier) {
+		v.strictKeyIDMatching = true
+	}
+}
+
+// WithKeyIdentityMatching makes the Verifier confirm, after a signature is
+// verified, that the PublicKeyID of the Attestation, or of the signature in
+// Signatures, identifies the public key that verified it: it must be the ID of
+// the key, or, for Pgp keys, its fingerprint in either case, or, for Pkix and
+// Jwt keys, the SPKI fingerprint of the key material. Otherwise, e.g. if the
+// key was found by key trial, a key alias or a KeyMatcher, the Attestation is
+// rejected with ErrKeyMismatch. The signatures of a DSSE envelope are matched
+// with their keyid instead, if any, and a COSE_Sign1 message with its kid
+// header if the Attestation has no PublicKeyID. The keys of CMS and sigstore
+// Attestations come from their signing certificates: the PublicKeyID must be
+// the SPKI fingerprint of the certificate's key, or, for sigstore, its
+// identity.
+func WithKeyIdentityMatching() VerifierOption {
+	return func(v *verifier) {
+		v.keyIdentityMatching = true
+	}
+}
+
+// WithKeyAlias groups the public keys with the given IDs under `alias`, e.g.
+// the old and new keys of a signer during key rotation. An Attestation that
+// names the alias or the ID of any key in the group may be verified by any of
+// its keys; the keys with the named ID are tried first. NewVerifier fails if
+// an ID names no public key or is in several groups.
+func WithKeyAlias(alias string, keyIDs ...string) VerifierOption {
+	return func(v *verifier) {
+		if v.keyAliases == nil {
+			v.keyAliases = map[string][]string{}
+		}
+		v.keyAliases[alias] = append(v.keyAliases[alias], keyIDs...)
+	}
+}
+
+// WithKeyMatcher sets a KeyMatcher that maps Attestation PublicKeyIDs that
+// name no public key exactly, e.g. a PGP short key ID, to the public keys they
+// refer to. All matching keys are tried. By default, PublicKeyIDs must be
+// exactly the ID of a public key. WithStrictKeyIDMatching takes precedence.
+func WithKeyMatcher(matcher KeyMatcher) VerifierOption {
+	return func(v *verifier) {
+		v.keyMatcher = matcher
+	}
+}
+
+// WithKmsClient sets the Cloud KMS client used to fetch the public keys of Kms
+// PublicKeys. Kms PublicKeys cannot verify Attestations without a client.
+func WithKmsClient(client KmsClient) VerifierOption {
+	return func(v *verifier) {
+		v.kmsVerifier = newKmsVerifier(client)
+	}
+}
+
+// WithCanonicalPayloads makes the Verifier canonicalize the JSON payloads of
+// PKIX Attestations with Canonicalize before verifying their signatures, so
+// that signatures created over the canonical form, e.g. by a Signer wrapped
+// with NewCanonicalSigner, verify regardless of how the payload was
+// reformatted. Payloads that are not JSON are verified as is, unless
+// `rejectNonJSON` is set.
+func WithCanonicalPayloads(rejectNonJSON bool) VerifierOption {
+	return func(v *verifier) {
+		v.canonicalPayloads = true
+		v.rejectNonJSONPayloads = rejectNonJSON
+	}
+}
+
+// WithJwtClaims makes the Verifier reject JWT Attestations whose iss claim is
+// not `issuer` or whose aud claim does not include `audience`. Tokens missing
+// a required claim are rejected too. An empty `issuer` or `audience` leaves
+// that claim unchecked. The claims are checked after the signature.
+func WithJwtClaims(issuer, audience string) VerifierOption {
+	return func(v *verifier) {
+		v.jwtVerifier = jwtVerifierImpl{issuer: issuer, audience: audience}
+	}
+}
+
+// WithJwksSource makes the Verifier look up the Jwt public keys of
+// Attestations whose PublicKeyID matches none of its public keys in the JWKS
+// provided by `source`.
+func WithJwksSource(source *JwksSource) VerifierOption {
+	return func(v *verifier) {
+		v.jwksSource = source
+	}
+}
+
+// WithVaultClient sets the Vault client used to fetch the public keys of
+// Vault PublicKeys, which are cached for `ttl`. Vault PublicKeys cannot verify
+// Attestations without a client.
+func WithVaultClient(client VaultClient, ttl time.Duration) VerifierOption {
+	return func(v *verifier) {
+		v.vaultVerifier = newVaultVerifier(client, ttl)
+	}
+}
+
+// WithAcceptableDigests makes the Verifier also accept Attestations whose
+// payload contains one of `digests` instead of the digest of the image passed
+// to NewVerifier, e.g. when a rebuilt manifest yields several equivalent
+// digests for an image. NewVerifier fails if a digest is malformed.
+func WithAcceptableDigests(digests ...string) VerifierOption {
+	return func(v *verifier) {
+		v.acceptableDigests = append(v.acceptableDigests, digests...)
+	}
+}
+
+// WithGzipPayloads makes the Verifier accept payloads that were gzip
+// compressed before signing. The signature is verified over the compressed
+// bytes, and the payload is decompressed before it is parsed. Payloads that
+// are not gzip compressed are parsed as they are. A payload that decompresses
+// to more than `maxSize` bytes is rejected with ErrInvalidPayload; a `maxSize`
+// of zero or less uses a limit of 4 MiB.
+func WithGzipPayloads(maxSize int64) VerifierOption {
+	return func(v *verifier) {
+		if maxSize <= 0 {
+			maxSize = defaultMaxGzipPayloadSize
+		}
+		v.maxGzipPayloadSize = maxSize
+	}
+}
+
+// WithMaxSignatureSize sets the maximum size in bytes of the Signature of an
+// Attestation, and of the Signature of each of its Signatures, before they
+// are decoded. Larger signatures are rejected with ErrInputTooLarge before
+// they are decoded or verified. A `maxSize` of zero or less removes the
+// limit. By default, the limit is 4 MiB.
+func WithMaxSignatureSize(maxSize int64) VerifierOption {
+	return func(v *verifier) {
+		v.maxSignatureSize = maxSize
+	}
+}
+
+// WithMaxPayloadSize sets the maximum size in bytes of the SerializedPayload
+// of an Attestation. Larger payloads are rejected with ErrInputTooLarge
+// before the signature is verified. A `maxSize` of zero or less removes the
+// limit. By default, the limit is 4 MiB. Payloads read by
+// VerifyAttestationStream are bounded by WithMaxStreamedPayloadSize instead,
+// except that those verified with an Ed25519 key, which signs the payload
+// itself rather than a digest of it and so needs it in memory, are also
+// bounded by this limit.
+func WithMaxPayloadSize(maxSize int64) VerifierOption {
+	return func(v *verifier) {
+		v.maxPayloadSize = maxSize
+	}
+}
+
+// WithMaxDecodedPayloadSize sets the maximum size in bytes of a payload whose
+// signature has been verified, e.g. one extracted from a PGP signature, JWT or
+// DSSE envelope. Larger payloads are rejected with ErrInputTooLarge before
+// they are parsed; the payload of a PGP signature, which may be compressed,
+// is rejected as soon as more than `maxSize` bytes are read. A `maxSize` of zero or less removes the limit. By default,
+// the limit is 4 MiB. Decompressed gzip payloads are bounded by
+// WithGzipPayloads instead.
+func WithMaxDecodedPayloadSize(maxSize int64) VerifierOption {
+	return func(v *verifier) {
+		v.maxDecodedPayloadSize = maxSize
+	}
+}
+
+// WithMaxStreamedPayloadSize sets the maximum size in bytes of a payload read
+// by VerifyAttestationStream. Larger payloads are rejected with
+// ErrInputTooLarge as soon as the limit is read past. The members of a
+// streamed payload other than its predicate, which are kept in memory, are
+// bounded by WithMaxDecodedPayloadSize. A `maxSize` of zero or less removes
+// the limit. By default, the limit is 1 GiB.
+func WithMaxStreamedPayloadSize(maxSize int64) VerifierOption {
+	return func(v *verifier) {
+		v.maxStreamedPayloadSize = maxSize
+	}
+}
+
+// AllowWeakDigests makes the Verifier accept PGP signatures with SHA-1
+// digests, which legacy signers still produce, e.g. for a migration window.
+// Each such signature is logged as a warning when it is accepted. It applies
+// to PGP only; signatures with MD5 digests are always rejected. By default,
+// PGP signatures with SHA-1 digests are rejected.
+func AllowWeakDigests() VerifierOption {
+	return func(v *verifier) {
+		v.allowWeakPgpDigests = true
+	}
+}
+
+// OnVerify adds a callback that is called synchronously after every
+// verification of an Attestation with a VerificationEvent describing it, e.g.
+// to feed an external audit log. Callbacks are called in the order they were
+// added and cannot alter the result of the verification; a callback that
+// panics is logged and ignored. Callbacks must be safe for concurrent use if
+// the Verifier is.
+func OnVerify(callback func(VerificationEvent)) VerifierOption {
+	return func(v *verifier) {
+		v.onVerify = append(v.onVerify, callback)
+	}
+}
+
+// WithTimeout bounds how long a single verification may wait for remote
+// backends: Cloud KMS, Vault, a JWKS endpoint or a DigestResolver. Backend
+// calls are cancelled once `timeout` has passed since the verification
+// started, and the verification fails with ErrVerificationTimeout. Checks
+// that run in memory are not bounded. A timeout of zero, the default,
+// disables the bound; the context passed to VerifyAttestationContext still
+// applies.
+func WithTimeout(timeout time.Duration) VerifierOption {
+	return func(v *verifier) {
+		v.timeout = timeout
+	}
+}
+
+// WithImageIndex makes the Verifier accept Attestations over a multi-arch
+// image index as well as over the per-platform images it lists. The image
+// passed to NewVerifier must have `indexDigest` or one of `childDigests`,
+// and a payload containing any of these digests is accepted. The caller
+// supplies the mapping, e.g. from the manifest list in the registry.
+// NewVerifier fails if a digest is malformed or the image digest is not part
+// of the index.
+func WithImageIndex(indexDigest string, childDigests ...string) VerifierOption {
+	return func(v *verifier) {
+		v.imageIndex = &imageIndex{digest: indexDigest, childDigests: childDigests}
+	}
+}
+
+// WithKeyFetchRetry sets how often fetching a public key from Cloud KMS,
+// Vault or a JwksSource is attempted before the Attestation is rejected with
+// ErrRetriesExhausted, and the delay before the first retry, which doubles with every retry. Only
+// transient fetch errors are retried, and retries stop once the context of
+// the verification is done; signatures that fail to verify are never retried.
+// By default, keys are fetched up to 3 times, starting with a 100ms backoff.
+// A `maxAttempts` of one or less disables retries.
+func WithKeyFetchRetry(maxAttempts int, initialBackoff time.Duration) VerifierOption {
+	return func(v *verifier) {
+		v.keyFetchRetry = retryPolicy{maxAttempts: maxAttempts, initialBackoff: initialBackoff, sleep: sleepContext}
+	}
+}
+
+// WithPayloadParser sets the PayloadParser used to interpret verified
+// payloads. It defaults to DefaultPayloadParser.
+func WithPayloadParser(parser PayloadParser) VerifierOption {
+	return func(v *verifier) {
+		v.payloadParser = parser
+	}
+}
+
+// RegisterPayloadParser makes the Verifier parse the payloads of verified
+// DSSE envelopes whose payloadType is `payloadType` with `parser`, instead of
+// the PayloadParser set by WithPayloadParser. It may be given several times
+// to register parsers for several payload types; a later registration for
+// the same payloadType replaces the earlier one.
+func RegisterPayloadParser(payloadType string, parser PayloadParser) VerifierOption {
+	return func(v *verifier) {
+		if v.payloadTypeParsers == nil {
+			v.payloadTypeParsers = map[string]PayloadParser{}
+		}
+		v.payloadTypeParsers[payloadType] = parser
+	}
+}
+
+// RejectUnknownPayloadTypes makes the Verifier reject DSSE envelopes whose
+// payloadType has no parser registered with RegisterPayloadParser with
+// ErrInvalidPayload, rather than parse their payloads with the default
+// PayloadParser. Attestations without a payloadType are not affected.
+func RejectUnknownPayloadTypes() VerifierOption {
+	return func(v *verifier) {
+		v.rejectUnknownPayloadTypes = true
+	}
+}
+
+// WithMinimumKeySize sets the minimum size, in bits, of the modulus of RSA
+// public keys and of the curve of ECDSA public keys that may verify
+// Attestations. Attestations signed by weaker keys are rejected with
+// ErrKeyTooWeak, even if their signature is valid. The minimum applies to all
+// keys that verify signatures: Pkix and Jwt keys, including those of JWKS,
+// keys fetched from Cloud KMS and Vault, the certificates of CMS and sigstore
+// signatures, and the Rekor public key, which NewVerifier rejects. A minimum
+// of zero disables the check. It defaults to 2048 bit RSA keys and P-256.
+func WithMinimumKeySize(rsaBits, ecdsaBits int) VerifierOption {
+	return func(v *verifier) {
+		v.keyStrength = keyStrengthPolicy{minRsaBits: rsaBits, minEcdsaBits: ecdsaBits}
+	}
+}
+
+// WithSoftMissingKeys is meant for key migrations, e.g. from PGP to Ed25519:
+// VerifyAttestation and VerifyAttestationContext accept Attestations WITHOUT
+// VERIFYING THEM if no registered public key matches them and their
+// signature is of one of `keyTypes`, recognized from its format. Such
+// Attestations are logged as warnings and recorded with OutcomeSoftPass.
+// Attestations of other key types are rejected with ErrNoMatchingKey as
+// usual, as are soft-passed Attestations by VerifyAttestationWithResult,
+// VerifyOrExplain, VerifyAttestations and VerifyQuorum, since no public key
+// verified them. Only Pgp and Jwt signatures can be recognized; NewVerifier
+// rejects other key types.
+func WithSoftMissingKeys(keyTypes ...AuthenticatorType) VerifierOption {
+	return func(v *verifier) {
+		if v.softMissingKeyTypes == nil {
+			v.softMissingKeyTypes = map[AuthenticatorType]bool{}
+		}
+		for _, keyType := range keyTypes {
+			v.softMissingKeyTypes[keyType] = true
+		}
+	}
+}
+
+// WithDigestResolver makes the Verifier accept payloads that reference the
+// image by tag rather than by digest: the tag is resolved with `resolver` at
+// verification time, and the resolved digest must be the image digest.
+// Resolution failures are reported as ErrDigestResolutionFailed.
+func WithDigestResolver(resolver DigestResolver) VerifierOption {
+	return func(v *verifier) {
+		v.digestResolver = resolver
+	}
+}
+
+// WithAuthenticatedAttChecker sets the AuthenticatedAttChecker that decides
+// whether verified payloads are acceptable, e.g. to also require a predicate
+// or label. It defaults to DefaultAuthenticatedAttChecker.
+func WithAuthenticatedAttChecker(checker AuthenticatedAttChecker) VerifierOption {
+	return func(v *verifier) {
+		v.AuthenticatedAttChecker = checker
+	}
+}
+
+// WithCosignCompatibility makes the Verifier accept signatures created by
+// cosign: Pkix, Ed25519, Kms and Vault signatures may be base64 encoded, and
+// cosign simple signing payloads are parsed in addition to the payloads
+// DefaultPayloadParser understands. A later WithPayloadParser overrides the
+// payload parser.
+func WithCosignCompatibility() VerifierOption {
+	return func(v *verifier) {
+		v.cosignCompatibility = true
+		v.payloadParser = PayloadParserFunc(convertCosignCompatiblePayload)
+	}
+}
+
+// WithMaxAge makes the Verifier reject Attestations whose payload was created
+// more than `maxAge` before the current time with ErrAttestationStale.
+// Payloads without a timestamp are rejected as well.
+func WithMaxAge(maxAge time.Duration) VerifierOption {
+	return func(v *verifier) {
+		v.maxAge = maxAge
+	}
+}
+
+// WithPolicy makes the Verifier evaluate `policy` on the payload of every
+// Attestation that passes all other checks, and reject the Attestation with
+// ErrPolicyDenied unless the policy allows it. Since the policy only sees
+// verified payloads, it can e.g. decide on the predicate of an in-toto
+// Statement without handling untrusted data. VerifyAttestationStream rejects
+// every Attestation, since it does not keep the predicate for the policy.
+func WithPolicy(policy PolicyEvaluator) VerifierOption {
+	return func(v *verifier) {
+		v.policy = policy
+	}
+}
+
+// WithRevokedKeys makes the Verifier reject Attestations with ErrKeyRevoked
+// if they name, or are verified by, a public key with one of the given IDs or
+// fingerprints, even if their signature is valid. The fingerprint of a PGP
+// signing subkey revokes that subkey only.
+func WithRevokedKeys(keyIDs ...string) VerifierOption {
+	return func(v *verifier) {
+		if v.revokedKeys == nil {
+			v.revokedKeys = make(map[string]bool, len(keyIDs))
+		}
+		for _, keyID := range keyIDs {
+			v.revokedKeys[strings.ToLower(keyID)] = true
+		}
+	}
+}
+
+// WithTracer sets the Tracer that traces every verification in a
+// SpanVerifyAttestation span, with child spans for signature checks and key
+// fetches. By default, verifications are not traced.
+func WithTracer(tracer Tracer) VerifierOption {
+	return func(v *verifier) {
+		v.tracer = tracer
+	}
+}
+
+// WithLogger sets the Logger that receives the Verifier's diagnostic
+// messages, such as warnings about public keys sharing an ID. By default,
+// messages are discarded.
+func WithLogger(logger Logger) VerifierOption {
+	return func(v *verifier) {
+		if logger == nil {
+			logger = nopLogger{}
+		}
+		v.logger = logger
+	}
+}
+
+// WithMetricsRecorder sets the MetricsRecorder that receives the outcome and
+// latency of every verification. By default, metrics are discarded.
+func WithMetricsRecorder(recorder MetricsRecorder) VerifierOption {
+	return func(v *verifier) {
+		if recorder == nil {
+			recorder = nopMetricsRecorder{}
+		}
+		v.metrics = recorder
+	}
+}
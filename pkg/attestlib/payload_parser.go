@@ -0,0 +1,132 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// PayloadParser extracts an AuthenticatedAttestation from a payload whose
+// signature has been verified. The Verifier then checks the
+// AuthenticatedAttestation against the image being verified.
+type PayloadParser interface {
+	Parse(payload []byte) (*AuthenticatedAttestation, error)
+}
+
+// PayloadParserFunc adapts a function to the PayloadParser interface.
+type PayloadParserFunc func(payload []byte) (*AuthenticatedAttestation, error)
+
+// Parse calls f(payload).
+func (f PayloadParserFunc) Parse(payload []byte) (*AuthenticatedAttestation, error) {
+	return f(payload)
+}
+
+var (
+	// AtomicPayloadParser parses payloads in the Atomic Host signature
+	// format.
+	AtomicPayloadParser PayloadParser = PayloadParserFunc(convertAuthenticatedAttestation)
+	// InTotoPayloadParser parses in-toto Statements.
+	InTotoPayloadParser PayloadParser = PayloadParserFunc(convertInTotoAttestation)
+	// CosignPayloadParser parses cosign simple signing payloads.
+	CosignPayloadParser PayloadParser = PayloadParserFunc(convertCosignPayload)
+	// NotationPayloadParser parses notation payloads, which describe the
+	// signed image by the descriptor of the target artifact.
+	NotationPayloadParser PayloadParser = PayloadParserFunc(convertNotationPayload)
+	// DefaultPayloadParser parses in-toto Statements, notation payloads, and
+	// any other payload in the Atomic Host signature format. It is used
+	// unless the Verifier is created with WithPayloadParser.
+	DefaultPayloadParser PayloadParser = PayloadParserFunc(convertPayload)
+	// ProvenancePayloadParser parses payloads like DefaultPayloadParser, but
+	// also matches the image digest against the build inputs of SLSA
+	// provenance: the predicate.materials of SLSA v0.2, or the
+	// predicate.buildDefinition.resolvedDependencies of SLSA v1.0. Build
+	// inputs include e.g. base images, so it should only be used with
+	// producers whose provenance lists the image it describes among them.
+	ProvenancePayloadParser PayloadParser = PayloadParserFunc(convertProvenancePayload)
+)
+
+// Strict variants of the payload parsers additionally reject payloads with
+// top-level fields their format does not define, so that a producer cannot
+// add data that policy code never looks at. Fields nested in the defined
+// ones, e.g. in the predicate of an in-toto Statement, are not checked.
+var (
+	// StrictAtomicPayloadParser is AtomicPayloadParser in strict mode.
+	StrictAtomicPayloadParser PayloadParser = strictPayloadParser{AtomicPayloadParser, newAtomicFields}
+	// StrictInTotoPayloadParser is InTotoPayloadParser in strict mode.
+	StrictInTotoPayloadParser PayloadParser = strictPayloadParser{InTotoPayloadParser, newInTotoFields}
+	// StrictCosignPayloadParser is CosignPayloadParser in strict mode.
+	StrictCosignPayloadParser PayloadParser = strictPayloadParser{CosignPayloadParser, newAtomicFields}
+	// StrictNotationPayloadParser is NotationPayloadParser in strict mode.
+	StrictNotationPayloadParser PayloadParser = strictPayloadParser{NotationPayloadParser, newNotationFields}
+	// StrictDefaultPayloadParser is DefaultPayloadParser in strict mode.
+	StrictDefaultPayloadParser PayloadParser = PayloadParserFunc(func(payload []byte) (*AuthenticatedAttestation, error) {
+		switch {
+		case isInTotoStatement(payload):
+			return StrictInTotoPayloadParser.Parse(payload)
+		case isNotationPayload(payload):
+			return StrictNotationPayloadParser.Parse(payload)
+		default:
+			return StrictAtomicPayloadParser.Parse(payload)
+		}
+	})
+)
+
+// strictPayloadParser rejects payloads with top-level fields that are not
+// fields of the struct returned by newFields, and parses the others with
+// parser.
+type strictPayloadParser struct {
+	parser    PayloadParser
+	newFields func() interface{}
+}
+
+// Parse implements PayloadParser.
+func (p strictPayloadParser) Parse(payload []byte) (*AuthenticatedAttestation, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p.newFields()); err != nil {
+		return nil, errors.Wrap(err, "error parsing attestation payload in strict mode")
+	}
+	return p.parser.Parse(payload)
+}
+
+// The top-level fields of each payload format. Their values are kept raw so
+// that only the top level is checked for unknown fields.
+
+func newAtomicFields() interface{} {
+	return &struct {
+		Critical json.RawMessage `json:"critical"`
+		Optional json.RawMessage `json:"optional"`
+	}{}
+}
+
+func newInTotoFields() interface{} {
+	return &struct {
+		Type          json.RawMessage `json:"_type"`
+		Subject       json.RawMessage `json:"subject"`
+		PredicateType json.RawMessage `json:"predicateType"`
+		Predicate     json.RawMessage `json:"predicate"`
+	}{}
+}
+
+func newNotationFields() interface{} {
+	return &struct {
+		TargetArtifact json.RawMessage `json:"targetArtifact"`
+	}{}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// digestOnlyParser parses a plaintext payload of the form "digest: <digest>".
+type digestOnlyParser struct {
+	calls int
+}
+
+func (p *digestOnlyParser) Parse(payload []byte) (*AuthenticatedAttestation, error) {
+	p.calls++
+	s := string(payload)
+	if !strings.HasPrefix(s, "digest: ") {
+		return nil, fmt.Errorf("%w: not a digest-only payload", ErrInvalidPayload)
+	}
+	return &AuthenticatedAttestation{ImageDigest: strings.TrimPrefix(s, "digest: ")}, nil
+}
+
+func TestVerifyAttestationPayloadParser(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	tcs := []struct {
+		name        string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:    "matching digest",
+			payload: "digest: " + helloAppDigest,
+		},
+		{
+			name:        "mismatched digest",
+			payload:     "digest: " + otherHelloAppDigest,
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "unsupported payload",
+			payload:     validPayload,
+			expectedErr: ErrInvalidPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			parser := &digestOnlyParser{}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithPayloadParser(parser))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want %v", err, tc.expectedErr)
+			}
+			if parser.calls != 1 {
+				t.Errorf("parser called %d times, expected 1", parser.calls)
+			}
+		})
+	}
+}
+
+func TestPayloadParsers(t *testing.T) {
+	tcs := []struct {
+		name        string
+		parser      PayloadParser
+		payload     string
+		expectedErr bool
+	}{
+		{
+			name:    "atomic parser with atomic payload",
+			parser:  AtomicPayloadParser,
+			payload: validPayload,
+		},
+		{
+			name:        "atomic parser with in-toto payload",
+			parser:      AtomicPayloadParser,
+			payload:     singleSubjectStatement,
+			expectedErr: true,
+		},
+		{
+			name:    "in-toto parser with in-toto payload",
+			parser:  InTotoPayloadParser,
+			payload: singleSubjectStatement,
+		},
+		{
+			name:        "in-toto parser with atomic payload",
+			parser:      InTotoPayloadParser,
+			payload:     validPayload,
+			expectedErr: true,
+		},
+		{
+			name:    "default parser with atomic payload",
+			parser:  DefaultPayloadParser,
+			payload: validPayload,
+		},
+		{
+			name:    "default parser with in-toto payload",
+			parser:  DefaultPayloadParser,
+			payload: singleSubjectStatement,
+		},
+		{
+			name:    "default parser with unknown field",
+			parser:  DefaultPayloadParser,
+			payload: withUnknownField(validPayload),
+		},
+		{
+			name:    "strict atomic parser with atomic payload",
+			parser:  StrictAtomicPayloadParser,
+			payload: validPayload,
+		},
+		{
+			name:        "strict atomic parser with unknown field",
+			parser:      StrictAtomicPayloadParser,
+			payload:     withUnknownField(validPayload),
+			expectedErr: true,
+		},
+		{
+			name:    "strict in-toto parser with nested fields",
+			parser:  StrictInTotoPayloadParser,
+			payload: tektonChainsProvenance,
+		},
+		{
+			name:        "strict in-toto parser with unknown field",
+			parser:      StrictInTotoPayloadParser,
+			payload:     withUnknownField(singleSubjectStatement),
+			expectedErr: true,
+		},
+		{
+			name:    "strict default parser with in-toto payload",
+			parser:  StrictDefaultPayloadParser,
+			payload: singleSubjectStatement,
+		},
+		{
+			name:        "strict default parser with unknown field",
+			parser:      StrictDefaultPayloadParser,
+			payload:     withUnknownField(validPayload),
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.parser.Parse([]byte(tc.payload))
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("Parse(_) = %v, expected error: %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// withUnknownField adds a top-level field to the JSON object `payload`.
+func withUnknownField(payload string) string {
+	return strings.Replace(payload, "{", `{"smuggled": "data",`, 1)
+}
+
+func TestVerifyAttestationStrictPayloadParser(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithPayloadParser(StrictDefaultPayloadParser))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	tcs := []struct {
+		name        string
+		payload     string
+		expectedErr error
+	}{
+		{
+			name:    "clean payload",
+			payload: validPayload,
+		},
+		{
+			name:        "payload with unknown field",
+			payload:     withUnknownField(validPayload),
+			expectedErr: ErrInvalidPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			err := v.VerifyAttestation(att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// countingParser counts the payloads it parses with parser.
+type countingParser struct {
+	parser PayloadParser
+	calls  int
+}
+
+func (p *countingParser) Parse(payload []byte) (*AuthenticatedAttestation, error) {
+	p.calls++
+	return p.parser.Parse(payload)
+}
+
+func TestVerifyAttestationRegisterPayloadParser(t *testing.T) {
+	const digestPayloadType = "text/vnd.dev.kritis.digest"
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	signers := map[string]ed25519.PrivateKey{"ed25519-key": ed25519PrivateKey}
+	dsseAttestation := func(payloadType, payload string) *Attestation {
+		return &Attestation{Signature: createDsseEnvelope(t, payloadType, []byte(payload), signers), EnvelopeType: Dsse}
+	}
+	tcs := []struct {
+		name                string
+		att                 *Attestation
+		rejectUnknown       bool
+		expectedErr         error
+		expectedDigestCalls int
+		expectedAtomicCalls int
+	}{
+		{
+			name:                "digest payloadType",
+			att:                 dsseAttestation(digestPayloadType, "digest: "+helloAppDigest),
+			expectedDigestCalls: 1,
+		},
+		{
+			name:                "atomic payloadType",
+			att:                 dsseAttestation(dssePayloadType, validPayload),
+			expectedAtomicCalls: 1,
+		},
+		{
+			name:                "payload of another type",
+			att:                 dsseAttestation(digestPayloadType, validPayload),
+			expectedErr:         ErrInvalidPayload,
+			expectedDigestCalls: 1,
+		},
+		{
+			name: "unknown payloadType falls back to the default parser",
+			att:  dsseAttestation("application/octet-stream", validPayload),
+		},
+		{
+			name:          "unknown payloadType rejected",
+			att:           dsseAttestation("application/octet-stream", validPayload),
+			rejectUnknown: true,
+			expectedErr:   ErrInvalidPayload,
+		},
+		{
+			name:          "attestation without payloadType",
+			att:           &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+			rejectUnknown: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			digestParser := &digestOnlyParser{}
+			atomicParser := &countingParser{parser: AtomicPayloadParser}
+			opts := []VerifierOption{
+				RegisterPayloadParser(digestPayloadType, digestParser),
+				RegisterPayloadParser(dssePayloadType, atomicParser),
+			}
+			if tc.rejectUnknown {
+				opts = append(opts, RejectUnknownPayloadTypes())
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want %v", err, tc.expectedErr)
+			}
+			if digestParser.calls != tc.expectedDigestCalls {
+				t.Errorf("digest parser called %d times, expected %d", digestParser.calls, tc.expectedDigestCalls)
+			}
+			if atomicParser.calls != tc.expectedAtomicCalls {
+				t.Errorf("atomic parser called %d times, expected %d", atomicParser.calls, tc.expectedAtomicCalls)
+			}
+		})
+	}
+}
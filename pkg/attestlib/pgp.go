@@ -18,52 +18,270 @@ package attestlib
 
 import (
 	"bytes"
+	"crypto"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/openpgp"
 	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
-type pgpVerifierImpl struct{}
+type pgpVerifierImpl struct {
+	// allowWeakDigests makes the verifier accept signatures with SHA-1
+	// digests, logging a warning to logger for each of them.
+	allowWeakDigests bool
+	logger           Logger
+	// maxPayloadSize is the size limit of the payload of an attached
+	// signature, which may be compressed. Zero or less is no limit.
+	maxPayloadSize int64
+}
 
 // verifyPgp verifies a PGP signature using a public key and outputs the
-// payload that was signed. `signature` is an ASCII-armored "attached"
-// signature, generated by `gpg --armor --sign --output signature payload`.
-// `publicKey` is an ASCII-armored PGP key.
-func (v pgpVerifierImpl) verifyPgp(signature, publicKey []byte) ([]byte, error) {
-	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKey))
+// payload that was signed. `signature` is an "attached" signature, generated
+// by `gpg --sign --output signature payload`, either ASCII-armored or binary.
+// `publicKey.KeyData` is a PGP key, either ASCII-armored or binary. The
+// signature may be produced by the primary key or by a signing-capable
+// subkey, and the fingerprint of either must match `publicKey.ID`. The
+// fingerprint of the (sub)key that produced the signature is returned along
+// with the payload. Signatures by a key or subkey that has expired at `now`,
+// and signatures that have themselves expired, are rejected. A payload larger
+// than `v.maxPayloadSize` is rejected with ErrInputTooLarge as soon as the
+// limit is read past, before its signature is checked.
+func (v pgpVerifierImpl) verifyPgp(signature []byte, publicKey PublicKey, now time.Time) ([]byte, string, error) {
+	keyring, err := pgpKeyring(publicKey)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading armored key ring")
+		return nil, "", err
 	}
 
-	armorBlock, err := armor.Decode(bytes.NewReader(signature))
+	signatureReader, err := dearmorPgp(signature)
 	if err != nil {
-		return nil, errors.Wrap(err, "error decoding armored signature")
+		return nil, "", errors.Wrap(err, "error decoding signature")
 	}
 
-	messageDetails, err := openpgp.ReadMessage(armorBlock.Body, keyring, nil, nil)
+	messageDetails, err := openpgp.ReadMessage(signatureReader, keyring, nil, nil)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading armor signature")
+		return nil, "", errors.Wrap(err, "error reading armor signature")
 	}
 
 	// MessageDetails.UnverifiedBody signature is not verified until we read it.
 	// This will call PublicKey.VerifySignature for the keys in the keyring.
-	payload, err := ioutil.ReadAll(messageDetails.UnverifiedBody)
+	body := messageDetails.UnverifiedBody
+	if v.maxPayloadSize > 0 {
+		body = io.LimitReader(body, v.maxPayloadSize+1)
+	}
+	payload, err := ioutil.ReadAll(body)
 	if err != nil {
-		return nil, errors.Wrap(err, "error reading message contents")
+		return nil, "", errors.Wrap(err, "error reading message contents")
+	}
+	if v.maxPayloadSize > 0 && int64(len(payload)) > v.maxPayloadSize {
+		return nil, "", fmt.Errorf("%w: PGP message contents exceed the limit of %d bytes", ErrInputTooLarge, v.maxPayloadSize)
 	}
 
 	// Make sure after reading the UnverifiedBody above that the Signature
 	// exists and there is no SignatureError.
 	if messageDetails.SignatureError != nil {
-		return nil, errors.Wrap(messageDetails.SignatureError, "failed to validate: signature error")
+		return nil, "", errors.Wrap(messageDetails.SignatureError, "failed to validate: signature error")
+	}
+	fingerprint, err := checkPgpSigner(messageDetails.SignedBy, messageDetails.Signature, publicKey, now)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := v.checkDigest(messageDetails.Signature, fingerprint); err != nil {
+		return nil, "", err
+	}
+	return payload, fingerprint, nil
+}
+
+// verifyPgpDetached verifies a detached PGP signature over `payload`, as
+// generated by `gpg --detach-sign`, either ASCII-armored or binary. The key
+// checks are those of verifyPgp, and the fingerprint of the (sub)key that
+// produced the signature is returned.
+func (v pgpVerifierImpl) verifyPgpDetached(signature []byte, payload []byte, publicKey PublicKey, now time.Time) (string, error) {
+	keyring, err := pgpKeyring(publicKey)
+	if err != nil {
+		return "", err
+	}
+	signatureReader, err := dearmorPgp(signature)
+	if err != nil {
+		return "", errors.Wrap(err, "error decoding signature")
+	}
+	p, err := packet.Read(signatureReader)
+	if err != nil {
+		return "", errors.Wrap(err, "error reading signature")
+	}
+	sig, ok := p.(*packet.Signature)
+	if !ok {
+		return "", fmt.Errorf("failed to validate: expected a signature packet, got %T", p)
+	}
+	if sig.IssuerKeyId == nil {
+		return "", fmt.Errorf("failed to validate: signature has no issuer")
+	}
+	// Text signatures are computed over canonicalized line endings, which
+	// would make the signed bytes differ from the SerializedPayload.
+	if sig.SigType != packet.SigTypeBinary {
+		return "", fmt.Errorf("failed to validate: unsupported signature type %d", sig.SigType)
+	}
+	if !sig.Hash.Available() {
+		return "", fmt.Errorf("failed to validate: unsupported hash function %v", sig.Hash)
+	}
+	keys := keyring.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign)
+	if len(keys) == 0 {
+		return "", fmt.Errorf("failed to validate: no key with ID %X", *sig.IssuerKeyId)
+	}
+	var verifyErr error
+	for i := range keys {
+		h := sig.Hash.New()
+		h.Write(payload)
+		if verifyErr = keys[i].PublicKey.VerifySignature(h, sig); verifyErr == nil {
+			fingerprint, err := checkPgpSigner(&keys[i], sig, publicKey, now)
+			if err != nil {
+				return "", err
+			}
+			if err := v.checkDigest(sig, fingerprint); err != nil {
+				return "", err
+			}
+			return fingerprint, nil
+		}
+	}
+	return "", errors.Wrap(verifyErr, "failed to validate: signature error")
+}
+
+// checkDigest checks that `sig`, which was created by the (sub)key with
+// `fingerprint`, does not use a broken digest. MD5 is always rejected, and
+// SHA-1 unless the verifier allows weak digests.
+func (v pgpVerifierImpl) checkDigest(sig *packet.Signature, fingerprint string) error {
+	switch sig.Hash {
+	case crypto.MD5:
+		return fmt.Errorf("failed to validate: signature by key %q uses the broken MD5 digest", fingerprint)
+	case crypto.SHA1:
+		if !v.allowWeakDigests {
+			return fmt.Errorf("failed to validate: signature by key %q uses the weak SHA-1 digest", fingerprint)
+		}
+		if v.logger != nil {
+			v.logger.Warningf("accepting PGP signature by key %q with the weak SHA-1 digest, since weak digests are allowed", fingerprint)
+		}
+	}
+	return nil
+}
+
+// checkPgpSigner checks that `signedBy`, the key that created `sig`, may
+// verify Attestations for `publicKey` at `now`, and returns its fingerprint.
+func checkPgpSigner(signedBy *openpgp.Key, sig *packet.Signature, publicKey PublicKey, now time.Time) (string, error) {
+	if sig == nil {
+		return "", fmt.Errorf("failed to validate: signature missing")
+	}
+	if signedBy == nil || signedBy.Entity == nil || signedBy.PublicKey == nil {
+		return "", fmt.Errorf("failed to validate: signing key missing")
+	}
+	primaryFingerprint := fmt.Sprintf("%X", signedBy.Entity.PrimaryKey.Fingerprint)
+	fingerprint := fmt.Sprintf("%X", signedBy.PublicKey.Fingerprint)
+	if signedBy.PublicKey != signedBy.Entity.PrimaryKey {
+		// A subkey may only sign if its binding signature says so.
+		if signedBy.SelfSignature == nil || !signedBy.SelfSignature.FlagsValid || !signedBy.SelfSignature.FlagSign {
+			return "", fmt.Errorf("signature was created by subkey %q of key %q, which is not a signing key", fingerprint, primaryFingerprint)
+		}
 	}
-	if messageDetails.Signature == nil {
-		return nil, fmt.Errorf("failed to validate: signature missing")
+	// Guard against a key that is registered under an ID other than its own
+	// fingerprint, e.g. a keyring containing several keys.
+	if !strings.EqualFold(primaryFingerprint, publicKey.ID) && !strings.EqualFold(fingerprint, publicKey.ID) {
+		return "", fmt.Errorf("signature was created by key with fingerprint %q, expected %q", fingerprint, publicKey.ID)
+	}
+	if err := checkPgpExpiration(signedBy, sig, now); err != nil {
+		return "", err
+	}
+	return fingerprint, nil
+}
+
+// checkPgpExpiration checks that, at `now`, neither the primary key nor the
+// subkey that created `sig` has expired, and that `sig` itself has not
+// expired.
+func checkPgpExpiration(signedBy *openpgp.Key, sig *packet.Signature, now time.Time) error {
+	primaryKey := signedBy.Entity.PrimaryKey
+	if pgpKeyExpired(primaryKey, pgpPrimarySelfSignature(signedBy.Entity), now) {
+		return fmt.Errorf("%w: key %X", ErrPgpKeyExpired, primaryKey.Fingerprint)
+	}
+	if signedBy.PublicKey != primaryKey && pgpKeyExpired(signedBy.PublicKey, signedBy.SelfSignature, now) {
+		return fmt.Errorf("%w: subkey %X of key %X", ErrPgpKeyExpired, signedBy.PublicKey.Fingerprint, primaryKey.Fingerprint)
+	}
+	if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+		expiry := sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+		if now.After(expiry) {
+			return fmt.Errorf("%w: signature expired at %v", ErrPgpSignatureExpired, expiry)
+		}
+	}
+	return nil
+}
+
+// pgpKeyExpired reports whether `key`, bound by the self-signature `selfSig`,
+// has expired at `now`. Key lifetimes count from the creation of the key, see
+// RFC 4880, section 5.2.3.6.
+func pgpKeyExpired(key *packet.PublicKey, selfSig *packet.Signature, now time.Time) bool {
+	if selfSig == nil || selfSig.KeyLifetimeSecs == nil || *selfSig.KeyLifetimeSecs == 0 {
+		return false
+	}
+	return now.After(key.CreationTime.Add(time.Duration(*selfSig.KeyLifetimeSecs) * time.Second))
+}
+
+// pgpPrimarySelfSignature returns the self-signature of the primary identity
+// of `entity`, which carries the expiration of its primary key.
+func pgpPrimarySelfSignature(entity *openpgp.Entity) *packet.Signature {
+	var selfSig *packet.Signature
+	for _, identity := range entity.Identities {
+		if identity.SelfSignature == nil {
+			continue
+		}
+		if identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId {
+			return identity.SelfSignature
+		}
+		if selfSig == nil {
+			selfSig = identity.SelfSignature
+		}
+	}
+	return selfSig
+}
+
+// parsePgpPublicKey parses a PGP key that is either ASCII-armored or binary.
+func parsePgpPublicKey(keyData []byte) (openpgp.EntityList, error) {
+	keyReader, err := dearmorPgp(keyData)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding key ring")
+	}
+	keyring, err := openpgp.ReadKeyRing(keyReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key ring")
+	}
+	return keyring, nil
+}
+
+// pgpArmorPrefix starts every ASCII-armored PGP block.
+var pgpArmorPrefix = []byte("-----BEGIN PGP ")
+
+// dearmorPgp returns a reader over the binary OpenPGP packets in `data`. If
+// `data` is ASCII-armored, the armor is decoded. Otherwise `data` is assumed
+// to be binary and returned as is.
+func dearmorPgp(data []byte) (io.Reader, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), pgpArmorPrefix) {
+		return bytes.NewReader(data), nil
+	}
+	armorBlock, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding ASCII armor")
+	}
+	return armorBlock.Body, nil
+}
+
+// pgpKeyring returns the parsed form of a PGP PublicKey, parsing KeyData if
+// the Verifier has not already done so.
+func pgpKeyring(publicKey PublicKey) (openpgp.EntityList, error) {
+	if keyring, ok := publicKey.parsedKey.(openpgp.EntityList); ok {
+		return keyring, nil
 	}
-	return payload, nil
+	return parsePgpPublicKey(publicKey.KeyData)
 }
 
 type pgpSigner struct {
@@ -0,0 +1,158 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PublicKeysFromKeyring reads the armored or binary PGP keyring in `r` and
+// returns one Pgp PublicKey per entity of the keyring, with the fingerprint
+// of the entity's primary key as ID. Only the public parts of an entity are
+// kept in KeyData, so a private keyring can be read as well. Entities that
+// cannot be parsed are skipped: the keys of all the other entities are
+// returned, and the returned error describes each skipped entity.
+func PublicKeysFromKeyring(r io.Reader) ([]PublicKey, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading key ring")
+	}
+	keyReader, err := dearmorPgp(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decoding key ring")
+	}
+	packets := packet.NewReader(keyReader)
+	var publicKeys []PublicKey
+	var failures []string
+	for i := 0; ; i++ {
+		entity, err := openpgp.ReadEntity(packets)
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			var publicKey *PublicKey
+			if publicKey, err = pgpEntityPublicKey(entity); err == nil {
+				publicKeys = append(publicKeys, *publicKey)
+				continue
+			}
+		}
+		failures = append(failures, fmt.Sprintf("entity %d: %v", i, err))
+		if err := skipToNextPgpEntity(packets); err != nil {
+			// The keyring is unreadable from here on, e.g. it is truncated.
+			failures = append(failures, fmt.Sprintf("after entity %d: %v", i, err))
+			break
+		}
+	}
+	if len(failures) != 0 {
+		return publicKeys, fmt.Errorf("error loading %d key ring entities: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return publicKeys, nil
+}
+
+// pgpEntityPublicKey returns a Pgp PublicKey holding the public parts of
+// `entity`.
+func pgpEntityPublicKey(entity *openpgp.Entity) (*PublicKey, error) {
+	var keyData bytes.Buffer
+	w, err := armor.Encode(&keyData, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error encoding key")
+	}
+	if err := serializePgpPublicEntity(w, entity); err != nil {
+		return nil, errors.Wrap(err, "error serializing key")
+	}
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "error encoding key")
+	}
+	return NewPublicKey(Pgp, PGPUnused, keyData.Bytes(), "")
+}
+
+// serializePgpPublicEntity writes the public parts of `entity` like
+// openpgp.Entity.Serialize does, but also writes the revocations of the
+// primary key, which Entity.Serialize drops. Without them a revoked key
+// would turn valid again.
+func serializePgpPublicEntity(w io.Writer, entity *openpgp.Entity) error {
+	if err := entity.PrimaryKey.Serialize(w); err != nil {
+		return err
+	}
+	for _, revocation := range entity.Revocations {
+		if err := revocation.Serialize(w); err != nil {
+			return err
+		}
+	}
+	for _, ident := range entity.Identities {
+		if err := ident.UserId.Serialize(w); err != nil {
+			return err
+		}
+		if err := ident.SelfSignature.Serialize(w); err != nil {
+			return err
+		}
+		for _, sig := range ident.Signatures {
+			if err := sig.Serialize(w); err != nil {
+				return err
+			}
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if err := subkey.PublicKey.Serialize(w); err != nil {
+			return err
+		}
+		if err := subkey.Sig.Serialize(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipToNextPgpEntity reads packets until the primary key of the next entity
+// and leaves that packet in `packets`. Unsupported packets are skipped.
+// Reaching the end of the keyring is not an error.
+func skipToNextPgpEntity(packets *packet.Reader) error {
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if _, ok := err.(pgperrors.UnsupportedError); ok {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		switch key := p.(type) {
+		case *packet.PublicKey:
+			if !key.IsSubkey {
+				packets.Unread(p)
+				return nil
+			}
+		case *packet.PrivateKey:
+			if !key.IsSubkey {
+				packets.Unread(p)
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// binaryPgpKey returns the binary packets of the armored PGP key `key`.
+func binaryPgpKey(t *testing.T, key string) []byte {
+	t.Helper()
+	block, err := armor.Decode(strings.NewReader(key))
+	if err != nil {
+		t.Fatalf("error decoding armor: %v", err)
+	}
+	data, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		t.Fatalf("error reading armored key: %v", err)
+	}
+	return data
+}
+
+// malformedPgpEntity returns an entity that consists of a bare primary key
+// without any identity.
+func malformedPgpEntity(t *testing.T) []byte {
+	t.Helper()
+	entity, err := openpgp.NewEntity("malformed", "", "malformed@cryptolib.com", nil)
+	if err != nil {
+		t.Fatalf("error creating entity: %v", err)
+	}
+	var data bytes.Buffer
+	if err := entity.PrimaryKey.Serialize(&data); err != nil {
+		t.Fatalf("error serializing key: %v", err)
+	}
+	return data.Bytes()
+}
+
+// multiEntityKeyring returns a binary keyring with the test keys and a
+// malformed entity between them.
+func multiEntityKeyring(t *testing.T) []byte {
+	t.Helper()
+	var keyring bytes.Buffer
+	keyring.Write(binaryPgpKey(t, gpgPublicKey))
+	keyring.Write(malformedPgpEntity(t))
+	keyring.Write(binaryPgpKey(t, subkeyPublicKey))
+	keyring.Write(binaryPgpKey(t, expiringPublicKey))
+	return keyring.Bytes()
+}
+
+func armorPgpKeyring(t *testing.T, keyring []byte) []byte {
+	t.Helper()
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("error encoding armor: %v", err)
+	}
+	if _, err := w.Write(keyring); err != nil {
+		t.Fatalf("error encoding armor: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("error encoding armor: %v", err)
+	}
+	return armored.Bytes()
+}
+
+func TestPublicKeysFromKeyring(t *testing.T) {
+	keyring := multiEntityKeyring(t)
+	tcs := []struct {
+		name    string
+		keyring []byte
+	}{
+		{"binary keyring", keyring},
+		{"armored keyring", armorPgpKeyring(t, keyring)},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKeys, err := PublicKeysFromKeyring(bytes.NewReader(tc.keyring))
+			if err == nil {
+				t.Fatalf("PublicKeysFromKeyring(_) = nil, expected non nil for the malformed entity")
+			}
+			if !strings.Contains(err.Error(), "entity 1:") {
+				t.Errorf("PublicKeysFromKeyring(_) = %v, expected error naming entity 1", err)
+			}
+			expectedIDs := []string{gpgPublicKeyID, subkeyPrimaryID, expiringPublicKeyID}
+			if len(publicKeys) != len(expectedIDs) {
+				t.Fatalf("PublicKeysFromKeyring(_) loaded %d keys, expected %d", len(publicKeys), len(expectedIDs))
+			}
+			for i, publicKey := range publicKeys {
+				if publicKey.ID != expectedIDs[i] || publicKey.AuthenticatorType != Pgp {
+					t.Errorf("PublicKeysFromKeyring(_) key %d has ID %s and type %v, expected a Pgp key with ID %s", i, publicKey.ID, publicKey.AuthenticatorType, expectedIDs[i])
+				}
+			}
+
+			v, err := NewVerifier(helloAppImage, publicKeys, WithClock(ClockFunc(func() time.Time { return gpgSignatureTime })))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: gpgPublicKeyID, Signature: newGpgSignatureWithHash(t, validPayload, crypto.SHA256, false)}
+			if err := v.VerifyAttestation(att); err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestPublicKeysFromKeyringPrivateKeys(t *testing.T) {
+	publicKeys, err := PublicKeysFromKeyring(strings.NewReader(gpgPrivateKey))
+	if err != nil {
+		t.Fatalf("PublicKeysFromKeyring(_) = %v, expected nil", err)
+	}
+	if len(publicKeys) != 1 || publicKeys[0].ID != gpgPublicKeyID {
+		t.Fatalf("PublicKeysFromKeyring(_) loaded %v, expected the key %s", publicKeys, gpgPublicKeyID)
+	}
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(publicKeys[0].KeyData))
+	if err != nil {
+		t.Fatalf("error reading key data: %v", err)
+	}
+	if entities[0].PrivateKey != nil {
+		t.Errorf("PublicKeysFromKeyring(_) key data holds the private key, expected only the public key")
+	}
+}
+
+func TestPublicKeysFromKeyringErrors(t *testing.T) {
+	keyring := multiEntityKeyring(t)
+	tcs := []struct {
+		name         string
+		keyring      []byte
+		expectedKeys int
+	}{
+		{"not a keyring", []byte("These are our trusted keys."), 0},
+		{"truncated keyring", keyring[:len(keyring)-10], 2},
+		{"corrupt armor", []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----\n\n!!!\n"), 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKeys, err := PublicKeysFromKeyring(bytes.NewReader(tc.keyring))
+			if err == nil {
+				t.Errorf("PublicKeysFromKeyring(_) = nil, expected non nil")
+			}
+			if len(publicKeys) != tc.expectedKeys {
+				t.Errorf("PublicKeysFromKeyring(_) loaded %d keys, expected %d", len(publicKeys), tc.expectedKeys)
+			}
+		})
+	}
+}
@@ -23,6 +23,33 @@ import (
 	"github.com/pkg/errors"
 )
 
+type pkixVerifierImpl struct {
+	// keyStrength is the minimum strength of the public keys.
+	keyStrength keyStrengthPolicy
+}
+
+// verifyPkix verifies a PKIX signature over `payload`. `publicKey.KeyData`
+// should be a PEM or DER encoded PKIX public key, and
+// `publicKey.SignatureAlgorithm` selects the signing and hashing algorithms
+// used to create `signature`. It must be one of the key's AllowedAlgorithms,
+// if any. Keys weaker than `v.keyStrength` are rejected with ErrKeyTooWeak.
+func (v pkixVerifierImpl) verifyPkix(signature []byte, payload []byte, publicKey PublicKey) error {
+	if len(publicKey.AllowedAlgorithms) > 0 && !publicKey.allowsAlgorithm(publicKey.SignatureAlgorithm) {
+		return fmt.Errorf("%w: signature algorithm %v is not allowed for key %q", ErrAlgorithmNotAllowed, publicKey.SignatureAlgorithm, publicKey.ID)
+	}
+	pub, err := pkixKey(publicKey)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing PKIX public key %q", publicKey.ID)
+	}
+	if err := v.keyStrength.check(pub); err != nil {
+		return fmt.Errorf("%w: key %q: %v", ErrKeyTooWeak, publicKey.ID, err)
+	}
+	if err := verifyDetachedWithKey(signature, pub, publicKey.SignatureAlgorithm, payload); err != nil {
+		return errors.Wrapf(err, "error verifying PKIX signature with key %q", publicKey.ID)
+	}
+	return nil
+}
+
 type pkixSigner struct {
 	privateKey         interface{}
 	publicKeyID        string
@@ -55,7 +82,7 @@ func NewPkixSigner(privateKey []byte, alg SignatureAlgorithm, publicKeyID string
 // CreateAttestation creates a signed PKIX Attestation. See Signer for more details.
 func (s *pkixSigner) CreateAttestation(payload []byte) (*Attestation, error) {
 	switch s.signatureAlgorithm {
-	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha512, RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, RsaPss4096Sha512:
+	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha384, RsaSignPkcs14096Sha512, RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, RsaPss4096Sha512:
 		rsaKey, ok := s.privateKey.(*rsa.PrivateKey)
 		if !ok {
 			return nil, errors.New("expected rsa key")
@@ -65,9 +92,10 @@ func (s *pkixSigner) CreateAttestation(payload []byte) (*Attestation, error) {
 			return nil, errors.Wrap(err, "error creating rsa signature")
 		}
 		return &Attestation{
-			PublicKeyID:       s.publicKeyID,
-			Signature:         signature,
-			SerializedPayload: payload,
+			PublicKeyID:        s.publicKeyID,
+			Signature:          signature,
+			SerializedPayload:  payload,
+			SignatureAlgorithm: s.signatureAlgorithm,
 		}, nil
 	case EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512:
 		ecKey, ok := s.privateKey.(*ecdsa.PrivateKey)
@@ -79,9 +107,10 @@ func (s *pkixSigner) CreateAttestation(payload []byte) (*Attestation, error) {
 			return nil, errors.Wrap(err, "error creating ecdsa signature")
 		}
 		return &Attestation{
-			PublicKeyID:       s.publicKeyID,
-			Signature:         signature,
-			SerializedPayload: payload,
+			PublicKeyID:        s.publicKeyID,
+			Signature:          signature,
+			SerializedPayload:  payload,
+			SignatureAlgorithm: s.signatureAlgorithm,
 		}, nil
 	default:
 		return nil, fmt.Errorf("unknown signature algorithm: %v", s.signatureAlgorithm)
@@ -17,13 +17,19 @@ limitations under the License.
 package attestlib
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
 	"fmt"
+	"strings"
+
 	"github.com/pkg/errors"
 )
 
@@ -41,6 +47,143 @@ func parsePkixPrivateKeyPem(privateKey []byte) (interface{}, error) {
 	return key, nil
 }
 
+// parsePkixPublicKey parses a PKIX public key. `publicKey` may either be a
+// single PEM block or the raw DER encoding of the SubjectPublicKeyInfo.
+func parsePkixPublicKey(publicKey []byte) (crypto.PublicKey, error) {
+	der := publicKey
+	if block, rest := pem.Decode(publicKey); block != nil {
+		if len(rest) != 0 {
+			return nil, errors.New("more than one public key given")
+		}
+		der = block.Bytes
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "expected PEM or DER encoded PKIX public key")
+	}
+	return pub, nil
+}
+
+// spkiFingerprintPrefix prefixes the hex encoded SHA-256 digest of an SPKI
+// fingerprint.
+const spkiFingerprintPrefix = "sha256:"
+
+// SPKIFingerprint returns the SHA-256 fingerprint of the DER encoded
+// SubjectPublicKeyInfo of a PKIX public key, as "sha256:<hex>". `keyData` is
+// a PEM or DER encoded public key, or a PEM encoded certificate chain, whose
+// leaf certificate's key is fingerprinted. PKIX PublicKeys with such an ID
+// are matched by the fingerprint of their key material.
+func SPKIFingerprint(keyData []byte) (string, error) {
+	var spki []byte
+	if isPkixCertificate(keyData) {
+		chain, err := parsePkixCertificateChain(keyData)
+		if err != nil {
+			return "", err
+		}
+		spki = chain.leaf.RawSubjectPublicKeyInfo
+	} else {
+		pub, err := parsePkixPublicKey(keyData)
+		if err != nil {
+			return "", err
+		}
+		// Re-encode the key, so that its fingerprint does not depend on how
+		// KeyData is encoded.
+		if spki, err = x509.MarshalPKIXPublicKey(pub); err != nil {
+			return "", errors.Wrap(err, "error encoding PKIX public key")
+		}
+	}
+	dgst := sha256.Sum256(spki)
+	return spkiFingerprintPrefix + hex.EncodeToString(dgst[:]), nil
+}
+
+// parseSPKIFingerprint reports whether the key ID `keyID` is an SPKI
+// fingerprint, and returns it in the lowercase form of SPKIFingerprint.
+func parseSPKIFingerprint(keyID string) (string, bool) {
+	fingerprint := strings.ToLower(keyID)
+	if !strings.HasPrefix(fingerprint, spkiFingerprintPrefix) {
+		return "", false
+	}
+	digest, err := parseDigest(fingerprint)
+	if err != nil || digest.String() != fingerprint {
+		return "", false
+	}
+	return fingerprint, true
+}
+
+// pkixCertificateChain is a parsed PKIX key that is given as an X.509
+// certificate, optionally followed by the intermediate certificates that chain
+// it to a trust root.
+type pkixCertificateChain struct {
+	leaf          *x509.Certificate
+	intermediates *x509.CertPool
+}
+
+// isPkixCertificate reports whether `keyData` is a PEM-encoded certificate
+// rather than a bare public key.
+func isPkixCertificate(keyData []byte) bool {
+	block, _ := pem.Decode(keyData)
+	return block != nil && block.Type == "CERTIFICATE"
+}
+
+// parsePkixCertificateChain parses one or more PEM-encoded certificates. The
+// first certificate is the leaf, and any others are intermediates.
+func parsePkixCertificateChain(keyData []byte) (*pkixCertificateChain, error) {
+	chain := &pkixCertificateChain{intermediates: x509.NewCertPool()}
+	rest := keyData
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("expected CERTIFICATE PEM block, got %q", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing certificate")
+		}
+		if chain.leaf == nil {
+			chain.leaf = cert
+		} else {
+			chain.intermediates.AddCert(cert)
+		}
+	}
+	if chain.leaf == nil {
+		return nil, errors.New("no certificate found")
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, errors.New("unexpected data after certificates")
+	}
+	return chain, nil
+}
+
+// parsePkixKeyData parses the KeyData of a PKIX PublicKey, which is either a
+// bare public key or a certificate chain.
+func parsePkixKeyData(keyData []byte) (interface{}, error) {
+	if isPkixCertificate(keyData) {
+		return parsePkixCertificateChain(keyData)
+	}
+	return parsePkixPublicKey(keyData)
+}
+
+// pkixKey returns the parsed form of a PKIX or JWT PublicKey, parsing KeyData
+// if the Verifier has not already done so. For certificates, this is the
+// public key of the leaf certificate.
+func pkixKey(publicKey PublicKey) (crypto.PublicKey, error) {
+	parsedKey := publicKey.parsedKey
+	if parsedKey == nil {
+		var err error
+		if parsedKey, err = parsePkixKeyData(publicKey.KeyData); err != nil {
+			return nil, err
+		}
+	}
+	if chain, ok := parsedKey.(*pkixCertificateChain); ok {
+		return chain.leaf.PublicKey, nil
+	}
+	return parsedKey, nil
+}
+
 func generatePkixPublicKeyId(privateKey interface{}) (string, error) {
 	switch privateKey.(type) {
 	case *rsa.PrivateKey:
@@ -61,6 +204,15 @@ func generatePkixPublicKeyId(privateKey interface{}) (string, error) {
 		dgst := sha256.Sum256(publicKeyMaterial)
 		base64Dgst := base64.RawURLEncoding.EncodeToString(dgst[:])
 		return fmt.Sprintf("ni:///sha-256;%s", base64Dgst), nil
+	case ed25519.PrivateKey:
+		edKey := privateKey.(ed25519.PrivateKey)
+		publicKeyMaterial, err := x509.MarshalPKIXPublicKey(edKey.Public())
+		if err != nil {
+			return "", errors.Wrap(err, "marshal ed25519 public key error")
+		}
+		dgst := sha256.Sum256(publicKeyMaterial)
+		base64Dgst := base64.RawURLEncoding.EncodeToString(dgst[:])
+		return fmt.Sprintf("ni:///sha-256;%s", base64Dgst), nil
 	default:
 		return "", errors.New("unexpected key type")
 	}
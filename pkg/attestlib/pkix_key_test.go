@@ -17,7 +17,17 @@ limitations under the License.
 package attestlib
 
 import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParsePkixPrivateKeyPem(t *testing.T) {
@@ -95,3 +105,144 @@ func TestGeneratePKIXPublicKeyId(t *testing.T) {
 		})
 	}
 }
+
+func TestSPKIFingerprint(t *testing.T) {
+	fingerprintOf := func(spki []byte) string {
+		dgst := sha256.Sum256(spki)
+		return "sha256:" + hex.EncodeToString(dgst[:])
+	}
+	ecBlock, _ := pem.Decode([]byte(ec256PubKey))
+	rsaBlock, _ := pem.Decode([]byte(rsa2048PubKey))
+
+	now := time.Now()
+	certKey, cert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}, nil, nil)
+	certSpki, err := x509.MarshalPKIXPublicKey(&certKey.PublicKey)
+	if err != nil {
+		t.Fatalf("error encoding public key: %v", err)
+	}
+
+	tcs := []struct {
+		name        string
+		keyData     []byte
+		expected    string
+		expectedErr bool
+	}{
+		{name: "PEM public key", keyData: []byte(ec256PubKey), expected: fingerprintOf(ecBlock.Bytes)},
+		{name: "DER public key", keyData: ecBlock.Bytes, expected: fingerprintOf(ecBlock.Bytes)},
+		{name: "certificate", keyData: encodeTestCertificate(cert), expected: fingerprintOf(certSpki)},
+		{name: "RSA public key", keyData: []byte(rsa2048PubKey), expected: fingerprintOf(rsaBlock.Bytes)},
+		{name: "invalid key", keyData: []byte("not a key"), expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			fingerprint, err := SPKIFingerprint(tc.keyData)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("SPKIFingerprint(_) = %q, expected error", fingerprint)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SPKIFingerprint(_) = %v, expected nil", err)
+			}
+			if fingerprint != tc.expected {
+				t.Errorf("SPKIFingerprint(_) = %q, expected %q", fingerprint, tc.expected)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationSPKIFingerprint(t *testing.T) {
+	fingerprint, err := SPKIFingerprint([]byte(ec256PubKey))
+	if err != nil {
+		t.Fatalf("SPKIFingerprint(_) = %v, expected nil", err)
+	}
+	privateKey, err := parsePkixPrivateKeyPem([]byte(ec256PrivateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	signature, err := ecSign(privateKey.(*ecdsa.PrivateKey), []byte(validPayload), EcdsaP256Sha256)
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	otherFingerprint := "sha256:" + strings.Repeat("0", 64)
+
+	tcs := []struct {
+		name          string
+		registeredID  string
+		keyID         string
+		expectNewErr  bool
+		expectedErr   error
+		expectedKeyID string
+	}{
+		{
+			name:          "matching fingerprint",
+			registeredID:  fingerprint,
+			keyID:         fingerprint,
+			expectedKeyID: fingerprint,
+		},
+		{
+			name:          "fingerprint in upper case",
+			registeredID:  strings.ToUpper(fingerprint),
+			keyID:         fingerprint,
+			expectedKeyID: fingerprint,
+		},
+		{
+			name:          "attestation fingerprint in upper case",
+			registeredID:  fingerprint,
+			keyID:         strings.ToUpper(fingerprint),
+			expectedKeyID: fingerprint,
+		},
+		{
+			name:         "mismatched attestation fingerprint",
+			registeredID: fingerprint,
+			keyID:        otherFingerprint,
+			expectedErr:  ErrNoMatchingKey,
+		},
+		{
+			name:         "registered fingerprint of another key",
+			registeredID: otherFingerprint,
+			keyID:        otherFingerprint,
+			expectNewErr: true,
+		},
+		{
+			name:          "ID that is not a fingerprint",
+			registeredID:  "ec-key",
+			keyID:         "ec-key",
+			expectedKeyID: "ec-key",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: tc.registeredID}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+			if tc.expectNewErr {
+				if !errors.Is(err, ErrInvalidPublicKey) {
+					t.Errorf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			result, err := v.VerifyAttestationWithResult(&Attestation{PublicKeyID: tc.keyID, Signature: signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if result.KeyID != tc.expectedKeyID {
+				t.Errorf("VerifyAttestationWithResult(_) verified with key %q, expected %q", result.KeyID, tc.expectedKeyID)
+			}
+		})
+	}
+}
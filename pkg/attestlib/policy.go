@@ -0,0 +1,73 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// PolicyEvaluator decides whether an Attestation whose signature has been
+// verified, and whose payload matches the image, is acceptable, e.g. by
+// evaluating a Rego policy with Open Policy Agent. `input` is the verified
+// payload decoded as JSON, with objects decoded as map[string]interface{} and
+// numbers as json.Number, so that it can be passed to an evaluator as is.
+// It reports whether the policy allows the Attestation; an error denies it.
+// Only verified content is ever passed to a PolicyEvaluator.
+type PolicyEvaluator func(ctx context.Context, input interface{}) (bool, error)
+
+// evaluatePolicy runs the verifier's PolicyEvaluator, if any, on `payload`,
+// whose signature has been verified.
+func (v *verifier) evaluatePolicy(ctx context.Context, payload []byte) error {
+	if v.policy == nil {
+		return nil
+	}
+	payload, err := v.decompressPayload(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPolicyDenied, err)
+	}
+	input, err := decodePolicyInput(payload)
+	if err != nil {
+		return fmt.Errorf("%w: payload is not JSON: %v", ErrPolicyDenied, err)
+	}
+	allowed, err := v.policy(ctx, input)
+	if err != nil {
+		return fmt.Errorf("%w: error evaluating policy: %v", ErrPolicyDenied, err)
+	}
+	if !allowed {
+		return fmt.Errorf("%w: attestation payload is not allowed by the policy", ErrPolicyDenied)
+	}
+	return nil
+}
+
+// decodePolicyInput decodes the JSON document `payload` as the input of a
+// PolicyEvaluator.
+func decodePolicyInput(payload []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var input interface{}
+	if err := dec.Decode(&input); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return input, nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const scanPolicyStatement = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "gcr.io/google-samples/hello-app",
+            "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+        }
+    ],
+    "predicateType": "https://example.com/vulnerability-scan/v1",
+    "predicate": {"scanner": "scanner-1", "critical": 2}
+}`
+
+// maxCriticalPolicy allows in-toto vulnerability scans with at most
+// `maxCritical` critical vulnerabilities, as a Rego policy might.
+func maxCriticalPolicy(maxCritical int64) PolicyEvaluator {
+	return func(ctx context.Context, input interface{}) (bool, error) {
+		statement, ok := input.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		predicate, ok := statement["predicate"].(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		critical, ok := predicate["critical"].(json.Number)
+		if !ok {
+			return false, nil
+		}
+		n, err := critical.Int64()
+		if err != nil {
+			return false, err
+		}
+		return n <= maxCritical, nil
+	}
+}
+
+func TestVerifyAttestationWithPolicy(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	sign := func(payload string) *Attestation {
+		return &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(payload)), SerializedPayload: []byte(payload)}
+	}
+	tampered := sign(scanPolicyStatement)
+	tampered.SerializedPayload = []byte(strings.Replace(scanPolicyStatement, `"critical": 2`, `"critical": 0`, 1))
+
+	tcs := []struct {
+		name           string
+		policy         PolicyEvaluator
+		att            *Attestation
+		expectedErr    error
+		expectedCalled bool
+	}{
+		{
+			name:           "allow policy",
+			policy:         maxCriticalPolicy(2),
+			att:            sign(scanPolicyStatement),
+			expectedCalled: true,
+		},
+		{
+			name:           "deny policy",
+			policy:         maxCriticalPolicy(0),
+			att:            sign(scanPolicyStatement),
+			expectedErr:    ErrPolicyDenied,
+			expectedCalled: true,
+		},
+		{
+			name: "policy evaluation error",
+			policy: func(ctx context.Context, input interface{}) (bool, error) {
+				return true, errors.New("policy not loaded")
+			},
+			att:            sign(scanPolicyStatement),
+			expectedErr:    ErrPolicyDenied,
+			expectedCalled: true,
+		},
+		{
+			name:        "policy not evaluated on an invalid signature",
+			policy:      maxCriticalPolicy(0),
+			att:         tampered,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "policy not evaluated on a payload for another image",
+			policy:      maxCriticalPolicy(0),
+			att:         sign(otherSubjectStatement),
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			called := false
+			policy := func(ctx context.Context, input interface{}) (bool, error) {
+				called = true
+				return tc.policy(ctx, input)
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithPolicy(policy))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if called != tc.expectedCalled {
+				t.Errorf("policy called = %t, expected %t", called, tc.expectedCalled)
+			}
+		})
+	}
+}
+
+func TestValidateAttestationWithPolicy(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	validator, err := NewAttestationValidator(helloAppImage, []PublicKey{publicKey}, WithPolicy(maxCriticalPolicy(0)))
+	if err != nil {
+		t.Fatalf("NewAttestationValidator(...) = %v, expected nil", err)
+	}
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(scanPolicyStatement)), SerializedPayload: []byte(scanPolicyStatement)}
+	problems := validator.ValidateAttestation(att)
+	if len(problems) != 1 || !errors.Is(problems[0], ErrPolicyDenied) {
+		t.Errorf("ValidateAttestation(_) = %v, want a single error matching %v", problems, ErrPolicyDenied)
+	}
+}
+
+func TestVerifyAttestationStreamWithPolicy(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithPolicy(maxCriticalPolicy(2)))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "ec-key", Signature: signStream(t, strings.NewReader(scanPolicyStatement))}
+	if _, err := v.VerifyAttestationStream(att, strings.NewReader(scanPolicyStatement)); err == nil {
+		t.Errorf("VerifyAttestationStream(_) = nil, expected non nil")
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// The predicate types of SLSA provenance, see https://slsa.dev/provenance.
+const (
+	SlsaProvenanceV02PredicateType = "https://slsa.dev/provenance/v0.2"
+	SlsaProvenanceV1PredicateType  = "https://slsa.dev/provenance/v1"
+)
+
+// slsaResourceDescriptor is a material of SLSA v0.2 provenance, or a
+// resolved dependency of SLSA v1.0 provenance.
+type slsaResourceDescriptor struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// convertProvenancePayload parses a verified payload like convertPayload, and
+// adds the digests of the build inputs of SLSA provenance to its subject
+// digests.
+func convertProvenancePayload(payload []byte) (*AuthenticatedAttestation, error) {
+	if !isInTotoStatement(payload) {
+		return convertPayload(payload)
+	}
+	return parseInTotoStatement(payload, provenanceDigests)
+}
+
+// provenanceDigests returns the digest sets of the build inputs of a SLSA
+// provenance predicate. Predicates of other types have none.
+func provenanceDigests(predicateType string, predicate json.RawMessage) ([]map[string]string, error) {
+	var inputs []slsaResourceDescriptor
+	switch predicateType {
+	case SlsaProvenanceV02PredicateType:
+		var p struct {
+			Materials []slsaResourceDescriptor `json:"materials"`
+		}
+		if err := unmarshalPredicate(predicate, &p); err != nil {
+			return nil, errors.Wrap(err, "error parsing SLSA v0.2 provenance")
+		}
+		inputs = p.Materials
+	case SlsaProvenanceV1PredicateType:
+		var p struct {
+			BuildDefinition struct {
+				ResolvedDependencies []slsaResourceDescriptor `json:"resolvedDependencies"`
+			} `json:"buildDefinition"`
+		}
+		if err := unmarshalPredicate(predicate, &p); err != nil {
+			return nil, errors.Wrap(err, "error parsing SLSA v1.0 provenance")
+		}
+		inputs = p.BuildDefinition.ResolvedDependencies
+	}
+	digestSets := make([]map[string]string, 0, len(inputs))
+	for _, input := range inputs {
+		digestSets = append(digestSets, input.Digest)
+	}
+	return digestSets, nil
+}
+
+// unmarshalPredicate decodes `predicate` into `v`. A missing predicate
+// decodes to the zero value.
+func unmarshalPredicate(predicate json.RawMessage, v interface{}) error {
+	if len(predicate) == 0 {
+		return nil
+	}
+	return json.Unmarshal(predicate, v)
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+// slsaV02Provenance is a SLSA v0.2 provenance whose subject is an SBOM, and
+// which lists the image among its materials.
+const slsaV02Provenance = `{
+    "_type": "https://in-toto.io/Statement/v0.1",
+    "subject": [
+        {
+            "name": "sbom.spdx.json",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v0.2",
+    "predicate": {
+        "builder": {"id": "https://example.com/builder"},
+        "buildType": "https://example.com/sbom-generator/v1",
+        "materials": [
+            {
+                "uri": "git+https://github.com/example/hello-app@refs/heads/main",
+                "digest": {"sha1": "2222222222222222222222222222222222222222"}
+            },
+            {
+                "uri": "oci://gcr.io/google-samples/hello-app",
+                "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+            }
+        ]
+    }
+}`
+
+// slsaV1Provenance is a SLSA v1.0 provenance whose subject is an SBOM, and
+// which lists the image among its resolved dependencies.
+const slsaV1Provenance = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "sbom.spdx.json",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v1",
+    "predicate": {
+        "buildDefinition": {
+            "buildType": "https://example.com/sbom-generator/v1",
+            "externalParameters": {"image": "gcr.io/google-samples/hello-app"},
+            "resolvedDependencies": [
+                {
+                    "uri": "oci://gcr.io/google-samples/hello-app",
+                    "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+                }
+            ]
+        },
+        "runDetails": {
+            "builder": {"id": "https://example.com/builder"}
+        }
+    }
+}`
+
+// slsaV1OtherDependencyProvenance is a SLSA v1.0 provenance that does not
+// list the image.
+const slsaV1OtherDependencyProvenance = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "sbom.spdx.json",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v1",
+    "predicate": {
+        "buildDefinition": {
+            "resolvedDependencies": [
+                {
+                    "uri": "oci://gcr.io/google-samples/other-app",
+                    "digest": {"sha256": "0000000000000000000000000000000000000000000000000000000000000000"}
+                }
+            ]
+        }
+    }
+}`
+
+// malformedSlsaV02Provenance has materials that are not a list.
+const malformedSlsaV02Provenance = `{
+    "_type": "https://in-toto.io/Statement/v0.1",
+    "subject": [
+        {
+            "name": "sbom.spdx.json",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://slsa.dev/provenance/v0.2",
+    "predicate": {
+        "materials": {"uri": "oci://gcr.io/google-samples/hello-app"}
+    }
+}`
+
+// otherPredicateMaterialsStatement has materials, but not a SLSA provenance
+// predicate.
+const otherPredicateMaterialsStatement = `{
+    "_type": "https://in-toto.io/Statement/v1",
+    "subject": [
+        {
+            "name": "sbom.spdx.json",
+            "digest": {"sha256": "1111111111111111111111111111111111111111111111111111111111111111"}
+        }
+    ],
+    "predicateType": "https://example.com/predicate/v1",
+    "predicate": {
+        "materials": [
+            {
+                "uri": "oci://gcr.io/google-samples/hello-app",
+                "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}
+            }
+        ]
+    }
+}`
+
+func TestVerifyAttestationProvenancePayloadParser(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	tcs := []struct {
+		name               string
+		payload            string
+		expectedErr        error
+		expectedDefaultErr error
+	}{
+		{
+			name:               "SLSA v0.2 materials",
+			payload:            slsaV02Provenance,
+			expectedDefaultErr: ErrPayloadMismatch,
+		},
+		{
+			name:               "SLSA v1.0 resolved dependencies",
+			payload:            slsaV1Provenance,
+			expectedDefaultErr: ErrPayloadMismatch,
+		},
+		{
+			name:               "SLSA v1.0 without the image",
+			payload:            slsaV1OtherDependencyProvenance,
+			expectedErr:        ErrPayloadMismatch,
+			expectedDefaultErr: ErrPayloadMismatch,
+		},
+		{
+			name:               "malformed SLSA v0.2 materials",
+			payload:            malformedSlsaV02Provenance,
+			expectedErr:        ErrInvalidPayload,
+			expectedDefaultErr: ErrPayloadMismatch,
+		},
+		{
+			name:               "materials of another predicate type",
+			payload:            otherPredicateMaterialsStatement,
+			expectedErr:        ErrPayloadMismatch,
+			expectedDefaultErr: ErrPayloadMismatch,
+		},
+		{
+			name:    "in-toto subject",
+			payload: singleSubjectStatement,
+		},
+		{
+			name:    "Atomic Host signature",
+			payload: validPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			for _, parser := range []struct {
+				name        string
+				opts        []VerifierOption
+				expectedErr error
+			}{
+				{"ProvenancePayloadParser", []VerifierOption{WithPayloadParser(ProvenancePayloadParser)}, tc.expectedErr},
+				{"DefaultPayloadParser", nil, tc.expectedDefaultErr},
+			} {
+				v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, parser.opts...)
+				if err != nil {
+					t.Fatalf("error creating verifier: %v", err)
+				}
+				err = v.VerifyAttestation(att)
+				if parser.expectedErr == nil && err != nil {
+					t.Errorf("%s: VerifyAttestation(_) = %v, expected nil", parser.name, err)
+				}
+				if parser.expectedErr != nil && !errors.Is(err, parser.expectedErr) {
+					t.Errorf("%s: VerifyAttestation(_) = %v, want error matching %v", parser.name, err, parser.expectedErr)
+				}
+			}
+		})
+	}
+}
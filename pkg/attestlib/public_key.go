@@ -17,39 +17,70 @@ limitations under the License.
 package attestlib
 
 import (
-	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
-	"golang.org/x/crypto/openpgp"
+	"github.com/cloudflare/circl/sign/ed448"
 )
 
 // PublicKey stores public key material for all key types.
 type PublicKey struct {
 	// AuthenticatorType indicates the transport format of the Attestation this
-	// key verifies, one of Pgp, Pkix, or Jwt.
+	// key verifies, one of Pgp, Pkix, Jwt, Ed25519, Ed448, Kms, Vault or
+	// Hmac.
 	AuthenticatorType AuthenticatorType
 	// Signature Algorithm holds the signing and padding algorithm for the signature.
 	SignatureAlgorithm SignatureAlgorithm
-	// KeyData holds the raw key material which can verify a signature.
+	// KeyData holds the raw key material which can verify a signature. For
+	// PGP, this is an ASCII-armored or binary key. For PKIX, this is either a
+	// public key or a PEM-encoded certificate followed by any intermediate
+	// certificates. For Ed25519, this is the 32 byte public key, and for
+	// Ed448 the 57 byte public key. For Kms, this is the resource name of the
+	// Cloud KMS CryptoKeyVersion. For Vault, this is the path of the transit
+	// key, e.g. "transit/keys/my-key". For Hmac, this is the shared secret,
+	// which must be kept confidential.
 	KeyData []byte
 	// ID uniquely identifies this public key. For PGP, this should be the
-	// OpenPGP RFC4880 V4 fingerprint of the key. For PKIX and JWT, this should
-	// be a StringOrURI: it must either not contain ":" or be a valid URI.
+	// OpenPGP RFC4880 V4 fingerprint of the key. For PKIX, JWT, Ed25519 and
+	// Ed448, this should be a StringOrURI: it must either not contain ":" or
+	// be a valid URI.
 	ID string
+	// NotBefore and NotAfter bound the period in which this key may verify
+	// Attestations. A zero value leaves that end of the period unbounded.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// AllowedAlgorithms optionally restricts a Pkix key to the given
+	// signature algorithms. Signatures with any other algorithm are rejected,
+	// even if they are valid for the key. An Attestation may declare any of
+	// them as its SignatureAlgorithm, e.g. for an RSA key that signs with
+	// both PKCS#1 v1.5 and PSS; SignatureAlgorithm, which is used otherwise,
+	// must be one of them.
+	AllowedAlgorithms []SignatureAlgorithm
+
+	// parsedKey caches the parsed form of KeyData. It is populated by
+	// NewVerifier so that each key is only parsed once.
+	parsedKey interface{}
 }
 
 // NewPublicKey creates a new PublicKey.
 // `authenticatorType` indicates the transport format of the Attestation this
-// PublicKey verifies, one of Pgp, Pkix or Jwt.
+// PublicKey verifies, one of Pgp, Pkix, Jwt, Ed25519, Ed448, Kms, Vault or
+// Hmac.
 // `keyData` contains the raw key material.
 // `keyID` contains a unique identifier for the public key. For PGP, this field
 // should be left blank. The ID will be the OpenPGP RFC4880 V4 fingerprint of
 // the key. For PKIX and JWT, this may be left blank, and the ID  will be
-// generated based on the DER encoding of the key. If not blank, the ID should
+// generated based on the DER encoding of the key. For Kms and Vault, the ID
+// defaults to the resource name or path of the key. For Hmac, the ID is
+// required, so that it is not derived from the secret. If not blank, the ID should
 // be a StringOrURI: it must either not contain ":" or be a valid URI.
-func NewPublicKey(authenticatorType AuthenticatorType, signatureAlgorithm SignatureAlgorithm, keyData []byte, keyID string) (*PublicKey, error) {
+// `opts` contains optional PublicKeyOptions, such as a validity period.
+func NewPublicKey(authenticatorType AuthenticatorType, signatureAlgorithm SignatureAlgorithm, keyData []byte, keyID string, opts ...PublicKeyOption) (*PublicKey, error) {
 	newKeyID := ""
 	switch authenticatorType {
 	case Pgp:
@@ -70,21 +101,303 @@ func NewPublicKey(authenticatorType AuthenticatorType, signatureAlgorithm Signat
 		if signatureAlgorithm == UnknownSigningAlgorithm || signatureAlgorithm == PGPUnused {
 			return nil, fmt.Errorf("expected signature algorithm with JWT/PKIX key type")
 		}
+		// Ed25519 detached signatures use the Ed25519 key type, but JWTs may
+		// be signed with EdDSA.
+		if authenticatorType == Pkix && signatureAlgorithm == EddsaEd25519 {
+			return nil, fmt.Errorf("expected Ed25519 key type with EddsaEd25519 signature algorithm")
+		}
+	case Ed25519:
+		id, err := extractPkixKeyID(keyData, keyID)
+		if err != nil {
+			return nil, err
+		}
+		newKeyID = id
+		if signatureAlgorithm != EddsaEd25519 {
+			return nil, fmt.Errorf("expected EddsaEd25519 signature algorithm with Ed25519 key type")
+		}
+	case Ed448:
+		id, err := extractPkixKeyID(keyData, keyID)
+		if err != nil {
+			return nil, err
+		}
+		newKeyID = id
+		if signatureAlgorithm != EddsaEd448 {
+			return nil, fmt.Errorf("expected EddsaEd448 signature algorithm with Ed448 key type")
+		}
+	case Hmac:
+		if keyID == "" {
+			return nil, fmt.Errorf("expected key ID with Hmac key type")
+		}
+		id, err := extractPkixKeyID(keyData, keyID)
+		if err != nil {
+			return nil, err
+		}
+		newKeyID = id
+		if signatureAlgorithm != HmacSha256 {
+			return nil, fmt.Errorf("expected HmacSha256 signature algorithm with Hmac key type")
+		}
+	case Kms:
+		if len(keyData) == 0 {
+			return nil, fmt.Errorf("expected Cloud KMS resource name with Kms key type")
+		}
+		if keyID == "" {
+			keyID = string(keyData)
+		}
+		id, err := extractPkixKeyID(keyData, keyID)
+		if err != nil {
+			return nil, err
+		}
+		newKeyID = id
+		if !isKmsSignatureAlgorithm(signatureAlgorithm) {
+			return nil, fmt.Errorf("expected signature algorithm supported by Cloud KMS with Kms key type")
+		}
+	case Vault:
+		if len(keyData) == 0 {
+			return nil, fmt.Errorf("expected Vault transit key path with Vault key type")
+		}
+		if keyID == "" {
+			keyID = string(keyData)
+		}
+		id, err := extractPkixKeyID(keyData, keyID)
+		if err != nil {
+			return nil, err
+		}
+		newKeyID = id
+		if signatureAlgorithm == UnknownSigningAlgorithm || signatureAlgorithm == PGPUnused {
+			return nil, fmt.Errorf("expected signature algorithm with Vault key type")
+		}
 	default:
 		return nil, fmt.Errorf("invalid AuthenticatorType")
 	}
 
-	return &PublicKey{
-		AuthenticatorType: authenticatorType,
-		KeyData:           keyData,
-		ID:                newKeyID,
-	}, nil
+	publicKey := &PublicKey{
+		AuthenticatorType:  authenticatorType,
+		SignatureAlgorithm: signatureAlgorithm,
+		KeyData:            keyData,
+		ID:                 newKeyID,
+	}
+	for _, opt := range opts {
+		opt(publicKey)
+	}
+	if !publicKey.NotBefore.IsZero() && !publicKey.NotAfter.IsZero() && publicKey.NotAfter.Before(publicKey.NotBefore) {
+		return nil, fmt.Errorf("key NotAfter %v is before NotBefore %v", publicKey.NotAfter, publicKey.NotBefore)
+	}
+	return publicKey, nil
+}
+
+// PublicKeyOption configures optional fields of a PublicKey created by
+// NewPublicKey.
+type PublicKeyOption func(*PublicKey)
+
+// WithNotBefore sets the time before which the PublicKey may not verify
+// Attestations.
+func WithNotBefore(notBefore time.Time) PublicKeyOption {
+	return func(k *PublicKey) {
+		k.NotBefore = notBefore
+	}
+}
+
+// WithNotAfter sets the time after which the PublicKey may no longer verify
+// Attestations.
+func WithNotAfter(notAfter time.Time) PublicKeyOption {
+	return func(k *PublicKey) {
+		k.NotAfter = notAfter
+	}
+}
+
+// WithPublicKeyAlgorithms sets the AllowedAlgorithms of a Pkix PublicKey.
+func WithPublicKeyAlgorithms(algs ...SignatureAlgorithm) PublicKeyOption {
+	return func(k *PublicKey) {
+		k.AllowedAlgorithms = append([]SignatureAlgorithm(nil), algs...)
+	}
+}
+
+// allowsAlgorithm reports whether `alg` is one of the AllowedAlgorithms of
+// the PublicKey.
+func (k PublicKey) allowsAlgorithm(alg SignatureAlgorithm) bool {
+	for _, allowed := range k.AllowedAlgorithms {
+		if allowed == alg {
+			return true
+		}
+	}
+	return false
+}
+
+// withDeclaredAlgorithm returns the PublicKey with the SignatureAlgorithm
+// declared by `att`, if it declares one.
+func (k PublicKey) withDeclaredAlgorithm(att *Attestation) PublicKey {
+	if att.SignatureAlgorithm != UnknownSigningAlgorithm {
+		k.SignatureAlgorithm = att.SignatureAlgorithm
+	}
+	return k
+}
+
+// DedupePublicKeys returns `publicKeys` without the keys whose key material
+// duplicates an earlier key, e.g. one found in several merged key sources
+// under different IDs. Keys duplicate each other if they have the same
+// AuthenticatorType, SignatureAlgorithm and byte-identical KeyData; the first
+// of them is kept, with its ID and validity period. The remaining keys keep
+// their order.
+func DedupePublicKeys(publicKeys []PublicKey) []PublicKey {
+	seen := map[string]bool{}
+	deduped := []PublicKey{}
+	for _, publicKey := range publicKeys {
+		material := publicKey.materialKey()
+		if seen[material] {
+			continue
+		}
+		seen[material] = true
+		deduped = append(deduped, publicKey)
+	}
+	return deduped
+}
+
+// materialKey returns a string that identifies the key material of the
+// PublicKey, regardless of its ID.
+func (k PublicKey) materialKey() string {
+	return fmt.Sprintf("%d/%d/%s", k.AuthenticatorType, k.SignatureAlgorithm, k.KeyData)
+}
+
+// checkValidityPeriod returns an error matching ErrKeyNotValid if `now` is
+// outside the PublicKey's validity period.
+func (k PublicKey) checkValidityPeriod(now time.Time) error {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return fmt.Errorf("%w: key %q is not valid before %v", ErrKeyNotValid, k.ID, k.NotBefore)
+	}
+	if !k.NotAfter.IsZero() && now.After(k.NotAfter) {
+		return fmt.Errorf("%w: key %q expired at %v", ErrKeyNotValid, k.ID, k.NotAfter)
+	}
+	return nil
+}
+
+// parseKeyData parses the key material of a PublicKey according to its
+// AuthenticatorType. Keys of an unknown type are not parsed.
+func parseKeyData(publicKey PublicKey) (interface{}, error) {
+	switch publicKey.AuthenticatorType {
+	case Pgp:
+		return parsePgpPublicKey(publicKey.KeyData)
+	case Pkix:
+		return parsePkixKeyData(publicKey.KeyData)
+	case Jwt:
+		return parsePkixPublicKey(publicKey.KeyData)
+	case Ed25519:
+		return parseEd25519PublicKey(publicKey.KeyData)
+	case Ed448:
+		return parseEd448PublicKey(publicKey.KeyData)
+	case Hmac:
+		return parseHmacSecret(publicKey.KeyData)
+	default:
+		return nil, nil
+	}
+}
+
+// validateKeyData parses the key material of a PublicKey like parseKeyData,
+// and checks that it is a key of the declared AuthenticatorType that can
+// create signatures of the declared SignatureAlgorithm.
+func validateKeyData(publicKey PublicKey) (interface{}, error) {
+	parsedKey, err := parseKeyData(publicKey)
+	if err != nil {
+		if detected := detectKeyType(publicKey.KeyData); detected != UnknownAuthenticatorType && detected != publicKey.AuthenticatorType {
+			return nil, fmt.Errorf("key material is a %v key, but the key is declared as %v", detected, publicKey.AuthenticatorType)
+		}
+		return nil, err
+	}
+	if parsedKey == nil {
+		// The key material of Kms and Vault keys is fetched when it is used.
+		return nil, nil
+	}
+	pub := parsedKey
+	if chain, ok := parsedKey.(*pkixCertificateChain); ok {
+		pub = chain.leaf.PublicKey
+	}
+	if err := checkKeyAlgorithm(pub, publicKey.SignatureAlgorithm); err != nil {
+		return nil, err
+	}
+	if len(publicKey.AllowedAlgorithms) > 0 {
+		if publicKey.AuthenticatorType != Pkix {
+			return nil, fmt.Errorf("allowed algorithms are only supported for PKIX keys, not %v keys", publicKey.AuthenticatorType)
+		}
+		if !publicKey.allowsAlgorithm(publicKey.SignatureAlgorithm) {
+			return nil, fmt.Errorf("signature algorithm %v is not one of the allowed algorithms", publicKey.SignatureAlgorithm)
+		}
+		for _, alg := range publicKey.AllowedAlgorithms {
+			if err := checkKeyAlgorithm(pub, alg); err != nil {
+				return nil, fmt.Errorf("allowed algorithm %v: %v", alg, err)
+			}
+		}
+	}
+	return parsedKey, nil
+}
+
+// detectKeyType returns the AuthenticatorType of the key material
+// `keyData` if it is a PGP or PKIX key, or UnknownAuthenticatorType.
+func detectKeyType(keyData []byte) AuthenticatorType {
+	if _, err := parsePgpPublicKey(keyData); err == nil {
+		return Pgp
+	}
+	if _, err := parsePkixKeyData(keyData); err == nil {
+		return Pkix
+	}
+	return UnknownAuthenticatorType
+}
+
+// checkKeyAlgorithm checks that the parsed public key `pub` can create
+// signatures of the algorithm `alg`. Keys other than RSA, ECDSA, Ed25519 and
+// Ed448 keys, and unknown algorithms, are not checked. Registered algorithms
+// require the keys of the algorithm they are based on.
+func checkKeyAlgorithm(pub interface{}, alg SignatureAlgorithm) error {
+	switch base := baseSignatureAlgorithm(alg); base {
+	case RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, RsaPss4096Sha512,
+		RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha384, RsaSignPkcs14096Sha512:
+		if _, ok := pub.(*rsa.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %v requires an RSA key, got %s", alg, describeKey(pub))
+		}
+	case EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512:
+		ecKey, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("signature algorithm %v requires an ECDSA key, got %s", alg, describeKey(pub))
+		}
+		if curve := ecdsaCurve(base); ecKey.Curve != curve {
+			return fmt.Errorf("signature algorithm %v requires an ECDSA key on curve %s, got %s", alg, curve.Params().Name, ecKey.Curve.Params().Name)
+		}
+	case EddsaEd25519:
+		if _, ok := pub.(ed25519.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %v requires an Ed25519 key, got %s", alg, describeKey(pub))
+		}
+	case EddsaEd448:
+		if _, ok := pub.(ed448.PublicKey); !ok {
+			return fmt.Errorf("signature algorithm %v requires an Ed448 key, got %s", alg, describeKey(pub))
+		}
+	case HmacSha256:
+		if _, ok := pub.(hmacSecret); !ok {
+			return fmt.Errorf("signature algorithm %v requires an HMAC secret, got %s", alg, describeKey(pub))
+		}
+	}
+	return nil
+}
+
+// describeKey names the kind of a parsed public key in error messages.
+func describeKey(pub interface{}) string {
+	switch pub.(type) {
+	case *rsa.PublicKey:
+		return "an RSA key"
+	case *ecdsa.PublicKey:
+		return "an ECDSA key"
+	case ed25519.PublicKey:
+		return "an Ed25519 key"
+	case ed448.PublicKey:
+		return "an Ed448 key"
+	case hmacSecret:
+		return "an HMAC secret"
+	default:
+		return fmt.Sprintf("a %T key", pub)
+	}
 }
 
 func extractPgpKeyID(keyData []byte) (string, error) {
-	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyData))
+	keyring, err := parsePgpPublicKey(keyData)
 	if err != nil {
-		return "", fmt.Errorf("error reading armored public key: %v", err)
+		return "", fmt.Errorf("error reading public key: %v", err)
 	}
 	if len(keyring) != 1 {
 		return "", fmt.Errorf("expected 1 public key, got %d", len(keyring))
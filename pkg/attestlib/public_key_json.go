@@ -0,0 +1,177 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// publicKeyJSON is the JSON encoding of a PublicKey. The key material is held
+// in exactly one of KeyData and KeyPem.
+type publicKeyJSON struct {
+	ID                 string                 `json:"id"`
+	AuthenticatorType  jsonAuthenticatorType  `json:"keyType"`
+	SignatureAlgorithm jsonSignatureAlgorithm `json:"signatureAlgorithm,omitempty"`
+	// KeyData holds binary key material, or a Kms or Vault key name, encoded
+	// as standard base64.
+	KeyData []byte `json:"keyData,omitempty"`
+	// KeyPem holds PEM-encoded or ASCII-armored key material as is.
+	KeyPem    string     `json:"keyPem,omitempty"`
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+	// AllowedAlgorithms holds the SignatureAlgorithms a Pkix key is
+	// restricted to, if any.
+	AllowedAlgorithms []jsonSignatureAlgorithm `json:"allowedAlgorithms,omitempty"`
+}
+
+// MarshalJSON encodes the PublicKey as a JSON object, e.g. for configuration
+// files. The AuthenticatorType and SignatureAlgorithms are encoded as their
+// names, except for algorithms registered with RegisterSignatureHash, which
+// have no name and are encoded as numbers. KeyData holding PEM or ASCII-armored key material is encoded as the
+// string "keyPem", other KeyData as the base64 string "keyData".
+func (k PublicKey) MarshalJSON() ([]byte, error) {
+	enc := publicKeyJSON{
+		ID:                 k.ID,
+		AuthenticatorType:  jsonAuthenticatorType(k.AuthenticatorType),
+		SignatureAlgorithm: jsonSignatureAlgorithm(k.SignatureAlgorithm),
+	}
+	for _, alg := range k.AllowedAlgorithms {
+		enc.AllowedAlgorithms = append(enc.AllowedAlgorithms, jsonSignatureAlgorithm(alg))
+	}
+	if isPemText(k.KeyData) {
+		enc.KeyPem = string(k.KeyData)
+	} else {
+		enc.KeyData = k.KeyData
+	}
+	if !k.NotBefore.IsZero() {
+		enc.NotBefore = &k.NotBefore
+	}
+	if !k.NotAfter.IsZero() {
+		enc.NotAfter = &k.NotAfter
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON decodes a PublicKey encoded by MarshalJSON. The ID and key
+// material are used as is: unlike NewPublicKey, no ID is derived from the key
+// material, which is parsed by NewVerifier.
+func (k *PublicKey) UnmarshalJSON(data []byte) error {
+	var enc publicKeyJSON
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return err
+	}
+	if AuthenticatorType(enc.AuthenticatorType) == UnknownAuthenticatorType {
+		return errors.New("public key is missing keyType")
+	}
+	if len(enc.KeyData) != 0 && enc.KeyPem != "" {
+		return errors.New("public key must not have both keyData and keyPem")
+	}
+	keyData := enc.KeyData
+	if enc.KeyPem != "" {
+		keyData = []byte(enc.KeyPem)
+	}
+	if len(keyData) == 0 {
+		return errors.New("public key is missing keyData or keyPem")
+	}
+	*k = PublicKey{
+		AuthenticatorType:  AuthenticatorType(enc.AuthenticatorType),
+		SignatureAlgorithm: SignatureAlgorithm(enc.SignatureAlgorithm),
+		KeyData:            keyData,
+		ID:                 enc.ID,
+	}
+	for _, alg := range enc.AllowedAlgorithms {
+		k.AllowedAlgorithms = append(k.AllowedAlgorithms, SignatureAlgorithm(alg))
+	}
+	if enc.NotBefore != nil {
+		k.NotBefore = *enc.NotBefore
+	}
+	if enc.NotAfter != nil {
+		k.NotAfter = *enc.NotAfter
+	}
+	return nil
+}
+
+// isPemText reports whether `keyData` is PEM-encoded or ASCII-armored text
+// that survives a round trip through a JSON string unchanged.
+func isPemText(keyData []byte) bool {
+	return utf8.Valid(keyData) && bytes.Contains(keyData, []byte("-----BEGIN "))
+}
+
+// jsonAuthenticatorType is the JSON encoding of an AuthenticatorType in a
+// publicKeyJSON: its name, e.g. "pkix".
+type jsonAuthenticatorType AuthenticatorType
+
+func (t jsonAuthenticatorType) MarshalJSON() ([]byte, error) {
+	name := AuthenticatorType(t).String()
+	if _, err := ParseAuthenticatorType(name); err != nil {
+		return nil, fmt.Errorf("cannot marshal unknown AuthenticatorType %d", int(t))
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON decodes an AuthenticatorType from its name, ignoring case.
+func (t *jsonAuthenticatorType) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "AuthenticatorType must be a string")
+	}
+	parsed, err := ParseAuthenticatorType(s)
+	if err != nil {
+		return err
+	}
+	*t = jsonAuthenticatorType(parsed)
+	return nil
+}
+
+// jsonSignatureAlgorithm is the JSON encoding of a SignatureAlgorithm in a
+// publicKeyJSON: its name, e.g. "ecdsa_p256_sha256", or its number if it has
+// no name, like the algorithms registered with RegisterSignatureHash.
+type jsonSignatureAlgorithm SignatureAlgorithm
+
+func (a jsonSignatureAlgorithm) MarshalJSON() ([]byte, error) {
+	name := SignatureAlgorithm(a).String()
+	if _, err := ParseSignatureAlgorithm(name); err != nil {
+		return json.Marshal(int(a))
+	}
+	return json.Marshal(name)
+}
+
+// UnmarshalJSON decodes a SignatureAlgorithm from its name, ignoring case, or
+// from its number.
+func (a *jsonSignatureAlgorithm) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		*a = jsonSignatureAlgorithm(n)
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return errors.Wrap(err, "SignatureAlgorithm must be a string or a number")
+	}
+	parsed, err := ParseSignatureAlgorithm(s)
+	if err != nil {
+		return err
+	}
+	*a = jsonSignatureAlgorithm(parsed)
+	return nil
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublicKeyJSONRoundTrip(t *testing.T) {
+	notBefore := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		name          string
+		publicKey     PublicKey
+		expectedField string
+	}{
+		{
+			name:          "PEM-encoded PKIX key",
+			publicKey:     PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "pkix-key"},
+			expectedField: `"keyPem"`,
+		},
+		{
+			name:          "ASCII-armored PGP key",
+			publicKey:     PublicKey{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(verifierPublicKey), ID: verifierPublicKeyID},
+			expectedField: `"keyPem"`,
+		},
+		{
+			name:          "binary Ed25519 key",
+			publicKey:     PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"},
+			expectedField: `"keyData"`,
+		},
+		{
+			name:          "key with validity period",
+			publicKey:     PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: "kms-key", NotBefore: notBefore, NotAfter: notAfter},
+			expectedField: `"notAfter"`,
+		},
+		{
+			name:          "key with allowed algorithms",
+			publicKey:     PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte(rsa2048PubKey), ID: "rsa-key", AllowedAlgorithms: []SignatureAlgorithm{RsaSignPkcs12048Sha256, RsaPss2048Sha256}},
+			expectedField: `"allowedAlgorithms"`,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.publicKey)
+			if err != nil {
+				t.Fatalf("json.Marshal(_) = %v, expected nil", err)
+			}
+			if !strings.Contains(string(data), tc.expectedField) {
+				t.Errorf("json.Marshal(_) = %s, expected field %s", data, tc.expectedField)
+			}
+			if !strings.Contains(string(data), `"keyType":"`+tc.publicKey.AuthenticatorType.String()+`"`) {
+				t.Errorf("json.Marshal(_) = %s, expected keyType %q", data, tc.publicKey.AuthenticatorType)
+			}
+			if !strings.Contains(string(data), `"signatureAlgorithm":"`+tc.publicKey.SignatureAlgorithm.String()+`"`) {
+				t.Errorf("json.Marshal(_) = %s, expected signatureAlgorithm %q", data, tc.publicKey.SignatureAlgorithm)
+			}
+			var actual PublicKey
+			if err := json.Unmarshal(data, &actual); err != nil {
+				t.Fatalf("json.Unmarshal(%s) = %v, expected nil", data, err)
+			}
+			if actual.ID != tc.publicKey.ID || actual.AuthenticatorType != tc.publicKey.AuthenticatorType || actual.SignatureAlgorithm != tc.publicKey.SignatureAlgorithm {
+				t.Errorf("json.Unmarshal(%s) = %+v, want %+v", data, actual, tc.publicKey)
+			}
+			if !bytes.Equal(actual.KeyData, tc.publicKey.KeyData) {
+				t.Errorf("json.Unmarshal(%s) KeyData = %q, want %q", data, actual.KeyData, tc.publicKey.KeyData)
+			}
+			if !actual.NotBefore.Equal(tc.publicKey.NotBefore) || !actual.NotAfter.Equal(tc.publicKey.NotAfter) {
+				t.Errorf("json.Unmarshal(%s) validity period = [%v, %v], want [%v, %v]", data, actual.NotBefore, actual.NotAfter, tc.publicKey.NotBefore, tc.publicKey.NotAfter)
+			}
+			if !reflect.DeepEqual(actual.AllowedAlgorithms, tc.publicKey.AllowedAlgorithms) {
+				t.Errorf("json.Unmarshal(%s) AllowedAlgorithms = %v, want %v", data, actual.AllowedAlgorithms, tc.publicKey.AllowedAlgorithms)
+			}
+		})
+	}
+}
+
+func TestUnmarshalPublicKeysFromConfig(t *testing.T) {
+	config := `[
+  {"id": "pkix-key", "keyType": "PKIX", "signatureAlgorithm": "ECDSA_P256_SHA256", "keyPem": ` + jsonString(t, ec256PubKey) + `},
+  {"id": "ed25519-key", "keyType": "ed25519", "signatureAlgorithm": "eddsa_ed25519", "keyData": "` + base64.StdEncoding.EncodeToString(ed25519PubKey) + `"},
+  {"id": "rsa-key", "keyType": "pkix", "signatureAlgorithm": "rsa_sign_pkcs1_2048_sha256", "allowedAlgorithms": ["rsa_sign_pkcs1_2048_sha256", "rsa_pss_2048_sha256"], "keyPem": ` + jsonString(t, rsa2048PubKey) + `}
+]`
+	var publicKeys []PublicKey
+	if err := json.Unmarshal([]byte(config), &publicKeys); err != nil {
+		t.Fatalf("json.Unmarshal(_) = %v, expected nil", err)
+	}
+	if len(publicKeys) != 3 || publicKeys[0].AuthenticatorType != Pkix || publicKeys[1].AuthenticatorType != Ed25519 || publicKeys[2].AuthenticatorType != Pkix {
+		t.Fatalf("json.Unmarshal(_) = %+v, expected a Pkix, an Ed25519 and a Pkix key", publicKeys)
+	}
+	if publicKeys[0].SignatureAlgorithm != EcdsaP256Sha256 || publicKeys[1].SignatureAlgorithm != EddsaEd25519 || publicKeys[2].SignatureAlgorithm != RsaSignPkcs12048Sha256 {
+		t.Errorf("json.Unmarshal(_) signature algorithms = %v, %v, %v, expected %v, %v, %v", publicKeys[0].SignatureAlgorithm, publicKeys[1].SignatureAlgorithm, publicKeys[2].SignatureAlgorithm, EcdsaP256Sha256, EddsaEd25519, RsaSignPkcs12048Sha256)
+	}
+	if expected := []SignatureAlgorithm{RsaSignPkcs12048Sha256, RsaPss2048Sha256}; !reflect.DeepEqual(publicKeys[2].AllowedAlgorithms, expected) {
+		t.Errorf("json.Unmarshal(_) AllowedAlgorithms = %v, expected %v", publicKeys[2].AllowedAlgorithms, expected)
+	}
+	if _, err := NewVerifier(helloAppImage, publicKeys); err != nil {
+		t.Errorf("NewVerifier(...) = %v, expected nil", err)
+	}
+}
+
+func TestUnmarshalPublicKeyErrors(t *testing.T) {
+	tcs := []struct {
+		name string
+		data string
+	}{
+		{name: "unknown key type", data: `{"id": "k", "keyType": "x509", "keyData": "AAAA"}`},
+		{name: "missing key type", data: `{"id": "k", "keyData": "AAAA"}`},
+		{name: "numeric key type", data: `{"id": "k", "keyType": 2, "keyData": "AAAA"}`},
+		{name: "unknown signature algorithm", data: `{"id": "k", "keyType": "pkix", "signatureAlgorithm": "ecdsa_p256", "keyData": "AAAA"}`},
+		{name: "boolean signature algorithm", data: `{"id": "k", "keyType": "pkix", "signatureAlgorithm": true, "keyData": "AAAA"}`},
+		{name: "missing key material", data: `{"id": "k", "keyType": "pkix"}`},
+		{name: "both keyData and keyPem", data: `{"id": "k", "keyType": "pkix", "keyData": "AAAA", "keyPem": "-----BEGIN PUBLIC KEY-----"}`},
+		{name: "invalid base64", data: `{"id": "k", "keyType": "pkix", "keyData": "not base64!"}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var publicKey PublicKey
+			if err := json.Unmarshal([]byte(tc.data), &publicKey); err == nil {
+				t.Errorf("json.Unmarshal(%s) = nil, expected non nil", tc.data)
+			}
+		})
+	}
+}
+
+func TestMarshalUnknownAuthenticatorType(t *testing.T) {
+	if _, err := json.Marshal(PublicKey{KeyData: []byte("key")}); err == nil {
+		t.Errorf("json.Marshal(_) = nil, expected non nil")
+	}
+}
+
+func TestPublicKeyJSONUnnamedSignatureAlgorithm(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: rsaPss2048Sha512_256, KeyData: []byte(rsa2048PubKey), ID: "rsa-key", AllowedAlgorithms: []SignatureAlgorithm{rsaPss2048Sha512_256, RsaPss2048Sha256}}
+	data, err := json.Marshal(publicKey)
+	if err != nil {
+		t.Fatalf("json.Marshal(_) = %v, expected nil", err)
+	}
+	expected := fmt.Sprintf(`"signatureAlgorithm":%d`, int(rsaPss2048Sha512_256))
+	if !strings.Contains(string(data), expected) {
+		t.Errorf("json.Marshal(_) = %s, expected field %s", data, expected)
+	}
+	var actual PublicKey
+	if err := json.Unmarshal(data, &actual); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v, expected nil", data, err)
+	}
+	if actual.SignatureAlgorithm != publicKey.SignatureAlgorithm || !reflect.DeepEqual(actual.AllowedAlgorithms, publicKey.AllowedAlgorithms) {
+		t.Errorf("json.Unmarshal(%s) algorithms = %v, %v, want %v, %v", data, actual.SignatureAlgorithm, actual.AllowedAlgorithms, publicKey.SignatureAlgorithm, publicKey.AllowedAlgorithms)
+	}
+}
+
+func TestUnmarshalNumericSignatureAlgorithm(t *testing.T) {
+	data := fmt.Sprintf(`{"id": "k", "keyType": "pkix", "signatureAlgorithm": %d, "allowedAlgorithms": [%d], "keyData": "AAAA"}`, int(EcdsaP256Sha256), int(RsaPss2048Sha256))
+	var publicKey PublicKey
+	if err := json.Unmarshal([]byte(data), &publicKey); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v, expected nil", data, err)
+	}
+	if publicKey.SignatureAlgorithm != EcdsaP256Sha256 || !reflect.DeepEqual(publicKey.AllowedAlgorithms, []SignatureAlgorithm{RsaPss2048Sha256}) {
+		t.Errorf("json.Unmarshal(%s) algorithms = %v, %v, want %v, %v", data, publicKey.SignatureAlgorithm, publicKey.AllowedAlgorithms, EcdsaP256Sha256, []SignatureAlgorithm{RsaPss2048Sha256})
+	}
+}
+
+func TestMarshalAttestationWithAnySignatureAlgorithm(t *testing.T) {
+	for _, alg := range []SignatureAlgorithm{UnknownSigningAlgorithm, EcdsaP256Sha256, ecdsaP256Sha224} {
+		att := Attestation{PublicKeyID: "key", Signature: []byte("sig"), SignatureAlgorithm: alg}
+		data, err := json.Marshal(att)
+		if err != nil {
+			t.Fatalf("json.Marshal(%+v) = %v, expected nil", att, err)
+		}
+		var actual Attestation
+		if err := json.Unmarshal(data, &actual); err != nil {
+			t.Fatalf("json.Unmarshal(%s) = %v, expected nil", data, err)
+		}
+		if actual.SignatureAlgorithm != alg {
+			t.Errorf("json.Unmarshal(%s) SignatureAlgorithm = %v, want %v", data, actual.SignatureAlgorithm, alg)
+		}
+	}
+}
+
+func jsonString(t *testing.T, s string) string {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("json.Marshal(%q) = %v, expected nil", s, err)
+	}
+	return string(data)
+}
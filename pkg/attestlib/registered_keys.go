@@ -0,0 +1,48 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import "sort"
+
+// KeyInfo describes a public key held by a Verifier, without its key
+// material, e.g. to expose a Verifier's keys for diagnostics.
+type KeyInfo struct {
+	// ID is the ID of the public key.
+	ID string
+	// KeyType is the AuthenticatorType of the public key.
+	KeyType AuthenticatorType
+}
+
+// RegisteredKeys returns the verifier's public keys ordered by ID. Keys that
+// share an ID are listed in the order they were passed to NewVerifier, and a
+// key listed again with the same key material is listed once. See Verifier
+// for more details.
+func (v *verifier) RegisteredKeys() []KeyInfo {
+	v = v.current()
+	ids := make([]string, 0, len(v.PublicKeys))
+	for id := range v.PublicKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var keys []KeyInfo
+	for _, id := range ids {
+		for _, publicKey := range v.PublicKeys[id] {
+			keys = append(keys, KeyInfo{ID: publicKey.ID, KeyType: publicKey.AuthenticatorType})
+		}
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisteredKeys(t *testing.T) {
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "shared-key"}
+	otherEd25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "shared-key"}
+	pkixKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	tcs := []struct {
+		name     string
+		keys     []PublicKey
+		expected []KeyInfo
+	}{
+		{
+			name: "keys ordered by ID",
+			keys: []PublicKey{ed25519Key, pkixKey},
+			expected: []KeyInfo{
+				{ID: "ec-key", KeyType: Pkix},
+				{ID: "shared-key", KeyType: Ed25519},
+			},
+		},
+		{
+			name: "keys sharing an ID",
+			keys: []PublicKey{ed25519Key, otherEd25519Key},
+			expected: []KeyInfo{
+				{ID: "shared-key", KeyType: Ed25519},
+				{ID: "shared-key", KeyType: Ed25519},
+			},
+		},
+		{
+			name: "duplicate key listed once",
+			keys: []PublicKey{pkixKey, pkixKey},
+			expected: []KeyInfo{
+				{ID: "ec-key", KeyType: Pkix},
+			},
+		},
+		{
+			name: "no keys",
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, tc.keys)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			if got := v.RegisteredKeys(); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("RegisteredKeys() = %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestMultiVerifierRegisteredKeys(t *testing.T) {
+	pkixKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	first, err := NewVerifier(helloAppImage, []PublicKey{pkixKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	second, err := WrapVerifier(first, helloAppImage)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	v := NewMultiVerifier(RequireAll, first, NewAlwaysRejectingVerifier(nil), second)
+	expected := []KeyInfo{{ID: "ec-key", KeyType: Pkix}, {ID: "ec-key", KeyType: Pkix}}
+	if got := v.RegisteredKeys(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("RegisteredKeys() = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// defaultKeyFetchAttempts is the number of times a public key is fetched
+	// from a network service before giving up on transient errors.
+	defaultKeyFetchAttempts = 3
+	// defaultKeyFetchBackoff is the delay before the first retry. It doubles
+	// with every retry.
+	defaultKeyFetchBackoff = 100 * time.Millisecond
+)
+
+// retryPolicy controls how fetches of public keys from Cloud KMS, Vault or a
+// JWKS endpoint are retried. Only fetches are retried: signatures that fail to
+// verify are never retried.
+type retryPolicy struct {
+	// maxAttempts is the maximum number of attempts. One or less disables
+	// retries.
+	maxAttempts int
+	// initialBackoff is the delay before the first retry. It doubles with
+	// every retry.
+	initialBackoff time.Duration
+	// sleep waits between retries. It returns early with ctx.Err() if `ctx`
+	// is done. If nil, sleepContext is used.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// defaultRetryPolicy is the retryPolicy used unless WithKeyFetchRetry is set.
+var defaultRetryPolicy = retryPolicy{
+	maxAttempts:    defaultKeyFetchAttempts,
+	initialBackoff: defaultKeyFetchBackoff,
+	sleep:          sleepContext,
+}
+
+// do calls `fetch` until it succeeds, fails with an error that `isTransient`
+// rejects, or the attempts are exhausted, and returns the number of attempts
+// made and the last error. It stops with ctx.Err() once `ctx` is done.
+func (p retryPolicy) do(ctx context.Context, isTransient func(error) bool, fetch func() error) (attempts int, err error) {
+	_, span := startSpan(ctx, SpanFetchKey)
+	defer func() {
+		span.SetAttribute(AttributeAttempts, attempts)
+		endSpan(span, err)
+	}()
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	backoff := p.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return attempt - 1, err
+		}
+		err := fetch()
+		if err == nil || !isTransient(err) || attempt >= p.maxAttempts {
+			return attempt, err
+		}
+		if err := sleep(ctx, backoff); err != nil {
+			return attempt, err
+		}
+		backoff *= 2
+	}
+}
+
+// transientError marks an error of a fetch that may succeed when retried.
+type transientError struct {
+	error
+}
+
+func (e transientError) Unwrap() error {
+	return e.error
+}
+
+// isTransientError reports whether `err` is a transientError.
+func isTransientError(err error) bool {
+	_, ok := err.(transientError)
+	return ok
+}
+
+// sleepContext waits for `d`, or until `ctx` is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	transient := transientError{errors.New("unavailable")}
+	permanent := errors.New("denied")
+	tcs := []struct {
+		name             string
+		maxAttempts      int
+		errs             []error
+		expectedAttempts int
+		expectedErr      error
+	}{
+		{
+			name:             "succeeds on third attempt",
+			maxAttempts:      3,
+			errs:             []error{transient, transient},
+			expectedAttempts: 3,
+		},
+		{
+			name:             "always fails",
+			maxAttempts:      3,
+			errs:             []error{transient, transient, transient, transient},
+			expectedAttempts: 3,
+			expectedErr:      transient,
+		},
+		{
+			name:             "permanent error fails fast",
+			maxAttempts:      3,
+			errs:             []error{permanent},
+			expectedAttempts: 1,
+			expectedErr:      permanent,
+		},
+		{
+			name:             "retries disabled",
+			maxAttempts:      0,
+			errs:             []error{transient},
+			expectedAttempts: 1,
+			expectedErr:      transient,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var sleeps []time.Duration
+			p := retryPolicy{maxAttempts: tc.maxAttempts, initialBackoff: time.Second, sleep: func(ctx context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			}}
+			errs := tc.errs
+			attempts, err := p.do(context.Background(), isTransientError, func() error {
+				if len(errs) == 0 {
+					return nil
+				}
+				err := errs[0]
+				errs = errs[1:]
+				return err
+			})
+			if err != tc.expectedErr {
+				t.Errorf("do(...) = %v, expected %v", err, tc.expectedErr)
+			}
+			if attempts != tc.expectedAttempts {
+				t.Errorf("do(...) made %d attempts, expected %d", attempts, tc.expectedAttempts)
+			}
+			for i, d := range sleeps {
+				if expected := time.Second << uint(i); d != expected {
+					t.Errorf("backoff %d = %v, expected %v", i, d, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPolicyContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	p := retryPolicy{maxAttempts: 5, initialBackoff: time.Hour}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := p.do(ctx, isTransientError, func() error {
+		calls++
+		return transientError{errors.New("unavailable")}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("do(...) = %v, want error matching %v", err, context.Canceled)
+	}
+	if calls != 1 {
+		t.Errorf("fetch called %d times, expected 1", calls)
+	}
+}
+
+// flakyVaultClient fails the first `failures` reads and then reads from
+// `client`.
+type flakyVaultClient struct {
+	client   *fakeVaultClient
+	failures int
+	calls    int
+}
+
+func (c *flakyVaultClient) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	c.calls++
+	if c.calls <= c.failures {
+		return nil, fmt.Errorf("read %d failed", c.calls)
+	}
+	return c.client.Read(ctx, path)
+}
+
+func TestVerifyAttestationVaultKeyFetchRetry(t *testing.T) {
+	publicKey, err := NewPublicKey(Vault, EddsaEd25519, []byte(vaultKeyPath), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	tcs := []struct {
+		name          string
+		failures      int
+		signature     []byte
+		expectedCalls int
+		expectedErr   error
+	}{
+		{
+			name:          "succeeds on third attempt",
+			failures:      2,
+			signature:     signature,
+			expectedCalls: 3,
+		},
+		{
+			name:          "always fails",
+			failures:      100,
+			signature:     signature,
+			expectedCalls: 4,
+			expectedErr:   ErrRetriesExhausted,
+		},
+		{
+			name:          "invalid signature is not retried",
+			signature:     ed25519.Sign(ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed")), []byte(validPayload)),
+			expectedCalls: 1,
+			expectedErr:   ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &flakyVaultClient{
+				client:   &fakeVaultClient{data: vaultTransitKeyData("ed25519", base64.StdEncoding.EncodeToString(ed25519PubKey))},
+				failures: tc.failures,
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithVaultClient(client, time.Minute), WithKeyFetchRetry(4, time.Millisecond))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: vaultKeyPath, Signature: tc.signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if client.calls != tc.expectedCalls {
+				t.Errorf("Read called %d times, expected %d", client.calls, tc.expectedCalls)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationJwksKeyFetchRetry(t *testing.T) {
+	tcs := []struct {
+		name             string
+		failures         int
+		status           int
+		expectedRequests int
+		expectedErr      bool
+		// exhausted is whether the error is expected to match
+		// ErrRetriesExhausted.
+		exhausted bool
+	}{
+		{
+			name:             "succeeds on third attempt",
+			failures:         2,
+			status:           http.StatusServiceUnavailable,
+			expectedRequests: 3,
+		},
+		{
+			name:             "always fails",
+			failures:         100,
+			status:           http.StatusServiceUnavailable,
+			expectedRequests: 3,
+			expectedErr:      true,
+			exhausted:        true,
+		},
+		{
+			name:             "client error is not retried",
+			failures:         100,
+			status:           http.StatusNotFound,
+			expectedRequests: 1,
+			expectedErr:      true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			jwks := ecJwks(t, "key-1")
+			var mu sync.Mutex
+			requests := 0
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				requests++
+				if requests <= tc.failures {
+					http.Error(w, "unavailable", tc.status)
+					return
+				}
+				fmt.Fprint(w, jwks)
+			}))
+			defer server.Close()
+			source, err := NewJwksSource(server.URL, server.Client())
+			if err != nil {
+				t.Fatalf("NewJwksSource(...) = %v, expected nil", err)
+			}
+			v, err := NewVerifier(helloAppImage, nil, WithJwksSource(source), WithKeyFetchRetry(3, time.Millisecond))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(ecJwtAttestation(t, "key-1"))
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+				}
+			} else if err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if errors.Is(err, ErrRetriesExhausted) != tc.exhausted {
+				t.Errorf("VerifyAttestation(_) = %v, matching %v: %t, expected %t", err, ErrRetriesExhausted, !tc.exhausted, tc.exhausted)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if requests != tc.expectedRequests {
+				t.Errorf("JWKS fetched %d times, expected %d", requests, tc.expectedRequests)
+			}
+		})
+	}
+}
@@ -25,7 +25,7 @@ import (
 
 func rsaSign(privateKey *rsa.PrivateKey, payload []byte, signatureAlgorithm SignatureAlgorithm) ([]byte, error) {
 	switch signatureAlgorithm {
-	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha512:
+	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha384, RsaSignPkcs14096Sha512:
 		hash, hashedPayload, err := hashPayload(payload, signatureAlgorithm)
 		if err != nil {
 			return nil, errors.Wrap(err, "hash payload error")
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// PublicKeysFromSecretData loads the public keys held in the data map of a
+// Kubernetes Secret, one key per entry. The KeyType of an entry is taken from
+// `typeHints`, e.g. as declared by annotations of the Secret, and otherwise
+// inferred from its contents as LoadPublicKeyFromFile does; entries without a
+// hint that do not contain a public key are skipped. Hints may declare the
+// Pgp, Pkix, Ed25519 and Jwt KeyTypes. The ID of a Jwt key is the name of its
+// entry, which must be the kid of the tokens it verifies.
+//
+// The keys of all the entries that could be loaded are returned, in the
+// order of their names; if any entry could not be loaded, the returned error
+// describes each such entry by name.
+func PublicKeysFromSecretData(data map[string][]byte, typeHints map[string]AuthenticatorType) ([]PublicKey, error) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var failures []string
+	for name := range typeHints {
+		if _, ok := data[name]; !ok {
+			failures = append(failures, fmt.Sprintf("%s: type hint for an entry that does not exist", name))
+		}
+	}
+	sort.Strings(failures)
+
+	var publicKeys []PublicKey
+	for _, name := range names {
+		keyType, hinted := typeHints[name]
+		var publicKey *PublicKey
+		var err error
+		if hinted {
+			publicKey, err = parseHintedPublicKey(name, data[name], keyType)
+		} else {
+			publicKey, err = parsePublicKeyData(data[name])
+			if err == errNoPublicKey {
+				continue
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		publicKeys = append(publicKeys, *publicKey)
+	}
+	if len(failures) != 0 {
+		return publicKeys, fmt.Errorf("error loading %d Secret entries: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return publicKeys, nil
+}
+
+// parseHintedPublicKey parses the public key of the Secret entry `name`,
+// whose contents are `data`, as a key of type `keyType`.
+func parseHintedPublicKey(name string, data []byte, keyType AuthenticatorType) (*PublicKey, error) {
+	switch keyType {
+	case Pgp, Pkix, Ed25519, Jwt:
+	default:
+		return nil, fmt.Errorf("%v keys cannot be loaded from a Secret", keyType)
+	}
+	publicKey, err := parsePublicKeyData(data)
+	if err == errNoPublicKey {
+		return nil, fmt.Errorf("entry does not contain a %v key", keyType)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %v key", keyType)
+	}
+	switch {
+	case publicKey.AuthenticatorType == keyType:
+		return publicKey, nil
+	case keyType == Jwt && publicKey.AuthenticatorType == Pkix:
+		return NewPublicKey(Jwt, publicKey.SignatureAlgorithm, publicKey.KeyData, name)
+	case keyType == Jwt && publicKey.AuthenticatorType == Ed25519:
+		return NewPublicKey(Jwt, EddsaEd25519, data, name)
+	default:
+		return nil, fmt.Errorf("entry holds a %v key, not a %v key", publicKey.AuthenticatorType, keyType)
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func TestPublicKeysFromSecretData(t *testing.T) {
+	ed25519Der, err := x509.MarshalPKIXPublicKey(ed25519PubKey)
+	if err != nil {
+		t.Fatalf("error marshaling public key: %v", err)
+	}
+	ed25519Pem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: ed25519Der})
+	data := map[string][]byte{
+		"attestor.asc": []byte(gpgPublicKey),
+		"ec256.pem":    []byte(ec256PubKey),
+		"ed25519.pem":  ed25519Pem,
+		"jwt-key":      []byte(ec256PubKey),
+		"rsa.pem":      []byte(rsa2048PubKey),
+		"README":       []byte("keys of the production attestors"),
+	}
+	typeHints := map[string]AuthenticatorType{
+		"attestor.asc": Pgp,
+		"jwt-key":      Jwt,
+	}
+	publicKeys, err := PublicKeysFromSecretData(data, typeHints)
+	if err != nil {
+		t.Fatalf("PublicKeysFromSecretData(...) = %v, expected nil", err)
+	}
+	expected := []struct {
+		keyType AuthenticatorType
+		alg     SignatureAlgorithm
+		id      string
+	}{
+		{Pgp, PGPUnused, gpgPublicKeyID},
+		{Pkix, EcdsaP256Sha256, spkiKeyID(t, ec256PubKey)},
+		{Ed25519, EddsaEd25519, spkiKeyID(t, string(ed25519Pem))},
+		{Jwt, EcdsaP256Sha256, "jwt-key"},
+		{Pkix, RsaSignPkcs12048Sha256, spkiKeyID(t, rsa2048PubKey)},
+	}
+	if len(publicKeys) != len(expected) {
+		t.Fatalf("PublicKeysFromSecretData(...) returned %d keys, expected %d", len(publicKeys), len(expected))
+	}
+	for i, want := range expected {
+		got := publicKeys[i]
+		if got.AuthenticatorType != want.keyType || got.SignatureAlgorithm != want.alg || got.ID != want.id {
+			t.Errorf("key %d = (%v, %v, %q), expected (%v, %v, %q)", i, got.AuthenticatorType, got.SignatureAlgorithm, got.ID, want.keyType, want.alg, want.id)
+		}
+	}
+
+	v, err := NewVerifier(helloAppImage, publicKeys)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(ecJwtAttestation(t, "jwt-key")); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+}
+
+func TestPublicKeysFromSecretDataErrors(t *testing.T) {
+	data := map[string][]byte{
+		"good.pem":    []byte(ec256PubKey),
+		"corrupt.pem": []byte("-----BEGIN PUBLIC KEY-----\naW52YWxpZA==\n-----END PUBLIC KEY-----\n"),
+		"not-pgp":     []byte(ec256PubKey),
+		"empty":       []byte("no key here"),
+		"kms":         []byte(kmsKeyName),
+	}
+	typeHints := map[string]AuthenticatorType{
+		"not-pgp": Pgp,
+		"empty":   Pkix,
+		"kms":     Kms,
+		"missing": Pkix,
+	}
+	publicKeys, err := PublicKeysFromSecretData(data, typeHints)
+	if err == nil {
+		t.Fatalf("PublicKeysFromSecretData(...) = nil, expected non nil")
+	}
+	for _, name := range []string{"corrupt.pem", "not-pgp", "empty", "kms", "missing"} {
+		if !strings.Contains(err.Error(), name+":") {
+			t.Errorf("PublicKeysFromSecretData(...) = %v, expected it to report %s", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), "good.pem") {
+		t.Errorf("PublicKeysFromSecretData(...) = %v, expected it not to report good.pem", err)
+	}
+	if len(publicKeys) != 1 || publicKeys[0].ID != spkiKeyID(t, ec256PubKey) {
+		t.Errorf("PublicKeysFromSecretData(...) returned %v, expected only the key of good.pem", publicKeys)
+	}
+}
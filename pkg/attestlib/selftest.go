@@ -0,0 +1,97 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// keyChecker is implemented by the verifiers of key backends that can check,
+// without verifying a signature, that a public key can be fetched.
+type keyChecker interface {
+	checkKey(ctx context.Context, publicKey PublicKey) error
+}
+
+// SelfTest checks that the verifier's public keys can be used: certificate
+// chains of PKIX keys are validated, and Kms and Vault public keys and the
+// JWKS source are fetched, bypassing their caches. Other public keys are
+// parsed by NewVerifier, so a verifier with only in-memory keys returns nil
+// without network requests. See Verifier for more details.
+func (v *verifier) SelfTest(ctx context.Context) error {
+	v = v.current()
+	ids := make([]string, 0, len(v.PublicKeys))
+	for id := range v.PublicKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var failures []string
+	for _, id := range ids {
+		for _, publicKey := range v.PublicKeys[id] {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := v.checkPublicKey(ctx, publicKey); err != nil {
+				if isContextError(err) {
+					return err
+				}
+				failures = append(failures, fmt.Sprintf("key %q: %v", id, err))
+			}
+		}
+	}
+	if v.jwksSource != nil {
+		if err := v.jwksSource.check(ctx, v.keyFetchRetry); err != nil {
+			if isContextError(err) {
+				return err
+			}
+			failures = append(failures, fmt.Sprintf("JWKS source: %v", err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%w: %s", ErrSelfTestFailed, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// checkPublicKey checks that `publicKey` can be used by its key backend.
+func (v *verifier) checkPublicKey(ctx context.Context, publicKey PublicKey) error {
+	var backend interface{}
+	switch publicKey.AuthenticatorType {
+	case Pkix:
+		return v.checkCertificateChain(publicKey)
+	case Kms:
+		if v.kmsVerifier == nil {
+			return errors.New("no Cloud KMS client is configured")
+		}
+		backend = v.kmsVerifier
+	case Vault:
+		if v.vaultVerifier == nil {
+			return errors.New("no Vault client is configured")
+		}
+		backend = v.vaultVerifier
+	default:
+		return nil
+	}
+	if checker, ok := backend.(keyChecker); ok {
+		return checker.checkKey(ctx, publicKey)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSelfTest(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "backend unavailable")
+	pkixKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "pkix-key"}
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	kmsKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: "kms-key"}
+	vaultKey := PublicKey{AuthenticatorType: Vault, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(vaultKeyPath), ID: "vault-key"}
+	vaultData := vaultTransitKeyData("ecdsa-p256", ec256PubKey)
+
+	tcs := []struct {
+		name             string
+		publicKeys       []PublicKey
+		opts             []VerifierOption
+		expectedFailures []string
+	}{
+		{
+			name:       "in-memory keys",
+			publicKeys: []PublicKey{pkixKey, ed25519Key},
+		},
+		{
+			name:       "reachable backends",
+			publicKeys: []PublicKey{pkixKey, kmsKey, vaultKey},
+			opts: []VerifierOption{
+				WithKmsClient(&fakeKmsClient{key: ec256KmsKey()}),
+				WithVaultClient(&fakeVaultClient{data: vaultData}, time.Minute),
+			},
+		},
+		{
+			name:             "Cloud KMS unavailable",
+			publicKeys:       []PublicKey{pkixKey, kmsKey},
+			opts:             []VerifierOption{WithKmsClient(&fakeKmsClient{errs: []error{unavailable}})},
+			expectedFailures: []string{`key "kms-key"`, "backend unavailable"},
+		},
+		{
+			name:             "no Cloud KMS client",
+			publicKeys:       []PublicKey{kmsKey},
+			expectedFailures: []string{`key "kms-key": no Cloud KMS client is configured`},
+		},
+		{
+			name:       "Cloud KMS and Vault unavailable",
+			publicKeys: []PublicKey{kmsKey, vaultKey},
+			opts: []VerifierOption{
+				WithKmsClient(&fakeKmsClient{errs: []error{unavailable}}),
+				WithVaultClient(&fakeVaultClient{err: errors.New("vault sealed")}, time.Minute),
+			},
+			expectedFailures: []string{`key "kms-key"`, `key "vault-key"`, "vault sealed"},
+		},
+		{
+			name:             "Vault key not found",
+			publicKeys:       []PublicKey{{AuthenticatorType: Vault, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte("transit/keys/other"), ID: "vault-key"}},
+			opts:             []VerifierOption{WithVaultClient(&fakeVaultClient{data: vaultData}, time.Minute)},
+			expectedFailures: []string{`key "vault-key"`, "not found"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]VerifierOption{WithKeyFetchRetry(1, 0)}, tc.opts...)
+			v, err := NewVerifier(helloAppImage, tc.publicKeys, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.SelfTest(context.Background())
+			if len(tc.expectedFailures) == 0 {
+				if err != nil {
+					t.Errorf("SelfTest(_) = %v, expected nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrSelfTestFailed) {
+				t.Fatalf("SelfTest(_) = %v, want error matching %v", err, ErrSelfTestFailed)
+			}
+			for _, failure := range tc.expectedFailures {
+				if !strings.Contains(err.Error(), failure) {
+					t.Errorf("SelfTest(_) = %v, expected it to contain %q", err, failure)
+				}
+			}
+		})
+	}
+}
+
+func TestSelfTestBypassesKeyCache(t *testing.T) {
+	client := &fakeKmsClient{key: ec256KmsKey()}
+	publicKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(kmsKeyName), ID: "kms-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithKmsClient(client), WithKeyFetchRetry(1, 0))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.SelfTest(context.Background()); err != nil {
+		t.Fatalf("SelfTest(_) = %v, expected nil", err)
+	}
+	client.errs = []error{status.Error(codes.Unavailable, "backend unavailable")}
+	if err := v.SelfTest(context.Background()); !errors.Is(err, ErrSelfTestFailed) {
+		t.Errorf("SelfTest(_) = %v, want error matching %v", err, ErrSelfTestFailed)
+	}
+	if client.calls != 2 {
+		t.Errorf("Cloud KMS called %d times, expected 2", client.calls)
+	}
+}
+
+func TestSelfTestJwksSource(t *testing.T) {
+	available := true
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(ecJwks(t, "key-1")))
+	}))
+	defer server.Close()
+	source, err := NewJwksSource(server.URL, server.Client())
+	if err != nil {
+		t.Fatalf("NewJwksSource(...) = %v, expected nil", err)
+	}
+	v, err := NewVerifier(helloAppImage, nil, WithJwksSource(source), WithKeyFetchRetry(1, 0))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.SelfTest(context.Background()); err != nil {
+		t.Errorf("SelfTest(_) = %v, expected nil", err)
+	}
+	available = false
+	if err := v.SelfTest(context.Background()); !errors.Is(err, ErrSelfTestFailed) || !strings.Contains(err.Error(), "JWKS source") {
+		t.Errorf("SelfTest(_) = %v, want error matching %v for the JWKS source", err, ErrSelfTestFailed)
+	}
+}
+
+func TestSelfTestWrappedVerifiers(t *testing.T) {
+	healthy, err := NewVerifier(helloAppImage, []PublicKey{{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	// The fake Cloud KMS client does not know this key version.
+	kmsKey := PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte("projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/2"), ID: "kms-key"}
+	unhealthy, err := NewVerifier(helloAppImage, []PublicKey{kmsKey}, WithKmsClient(&fakeKmsClient{}))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	cached, err := WrapVerifier(unhealthy, helloAppImage)
+	if err != nil {
+		t.Fatalf("WrapVerifier(...) = %v, expected nil", err)
+	}
+
+	tcs := []struct {
+		name        string
+		verifier    Verifier
+		expectedErr bool
+	}{
+		{"accepting verifier", NewInsecureAcceptingVerifier(), false},
+		{"rejecting verifier", NewAlwaysRejectingVerifier(errors.New("rejected")), false},
+		{"caching verifier", cached, true},
+		{"multi verifier requiring any", NewMultiVerifier(RequireAny, healthy, unhealthy), true},
+		{"healthy multi verifier", NewMultiVerifier(RequireAll, healthy, healthy), false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.verifier.SelfTest(context.Background())
+			if !tc.expectedErr && err != nil {
+				t.Errorf("SelfTest(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr && !errors.Is(err, ErrSelfTestFailed) {
+				t.Errorf("SelfTest(_) = %v, want error matching %v", err, ErrSelfTestFailed)
+			}
+		})
+	}
+}
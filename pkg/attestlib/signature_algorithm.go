@@ -16,11 +16,18 @@ limitations under the License.
 
 package attestlib
 
+import (
+	"fmt"
+	"strings"
+)
+
 // SignatureAlgorithm specifies the algorithm and hashing functions used to
-// sign PKIX and JWT Attestations.
+// sign PKIX, JWT, Ed25519, Ed448 and Hmac Attestations.
 type SignatureAlgorithm int
 
-// Enumeration of SignatureAlgorithm
+// Enumeration of SignatureAlgorithm. The values are part of the API, e.g.
+// they may be stored in configuration: new algorithms are appended so that the
+// values of the existing ones never change.
 const (
 	UnknownSigningAlgorithm SignatureAlgorithm = iota
 	// RSASSA-PSS 2048 bit key with a SHA256 digest.
@@ -49,8 +56,83 @@ const (
 	EcdsaP521Sha512
 	// Valid for PGP case
 	PGPUnused
+	// RSASSA-PKCS1-v1_5 with a 4096 bit key and a SHA384 digest.
+	RsaSignPkcs14096Sha384
+	// EdDSA on the Ed25519 curve, as specified in RFC 8032.
+	EddsaEd25519
+	// EdDSA on the Ed448 curve, as specified in RFC 8032.
+	EddsaEd448
+	// HMAC with a SHA256 digest, as specified in RFC 2104.
+	HmacSha256
 )
 
+// String returns a lowercase name for the SignatureAlgorithm, e.g.
+// "ecdsa_p256_sha256", suitable for configuration files and log messages.
+// Algorithms registered with RegisterSignatureHash have no name.
+func (a SignatureAlgorithm) String() string {
+	switch a {
+	case UnknownSigningAlgorithm:
+		return "unknown"
+	case RsaPss2048Sha256:
+		return "rsa_pss_2048_sha256"
+	case RsaPss3072Sha256:
+		return "rsa_pss_3072_sha256"
+	case RsaPss4096Sha256:
+		return "rsa_pss_4096_sha256"
+	case RsaPss4096Sha512:
+		return "rsa_pss_4096_sha512"
+	case RsaSignPkcs12048Sha256:
+		return "rsa_sign_pkcs1_2048_sha256"
+	case RsaSignPkcs13072Sha256:
+		return "rsa_sign_pkcs1_3072_sha256"
+	case RsaSignPkcs14096Sha256:
+		return "rsa_sign_pkcs1_4096_sha256"
+	case RsaSignPkcs14096Sha384:
+		return "rsa_sign_pkcs1_4096_sha384"
+	case RsaSignPkcs14096Sha512:
+		return "rsa_sign_pkcs1_4096_sha512"
+	case EcdsaP256Sha256:
+		return "ecdsa_p256_sha256"
+	case EcdsaP384Sha384:
+		return "ecdsa_p384_sha384"
+	case EcdsaP521Sha512:
+		return "ecdsa_p521_sha512"
+	case EddsaEd25519:
+		return "eddsa_ed25519"
+	case EddsaEd448:
+		return "eddsa_ed448"
+	case HmacSha256:
+		return "hmac_sha256"
+	case PGPUnused:
+		return "pgp_unused"
+	default:
+		return fmt.Sprintf("SignatureAlgorithm(%d)", int(a))
+	}
+}
+
+// signatureAlgorithms lists the SignatureAlgorithms that have a name.
+var signatureAlgorithms = []SignatureAlgorithm{
+	RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, RsaPss4096Sha512,
+	RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha384, RsaSignPkcs14096Sha512,
+	EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512,
+	EddsaEd25519, EddsaEd448, HmacSha256, PGPUnused,
+}
+
+// ParseSignatureAlgorithm returns the SignatureAlgorithm named `s`, e.g.
+// "ecdsa_p256_sha256" or "RSA_PSS_2048_SHA256", as found in configuration
+// files. The name is case insensitive, and
+// ParseSignatureAlgorithm(a.String()) returns a for every named algorithm.
+func ParseSignatureAlgorithm(s string) (SignatureAlgorithm, error) {
+	names := make([]string, 0, len(signatureAlgorithms))
+	for _, a := range signatureAlgorithms {
+		if strings.EqualFold(s, a.String()) {
+			return a, nil
+		}
+		names = append(names, fmt.Sprintf("%q", a.String()))
+	}
+	return UnknownSigningAlgorithm, fmt.Errorf("unknown SignatureAlgorithm %q, valid values are %s", s, strings.Join(names, ", "))
+}
+
 // AuthenticatorType specifies the transport format of the Attestation. It
 // indicates to the Verifier how to extract the appropriate information out of
 // an Attestation.
@@ -62,4 +144,69 @@ const (
 	Pgp
 	Pkix
 	Jwt
+	Ed25519
+	// Kms indicates a detached signature, as for Pkix, whose public key is
+	// held in Google Cloud KMS.
+	Kms
+	// Vault indicates a detached signature whose public key is held in the
+	// HashiCorp Vault transit engine.
+	Vault
+	// Ed448 indicates a detached signature, as for Ed25519, by an Ed448 key.
+	Ed448
+	// Hmac indicates a detached HMAC over the payload, computed with a secret
+	// shared by the signer and the Verifier. It is only meant for pipelines
+	// in which every holder of the secret is trusted.
+	Hmac
 )
+
+// String returns a lowercase name for the AuthenticatorType, suitable for
+// metric labels and log messages.
+func (t AuthenticatorType) String() string {
+	switch t {
+	case Pgp:
+		return "pgp"
+	case Pkix:
+		return "pkix"
+	case Jwt:
+		return "jwt"
+	case Ed25519:
+		return "ed25519"
+	case Kms:
+		return "kms"
+	case Vault:
+		return "vault"
+	case Ed448:
+		return "ed448"
+	case Hmac:
+		return "hmac"
+	default:
+		return "unknown"
+	}
+}
+
+// authenticatorTypes lists the known AuthenticatorTypes.
+var authenticatorTypes = []AuthenticatorType{Pgp, Pkix, Jwt, Ed25519, Kms, Vault, Ed448, Hmac}
+
+// known reports whether the AuthenticatorType is one of authenticatorTypes.
+func (t AuthenticatorType) known() bool {
+	for _, known := range authenticatorTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAuthenticatorType returns the AuthenticatorType named `s`, e.g. "pgp"
+// or "PKIX", as found in configuration files. The name is case insensitive,
+// and ParseAuthenticatorType(t.String()) returns t for every known type.
+func ParseAuthenticatorType(s string) (AuthenticatorType, error) {
+	names := make([]string, 0, len(authenticatorTypes))
+	for _, t := range authenticatorTypes {
+		if strings.EqualFold(s, t.String()) {
+			return t, nil
+		}
+		names = append(names, fmt.Sprintf("%q", t.String()))
+	}
+	return UnknownAuthenticatorType, fmt.Errorf("unknown AuthenticatorType %q, valid values are %s", s, strings.Join(names, ", "))
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAuthenticatorType(t *testing.T) {
+	tcs := []struct {
+		name        string
+		s           string
+		expected    AuthenticatorType
+		expectedErr bool
+	}{
+		{name: "pgp", s: "pgp", expected: Pgp},
+		{name: "pkix", s: "pkix", expected: Pkix},
+		{name: "jwt", s: "jwt", expected: Jwt},
+		{name: "ed25519", s: "ed25519", expected: Ed25519},
+		{name: "kms", s: "kms", expected: Kms},
+		{name: "vault", s: "vault", expected: Vault},
+		{name: "uppercase", s: "PGP", expected: Pgp},
+		{name: "mixed case", s: "Pkix", expected: Pkix},
+		{name: "unknown", s: "x509", expectedErr: true},
+		{name: "unknown type name", s: "unknown", expectedErr: true},
+		{name: "empty", s: "", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseAuthenticatorType(tc.s)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("ParseAuthenticatorType(%q) = %v, expected error", tc.s, actual)
+				} else if !strings.Contains(err.Error(), `"pkix"`) {
+					t.Errorf("ParseAuthenticatorType(%q) = %v, expected error listing valid values", tc.s, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAuthenticatorType(%q) = %v, expected nil", tc.s, err)
+			}
+			if actual != tc.expected {
+				t.Errorf("ParseAuthenticatorType(%q) = %v, want %v", tc.s, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestAuthenticatorTypeStringRoundTrip(t *testing.T) {
+	for _, authenticatorType := range authenticatorTypes {
+		actual, err := ParseAuthenticatorType(authenticatorType.String())
+		if err != nil {
+			t.Errorf("ParseAuthenticatorType(%q) = %v, expected nil", authenticatorType, err)
+			continue
+		}
+		if actual != authenticatorType {
+			t.Errorf("ParseAuthenticatorType(%q) = %v, want %v", authenticatorType, actual, authenticatorType)
+		}
+	}
+}
+
+func TestSignatureAlgorithmValues(t *testing.T) {
+	// The values of released algorithms must never change, as they may be
+	// stored in configuration.
+	tcs := []struct {
+		alg      SignatureAlgorithm
+		expected int
+	}{
+		{UnknownSigningAlgorithm, 0},
+		{RsaPss2048Sha256, 1},
+		{RsaPss3072Sha256, 2},
+		{RsaPss4096Sha256, 3},
+		{RsaPss4096Sha512, 4},
+		{RsaSignPkcs12048Sha256, 5},
+		{RsaSignPkcs13072Sha256, 6},
+		{RsaSignPkcs14096Sha256, 7},
+		{RsaSignPkcs14096Sha512, 8},
+		{EcdsaP256Sha256, 9},
+		{EcdsaP384Sha384, 10},
+		{EcdsaP521Sha512, 11},
+		{PGPUnused, 12},
+		{RsaSignPkcs14096Sha384, 13},
+		{EddsaEd25519, 14},
+		{EddsaEd448, 15},
+		{HmacSha256, 16},
+	}
+	for _, tc := range tcs {
+		if int(tc.alg) != tc.expected {
+			t.Errorf("SignatureAlgorithm %v has value %d, expected %d", tc.alg, int(tc.alg), tc.expected)
+		}
+	}
+}
+
+func TestParseSignatureAlgorithm(t *testing.T) {
+	tcs := []struct {
+		name        string
+		s           string
+		expected    SignatureAlgorithm
+		expectedErr bool
+	}{
+		{name: "rsa pss", s: "rsa_pss_2048_sha256", expected: RsaPss2048Sha256},
+		{name: "rsa pkcs1", s: "rsa_sign_pkcs1_4096_sha384", expected: RsaSignPkcs14096Sha384},
+		{name: "ecdsa", s: "ecdsa_p384_sha384", expected: EcdsaP384Sha384},
+		{name: "ed25519", s: "eddsa_ed25519", expected: EddsaEd25519},
+		{name: "hmac", s: "hmac_sha256", expected: HmacSha256},
+		{name: "pgp", s: "pgp_unused", expected: PGPUnused},
+		{name: "uppercase", s: "ECDSA_P256_SHA256", expected: EcdsaP256Sha256},
+		{name: "unknown", s: "ecdsa_p256", expectedErr: true},
+		{name: "unknown algorithm name", s: "unknown", expectedErr: true},
+		{name: "number", s: "9", expectedErr: true},
+		{name: "empty", s: "", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := ParseSignatureAlgorithm(tc.s)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("ParseSignatureAlgorithm(%q) = %v, expected error", tc.s, actual)
+				} else if !strings.Contains(err.Error(), `"ecdsa_p256_sha256"`) {
+					t.Errorf("ParseSignatureAlgorithm(%q) = %v, expected error listing valid values", tc.s, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSignatureAlgorithm(%q) = %v, expected nil", tc.s, err)
+			}
+			if actual != tc.expected {
+				t.Errorf("ParseSignatureAlgorithm(%q) = %v, want %v", tc.s, actual, tc.expected)
+			}
+		})
+	}
+}
+
+func TestSignatureAlgorithmStringRoundTrip(t *testing.T) {
+	for _, alg := range signatureAlgorithms {
+		actual, err := ParseSignatureAlgorithm(alg.String())
+		if err != nil {
+			t.Errorf("ParseSignatureAlgorithm(%q) = %v, expected nil", alg, err)
+			continue
+		}
+		if actual != alg {
+			t.Errorf("ParseSignatureAlgorithm(%q) = %v, want %v", alg, actual, alg)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// decodeSignatureEncoding returns a copy of `att` whose signatures are
+// decoded according to its SignatureEncoding. An Attestation with raw
+// signatures is returned as is.
+func decodeSignatureEncoding(att *Attestation) (*Attestation, error) {
+	if att == nil || att.SignatureEncoding == RawEncoding {
+		return att, nil
+	}
+	decoded := *att
+	decoded.SignatureEncoding = RawEncoding
+	var err error
+	if len(att.Signature) > 0 {
+		if decoded.Signature, err = decodeEncodedSignature(att.Signature, att.SignatureEncoding); err != nil {
+			return nil, err
+		}
+	}
+	if len(att.Signatures) > 0 {
+		decoded.Signatures = make([]SignatureEntry, len(att.Signatures))
+		for i, entry := range att.Signatures {
+			decoded.Signatures[i] = entry
+			if decoded.Signatures[i].Signature, err = decodeEncodedSignature(entry.Signature, att.SignatureEncoding); err != nil {
+				return nil, fmt.Errorf("signature %d: %w", i, err)
+			}
+		}
+	}
+	return &decoded, nil
+}
+
+// decodeEncodedSignature decodes a signature encoded as text with `encoding`.
+// Surrounding whitespace is ignored.
+func decodeEncodedSignature(signature []byte, encoding SignatureEncoding) ([]byte, error) {
+	text := string(bytes.TrimSpace(signature))
+	switch encoding {
+	case Base64Encoding:
+		enc := base64.RawStdEncoding
+		if bytes.ContainsAny(signature, "-_") {
+			enc = base64.RawURLEncoding
+		}
+		decoded, err := enc.DecodeString(trimBase64Padding(text))
+		if err != nil {
+			return nil, fmt.Errorf("%w: signature is not valid base64: %v", ErrSignatureInvalid, err)
+		}
+		return decoded, nil
+	case HexEncoding:
+		decoded, err := hex.DecodeString(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: signature is not valid hex: %v", ErrSignatureInvalid, err)
+		}
+		return decoded, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown signature encoding %d", ErrSignatureInvalid, encoding)
+	}
+}
+
+// trimBase64Padding removes the padding of a base64 encoded string. At most
+// two padding characters are removed, so that malformed input is still
+// rejected.
+func trimBase64Padding(text string) string {
+	for i := 0; i < 2 && len(text) > 0 && text[len(text)-1] == '='; i++ {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// decodeAttestation checks `att` against the size limits of the verifier, and
+// returns it with its signatures decoded as by decodeSignatureEncoding.
+func (v *verifier) decodeAttestation(att *Attestation) (*Attestation, error) {
+	if err := v.checkAttestationSize(att); err != nil {
+		return nil, err
+	}
+	return decodeSignatureEncoding(att)
+}
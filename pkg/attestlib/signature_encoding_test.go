@@ -0,0 +1,170 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAttestationSignatureEncoding(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed-key"}
+	// The base64 encodings of a 64 byte signature are padded. This one also
+	// differs between the standard and the URL-safe alphabet.
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	if !strings.ContainsAny(base64.StdEncoding.EncodeToString(signature), "+/") {
+		t.Fatalf("test signature %x has no characters specific to the standard base64 alphabet", signature)
+	}
+
+	tcs := []struct {
+		name        string
+		signature   string
+		encoding    SignatureEncoding
+		expectedErr error
+	}{
+		{
+			name:      "raw",
+			signature: string(signature),
+			encoding:  RawEncoding,
+		},
+		{
+			name:      "padded base64",
+			signature: base64.StdEncoding.EncodeToString(signature),
+			encoding:  Base64Encoding,
+		},
+		{
+			name:      "unpadded base64",
+			signature: base64.RawStdEncoding.EncodeToString(signature),
+			encoding:  Base64Encoding,
+		},
+		{
+			name:      "padded URL-safe base64",
+			signature: base64.URLEncoding.EncodeToString(signature),
+			encoding:  Base64Encoding,
+		},
+		{
+			name:      "unpadded URL-safe base64",
+			signature: base64.RawURLEncoding.EncodeToString(signature),
+			encoding:  Base64Encoding,
+		},
+		{
+			name:      "base64 with surrounding whitespace",
+			signature: " " + base64.StdEncoding.EncodeToString(signature) + "\n",
+			encoding:  Base64Encoding,
+		},
+		{
+			name:      "lower case hex",
+			signature: hex.EncodeToString(signature),
+			encoding:  HexEncoding,
+		},
+		{
+			name:      "upper case hex",
+			signature: strings.ToUpper(hex.EncodeToString(signature)),
+			encoding:  HexEncoding,
+		},
+		{
+			name:        "invalid base64",
+			signature:   "not*base64",
+			encoding:    Base64Encoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "base64 with excess padding",
+			signature:   base64.RawStdEncoding.EncodeToString(signature) + "===",
+			encoding:    Base64Encoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "invalid hex",
+			signature:   "0g",
+			encoding:    HexEncoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "odd length hex",
+			signature:   hex.EncodeToString(signature)[1:],
+			encoding:    HexEncoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "base64 signature verified as raw",
+			signature:   base64.StdEncoding.EncodeToString(signature),
+			encoding:    RawEncoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "hex signature verified as base64",
+			signature:   hex.EncodeToString(signature),
+			encoding:    Base64Encoding,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unknown encoding",
+			signature:   string(signature),
+			encoding:    SignatureEncoding(42),
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "ed-key", Signature: []byte(tc.signature), SignatureEncoding: tc.encoding, SerializedPayload: []byte(validPayload)}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if string(att.Signature) != tc.signature {
+				t.Errorf("VerifyAttestation(_) modified the attestation's signature")
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationSignatureEncodingOfSignatures(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{
+		Signatures: []SignatureEntry{
+			{PublicKeyID: "other-key", Signature: []byte(hex.EncodeToString([]byte("other signature")))},
+			{PublicKeyID: "ed-key", Signature: []byte(hex.EncodeToString(signature))},
+		},
+		SignatureEncoding: HexEncoding,
+		SerializedPayload: []byte(validPayload),
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	att.Signatures[0].Signature = []byte("not hex")
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrSignatureInvalid)
+	}
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto"
+	// Link the hash functions of the built-in signature algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// signatureHashes maps the RSA and ECDSA signature algorithms to the hash
+// function their signatures are computed over.
+var signatureHashes = map[SignatureAlgorithm]crypto.Hash{
+	RsaSignPkcs12048Sha256: crypto.SHA256,
+	RsaSignPkcs13072Sha256: crypto.SHA256,
+	RsaSignPkcs14096Sha256: crypto.SHA256,
+	RsaSignPkcs14096Sha384: crypto.SHA384,
+	RsaSignPkcs14096Sha512: crypto.SHA512,
+	RsaPss2048Sha256:       crypto.SHA256,
+	RsaPss3072Sha256:       crypto.SHA256,
+	RsaPss4096Sha256:       crypto.SHA256,
+	RsaPss4096Sha512:       crypto.SHA512,
+	EcdsaP256Sha256:        crypto.SHA256,
+	EcdsaP384Sha384:        crypto.SHA384,
+	EcdsaP521Sha512:        crypto.SHA512,
+}
+
+// registeredAlgorithm is a signature algorithm added with
+// RegisterSignatureHash.
+type registeredAlgorithm struct {
+	// base is the built-in algorithm whose signing scheme and key
+	// requirements the algorithm shares.
+	base SignatureAlgorithm
+	hash crypto.Hash
+}
+
+// FirstRegisteredSignatureAlgorithm is the lowest value that
+// RegisterSignatureHash accepts. Values below it are reserved for the
+// built-in signature algorithms, so that appending new built-in algorithms
+// never collides with a registered one.
+const FirstRegisteredSignatureAlgorithm SignatureAlgorithm = 1 << 16
+
+var (
+	registeredAlgorithmsMu sync.RWMutex
+	registeredAlgorithms   = map[SignatureAlgorithm]registeredAlgorithm{}
+)
+
+// RegisterSignatureHash adds the PKIX signature algorithm `alg`, whose
+// signatures are created like those of `base`, one of the RSA or ECDSA
+// signature algorithms, but over a digest computed with `hash`. For example,
+// it lets PKIX keys verify RSA-PSS signatures over SHA3-256 digests:
+//
+//	const RsaPss2048Sha3256 = attestlib.FirstRegisteredSignatureAlgorithm
+//	err := attestlib.RegisterSignatureHash(RsaPss2048Sha3256, attestlib.RsaPss2048Sha256, crypto.SHA3_256)
+//
+// `alg` can then be used as the SignatureAlgorithm of PKIX public keys and
+// Attestations. It must be at least FirstRegisteredSignatureAlgorithm and not
+// already registered, and the package implementing `hash` must be linked into the binary.
+// RegisterSignatureHash is meant to be called during initialization, before
+// any Verifier uses `alg`. Signers do not support registered algorithms.
+func RegisterSignatureHash(alg, base SignatureAlgorithm, hash crypto.Hash) error {
+	if _, ok := signatureHashes[base]; !ok {
+		return fmt.Errorf("signature algorithm %v is not an RSA or ECDSA signature algorithm", base)
+	}
+	if !hash.Available() {
+		return fmt.Errorf("hash function %v is not available", hash)
+	}
+	if alg < FirstRegisteredSignatureAlgorithm {
+		return fmt.Errorf("signature algorithm %v is reserved for built-in signature algorithms", alg)
+	}
+	registeredAlgorithmsMu.Lock()
+	defer registeredAlgorithmsMu.Unlock()
+	if _, ok := registeredAlgorithms[alg]; ok {
+		return fmt.Errorf("signature algorithm %v is already registered", alg)
+	}
+	registeredAlgorithms[alg] = registeredAlgorithm{base: base, hash: hash}
+	return nil
+}
+
+// resolveSignatureAlgorithm returns the built-in RSA or ECDSA algorithm whose
+// signing scheme `alg` uses, and the hash function of `alg`. It fails if
+// `alg` is neither a built-in RSA or ECDSA algorithm nor registered.
+func resolveSignatureAlgorithm(alg SignatureAlgorithm) (SignatureAlgorithm, crypto.Hash, error) {
+	if hash, ok := signatureHashes[alg]; ok {
+		return alg, hash, nil
+	}
+	registeredAlgorithmsMu.RLock()
+	defer registeredAlgorithmsMu.RUnlock()
+	if registered, ok := registeredAlgorithms[alg]; ok {
+		return registered.base, registered.hash, nil
+	}
+	return UnknownSigningAlgorithm, 0, errors.New("invalid signature algorithm")
+}
+
+// baseSignatureAlgorithm returns the built-in algorithm that the registered
+// algorithm `alg` is based on, or `alg` itself if it is not registered.
+func baseSignatureAlgorithm(alg SignatureAlgorithm) SignatureAlgorithm {
+	if base, _, err := resolveSignatureAlgorithm(alg); err == nil {
+		return base
+	}
+	return alg
+}
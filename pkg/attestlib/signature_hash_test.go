@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"testing"
+)
+
+// Signature algorithms registered for the tests, over digests that no built-in
+// algorithm uses.
+const (
+	ecdsaP256Sha224 = FirstRegisteredSignatureAlgorithm + iota
+	rsaPss2048Sha512_256
+)
+
+func init() {
+	if err := RegisterSignatureHash(ecdsaP256Sha224, EcdsaP256Sha256, crypto.SHA224); err != nil {
+		panic(err)
+	}
+	if err := RegisterSignatureHash(rsaPss2048Sha512_256, RsaPss2048Sha256, crypto.SHA512_256); err != nil {
+		panic(err)
+	}
+}
+
+func TestVerifyAttestationRegisteredSignatureHash(t *testing.T) {
+	ecKey, err := parsePkixPrivateKeyPem([]byte(ec256PrivateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	rsaKey, err := parsePkixPrivateKeyPem([]byte(rsa2048PrivateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	sha224Digest := sha256.Sum224([]byte(validPayload))
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecKey.(*ecdsa.PrivateKey), sha224Digest[:])
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	truncatedSha512Digest := sha512.Sum512_256([]byte(validPayload))
+	rsaSignature, err := rsa.SignPSS(rand.Reader, rsaKey.(*rsa.PrivateKey), crypto.SHA512_256, truncatedSha512Digest[:], nil)
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+
+	tcs := []struct {
+		name        string
+		publicKey   PublicKey
+		signature   []byte
+		expectedErr error
+	}{
+		{
+			name:      "ECDSA signature over a SHA-224 digest",
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: ecdsaP256Sha224, KeyData: []byte(ec256PubKey), ID: "pkix-key"},
+			signature: ecSignature,
+		},
+		{
+			name:      "RSA-PSS signature over a SHA-512/256 digest",
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: rsaPss2048Sha512_256, KeyData: []byte(rsa2048PubKey), ID: "pkix-key"},
+			signature: rsaSignature,
+		},
+		{
+			name:        "SHA-224 signature verified with the base algorithm",
+			publicKey:   PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "pkix-key"},
+			signature:   ecSignature,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "SHA-512/256 signature verified with another registered algorithm",
+			publicKey:   PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: ecdsaP256Sha224, KeyData: []byte(ec256PubKey), ID: "pkix-key"},
+			signature:   rsaSignature,
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey})
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: "pkix-key", Signature: tc.signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRegisteredSignatureHashKeyMismatch(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: ecdsaP256Sha224, KeyData: []byte(rsa2048PubKey), ID: "pkix-key"}
+	if _, err := NewVerifier(helloAppImage, []PublicKey{publicKey}); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+	}
+}
+
+func TestRegisterSignatureHashErrors(t *testing.T) {
+	tcs := []struct {
+		name string
+		alg  SignatureAlgorithm
+		base SignatureAlgorithm
+		hash crypto.Hash
+	}{
+		{"built-in algorithm", RsaPss4096Sha256, RsaPss2048Sha256, crypto.SHA224},
+		{"below the registered range", FirstRegisteredSignatureAlgorithm - 1, RsaPss2048Sha256, crypto.SHA224},
+		{"already registered", ecdsaP256Sha224, EcdsaP256Sha256, crypto.SHA224},
+		{"base is not RSA or ECDSA", FirstRegisteredSignatureAlgorithm + 1000, EddsaEd25519, crypto.SHA224},
+		{"base is registered", FirstRegisteredSignatureAlgorithm + 1000, ecdsaP256Sha224, crypto.SHA224},
+		{"unavailable hash", FirstRegisteredSignatureAlgorithm + 1000, EcdsaP256Sha256, crypto.Hash(0)},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := RegisterSignatureHash(tc.alg, tc.base, tc.hash); err == nil {
+				t.Errorf("RegisterSignatureHash(%v, %v, %v) = nil, expected non nil", tc.alg, tc.base, tc.hash)
+			}
+		})
+	}
+}
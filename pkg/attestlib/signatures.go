@@ -0,0 +1,147 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SignatureEntry is one of several signatures over the payload of an
+// Attestation, e.g. by different signers.
+type SignatureEntry struct {
+	// PublicKeyID is the ID of the public key that can verify Signature.
+	PublicKeyID string
+	// Signature stores the signature content, as described for
+	// Attestation.Signature.
+	Signature []byte
+}
+
+// SignatureResult is the outcome of verifying one signature of an
+// Attestation.
+type SignatureResult struct {
+	// PublicKeyID is the public key ID the signature names.
+	PublicKeyID string
+	// KeyID is the ID of the public key that verified the signature. It is
+	// empty if the signature could not be verified.
+	KeyID string
+	// KeyType is the AuthenticatorType of the public key that verified the
+	// signature.
+	KeyType AuthenticatorType
+	// Err is the reason the signature could not be verified, or nil if it
+	// was verified.
+	Err error
+}
+
+// signatureEntries returns the signatures of an Attestation. An Attestation
+// without Signatures has a single signature, Signature by PublicKeyID.
+func (att *Attestation) signatureEntries() []SignatureEntry {
+	if len(att.Signatures) > 0 {
+		return att.Signatures
+	}
+	return []SignatureEntry{{PublicKeyID: att.PublicKeyID, Signature: att.Signature}}
+}
+
+// verifiedKeyIDs returns the distinct IDs of the public keys that verified one
+// of `signatures`, or `keyID` if the Attestation had no signature results.
+func verifiedKeyIDs(keyID string, signatures []SignatureResult) []string {
+	if len(signatures) == 0 {
+		return []string{keyID}
+	}
+	var keyIDs []string
+	for _, signature := range signatures {
+		if signature.Err == nil && !containsString(keyIDs, signature.KeyID) {
+			keyIDs = append(keyIDs, signature.KeyID)
+		}
+	}
+	return keyIDs
+}
+
+// verifySignatures verifies each signature of an Attestation that is not
+// wrapped in an envelope, and returns the payload that was signed, the public
+// key that verified the first verified signature, and the result of every
+// signature. It fails unless at least one signature is verified. All verified
+// signatures must sign the same payload.
+func (v *verifier) verifySignatures(ctx context.Context, att *Attestation) ([]byte, PublicKey, []SignatureResult, error) {
+	if len(att.Signatures) > 0 && (att.PublicKeyID != "" || len(att.Signature) != 0) {
+		return nil, PublicKey{}, nil, errors.New("attestation has both Signatures and a PublicKeyID or Signature")
+	}
+	entries := att.signatureEntries()
+	results := make([]SignatureResult, len(entries))
+	var payload []byte
+	var verifiedKey PublicKey
+	verified := 0
+	for i, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, PublicKey{}, nil, err
+		}
+		results[i].PublicKeyID = entry.PublicKeyID
+		signed, publicKey, err := v.verifySignatureEntry(ctx, att, entry)
+		if err == nil && verified > 0 && !bytes.Equal(signed, payload) {
+			err = fmt.Errorf("%w: signature %d signs a different payload than the signatures before it", ErrSignatureInvalid, i)
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].KeyID = publicKey.ID
+		results[i].KeyType = publicKey.AuthenticatorType
+		if verified == 0 {
+			payload, verifiedKey = signed, publicKey
+		}
+		verified++
+	}
+	if verified > 0 {
+		return payload, verifiedKey, results, nil
+	}
+	if len(results) == 1 {
+		return nil, PublicKey{}, nil, results[0].Err
+	}
+	var failures []string
+	for i, result := range results[1:] {
+		failures = append(failures, fmt.Sprintf("signature %d: %v", i+1, result.Err))
+	}
+	return nil, PublicKey{}, nil, fmt.Errorf("none of the %d signatures was verified, signature 0: %w; %s", len(results), results[0].Err, strings.Join(failures, "; "))
+}
+
+// verifySignatureEntry verifies one signature of an Attestation with the
+// public keys matching its PublicKeyID, and returns the payload that was
+// signed and the public key that verified it.
+func (v *verifier) verifySignatureEntry(ctx context.Context, att *Attestation, entry SignatureEntry) ([]byte, PublicKey, error) {
+	if entry.PublicKeyID != "" && v.isRevoked(entry.PublicKeyID) {
+		return nil, PublicKey{}, fmt.Errorf("%w: %q", ErrKeyRevoked, entry.PublicKeyID)
+	}
+	single := *att
+	single.PublicKeyID = entry.PublicKeyID
+	single.Signature = entry.Signature
+	single.Signatures = nil
+	payload, publicKey, err := v.verifyBareSignature(ctx, &single)
+	if err != nil {
+		return nil, PublicKey{}, err
+	}
+	if err := v.checkKeyIdentity(entry.PublicKeyID, publicKey); err != nil {
+		return nil, PublicKey{}, err
+	}
+	if err := publicKey.checkValidityPeriod(v.currentTime()); err != nil {
+		return nil, PublicKey{}, err
+	}
+	return payload, publicKey, nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// multiSignatureVerifier returns a Verifier with an Ed25519 key and an ECDSA
+// key, and the signatures of both keys over validPayload.
+func multiSignatureVerifier(t *testing.T, opts ...VerifierOption) (Verifier, []byte, []byte) {
+	t.Helper()
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"},
+	}
+	v, err := NewVerifier(helloAppImage, publicKeys, opts...)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "ec-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	ecAtt, err := signer.CreateAttestation([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	return v, ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), ecAtt.Signature
+}
+
+func TestVerifyAttestationMultipleSignatures(t *testing.T) {
+	v, edSignature, ecSignature := multiSignatureVerifier(t)
+	otherSignature := ed25519.Sign(ed25519PrivateKey, []byte("other payload"))
+	tcs := []struct {
+		name           string
+		signatures     []SignatureEntry
+		expectedKeyIDs []string
+		// expectedErrs holds the error each signature's result must match.
+		expectedErrs []error
+		expectedErr  error
+	}{
+		{
+			name: "two valid signatures",
+			signatures: []SignatureEntry{
+				{PublicKeyID: "ed25519-key", Signature: edSignature},
+				{PublicKeyID: "ec-key", Signature: ecSignature},
+			},
+			expectedKeyIDs: []string{"ed25519-key", "ec-key"},
+			expectedErrs:   []error{nil, nil},
+		},
+		{
+			name: "valid and invalid signature",
+			signatures: []SignatureEntry{
+				{PublicKeyID: "ed25519-key", Signature: otherSignature},
+				{PublicKeyID: "ec-key", Signature: ecSignature},
+			},
+			expectedKeyIDs: []string{"ec-key"},
+			expectedErrs:   []error{ErrSignatureInvalid, nil},
+		},
+		{
+			name: "valid signature and unknown key",
+			signatures: []SignatureEntry{
+				{PublicKeyID: "ed25519-key", Signature: edSignature},
+				{PublicKeyID: "unknown-key", Signature: ecSignature},
+			},
+			expectedKeyIDs: []string{"ed25519-key"},
+			expectedErrs:   []error{nil, ErrNoMatchingKey},
+		},
+		{
+			name: "same key twice",
+			signatures: []SignatureEntry{
+				{PublicKeyID: "ed25519-key", Signature: edSignature},
+				{PublicKeyID: "ed25519-key", Signature: edSignature},
+			},
+			expectedKeyIDs: []string{"ed25519-key"},
+			expectedErrs:   []error{nil, nil},
+		},
+		{
+			name: "no valid signature",
+			signatures: []SignatureEntry{
+				{PublicKeyID: "ed25519-key", Signature: otherSignature},
+				{PublicKeyID: "ec-key", Signature: edSignature},
+			},
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att := &Attestation{Signatures: tc.signatures, SerializedPayload: []byte(validPayload)}
+			result, err := v.VerifyAttestationWithResult(att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if got := result.VerifiedKeyIDs(); !reflect.DeepEqual(got, tc.expectedKeyIDs) {
+				t.Errorf("VerifiedKeyIDs() = %v, expected %v", got, tc.expectedKeyIDs)
+			}
+			if result.KeyID != tc.expectedKeyIDs[0] {
+				t.Errorf("KeyID = %q, expected %q", result.KeyID, tc.expectedKeyIDs[0])
+			}
+			if len(result.Signatures) != len(tc.signatures) {
+				t.Fatalf("got %d signature results, expected %d", len(result.Signatures), len(tc.signatures))
+			}
+			for i, signature := range result.Signatures {
+				if signature.PublicKeyID != tc.signatures[i].PublicKeyID {
+					t.Errorf("Signatures[%d].PublicKeyID = %q, expected %q", i, signature.PublicKeyID, tc.signatures[i].PublicKeyID)
+				}
+				if expected := tc.expectedErrs[i]; expected == nil && signature.Err != nil {
+					t.Errorf("Signatures[%d].Err = %v, expected nil", i, signature.Err)
+				} else if expected != nil && !errors.Is(signature.Err, expected) {
+					t.Errorf("Signatures[%d].Err = %v, want error matching %v", i, signature.Err, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationLegacySignature(t *testing.T) {
+	v, edSignature, _ := multiSignatureVerifier(t)
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: edSignature, SerializedPayload: []byte(validPayload)}
+	result, err := v.VerifyAttestationWithResult(att)
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	expected := []SignatureResult{{PublicKeyID: "ed25519-key", KeyID: "ed25519-key", KeyType: Ed25519}}
+	if !reflect.DeepEqual(result.Signatures, expected) {
+		t.Errorf("Signatures = %+v, expected %+v", result.Signatures, expected)
+	}
+}
+
+func TestVerifyAttestationMultipleSignaturesInvalid(t *testing.T) {
+	v, edSignature, ecSignature := multiSignatureVerifier(t, WithRevokedKeys("ec-key"))
+	tcs := []struct {
+		name string
+		att  *Attestation
+	}{
+		{
+			name: "signatures and legacy signature",
+			att: &Attestation{
+				PublicKeyID:       "ed25519-key",
+				Signature:         edSignature,
+				Signatures:        []SignatureEntry{{PublicKeyID: "ed25519-key", Signature: edSignature}},
+				SerializedPayload: []byte(validPayload),
+			},
+		},
+		{
+			name: "signatures in a DSSE envelope",
+			att: &Attestation{
+				Signatures:   []SignatureEntry{{PublicKeyID: "ed25519-key", Signature: edSignature}},
+				EnvelopeType: Dsse,
+			},
+		},
+		{
+			name: "only signature is by a revoked key",
+			att: &Attestation{
+				Signatures:        []SignatureEntry{{PublicKeyID: "ec-key", Signature: ecSignature}},
+				SerializedPayload: []byte(validPayload),
+			},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := v.VerifyAttestation(tc.att); err == nil {
+				t.Errorf("VerifyAttestation(_) = nil, expected non nil")
+			}
+		})
+	}
+}
+
+func TestVerifyQuorumMultipleSignatures(t *testing.T) {
+	v, edSignature, ecSignature := multiSignatureVerifier(t)
+	att := &Attestation{
+		Signatures: []SignatureEntry{
+			{PublicKeyID: "ed25519-key", Signature: edSignature},
+			{PublicKeyID: "ec-key", Signature: ecSignature},
+		},
+		SerializedPayload: []byte(validPayload),
+	}
+	if err := v.VerifyQuorum([]*Attestation{att}, 2); err != nil {
+		t.Errorf("VerifyQuorum(_, 2) = %v, expected nil", err)
+	}
+	if err := v.VerifyQuorum([]*Attestation{att}, 3); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("VerifyQuorum(_, 3) = %v, want error matching %v", err, ErrQuorumNotMet)
+	}
+}
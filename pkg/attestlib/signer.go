@@ -16,7 +16,11 @@ limitations under the License.
 
 package attestlib
 
-import "errors"
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
 
 // Signer contains methods to create a signed Attestation.
 type Signer interface {
@@ -27,6 +31,47 @@ type Signer interface {
 	CreateAttestation(payload []byte) (*Attestation, error)
 }
 
+// CreateImageAttestation creates an Attestation for `image` using `signer`.
+// `image` must be a fully qualified image name with a digest. The payload is
+// serialized in the Atomic Host signature format with the current time as its
+// timestamp, so the Attestation can be verified by a Verifier created for the
+// same image.
+func CreateImageAttestation(signer Signer, image string) (*Attestation, error) {
+	imageName, imageDigest, err := parseImageName(image)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid image name")
+	}
+	payload, err := newAtomicContainerPayload(imageName, imageDigest, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return signer.CreateAttestation(payload)
+}
+
+type canonicalSigner struct {
+	signer        Signer
+	rejectNonJSON bool
+}
+
+// NewCanonicalSigner creates a Signer that canonicalizes JSON payloads with
+// Canonicalize before signing them with `signer`, which makes signatures
+// reproducible across implementations. Payloads that are not JSON, such as
+// the serialized tokens passed to a JWT Signer, are signed as is, unless
+// `rejectNonJSON` is set.
+func NewCanonicalSigner(signer Signer, rejectNonJSON bool) Signer {
+	return &canonicalSigner{signer: signer, rejectNonJSON: rejectNonJSON}
+}
+
+// CreateAttestation creates an Attestation over the canonical form of
+// `payload`. See Signer for more details.
+func (s *canonicalSigner) CreateAttestation(payload []byte) (*Attestation, error) {
+	payload, err := canonicalizePayload(payload, s.rejectNonJSON)
+	if err != nil {
+		return nil, err
+	}
+	return s.signer.CreateAttestation(payload)
+}
+
 type jwtSigner struct {
 	PrivateKey         []byte
 	PublicKeyID        string
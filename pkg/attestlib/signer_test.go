@@ -0,0 +1,189 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const otherHelloAppDigest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+
+func TestCreateImageAttestation(t *testing.T) {
+	pkixSigner, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, "pkix-key")
+	if err != nil {
+		t.Fatalf("error creating PKIX signer: %v", err)
+	}
+	ed25519Signer, err := NewEd25519Signer(ed25519PrivateKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating Ed25519 signer: %v", err)
+	}
+	tcs := []struct {
+		name      string
+		signer    Signer
+		publicKey PublicKey
+	}{
+		{
+			name:      "pkix round trip",
+			signer:    pkixSigner,
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "pkix-key"},
+		},
+		{
+			name:      "ed25519 round trip",
+			signer:    ed25519Signer,
+			publicKey: PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			att, err := CreateImageAttestation(tc.signer, helloAppImage)
+			if err != nil {
+				t.Fatalf("CreateImageAttestation(...) = %v, expected nil", err)
+			}
+			if att.PublicKeyID != tc.publicKey.ID {
+				t.Errorf("PublicKeyID = %q, expected %q", att.PublicKeyID, tc.publicKey.ID)
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey})
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			if err := v.VerifyAttestation(att); err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+
+			// Altering the digest after signing must invalidate the signature.
+			digest := []byte(helloAppImage[len(helloAppImage)-len(otherHelloAppDigest):])
+			att.SerializedPayload = bytes.Replace(att.SerializedPayload, digest, []byte(otherHelloAppDigest), 1)
+			if err := v.VerifyAttestation(att); !errors.Is(err, ErrSignatureInvalid) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrSignatureInvalid)
+			}
+		})
+	}
+}
+
+func TestCreateImageAttestationInvalidImage(t *testing.T) {
+	signer, err := NewEd25519Signer(ed25519PrivateKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating Ed25519 signer: %v", err)
+	}
+	if _, err := CreateImageAttestation(signer, "gcr.io/google-samples/hello-app:latest"); err == nil {
+		t.Errorf("CreateImageAttestation(...) = nil, expected non nil")
+	}
+}
+
+func TestCreateImageAttestationSha512Digest(t *testing.T) {
+	signer, err := NewEd25519Signer(ed25519PrivateKey, "ed25519-key")
+	if err != nil {
+		t.Fatalf("error creating Ed25519 signer: %v", err)
+	}
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	sha512Image := "gcr.io/google-samples/hello-app@sha512:" + strings.Repeat("ab", 64)
+	att, err := CreateImageAttestation(signer, sha512Image)
+	if err != nil {
+		t.Fatalf("CreateImageAttestation(...) = %v, expected nil", err)
+	}
+	v, err := NewVerifier(sha512Image, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+
+	// An Attestation for the sha256 digest of an image cannot verify its
+	// sha512 digest.
+	v, err = NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	var mismatch *DigestAlgorithmMismatchError
+	if err := v.VerifyAttestation(att); !errors.As(err, &mismatch) {
+		t.Errorf("VerifyAttestation(_) = %v, want *DigestAlgorithmMismatchError", err)
+	}
+}
+
+func TestNewEd25519Signer(t *testing.T) {
+	tcs := []struct {
+		name        string
+		privateKey  []byte
+		publicKeyID string
+		expectedID  string
+		expectErr   bool
+	}{
+		{
+			name:        "private key with id",
+			privateKey:  ed25519PrivateKey,
+			publicKeyID: "ed25519-key",
+			expectedID:  "ed25519-key",
+		},
+		{
+			name:        "seed with id",
+			privateKey:  ed25519PrivateKey.Seed(),
+			publicKeyID: "ed25519-key",
+			expectedID:  "ed25519-key",
+		},
+		{
+			name:       "generated id",
+			privateKey: ed25519PrivateKey,
+			expectedID: ed25519PubKeyID(t),
+		},
+		{
+			name:       "truncated key",
+			privateKey: ed25519PrivateKey[:16],
+			expectErr:  true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, err := NewEd25519Signer(tc.privateKey, tc.publicKeyID)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("NewEd25519Signer(...) = nil, expected non nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewEd25519Signer(...) = %v, expected nil", err)
+			}
+			att, err := signer.CreateAttestation([]byte(validPayload))
+			if err != nil {
+				t.Fatalf("CreateAttestation(...) = %v, expected nil", err)
+			}
+			if att.PublicKeyID != tc.expectedID {
+				t.Errorf("PublicKeyID = %q, expected %q", att.PublicKeyID, tc.expectedID)
+			}
+			if err := (ed25519VerifierImpl{}).verifyEd25519(att.Signature, att.SerializedPayload, PublicKey{KeyData: ed25519PubKey}); err != nil {
+				t.Errorf("verifyEd25519(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func ed25519PubKeyID(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(ed25519PubKey)
+	if err != nil {
+		t.Fatalf("error marshaling public key: %v", err)
+	}
+	dgst := sha256.Sum256(der)
+	return "ni:///sha-256;" + base64.RawURLEncoding.EncodeToString(dgst[:])
+}
@@ -0,0 +1,465 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SigstoreBundle holds what is needed to verify a keyless Attestation signed
+// with an ephemeral certificate issued by Fulcio: the certificate, and the
+// Rekor transparency log entry recording the signature.
+type SigstoreBundle struct {
+	// Certificate is the PEM-encoded signing certificate, optionally followed
+	// by the intermediate certificates that chain it to a Fulcio root.
+	Certificate []byte
+	// RekorEntry is the Rekor entry of the Attestation's signature.
+	RekorEntry RekorEntry
+}
+
+// RekorEntry is a Rekor transparency log entry together with the signed entry
+// timestamp (SET) by which Rekor promises to include it in the log.
+type RekorEntry struct {
+	// Body is the entry as stored in the log: a hashedrekord recording the
+	// hash of the payload, the signature and the signing certificate.
+	Body []byte
+	// IntegratedTime is the time at which Rekor added the entry, in
+	// seconds since the Unix epoch.
+	IntegratedTime int64
+	// LogIndex is the index of the entry in the log.
+	LogIndex int64
+	// LogID is the hex encoded SHA-256 hash of the DER encoded public key
+	// of the log.
+	LogID string
+	// SignedEntryTimestamp is the signature of the log over the canonical
+	// JSON encoding of Body, IntegratedTime, LogID and LogIndex.
+	SignedEntryTimestamp []byte
+	// InclusionProof proves that the entry is included in the log. It is
+	// required: the SignedEntryTimestamp only promises that the entry will
+	// be included, so a log that signs it but never publishes the entry
+	// could hide a signature from the monitors of the log.
+	InclusionProof *InclusionProof
+}
+
+// InclusionProof is an RFC 6962 Merkle inclusion proof of a Rekor entry in a
+// tree whose size and root hash are attested by a signed checkpoint.
+type InclusionProof struct {
+	// LogIndex is the index of the entry in the tree.
+	LogIndex int64
+	// TreeSize is the number of entries in the tree.
+	TreeSize int64
+	// RootHash is the root hash of the tree.
+	RootHash []byte
+	// Hashes are the hashes of the inclusion path, from the leaf upwards.
+	Hashes [][]byte
+	// Checkpoint is the signed note in which the log commits to TreeSize and
+	// RootHash.
+	Checkpoint string
+}
+
+// sigstoreConfig holds the trust roots for SigstoreBundles.
+type sigstoreConfig struct {
+	// fulcioRoots are the roots that signing certificates must chain to.
+	fulcioRoots *x509.CertPool
+	// rekorPublicKey is the PEM or DER encoded public key of the Rekor log,
+	// as passed to WithSigstore.
+	rekorPublicKey []byte
+	// issuer is the OIDC issuer that must have authenticated the signer, as
+	// recorded by Fulcio in the signing certificate.
+	issuer string
+	// identities are the certificate identities, email addresses or URIs,
+	// allowed to sign Attestations. If empty, any identity is allowed, which
+	// NewVerifier only permits with WithInsecureAnySigstoreIdentity.
+	identities []string
+
+	// The following fields are set by NewVerifier.
+	rekorKey       crypto.PublicKey
+	rekorAlgorithm SignatureAlgorithm
+	rekorLogID     string
+}
+
+// Fulcio records the OIDC issuer that authenticated the signer in an extension
+// of the signing certificate: DER encoded in current certificates, and as the
+// raw string in the deprecated extension of older ones.
+var (
+	oidFulcioIssuer       = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+	oidFulcioIssuerLegacy = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+)
+
+// checkConfig checks that the config restricts the signers of Attestations
+// to an OIDC issuer and, unless `anyIdentity` is set, to allowed identities.
+func (c *sigstoreConfig) checkConfig(anyIdentity bool) error {
+	if c.issuer == "" {
+		return errors.New("sigstore requires the OIDC issuer of signing certificates")
+	}
+	if len(c.identities) == 0 && !anyIdentity {
+		return errors.New("sigstore requires at least one allowed certificate identity, or WithInsecureAnySigstoreIdentity")
+	}
+	return nil
+}
+
+// parseRekorKey parses the Rekor public key of the config and derives the ID
+// of the log from it.
+func (c *sigstoreConfig) parseRekorKey() error {
+	der := c.rekorPublicKey
+	if block, _ := pem.Decode(c.rekorPublicKey); block != nil {
+		der = block.Bytes
+	}
+	pub, err := parsePkixPublicKey(c.rekorPublicKey)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Rekor public key")
+	}
+	key, err := newPkixPublicKey(pub, der, c.rekorPublicKey)
+	if err != nil {
+		return errors.Wrap(err, "error parsing Rekor public key")
+	}
+	logID := sha256.Sum256(der)
+	c.rekorKey = pub
+	c.rekorAlgorithm = key.SignatureAlgorithm
+	c.rekorLogID = hex.EncodeToString(logID[:])
+	return nil
+}
+
+// hashedRekord is the subset of a Rekor hashedrekord entry body that binds
+// the entry to an Attestation.
+type hashedRekord struct {
+	Kind string `json:"kind"`
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   []byte `json:"content"`
+			PublicKey struct {
+				Content []byte `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// verifySigstoreBundle verifies an Attestation signed with the certificate of
+// its SigstoreBundle, and returns the payload that was signed and a public key
+// for the certificate whose ID is the certificate's identity. With key identity
+// matching, the Attestation's PublicKeyID must be that identity or the SPKI
+// fingerprint of the certificate's key.
+func (v *verifier) verifySigstoreBundle(ctx context.Context, att *Attestation) ([]byte, PublicKey, error) {
+	if v.sigstore == nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: attestation carries a sigstore bundle, but no sigstore trust roots are configured", ErrUnsupportedKeyType)
+	}
+	bundle := att.SigstoreBundle
+	entry := bundle.RekorEntry
+	if err := v.sigstore.verifySignedEntryTimestamp(entry); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrTransparencyLogInvalid, err)
+	}
+	if entry.InclusionProof == nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: entry has no inclusion proof", ErrTransparencyLogInvalid)
+	}
+	if err := v.sigstore.verifyInclusionProof(entry); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrTransparencyLogInvalid, err)
+	}
+
+	chain, err := parsePkixCertificateChain(bundle.Certificate)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrCertificateNotTrusted, err)
+	}
+	// Fulcio certificates expire minutes after they are issued, so they are
+	// checked at the time the signature was logged rather than now.
+	opts := x509.VerifyOptions{
+		Roots:         v.sigstore.fulcioRoots,
+		Intermediates: chain.intermediates,
+		CurrentTime:   time.Unix(entry.IntegratedTime, 0),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	if _, err := chain.leaf.Verify(opts); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: signing certificate: %v", ErrCertificateNotTrusted, err)
+	}
+	if err := v.sigstore.checkIssuer(chain.leaf); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrCertificateNotTrusted, err)
+	}
+	identity, err := v.sigstore.checkIdentity(chain.leaf)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrCertificateNotTrusted, err)
+	}
+
+	signature := att.Signature
+	if v.cosignCompatibility {
+		signature = decodeCosignSignature(signature)
+	}
+	if err := checkRekorBody(entry.Body, signature, att.SerializedPayload, chain.leaf); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrTransparencyLogInvalid, err)
+	}
+
+	publicKey, err := newPkixPublicKey(chain.leaf.PublicKey, chain.leaf.RawSubjectPublicKeyInfo, bundle.Certificate)
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: signing certificate: %v", ErrUnsupportedKeyType, err)
+	}
+	publicKey.ID = identity
+	publicKey.parsedKey = chain
+	if err := v.checkRevoked(*publicKey); err != nil {
+		return nil, PublicKey{}, err
+	}
+	if err := v.checkAlgorithm(att, *publicKey); err != nil {
+		return nil, PublicKey{}, err
+	}
+	if err := v.keyStrength.check(chain.leaf.PublicKey); err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: signing certificate: %v", ErrKeyTooWeak, err)
+	}
+	err = traceSignature(ctx, *publicKey, func(ctx context.Context) error {
+		return v.verifyPkix(signature, att.SerializedPayload, *publicKey)
+	})
+	if err != nil {
+		return nil, PublicKey{}, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if err := v.checkKeyIdentity(att.PublicKeyID, *publicKey); err != nil {
+		return nil, PublicKey{}, err
+	}
+	return att.SerializedPayload, *publicKey, nil
+}
+
+// checkIdentity returns the identity of a signing certificate, its first
+// email address or URI, and checks that one of them is allowed.
+func (c *sigstoreConfig) checkIdentity(cert *x509.Certificate) (string, error) {
+	var identities []string
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	if len(identities) == 0 {
+		return "", errors.New("signing certificate has no email address or URI")
+	}
+	if len(c.identities) == 0 {
+		return identities[0], nil
+	}
+	for _, identity := range identities {
+		if containsString(c.identities, identity) {
+			return identity, nil
+		}
+	}
+	return "", fmt.Errorf("signing certificate identities %v are not allowed", identities)
+}
+
+// checkIssuer checks that `cert` was issued for a signer authenticated by the
+// config's OIDC issuer.
+func (c *sigstoreConfig) checkIssuer(cert *x509.Certificate) error {
+	issuer, err := certificateIssuer(cert)
+	if err != nil {
+		return err
+	}
+	if issuer != c.issuer {
+		return fmt.Errorf("signing certificate was issued for OIDC issuer %q, expected %q", issuer, c.issuer)
+	}
+	return nil
+}
+
+// certificateIssuer returns the OIDC issuer recorded in a Fulcio certificate.
+func certificateIssuer(cert *x509.Certificate) (string, error) {
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidFulcioIssuer) {
+			var issuer string
+			if rest, err := asn1.Unmarshal(ext.Value, &issuer); err != nil || len(rest) > 0 {
+				return "", errors.New("signing certificate has a malformed OIDC issuer")
+			}
+			return issuer, nil
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidFulcioIssuerLegacy) {
+			return string(ext.Value), nil
+		}
+	}
+	return "", errors.New("signing certificate has no OIDC issuer")
+}
+
+// verifySignedEntryTimestamp checks that the SET of `entry` was signed by the
+// Rekor log.
+func (c *sigstoreConfig) verifySignedEntryTimestamp(entry RekorEntry) error {
+	if !strings.EqualFold(entry.LogID, c.rekorLogID) {
+		return fmt.Errorf("entry is from log %q, expected %q", entry.LogID, c.rekorLogID)
+	}
+	if len(entry.SignedEntryTimestamp) == 0 {
+		return errors.New("entry has no signed entry timestamp")
+	}
+	promise, err := json.Marshal(struct {
+		Body           []byte `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	if err != nil {
+		return errors.Wrap(err, "error serializing entry")
+	}
+	if promise, err = Canonicalize(promise); err != nil {
+		return err
+	}
+	if err := verifyDetachedWithKey(entry.SignedEntryTimestamp, c.rekorKey, c.rekorAlgorithm, promise); err != nil {
+		return errors.Wrap(err, "error verifying signed entry timestamp")
+	}
+	return nil
+}
+
+// verifyInclusionProof checks the inclusion proof of `entry` against a
+// checkpoint signed by the Rekor log.
+func (c *sigstoreConfig) verifyInclusionProof(entry RekorEntry) error {
+	proof := entry.InclusionProof
+	treeSize, rootHash, err := c.verifyCheckpoint(proof.Checkpoint)
+	if err != nil {
+		return err
+	}
+	if treeSize != proof.TreeSize || !bytes.Equal(rootHash, proof.RootHash) {
+		return errors.New("checkpoint does not match the inclusion proof")
+	}
+	leafHash := sha256.Sum256(append([]byte{0}, entry.Body...))
+	return verifyMerkleInclusion(proof.LogIndex, proof.TreeSize, leafHash[:], proof.Hashes, proof.RootHash)
+}
+
+// verifyCheckpoint verifies a checkpoint, a signed note whose text consists of
+// the origin of the log, the tree size and the base64 encoded root hash, each
+// on its own line, and returns the tree size and root hash.
+func (c *sigstoreConfig) verifyCheckpoint(checkpoint string) (int64, []byte, error) {
+	parts := strings.SplitN(checkpoint, "\n\n", 2)
+	if len(parts) != 2 {
+		return 0, nil, errors.New("checkpoint has no signatures")
+	}
+	text := parts[0] + "\n"
+	lines := strings.Split(parts[0], "\n")
+	if len(lines) < 3 {
+		return 0, nil, errors.New("checkpoint is missing the tree size or root hash")
+	}
+	treeSize, err := strconv.ParseInt(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "invalid checkpoint tree size")
+	}
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "invalid checkpoint root hash")
+	}
+
+	// Signature lines have the form "— <name> <base64(key hint || signature)>",
+	// where the key hint is the first four bytes of the log ID.
+	keyHint, err := hex.DecodeString(c.rekorLogID[:8])
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, line := range strings.Split(parts[1], "\n") {
+		if !strings.HasPrefix(line, "— ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "— "))
+		if len(fields) != 2 {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(sig) < 4 || !bytes.Equal(sig[:4], keyHint) {
+			continue
+		}
+		if err := verifyDetachedWithKey(sig[4:], c.rekorKey, c.rekorAlgorithm, []byte(text)); err == nil {
+			return treeSize, rootHash, nil
+		}
+	}
+	return 0, nil, errors.New("checkpoint is not signed by the Rekor log")
+}
+
+// verifyMerkleInclusion verifies an RFC 6962 inclusion proof of the leaf with
+// hash `leafHash` at `index` in a tree of `size` leaves, following RFC 9162,
+// section 2.1.3.2.
+func verifyMerkleInclusion(index, size int64, leafHash []byte, proof [][]byte, rootHash []byte) error {
+	if index < 0 || index >= size {
+		return fmt.Errorf("leaf index %d is outside of a tree of size %d", index, size)
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return errors.New("inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = hashMerkleChildren(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = hashMerkleChildren(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return errors.New("inclusion proof is too short")
+	}
+	if !bytes.Equal(r, rootHash) {
+		return errors.New("inclusion proof does not lead to the root hash")
+	}
+	return nil
+}
+
+// hashMerkleChildren returns the hash of an interior Merkle tree node.
+func hashMerkleChildren(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// checkRekorBody checks that a hashedrekord entry body records `signature`
+// over `payload` by `cert`.
+func checkRekorBody(body []byte, signature []byte, payload []byte, cert *x509.Certificate) error {
+	var rekord hashedRekord
+	if err := json.Unmarshal(body, &rekord); err != nil {
+		return errors.Wrap(err, "error parsing entry body")
+	}
+	if rekord.Kind != "hashedrekord" {
+		return fmt.Errorf("entry is of kind %q, expected hashedrekord", rekord.Kind)
+	}
+	if rekord.Spec.Data.Hash.Algorithm != "sha256" {
+		return fmt.Errorf("entry uses hash algorithm %q, expected sha256", rekord.Spec.Data.Hash.Algorithm)
+	}
+	hash := sha256.Sum256(payload)
+	if !strings.EqualFold(rekord.Spec.Data.Hash.Value, hex.EncodeToString(hash[:])) {
+		return errors.New("entry does not record the hash of the payload")
+	}
+	if !bytes.Equal(rekord.Spec.Signature.Content, signature) {
+		return errors.New("entry does not record the signature of the attestation")
+	}
+	entryCert, err := parsePkixCertificateChain(rekord.Spec.Signature.PublicKey.Content)
+	if err != nil {
+		return errors.Wrap(err, "error parsing entry certificate")
+	}
+	if !entryCert.leaf.Equal(cert) {
+		return errors.New("entry does not record the signing certificate")
+	}
+	return nil
+}
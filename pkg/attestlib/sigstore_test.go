@@ -0,0 +1,507 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOidcIssuer is the OIDC issuer recorded in the certificates of the
+// sigstore fixture.
+const testOidcIssuer = "https://accounts.example.com"
+
+// sigstoreFixture is a fake Fulcio CA and Rekor log that create keyless
+// Attestations.
+type sigstoreFixture struct {
+	t        *testing.T
+	caKey    *ecdsa.PrivateKey
+	caCert   *x509.Certificate
+	rekorKey *ecdsa.PrivateKey
+	rekorPem []byte
+	logID    string
+	issuedAt time.Time
+	// extensions are added to the certificates issued by the fixture, by
+	// default the OIDC issuer extension for testOidcIssuer.
+	extensions []pkix.Extension
+}
+
+// issuerExtension returns the Fulcio extension recording `issuer`.
+func issuerExtension(t *testing.T, issuer string) pkix.Extension {
+	t.Helper()
+	value, err := asn1.MarshalWithParams(issuer, "utf8")
+	if err != nil {
+		t.Fatalf("error marshaling issuer: %v", err)
+	}
+	return pkix.Extension{Id: oidFulcioIssuer, Value: value}
+}
+
+func newSigstoreFixture(t *testing.T) *sigstoreFixture {
+	t.Helper()
+	f := &sigstoreFixture{t: t, issuedAt: time.Now().Add(-24 * time.Hour)}
+	f.caKey = generateEcKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fake fulcio"},
+		NotBefore:             f.issuedAt.Add(-time.Hour),
+		NotAfter:              f.issuedAt.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &f.caKey.PublicKey, f.caKey)
+	if err != nil {
+		t.Fatalf("error creating CA certificate: %v", err)
+	}
+	if f.caCert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("error parsing CA certificate: %v", err)
+	}
+	f.rekorKey = generateEcKey(t)
+	spki, err := x509.MarshalPKIXPublicKey(&f.rekorKey.PublicKey)
+	if err != nil {
+		t.Fatalf("error marshaling Rekor key: %v", err)
+	}
+	f.rekorPem = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: spki})
+	logID := sha256.Sum256(spki)
+	f.logID = hex.EncodeToString(logID[:])
+	f.extensions = []pkix.Extension{issuerExtension(t, testOidcIssuer)}
+	return f
+}
+
+func generateEcKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return key
+}
+
+func (f *sigstoreFixture) roots() *x509.CertPool {
+	roots := x509.NewCertPool()
+	roots.AddCert(f.caCert)
+	return roots
+}
+
+func (f *sigstoreFixture) sign(key *ecdsa.PrivateKey, message []byte) []byte {
+	f.t.Helper()
+	sig, err := ecSign(key, message, EcdsaP256Sha256)
+	if err != nil {
+		f.t.Fatalf("error signing: %v", err)
+	}
+	return sig
+}
+
+// issue returns a PEM-encoded code signing certificate for `key` with the
+// email address `email`, valid for ten minutes from the fixture's issue time.
+func (f *sigstoreFixture) issue(key *ecdsa.PrivateKey, email string) []byte {
+	f.t.Helper()
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       f.issuedAt,
+		NotAfter:        f.issuedAt.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{email},
+		URIs:            []*url.URL{{Scheme: "https", Host: "accounts.example.com"}},
+		ExtraExtensions: f.extensions,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, f.caCert, &key.PublicKey, f.caKey)
+	if err != nil {
+		f.t.Fatalf("error creating certificate: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+// attestation signs `payload` with an ephemeral key certified for `email`,
+// and logs the signature at index 3 of a tree of ten entries.
+func (f *sigstoreFixture) attestation(payload string, email string) *Attestation {
+	f.t.Helper()
+	key := generateEcKey(f.t)
+	cert := f.issue(key, email)
+	signature := f.sign(key, []byte(payload))
+
+	var body hashedRekord
+	body.Kind = "hashedrekord"
+	hash := sha256.Sum256([]byte(payload))
+	body.Spec.Data.Hash.Algorithm = "sha256"
+	body.Spec.Data.Hash.Value = hex.EncodeToString(hash[:])
+	body.Spec.Signature.Content = signature
+	body.Spec.Signature.PublicKey.Content = cert
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatalf("error marshaling entry body: %v", err)
+	}
+
+	entry := RekorEntry{
+		Body:           bodyJSON,
+		IntegratedTime: f.issuedAt.Add(time.Minute).Unix(),
+		LogIndex:       1003,
+		LogID:          f.logID,
+	}
+	promise, err := json.Marshal(map[string]interface{}{
+		"body":           entry.Body,
+		"integratedTime": entry.IntegratedTime,
+		"logID":          entry.LogID,
+		"logIndex":       entry.LogIndex,
+	})
+	if err != nil {
+		f.t.Fatalf("error marshaling entry: %v", err)
+	}
+	entry.SignedEntryTimestamp = f.sign(f.rekorKey, promise)
+
+	leaves := make([][]byte, 10)
+	for i := range leaves {
+		leaves[i] = merkleLeafHash([]byte(fmt.Sprintf("entry %d", i)))
+	}
+	const index = 3
+	leaves[index] = merkleLeafHash(bodyJSON)
+	rootHash := merkleRoot(leaves)
+	entry.InclusionProof = &InclusionProof{
+		LogIndex:   index,
+		TreeSize:   int64(len(leaves)),
+		RootHash:   rootHash,
+		Hashes:     merklePath(index, leaves),
+		Checkpoint: f.checkpoint(int64(len(leaves)), rootHash),
+	}
+	return &Attestation{
+		Signature:         signature,
+		SerializedPayload: []byte(payload),
+		SigstoreBundle:    &SigstoreBundle{Certificate: cert, RekorEntry: entry},
+	}
+}
+
+// checkpoint returns a checkpoint for the tree signed by the Rekor key.
+func (f *sigstoreFixture) checkpoint(treeSize int64, rootHash []byte) string {
+	text := fmt.Sprintf("rekor.example.com - 1234\n%d\n%s\n", treeSize, base64.StdEncoding.EncodeToString(rootHash))
+	keyHint, err := hex.DecodeString(f.logID[:8])
+	if err != nil {
+		f.t.Fatalf("error decoding log ID: %v", err)
+	}
+	sig := append(keyHint, f.sign(f.rekorKey, []byte(text))...)
+	return text + "\n— rekor.example.com " + base64.StdEncoding.EncodeToString(sig) + "\n"
+}
+
+func merkleLeafHash(data []byte) []byte {
+	h := sha256.Sum256(append([]byte{0}, data...))
+	return h[:]
+}
+
+// largestPowerOfTwoBelow returns the largest power of two smaller than n > 1.
+func largestPowerOfTwoBelow(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// merkleRoot returns the RFC 6962 Merkle tree hash of the leaf hashes.
+func merkleRoot(leaves [][]byte) []byte {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+	k := largestPowerOfTwoBelow(len(leaves))
+	return hashMerkleChildren(merkleRoot(leaves[:k]), merkleRoot(leaves[k:]))
+}
+
+// merklePath returns the RFC 6962 inclusion path of leaf m.
+func merklePath(m int, leaves [][]byte) [][]byte {
+	if len(leaves) == 1 {
+		return nil
+	}
+	k := largestPowerOfTwoBelow(len(leaves))
+	if m < k {
+		return append(merklePath(m, leaves[:k]), merkleRoot(leaves[k:]))
+	}
+	return append(merklePath(m-k, leaves[k:]), merkleRoot(leaves[:k]))
+}
+
+func TestVerifyAttestationSigstoreBundle(t *testing.T) {
+	f := newSigstoreFixture(t)
+	other := newSigstoreFixture(t)
+	// withExtensions returns a fixture of the same CA and log whose
+	// certificates have `extensions` instead of the OIDC issuer.
+	withExtensions := func(extensions ...pkix.Extension) *sigstoreFixture {
+		g := *f
+		g.extensions = extensions
+		return &g
+	}
+	tcs := []struct {
+		name        string
+		identities  []string
+		anyIdentity bool
+		attestation func() *Attestation
+		expectedErr error
+	}{
+		{
+			name:        "valid bundle",
+			attestation: func() *Attestation { return f.attestation(validPayload, "signer@example.com") },
+		},
+		{
+			name:        "valid bundle with one of several identities",
+			identities:  []string{"release@example.com", "signer@example.com"},
+			attestation: func() *Attestation { return f.attestation(validPayload, "signer@example.com") },
+		},
+		{
+			name:        "valid bundle with any identity",
+			anyIdentity: true,
+			attestation: func() *Attestation { return f.attestation(validPayload, "signer@example.com") },
+		},
+		{
+			name: "valid bundle with legacy issuer extension",
+			attestation: func() *Attestation {
+				return withExtensions(pkix.Extension{Id: oidFulcioIssuerLegacy, Value: []byte(testOidcIssuer)}).attestation(validPayload, "signer@example.com")
+			},
+		},
+		{
+			name: "bundle without inclusion proof",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.SigstoreBundle.RekorEntry.InclusionProof = nil
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "certificate for another issuer",
+			attestation: func() *Attestation {
+				return withExtensions(issuerExtension(t, "https://issuer.example.org")).attestation(validPayload, "signer@example.com")
+			},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "certificate for another issuer with any identity",
+			anyIdentity: true,
+			attestation: func() *Attestation {
+				return withExtensions(issuerExtension(t, "https://issuer.example.org")).attestation(validPayload, "signer@example.com")
+			},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "certificate without issuer",
+			attestation: func() *Attestation { return withExtensions().attestation(validPayload, "signer@example.com") },
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name: "certificate with malformed issuer",
+			attestation: func() *Attestation {
+				return withExtensions(pkix.Extension{Id: oidFulcioIssuer, Value: []byte(testOidcIssuer)}).attestation(validPayload, "signer@example.com")
+			},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name: "bad inclusion proof",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.SigstoreBundle.RekorEntry.InclusionProof.Hashes[1] = merkleLeafHash([]byte("forged"))
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "inclusion proof for another root hash",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.SigstoreBundle.RekorEntry.InclusionProof.RootHash = merkleLeafHash([]byte("forged"))
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "checkpoint signed by another log",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				proof := att.SigstoreBundle.RekorEntry.InclusionProof
+				proof.Checkpoint = other.checkpoint(proof.TreeSize, proof.RootHash)
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "tampered signed entry timestamp",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.SigstoreBundle.RekorEntry.IntegratedTime++
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name:        "entry from another log",
+			attestation: func() *Attestation { return other.attestation(validPayload, "signer@example.com") },
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "entry for another signature",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.Signature = f.attestation(validPayload, "signer@example.com").Signature
+				return att
+			},
+			expectedErr: ErrTransparencyLogInvalid,
+		},
+		{
+			name: "certificate not issued by fulcio",
+			attestation: func() *Attestation {
+				att := f.attestation(validPayload, "signer@example.com")
+				att.SigstoreBundle.Certificate = other.issue(generateEcKey(t), "signer@example.com")
+				return att
+			},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "identity not allowed",
+			identities:  []string{"release@example.com"},
+			attestation: func() *Attestation { return f.attestation(validPayload, "signer@example.com") },
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name: "payload for another image",
+			attestation: func() *Attestation {
+				return f.attestation(strings.Replace(validPayload, helloAppDigest, otherHelloAppDigest, 1), "signer@example.com")
+			},
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			identities := tc.identities
+			if identities == nil && !tc.anyIdentity {
+				identities = []string{"signer@example.com"}
+			}
+			opts := []VerifierOption{WithSigstore(f.roots(), f.rekorPem, testOidcIssuer, identities...)}
+			if tc.anyIdentity {
+				opts = append(opts, WithInsecureAnySigstoreIdentity())
+			}
+			v, err := NewVerifier(helloAppImage, nil, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			result, err := v.VerifyAttestationWithResult(tc.attestation())
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if result.KeyID != "signer@example.com" {
+				t.Errorf("KeyID = %q, expected %q", result.KeyID, "signer@example.com")
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationSigstoreBundleNotConfigured(t *testing.T) {
+	f := newSigstoreFixture(t)
+	v, err := NewVerifier(helloAppImage, nil)
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(f.attestation(validPayload, "signer@example.com")); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrUnsupportedKeyType)
+	}
+}
+
+func TestNewVerifierInvalidRekorKey(t *testing.T) {
+	f := newSigstoreFixture(t)
+	if _, err := NewVerifier(helloAppImage, nil, WithSigstore(f.roots(), []byte("not a key"), testOidcIssuer, "signer@example.com")); err == nil {
+		t.Errorf("NewVerifier(...) = nil, expected non nil")
+	}
+}
+
+func TestNewVerifierSigstoreSigners(t *testing.T) {
+	f := newSigstoreFixture(t)
+	tcs := []struct {
+		name        string
+		opts        []VerifierOption
+		expectedErr bool
+	}{
+		{
+			name: "issuer and identity",
+			opts: []VerifierOption{WithSigstore(f.roots(), f.rekorPem, testOidcIssuer, "signer@example.com")},
+		},
+		{
+			name:        "no issuer",
+			opts:        []VerifierOption{WithSigstore(f.roots(), f.rekorPem, "", "signer@example.com")},
+			expectedErr: true,
+		},
+		{
+			name:        "no identity",
+			opts:        []VerifierOption{WithSigstore(f.roots(), f.rekorPem, testOidcIssuer)},
+			expectedErr: true,
+		},
+		{
+			name: "any identity",
+			opts: []VerifierOption{WithInsecureAnySigstoreIdentity(), WithSigstore(f.roots(), f.rekorPem, testOidcIssuer)},
+		},
+		{
+			name:        "any identity without issuer",
+			opts:        []VerifierOption{WithSigstore(f.roots(), f.rekorPem, ""), WithInsecureAnySigstoreIdentity()},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewVerifier(helloAppImage, nil, tc.opts...)
+			if tc.expectedErr && err == nil {
+				t.Errorf("NewVerifier(...) = nil, expected non nil")
+			}
+			if !tc.expectedErr && err != nil {
+				t.Errorf("NewVerifier(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestVerifyMerkleInclusion(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		leaves := make([][]byte, size)
+		for i := range leaves {
+			leaves[i] = merkleLeafHash([]byte{byte(i)})
+		}
+		root := merkleRoot(leaves)
+		for index := 0; index < size; index++ {
+			proof := merklePath(index, leaves)
+			if err := verifyMerkleInclusion(int64(index), int64(size), leaves[index], proof, root); err != nil {
+				t.Errorf("verifyMerkleInclusion(%d, %d, ...) = %v, expected nil", index, size, err)
+			}
+			if err := verifyMerkleInclusion(int64(index), int64(size), merkleLeafHash([]byte("other")), proof, root); err == nil {
+				t.Errorf("verifyMerkleInclusion(%d, %d, ...) with another leaf = nil, expected non nil", index, size)
+			}
+		}
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// errSoftPassed is recorded as the error of a verification that soft-passed
+// an Attestation whose public key is not registered.
+var errSoftPassed = errors.New("attestation soft-passed: its public key is not registered")
+
+// checkSoftMissingKeyTypes checks that the key types of WithSoftMissingKeys
+// can be recognized from an Attestation's signature, and warns that the
+// Verifier accepts unverified Attestations.
+func (v *verifier) checkSoftMissingKeyTypes() error {
+	if len(v.softMissingKeyTypes) == 0 {
+		return nil
+	}
+	var names []string
+	for keyType := range v.softMissingKeyTypes {
+		if keyType != Pgp && keyType != Jwt {
+			return fmt.Errorf("soft missing keys are only supported for pgp and jwt keys, not %v", keyType)
+		}
+		names = append(names, keyType.String())
+	}
+	sort.Strings(names)
+	v.log().Warningf("Created a Verifier that accepts attestations by unregistered %s keys WITHOUT VERIFYING THEM. This must only be used during a key migration.", strings.Join(names, " and "))
+	return nil
+}
+
+// verifySoftMissingKey verifies an Attestation like verifyAttestation, but
+// reports errSoftPassed instead of ErrNoMatchingKey if the Attestation's
+// signature is of a key type of WithSoftMissingKeys.
+func (v *verifier) verifySoftMissingKey(ctx context.Context, att *Attestation) (verifiedAttestation, error) {
+	verified, err := v.verifyAttestation(ctx, att)
+	if err == nil || len(v.softMissingKeyTypes) == 0 || !errors.Is(err, ErrNoMatchingKey) {
+		return verified, err
+	}
+	keyType := signatureKeyType(att)
+	if !v.softMissingKeyTypes[keyType] {
+		return verified, err
+	}
+	v.log().Warningf("Soft-passing attestation by unregistered %v key %q WITHOUT VERIFYING IT: %v", keyType, att.PublicKeyID, err)
+	return verifiedAttestation{publicKey: PublicKey{ID: att.PublicKeyID, AuthenticatorType: keyType}}, errSoftPassed
+}
+
+// signatureKeyType recognizes the AuthenticatorType of the key that created
+// the bare Signature of `att` from its format: an OpenPGP signed message or
+// signature for Pgp, and a JWS compact serialization for Jwt. It returns
+// UnknownAuthenticatorType for other signatures.
+func signatureKeyType(att *Attestation) AuthenticatorType {
+	if att.EnvelopeType != NoEnvelope || att.SigstoreBundle != nil || len(att.Signatures) > 0 {
+		return UnknownAuthenticatorType
+	}
+	if isPgpSignature(att.Signature) {
+		return Pgp
+	}
+	if isJws(att.Signature) {
+		return Jwt
+	}
+	return UnknownAuthenticatorType
+}
+
+// isPgpSignature reports whether `signature` starts with an OpenPGP packet
+// that begins a signed message or a detached signature.
+func isPgpSignature(signature []byte) bool {
+	r, err := dearmorPgp(signature)
+	if err != nil {
+		return false
+	}
+	p, err := packet.Read(r)
+	if err != nil {
+		return false
+	}
+	switch p.(type) {
+	case *packet.OnePassSignature, *packet.Signature, *packet.Compressed:
+		return true
+	default:
+		return false
+	}
+}
+
+// isJws reports whether `signature` is a JWS compact serialization with a
+// JSON header naming its algorithm.
+func isJws(signature []byte) bool {
+	parts := bytes.Split(signature, []byte("."))
+	if len(parts) != 3 {
+		return false
+	}
+	header, err := base64.RawURLEncoding.DecodeString(string(parts[0]))
+	if err != nil {
+		return false
+	}
+	h := struct {
+		Alg string `json:"alg"`
+	}{}
+	return json.Unmarshal(header, &h) == nil && h.Alg != ""
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyAttestationSoftMissingKeys(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	pgpAtt := &Attestation{PublicKeyID: gpgPublicKeyID, Signature: []byte(gpgSignature)}
+	jwtAtt := ecJwtAttestation(t, "jwt-key")
+	otherPrivateKey := ed25519.NewKeyFromSeed([]byte("attestlib-ed25519-other-key-seed"))
+
+	tcs := []struct {
+		name            string
+		att             *Attestation
+		expectedErr     error
+		expectedOutcome verificationLabels
+	}{
+		{
+			name:            "unregistered pgp key soft-passes",
+			att:             pgpAtt,
+			expectedOutcome: verificationLabels{keyType: Pgp, outcome: OutcomeSoftPass},
+		},
+		{
+			name:            "unregistered ed25519 key is rejected",
+			att:             &Attestation{PublicKeyID: "unknown-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+			expectedErr:     ErrNoMatchingKey,
+			expectedOutcome: verificationLabels{keyType: UnknownAuthenticatorType, outcome: OutcomeNoKey},
+		},
+		{
+			name:            "unregistered jwt key is rejected",
+			att:             jwtAtt,
+			expectedErr:     ErrNoMatchingKey,
+			expectedOutcome: verificationLabels{keyType: UnknownAuthenticatorType, outcome: OutcomeNoKey},
+		},
+		{
+			name:            "invalid signature by registered key is rejected",
+			att:             &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(otherPrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)},
+			expectedErr:     ErrSignatureInvalid,
+			expectedOutcome: verificationLabels{keyType: Ed25519, outcome: OutcomeBadSignature},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &capturingLogger{}
+			metrics := &fakeMetricsRecorder{}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithSoftMissingKeys(Pgp), WithLogger(logger), WithMetricsRecorder(metrics))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			if len(logger.warnings) != 1 || !strings.Contains(logger.warnings[0], "unregistered pgp keys WITHOUT VERIFYING THEM") {
+				t.Errorf("got warnings %q, expected a warning about soft missing keys", logger.warnings)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if tc.expectedErr == nil && len(logger.warnings) != 2 {
+				t.Errorf("got warnings %q, expected a warning about the soft-passed attestation", logger.warnings)
+			}
+			if len(metrics.verifications) != 1 || metrics.verifications[0] != tc.expectedOutcome {
+				t.Errorf("recorded %v, expected [%v]", metrics.verifications, tc.expectedOutcome)
+			}
+		})
+	}
+}
+
+func TestSoftMissingKeysOnlyForVerifyAttestation(t *testing.T) {
+	att := &Attestation{PublicKeyID: gpgPublicKeyID, Signature: []byte(gpgSignature)}
+	v, err := NewVerifier(helloAppImage, nil, WithSoftMissingKeys(Pgp))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if _, err := v.VerifyAttestationWithResult(att); !errors.Is(err, ErrNoMatchingKey) {
+		t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, ErrNoMatchingKey)
+	}
+	if err := v.VerifyQuorum([]*Attestation{att}, 1); !errors.Is(err, ErrQuorumNotMet) {
+		t.Errorf("VerifyQuorum(_) = %v, want error matching %v", err, ErrQuorumNotMet)
+	}
+}
+
+func TestNewVerifierSoftMissingKeysUnsupportedType(t *testing.T) {
+	if _, err := NewVerifier(helloAppImage, nil, WithSoftMissingKeys(Pgp, Ed25519)); err == nil {
+		t.Errorf("NewVerifier(...) = nil, expected non nil")
+	}
+}
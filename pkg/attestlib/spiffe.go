@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// spiffeConfig holds the trust bundle and the allowed SPIFFE IDs of PKIX
+// public keys given as X.509 SVIDs.
+type spiffeConfig struct {
+	// bundle is the SPIFFE trust bundle that SVIDs must chain to.
+	bundle *x509.CertPool
+	// ids are the SPIFFE IDs allowed to sign Attestations. An ID without a
+	// path allows every workload of its trust domain. If empty, any SPIFFE ID
+	// is allowed.
+	ids []string
+}
+
+// checkIDs checks that the allowed SPIFFE IDs of the config are valid, and
+// normalizes them for comparison.
+func (c *spiffeConfig) checkIDs() error {
+	for i, id := range c.ids {
+		parsed, err := parseSpiffeID(id)
+		if err != nil {
+			return errors.Wrapf(err, "invalid SPIFFE ID %q", id)
+		}
+		c.ids[i] = parsed.String()
+	}
+	return nil
+}
+
+// checkSpiffeID returns the SPIFFE ID of the X.509 SVID `cert`, its only URI
+// SAN, and checks that it is allowed. Its errors match
+// ErrCertificateNotTrusted.
+func (c *spiffeConfig) checkSpiffeID(cert *x509.Certificate) (string, error) {
+	if cert.IsCA {
+		return "", fmt.Errorf("%w: X.509 SVID is a CA certificate", ErrCertificateNotTrusted)
+	}
+	if len(cert.URIs) != 1 {
+		return "", fmt.Errorf("%w: X.509 SVID must have exactly one URI SAN, got %d", ErrCertificateNotTrusted, len(cert.URIs))
+	}
+	parsed, err := parseSpiffeID(cert.URIs[0].String())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrCertificateNotTrusted, err)
+	}
+	id := parsed.String()
+	if len(c.ids) == 0 {
+		return id, nil
+	}
+	for _, allowed := range c.ids {
+		// An allowed ID without a path is a trust domain.
+		if id == allowed || allowed == "spiffe://"+parsed.Host {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrSpiffeIDNotAllowed, id)
+}
+
+// parseSpiffeID parses a SPIFFE ID, a URI with the scheme "spiffe", a trust
+// domain and an optional path, but no port, user info, query or fragment.
+func parseSpiffeID(id string) (*url.URL, error) {
+	parsed, err := url.Parse(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing SPIFFE ID")
+	}
+	switch {
+	case parsed.Scheme != "spiffe":
+		return nil, fmt.Errorf("SPIFFE ID %q does not have the scheme spiffe", id)
+	case parsed.Host == "":
+		return nil, fmt.Errorf("SPIFFE ID %q has no trust domain", id)
+	case parsed.Port() != "", parsed.User != nil, parsed.RawQuery != "", parsed.Fragment != "":
+		return nil, fmt.Errorf("SPIFFE ID %q may not have a port, user info, query or fragment", id)
+	case parsed.Host != strings.ToLower(parsed.Host):
+		return nil, fmt.Errorf("SPIFFE ID %q has a trust domain that is not lowercase", id)
+	case strings.HasSuffix(parsed.Path, "/"):
+		return nil, fmt.Errorf("SPIFFE ID %q has a trailing slash", id)
+	}
+	return parsed, nil
+}
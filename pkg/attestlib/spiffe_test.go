@@ -0,0 +1,198 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestVerifyAttestationSpiffe(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	newCA := func(name string) (*x509.CertPool, func(uris ...string) PublicKey, func(PublicKey) []byte) {
+		caKey, ca := newTestCertificate(t, &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             now.Add(-24 * time.Hour),
+			NotAfter:              now.Add(24 * time.Hour),
+			KeyUsage:              x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}, nil, nil)
+		bundle := x509.NewCertPool()
+		bundle.AddCert(ca)
+		signatures := map[string][]byte{}
+		newSvid := func(uris ...string) PublicKey {
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				NotBefore:    now.Add(-time.Hour),
+				NotAfter:     now.Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+			}
+			for _, uri := range uris {
+				parsed, err := url.Parse(uri)
+				if err != nil {
+					t.Fatalf("error parsing URI: %v", err)
+				}
+				template.URIs = append(template.URIs, parsed)
+			}
+			leafKey, leaf := newTestCertificate(t, template, ca, caKey)
+			signature, err := ecSign(leafKey, []byte(validPayload), EcdsaP256Sha256)
+			if err != nil {
+				t.Fatalf("error signing payload: %v", err)
+			}
+			keyData := encodeTestCertificate(leaf)
+			signatures[string(keyData)] = signature
+			return PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: keyData, ID: "workload"}
+		}
+		signature := func(publicKey PublicKey) []byte {
+			return signatures[string(publicKey.KeyData)]
+		}
+		return bundle, newSvid, signature
+	}
+	bundle, newSvid, signature := newCA("example.org")
+	otherBundle, _, _ := newCA("other.org")
+
+	tcs := []struct {
+		name        string
+		publicKey   PublicKey
+		bundle      *x509.CertPool
+		spiffeIDs   []string
+		expectedErr error
+	}{
+		{
+			name:      "matching SPIFFE ID",
+			publicKey: newSvid("spiffe://example.org/ns/prod/sa/builder"),
+			bundle:    bundle,
+			spiffeIDs: []string{"spiffe://example.org/ns/prod/sa/deployer", "spiffe://example.org/ns/prod/sa/builder"},
+		},
+		{
+			name:      "matching trust domain",
+			publicKey: newSvid("spiffe://example.org/ns/prod/sa/builder"),
+			bundle:    bundle,
+			spiffeIDs: []string{"spiffe://example.org"},
+		},
+		{
+			name:      "any SPIFFE ID",
+			publicKey: newSvid("spiffe://example.org/ns/prod/sa/builder"),
+			bundle:    bundle,
+		},
+		{
+			name:        "wrong trust domain",
+			publicKey:   newSvid("spiffe://evil.org/ns/prod/sa/builder"),
+			bundle:      bundle,
+			spiffeIDs:   []string{"spiffe://example.org/ns/prod/sa/builder"},
+			expectedErr: ErrSpiffeIDNotAllowed,
+		},
+		{
+			name:        "trust domain that is a prefix",
+			publicKey:   newSvid("spiffe://example.org.evil.org/ns/prod/sa/builder"),
+			bundle:      bundle,
+			spiffeIDs:   []string{"spiffe://example.org"},
+			expectedErr: ErrSpiffeIDNotAllowed,
+		},
+		{
+			name:        "wrong path",
+			publicKey:   newSvid("spiffe://example.org/ns/dev/sa/builder"),
+			bundle:      bundle,
+			spiffeIDs:   []string{"spiffe://example.org/ns/prod/sa/builder"},
+			expectedErr: ErrSpiffeIDNotAllowed,
+		},
+		{
+			name:        "missing URI SAN",
+			publicKey:   newSvid(),
+			bundle:      bundle,
+			spiffeIDs:   []string{"spiffe://example.org"},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "several URI SANs",
+			publicKey:   newSvid("spiffe://example.org/a", "spiffe://example.org/b"),
+			bundle:      bundle,
+			spiffeIDs:   []string{"spiffe://example.org"},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "URI SAN that is not a SPIFFE ID",
+			publicKey:   newSvid("https://example.org/ns/prod/sa/builder"),
+			bundle:      bundle,
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "SVID not in the trust bundle",
+			publicKey:   newSvid("spiffe://example.org/ns/prod/sa/builder"),
+			bundle:      otherBundle,
+			spiffeIDs:   []string{"spiffe://example.org"},
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "no trust bundle",
+			publicKey:   newSvid("spiffe://example.org/ns/prod/sa/builder"),
+			expectedErr: ErrCertificateNotTrusted,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			// The roots must not be used to validate SVIDs.
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, WithRoots(bundle), WithSpiffe(tc.bundle, tc.spiffeIDs...), WithClock(ClockFunc(func() time.Time { return now })))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: "workload", Signature: signature(tc.publicKey), SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierSpiffeIDs(t *testing.T) {
+	tcs := []struct {
+		name      string
+		spiffeID  string
+		expectErr bool
+	}{
+		{"workload", "spiffe://example.org/ns/prod/sa/builder", false},
+		{"trust domain", "spiffe://example.org", false},
+		{"wrong scheme", "https://example.org/workload", true},
+		{"no trust domain", "spiffe:///workload", true},
+		{"port", "spiffe://example.org:443/workload", true},
+		{"query", "spiffe://example.org/workload?a=b", true},
+		{"uppercase trust domain", "spiffe://Example.org/workload", true},
+		{"trailing slash", "spiffe://example.org/workload/", true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewVerifier(helloAppImage, nil, WithSpiffe(x509.NewCertPool(), tc.spiffeID))
+			if tc.expectErr && err == nil {
+				t.Errorf("NewVerifier(...) = nil, expected non nil")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("NewVerifier(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// errVerificationRejected is returned by a rejecting Verifier created with a
+// nil error.
+var errVerificationRejected = errors.New("attestation rejected by a Verifier that rejects all attestations")
+
+// staticVerifier is a Verifier that does not check Attestations, and either
+// accepts all of them or rejects all of them with err.
+type staticVerifier struct {
+	err error
+}
+
+// NewInsecureAcceptingVerifier creates a Verifier that accepts every
+// Attestation WITHOUT VERIFYING IT. It is meant for tests of code that
+// depends on the Verifier interface and for dry-run modes, and must never be
+// used to enforce a policy. A warning is logged to the Logger passed with
+// WithLogger when the Verifier is created; other options are ignored.
+// VerifyAttestationWithResult reports the unverified PublicKeyID of the
+// Attestation.
+func NewInsecureAcceptingVerifier(opts ...VerifierOption) Verifier {
+	v := &verifier{logger: nopLogger{}}
+	for _, opt := range opts {
+		opt(v)
+	}
+	v.log().Warningf("Created an insecure Verifier that accepts all attestations without verifying them.")
+	return staticVerifier{}
+}
+
+// NewAlwaysRejectingVerifier creates a Verifier that rejects every
+// Attestation with `err`, e.g. to test how callers handle verification
+// failures. If `err` is nil, a generic error is used.
+func NewAlwaysRejectingVerifier(err error) Verifier {
+	if err == nil {
+		err = errVerificationRejected
+	}
+	return staticVerifier{err: err}
+}
+
+// VerifyAttestation returns the static result of the Verifier. See Verifier
+// for more details.
+func (v staticVerifier) VerifyAttestation(att *Attestation) error {
+	return v.VerifyAttestationContext(context.Background(), att)
+}
+
+// VerifyAttestationContext returns ctx.Err() if `ctx` is done, and the static
+// result of the Verifier otherwise. See Verifier for more details.
+func (v staticVerifier) VerifyAttestationContext(ctx context.Context, att *Attestation) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return v.err
+}
+
+// VerifyAttestationWithResult returns the static result of the Verifier. An
+// accepted Attestation's result holds its PublicKeyID, which has not been
+// verified. See Verifier for more details.
+func (v staticVerifier) VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	return &VerificationResult{KeyID: att.PublicKeyID}, nil
+}
+
+// VerifyAttestationStream returns the static result of the Verifier without
+// reading `payload`. See Verifier for more details.
+func (v staticVerifier) VerifyAttestationStream(att *Attestation, payload io.Reader) (*VerificationResult, error) {
+	return v.VerifyAttestationWithResult(att)
+}
+
+// VerifyOrExplain returns the static result of the Verifier. A rejection is
+// explained by the Verifier's error. See Verifier for more details.
+func (v staticVerifier) VerifyOrExplain(att *Attestation) (bool, string) {
+	if v.err != nil {
+		return false, fmt.Sprintf("attestation rejected without verification: %v", v.err)
+	}
+	return true, "attestation accepted without verification"
+}
+
+// VerifyAttestations returns the static result of the Verifier for every
+// Attestation. A rejecting Verifier does not meet a positive `minVerified`.
+// See Verifier for more details.
+func (v staticVerifier) VerifyAttestations(atts []*Attestation, minVerified int) ([]error, error) {
+	results := make([]error, len(atts))
+	for i := range atts {
+		results[i] = v.err
+	}
+	if v.err != nil && minVerified > 0 {
+		return results, fmt.Errorf("%w: 0 of %d required keys verified", ErrQuorumNotMet, minVerified)
+	}
+	return results, nil
+}
+
+// VerifyQuorum returns nil for an accepting Verifier. A rejecting Verifier
+// does not meet a positive `threshold`. See Verifier for more details.
+func (v staticVerifier) VerifyQuorum(atts []*Attestation, threshold int) error {
+	if v.err != nil && threshold > 0 {
+		return fmt.Errorf("%w: 0 of %d required keys verified: %v", ErrQuorumNotMet, threshold, v.err)
+	}
+	return nil
+}
+
+// SelfTest returns nil, since a static Verifier has no public keys or key
+// backends. See Verifier for more details.
+func (v staticVerifier) SelfTest(ctx context.Context) error {
+	return nil
+}
+
+// RegisteredKeys returns nil, since a static Verifier has no public keys. See
+// Verifier for more details.
+func (v staticVerifier) RegisteredKeys() []KeyInfo {
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestInsecureAcceptingVerifier(t *testing.T) {
+	logger := &capturingLogger{}
+	v := NewInsecureAcceptingVerifier(WithLogger(logger))
+	if len(logger.warnings) != 1 {
+		t.Errorf("NewInsecureAcceptingVerifier(...) logged warnings %q, expected 1", logger.warnings)
+	}
+
+	att := &Attestation{PublicKeyID: "some-key", Signature: []byte("not a signature")}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	result, err := v.VerifyAttestationWithResult(att)
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.KeyID != "some-key" {
+		t.Errorf("VerifyAttestationWithResult(_) = %+v, expected KeyID %q", *result, "some-key")
+	}
+	results, err := v.VerifyAttestations([]*Attestation{att, att}, 2)
+	if err != nil {
+		t.Errorf("VerifyAttestations(_) = %v, expected nil", err)
+	}
+	for i, result := range results {
+		if result != nil {
+			t.Errorf("VerifyAttestations(_) result %d = %v, expected nil", i, result)
+		}
+	}
+	if err := v.VerifyQuorum([]*Attestation{att}, 2); err != nil {
+		t.Errorf("VerifyQuorum(_) = %v, expected nil", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := v.VerifyAttestationContext(ctx, att); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestAlwaysRejectingVerifier(t *testing.T) {
+	rejected := errors.New("rejected in staging")
+	tcs := []struct {
+		name        string
+		err         error
+		expectedErr error
+	}{
+		{
+			name:        "given error",
+			err:         rejected,
+			expectedErr: rejected,
+		},
+		{
+			name:        "nil error",
+			expectedErr: errVerificationRejected,
+		},
+	}
+	att := &Attestation{PublicKeyID: "some-key", Signature: []byte("signature")}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := NewAlwaysRejectingVerifier(tc.err)
+			if err := v.VerifyAttestation(att); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if err := v.VerifyAttestationContext(context.Background(), att); !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestationContext(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if result, err := v.VerifyAttestationWithResult(att); result != nil || !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestationWithResult(_) = %v, %v, want error matching %v", result, err, tc.expectedErr)
+			}
+			results, err := v.VerifyAttestations([]*Attestation{att}, 1)
+			if !errors.Is(err, ErrQuorumNotMet) {
+				t.Errorf("VerifyAttestations(_) = %v, want error matching %v", err, ErrQuorumNotMet)
+			}
+			if len(results) != 1 || !errors.Is(results[0], tc.expectedErr) {
+				t.Errorf("VerifyAttestations(_) results = %v, want errors matching %v", results, tc.expectedErr)
+			}
+			if err := v.VerifyQuorum([]*Attestation{att}, 1); !errors.Is(err, ErrQuorumNotMet) {
+				t.Errorf("VerifyQuorum(_) = %v, want error matching %v", err, ErrQuorumNotMet)
+			}
+		})
+	}
+}
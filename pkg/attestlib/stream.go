@@ -0,0 +1,293 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// streamedPredicateMember is the top-level member of a streamed payload that
+// is skipped instead of buffered: the predicate of an in-toto Statement,
+// e.g. an SBOM, which makes up most of a large payload.
+const streamedPredicateMember = "predicate"
+
+// VerifyAttestationStream verifies an Attestation whose payload is read from
+// `payload`. See Verifier for more details.
+func (v *verifier) VerifyAttestationStream(att *Attestation, payload io.Reader) (*VerificationResult, error) {
+	v = v.current()
+	verified, err := v.verify(context.Background(), att, func(ctx context.Context, att *Attestation) (verifiedAttestation, error) {
+		return v.verifyAttestationStream(ctx, att, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.newVerificationResult(verified), nil
+}
+
+// verifyAttestationStream checks the signature of an Attestation over the
+// payload read from `r`, hashing the payload as it is read, and then checks
+// the payload like verifyAttestation.
+func (v *verifier) verifyAttestationStream(ctx context.Context, att *Attestation, r io.Reader) (verifiedAttestation, error) {
+	if err := ctx.Err(); err != nil {
+		return verifiedAttestation{}, err
+	}
+	if att.PublicKeyID != "" && v.isRevoked(att.PublicKeyID) {
+		return verifiedAttestation{}, fmt.Errorf("%w: %q", ErrKeyRevoked, att.PublicKeyID)
+	}
+	switch {
+	case att.EnvelopeType != NoEnvelope || att.SigstoreBundle != nil || len(att.Signatures) > 0:
+		return verifiedAttestation{}, errors.New("only attestations with a single signature and no envelope or sigstore bundle can be streamed")
+	case len(att.SerializedPayload) != 0:
+		return verifiedAttestation{}, errors.New("streamed attestations must not carry a SerializedPayload")
+	case v.canonicalPayloads:
+		return verifiedAttestation{}, errors.New("payloads cannot be streamed by a verifier that canonicalizes payloads")
+	case v.policy != nil:
+		// The predicate of a streamed payload is not kept for the policy.
+		return verifiedAttestation{}, errors.New("payloads cannot be streamed by a verifier with a policy")
+	}
+
+	publicKeys, err := v.streamPublicKeys(att)
+	if err != nil {
+		return verifiedAttestation{}, err
+	}
+	// Every hash function used by the public keys is computed as the payload
+	// is read. Ed25519 signatures are over the payload itself, so it is only
+	// buffered if an Ed25519 key may verify the signature, up to the size
+	// limit of serialized payloads.
+	hashes := map[crypto.Hash]hash.Hash{}
+	var buffer *cappedBuffer
+	var writers []io.Writer
+	for _, publicKey := range publicKeys {
+		if publicKey.AuthenticatorType == Ed25519 {
+			if buffer == nil {
+				buffer = &cappedBuffer{maxSize: v.maxPayloadSize}
+				writers = append(writers, buffer)
+			}
+			continue
+		}
+		h, err := signatureHash(publicKey.SignatureAlgorithm)
+		if err != nil {
+			return verifiedAttestation{}, fmt.Errorf("%w: key %q: %v", ErrSignatureInvalid, publicKey.ID, err)
+		}
+		if _, ok := hashes[h]; !ok {
+			hashes[h] = h.New()
+			writers = append(writers, hashes[h])
+		}
+	}
+	if v.maxStreamedPayloadSize > 0 {
+		r = newSizeLimitedReader(r, "streamed payload", v.maxStreamedPayloadSize)
+	}
+	tee := io.TeeReader(r, io.MultiWriter(writers...))
+	reduced, parseErr := reduceStreamedPayload(tee, v.maxDecodedPayloadSize)
+	// The whole payload must be hashed, even if it could not be parsed.
+	if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+		if isInputTooLarge(err) {
+			return verifiedAttestation{}, err
+		}
+		return verifiedAttestation{}, errors.Wrap(err, "error reading payload")
+	}
+
+	signature := att.Signature
+	if v.cosignCompatibility {
+		signature = decodeCosignSignature(signature)
+	}
+	var failures []string
+	for _, publicKey := range publicKeys {
+		publicKey := publicKey
+		err := traceSignature(ctx, publicKey, func(ctx context.Context) error {
+			if publicKey.AuthenticatorType == Ed25519 {
+				if buffer.exceeded {
+					return fmt.Errorf("%w: streamed payload verified with Ed25519 key %q exceeds the limit of %d bytes", ErrInputTooLarge, publicKey.ID, buffer.maxSize)
+				}
+				return v.verifyEd25519(signature, buffer.Bytes(), publicKey)
+			}
+			pub, err := pkixKey(publicKey)
+			if err != nil {
+				return errors.Wrapf(err, "error parsing PKIX public key %q", publicKey.ID)
+			}
+			h, _ := signatureHash(publicKey.SignatureAlgorithm)
+			return verifyDigestWithKey(signature, pub, publicKey.SignatureAlgorithm, hashes[h].Sum(nil))
+		})
+		if isInputTooLarge(err) {
+			return verifiedAttestation{}, err
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("key %q: %v", publicKey.ID, err))
+			continue
+		}
+		if err := v.checkKeyIdentity(att.PublicKeyID, publicKey); err != nil {
+			return verifiedAttestation{}, err
+		}
+		if isInputTooLarge(parseErr) {
+			return verifiedAttestation{}, parseErr
+		}
+		if parseErr != nil {
+			return verifiedAttestation{}, fmt.Errorf("%w: %v", ErrInvalidPayload, parseErr)
+		}
+		signatures := []SignatureResult{{PublicKeyID: att.PublicKeyID, KeyID: publicKey.ID, KeyType: publicKey.AuthenticatorType}}
+		return v.checkVerifiedPayload(ctx, reduced, "", publicKey, signatures)
+	}
+	return verifiedAttestation{}, fmt.Errorf("%w: %s", ErrSignatureInvalid, strings.Join(failures, "; "))
+}
+
+// streamPublicKeys returns the public keys whose ID is the PublicKeyID of
+// `att` and that can verify a streamed payload: Pkix keys, whose signatures
+// are over a digest of the payload, and Ed25519 keys.
+func (v *verifier) streamPublicKeys(att *Attestation) ([]PublicKey, error) {
+	candidates := v.publicKeysByID(att.PublicKeyID)
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: no public key with ID %q found", ErrNoMatchingKey, att.PublicKeyID)
+	}
+	var publicKeys []PublicKey
+	var firstErr error
+	for _, publicKey := range candidates {
+		var err error
+		switch publicKey.AuthenticatorType {
+		case Pkix:
+			if err = v.checkCertificateChain(publicKey); err == nil {
+				err = v.keyStrength.checkPublicKey(publicKey)
+			}
+		case Ed25519:
+		default:
+			err = fmt.Errorf("%w: key %q has type %v, whose signatures cannot be verified over a streamed payload", ErrKeyTypeNotImplemented, publicKey.ID, publicKey.AuthenticatorType)
+		}
+		if err == nil {
+			err = v.checkRevoked(publicKey)
+		}
+		if err == nil {
+			err = v.checkAlgorithm(att, publicKey)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+	if len(publicKeys) == 0 {
+		return nil, firstErr
+	}
+	return publicKeys, nil
+}
+
+// reduceStreamedPayload reads a JSON object from `r` and returns it without
+// its streamedPredicateMember, which is skipped token by token so that it is
+// never held in memory as a whole. The returned object is built member by
+// member, and ErrInputTooLarge is returned as soon as it would exceed
+// `maxSize`, unless `maxSize` is zero or less.
+func reduceStreamedPayload(r io.Reader, maxSize int64) ([]byte, error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return nil, errors.Wrap(err, "error parsing payload")
+	} else if tok != json.Delim('{') {
+		return nil, errors.New("streamed payload is not a JSON object")
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing payload")
+		}
+		name, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object member name %v", tok)
+		}
+		if name == streamedPredicateMember {
+			if err := skipJSONValue(dec); err != nil {
+				return nil, errors.Wrap(err, "error parsing payload")
+			}
+			continue
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, errors.Wrap(err, "error parsing payload")
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		encodedName, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		// The colon and the closing brace of the object follow.
+		size := int64(buf.Len() + len(encodedName) + len(value) + 2)
+		if maxSize > 0 && size > maxSize {
+			return nil, fmt.Errorf("%w: streamed payload without its predicate exceeds the limit of %d bytes", ErrInputTooLarge, maxSize)
+		}
+		buf.Write(encodedName)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, errors.Wrap(err, "error parsing payload")
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after streamed payload")
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// cappedBuffer is a bytes.Buffer that stops holding what is written to it
+// once it would grow past `maxSize`, unless `maxSize` is zero or less, and
+// sets `exceeded` instead of failing the write.
+type cappedBuffer struct {
+	bytes.Buffer
+	maxSize  int64
+	exceeded bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.exceeded || (b.maxSize > 0 && int64(b.Len()+len(p)) > b.maxSize) {
+		b.exceeded = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// skipJSONValue reads the next JSON value from `dec` and discards it.
+func skipJSONValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
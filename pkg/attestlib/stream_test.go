@@ -0,0 +1,261 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// sbomReader generates an in-toto Statement for the hello-app image whose
+// predicate is an SBOM listing `packages` packages, without holding it in
+// memory.
+type sbomReader struct {
+	packages int
+	next     int
+	buf      bytes.Buffer
+}
+
+func newSbomReader(packages int) io.Reader {
+	r := &sbomReader{packages: packages}
+	r.buf.WriteString(`{"_type": "https://in-toto.io/Statement/v0.1", "subject": [{"name": "gcr.io/google-samples/hello-app", "digest": {"sha256": "bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"}}], "predicateType": "https://spdx.dev/Document", "predicate": {"packages": [`)
+	return r
+}
+
+func (r *sbomReader) Read(p []byte) (int, error) {
+	for r.buf.Len() < len(p) && r.next <= r.packages {
+		switch {
+		case r.next == r.packages:
+			r.buf.WriteString(`]}}`)
+		case r.next > 0:
+			r.buf.WriteString(`, `)
+			fallthrough
+		default:
+			fmt.Fprintf(&r.buf, `{"name": "package-%d", "versionInfo": "1.0.%d", "licenseConcluded": "Apache-2.0"}`, r.next, r.next)
+		}
+		r.next++
+	}
+	if r.buf.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buf.Read(p)
+}
+
+// signStream signs the payload read from `r` with the P-256 test key.
+func signStream(t testing.TB, r io.Reader) []byte {
+	t.Helper()
+	key, err := parsePkixPrivateKeyPem([]byte(ec256PrivateKey))
+	if err != nil {
+		t.Fatalf("error parsing private key: %v", err)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		t.Fatalf("error hashing payload: %v", err)
+	}
+	var sig struct {
+		R, S *big.Int
+	}
+	if sig.R, sig.S, err = ecdsa.Sign(rand.Reader, key.(*ecdsa.PrivateKey), h.Sum(nil)); err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	signature, err := asn1.Marshal(sig)
+	if err != nil {
+		t.Fatalf("error encoding signature: %v", err)
+	}
+	return signature
+}
+
+func TestVerifyAttestationStream(t *testing.T) {
+	ecKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	edKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed-key"}
+	jwtKey := PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "jwt-key"}
+	sbomSignature := signStream(t, newSbomReader(1000))
+
+	tcs := []struct {
+		name                  string
+		att                   *Attestation
+		payload               io.Reader
+		opts                  []VerifierOption
+		expectedErr           error
+		expectedPredicateType string
+	}{
+		{
+			name:                  "SBOM signed by a PKIX key",
+			att:                   &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:               newSbomReader(1000),
+			expectedPredicateType: "https://spdx.dev/Document",
+		},
+		{
+			name:    "atomic payload signed by a PKIX key",
+			att:     &Attestation{PublicKeyID: "ec-key", Signature: signStream(t, strings.NewReader(validPayload))},
+			payload: strings.NewReader(validPayload),
+		},
+		{
+			name:    "atomic payload signed by an Ed25519 key",
+			att:     &Attestation{PublicKeyID: "ed-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload))},
+			payload: strings.NewReader(validPayload),
+		},
+		{
+			name:                  "SBOM with a predicate over the decoded payload limit",
+			att:                   &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:               newSbomReader(1000),
+			opts:                  []VerifierOption{WithMaxDecodedPayloadSize(1024)},
+			expectedPredicateType: "https://spdx.dev/Document",
+		},
+		{
+			name:        "SBOM over the streamed payload limit",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:     newSbomReader(1000),
+			opts:        []VerifierOption{WithMaxStreamedPayloadSize(16 << 10)},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "members besides the predicate over the decoded payload limit",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:     newSbomReader(1000),
+			opts:        []VerifierOption{WithMaxDecodedPayloadSize(128)},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "payload signed by an Ed25519 key over the payload limit",
+			att:         &Attestation{PublicKeyID: "ed-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload))},
+			payload:     strings.NewReader(validPayload),
+			opts:        []VerifierOption{WithMaxPayloadSize(int64(len(validPayload) - 1))},
+			expectedErr: ErrInputTooLarge,
+		},
+		{
+			name:        "tampered SBOM",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:     newSbomReader(999),
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "payload for another image",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: signStream(t, strings.NewReader(otherDigestPayload))},
+			payload:     strings.NewReader(otherDigestPayload),
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "payload that is not a JSON object",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: signStream(t, strings.NewReader(`["not", "an", "object"]`))},
+			payload:     strings.NewReader(`["not", "an", "object"]`),
+			expectedErr: ErrInvalidPayload,
+		},
+		{
+			name:        "unknown key",
+			att:         &Attestation{PublicKeyID: "other-key", Signature: sbomSignature},
+			payload:     newSbomReader(1000),
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "JWT key",
+			att:         &Attestation{PublicKeyID: "jwt-key", Signature: sbomSignature},
+			payload:     newSbomReader(1000),
+			expectedErr: ErrKeyTypeNotImplemented,
+		},
+		{
+			name:        "revoked key",
+			att:         &Attestation{PublicKeyID: "ec-key", Signature: sbomSignature},
+			payload:     newSbomReader(1000),
+			opts:        []VerifierOption{WithRevokedKeys("ec-key")},
+			expectedErr: ErrKeyRevoked,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{ecKey, edKey, jwtKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			result, err := v.VerifyAttestationStream(tc.att, tc.payload)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationStream(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationStream(_) = %v, expected nil", err)
+			}
+			if result.KeyID != tc.att.PublicKeyID {
+				t.Errorf("KeyID = %q, expected %q", result.KeyID, tc.att.PublicKeyID)
+			}
+			if result.PredicateType != tc.expectedPredicateType {
+				t.Errorf("PredicateType = %q, expected %q", result.PredicateType, tc.expectedPredicateType)
+			}
+			if result.Predicate() != nil {
+				t.Errorf("Predicate() = %s, expected nil for a streamed payload", result.Predicate())
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationStreamRejectsSerializedPayload(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{PublicKeyID: "ec-key", Signature: signStream(t, strings.NewReader(validPayload)), SerializedPayload: []byte(validPayload)}
+	if _, err := v.VerifyAttestationStream(att, strings.NewReader(validPayload)); err == nil {
+		t.Errorf("VerifyAttestationStream(_) = nil, expected non nil")
+	}
+}
+
+// BenchmarkVerifyAttestationStream compares the memory allocated to verify a
+// large SBOM read into SerializedPayload with verifying it from a stream.
+func BenchmarkVerifyAttestationStream(b *testing.B) {
+	const packages = 100000
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		b.Fatalf("error creating verifier: %v", err)
+	}
+	signature := signStream(b, newSbomReader(packages))
+
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			payload, err := ioutil.ReadAll(newSbomReader(packages))
+			if err != nil {
+				b.Fatalf("error reading payload: %v", err)
+			}
+			if _, err := v.VerifyAttestationWithResult(&Attestation{PublicKeyID: "ec-key", Signature: signature, SerializedPayload: payload}); err != nil {
+				b.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+		}
+	})
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := v.VerifyAttestationStream(&Attestation{PublicKeyID: "ec-key", Signature: signature}, newSbomReader(packages)); err != nil {
+				b.Fatalf("VerifyAttestationStream(_) = %v, expected nil", err)
+			}
+		}
+	})
+}
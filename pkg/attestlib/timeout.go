@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// verificationTimer tracks the deadline of a VerifyAttestation call of a
+// verifier with a timeout. Only calls to remote backends are bounded by the
+// deadline; in-memory cryptography cannot hang and is never cut short.
+type verificationTimer struct {
+	deadline time.Time
+	// exceeded is set to 1 once a backend call ran into the deadline.
+	exceeded int32
+}
+
+type verificationTimerKey struct{}
+
+// startTimer returns a context that carries the deadline of a verification
+// started now, if the verifier has a timeout.
+func (v *verifier) startTimer(ctx context.Context) (context.Context, *verificationTimer) {
+	if v.timeout <= 0 {
+		return ctx, nil
+	}
+	timer := &verificationTimer{deadline: time.Now().Add(v.timeout)}
+	return context.WithValue(ctx, verificationTimerKey{}, timer), timer
+}
+
+// callBackend calls a remote backend with `call`. If the verification has a
+// deadline, the context passed to `call` is done once it passes.
+func callBackend(ctx context.Context, call func(context.Context) error) error {
+	timer, ok := ctx.Value(verificationTimerKey{}).(*verificationTimer)
+	if !ok {
+		return call(ctx)
+	}
+	backendCtx, cancel := context.WithDeadline(ctx, timer.deadline)
+	defer cancel()
+	err := call(backendCtx)
+	if err != nil && ctx.Err() == nil && backendCtx.Err() == context.DeadlineExceeded {
+		atomic.StoreInt32(&timer.exceeded, 1)
+	}
+	return err
+}
+
+// checkTimeout returns ErrVerificationTimeout in place of `err` if a backend
+// call of the verification ran into the deadline of `timer`.
+func (v *verifier) checkTimeout(timer *verificationTimer, err error) error {
+	if err == nil || timer == nil || atomic.LoadInt32(&timer.exceeded) == 0 {
+		return err
+	}
+	return fmt.Errorf("%w after %v: %v", ErrVerificationTimeout, v.timeout, err)
+}
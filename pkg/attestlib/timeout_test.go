@@ -0,0 +1,169 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	gax "github.com/googleapis/gax-go/v2"
+	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+)
+
+// slowKmsClient waits for `delay` before returning `key`, or returns early
+// with the error of `ctx`.
+type slowKmsClient struct {
+	key   *kmspb.PublicKey
+	delay time.Duration
+}
+
+func (c *slowKmsClient) GetPublicKey(ctx context.Context, req *kmspb.GetPublicKeyRequest, opts ...gax.CallOption) (*kmspb.PublicKey, error) {
+	select {
+	case <-time.After(c.delay):
+		return c.key, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestVerifyAttestationTimeout(t *testing.T) {
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, kmsKeyName)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := CreateImageAttestation(signer, helloAppImage)
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	publicKey, err := NewPublicKey(Kms, EcdsaP256Sha256, []byte(kmsKeyName), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+
+	tcs := []struct {
+		name        string
+		delay       time.Duration
+		timeout     time.Duration
+		expectedErr error
+	}{
+		{
+			name:    "backend within timeout",
+			timeout: time.Minute,
+		},
+		{
+			name:        "slow backend exceeds timeout",
+			delay:       time.Minute,
+			timeout:     50 * time.Millisecond,
+			expectedErr: ErrVerificationTimeout,
+		},
+		{
+			name:  "no timeout",
+			delay: 10 * time.Millisecond,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &slowKmsClient{key: ec256KmsKey(), delay: tc.delay}
+			v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithKmsClient(client), WithTimeout(tc.timeout))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			start := time.Now()
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			if elapsed := time.Since(start); tc.timeout > 0 && elapsed > tc.timeout+5*time.Second {
+				t.Errorf("VerifyAttestation(_) took %v, expected at most about %v", elapsed, tc.timeout)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationTimeoutContextCancelled(t *testing.T) {
+	publicKey, err := NewPublicKey(Kms, EcdsaP256Sha256, []byte(kmsKeyName), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	client := &slowKmsClient{key: ec256KmsKey(), delay: time.Minute}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithKmsClient(client), WithTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = v.VerifyAttestationContext(ctx, &Attestation{PublicKeyID: publicKey.ID, Signature: []byte("signature"), SerializedPayload: []byte(validPayload)})
+	if err == nil || errors.Is(err, ErrVerificationTimeout) {
+		t.Errorf("VerifyAttestationContext(_) = %v, expected an error not matching %v", err, ErrVerificationTimeout)
+	}
+}
+
+func TestVerifyAttestationTimeoutInMemory(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	// The timeout passes before verification starts, but no backend is
+	// called.
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithTimeout(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	att := &Attestation{
+		PublicKeyID:       "ed25519-key",
+		Signature:         ed25519.Sign(ed25519PrivateKey, []byte(validPayload)),
+		SerializedPayload: []byte(validPayload),
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+	att.SerializedPayload = []byte(strings.Replace(validPayload, "hello-app", "other-app", -1))
+	if err := v.VerifyAttestation(att); err == nil || errors.Is(err, ErrVerificationTimeout) {
+		t.Errorf("VerifyAttestation(_) = %v, expected an error not matching %v", err, ErrVerificationTimeout)
+	}
+}
+
+func TestVerifyAttestationTimeoutDigestResolver(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	resolver := &blockingDigestResolver{}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithDigestResolver(resolver), WithTimeout(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	payload := taggedPayload("gcr.io/google-samples/hello-app:1.0")
+	att := &Attestation{
+		PublicKeyID:       "ed25519-key",
+		Signature:         ed25519.Sign(ed25519PrivateKey, []byte(payload)),
+		SerializedPayload: []byte(payload),
+	}
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrVerificationTimeout) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrVerificationTimeout)
+	}
+}
+
+// blockingDigestResolver blocks until the context of a resolution is done.
+type blockingDigestResolver struct{}
+
+func (blockingDigestResolver) ResolveDigest(ctx context.Context, tag string) (string, error) {
+	<-ctx.Done()
+	return "", ctx.Err()
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import "context"
+
+// Tracer starts the spans that trace the verification of Attestations, e.g.
+// for distributed tracing of admission requests. The package does not depend
+// on a tracing library; an adapter for OpenTelemetry only needs to wrap a
+// trace.Tracer and its spans in these methods. Its methods must be safe for
+// concurrent use.
+type Tracer interface {
+	// Start starts a span named `name` as a child of the span in `ctx`, if
+	// any, and returns a context holding the new span.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute sets an attribute of the span, whose value is a string,
+	// an int or a bool.
+	SetAttribute(key string, value interface{})
+	// RecordError records that the traced operation failed with `err`.
+	RecordError(err error)
+	// End ends the span.
+	End()
+}
+
+// Names of the spans started by the Verifier.
+const (
+	// SpanVerifyAttestation traces the verification of an Attestation.
+	SpanVerifyAttestation = "attestlib.VerifyAttestation"
+	// SpanVerifySignature traces the check of a signature with one public
+	// key. It is a child of SpanVerifyAttestation.
+	SpanVerifySignature = "attestlib.VerifySignature"
+	// SpanFetchKey traces the fetch of public keys from Cloud KMS, Vault or
+	// a JwksSource, including retries. It is a child of SpanVerifySignature,
+	// or of SpanVerifyAttestation for JWKS fetches.
+	SpanFetchKey = "attestlib.FetchKey"
+)
+
+// Attributes set on the spans started by the Verifier.
+const (
+	// AttributeKeyID is the ID of the public key that verified the
+	// Attestation, or that the signature was checked with.
+	AttributeKeyID = "attestlib.key_id"
+	// AttributeKeyType is the AuthenticatorType of that public key.
+	AttributeKeyType = "attestlib.key_type"
+	// AttributeOutcome is the VerificationOutcome of the verification.
+	AttributeOutcome = "attestlib.outcome"
+	// AttributeAttempts is the number of attempts a key fetch took.
+	AttributeAttempts = "attestlib.attempts"
+)
+
+// nopSpan is a Span that discards everything.
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {}
+
+func (nopSpan) RecordError(err error) {}
+
+func (nopSpan) End() {}
+
+// tracerKey is the context key of the Tracer of a verification.
+type tracerKey struct{}
+
+// withTracer returns a context from which startSpan starts spans with
+// `tracer`. The Tracer travels with the context so that nested operations,
+// such as key fetches, can start child spans.
+func withTracer(ctx context.Context, tracer Tracer) context.Context {
+	if tracer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// startSpan starts a span with the Tracer of `ctx`. If `ctx` carries no
+// Tracer, the span is a no-op.
+func startSpan(ctx context.Context, name string) (context.Context, Span) {
+	tracer, ok := ctx.Value(tracerKey{}).(Tracer)
+	if !ok {
+		return ctx, nopSpan{}
+	}
+	return tracer.Start(ctx, name)
+}
+
+// endSpan records the outcome of an operation on `span` and ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// traceSignature checks a signature with `publicKey` by calling `verify` in
+// a SpanVerifySignature span.
+func traceSignature(ctx context.Context, publicKey PublicKey, verify func(ctx context.Context) error) error {
+	ctx, span := startSpan(ctx, SpanVerifySignature)
+	span.SetAttribute(AttributeKeyID, publicKey.ID)
+	span.SetAttribute(AttributeKeyType, publicKey.AuthenticatorType.String())
+	err := verify(ctx)
+	endSpan(span, err)
+	return err
+}
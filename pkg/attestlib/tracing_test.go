@@ -0,0 +1,223 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// recordedSpan is a span recorded by a recordingTracer.
+type recordedSpan struct {
+	name       string
+	parent     string
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+// recordingTracer is an in-memory Tracer that records every span it starts.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+type recordedSpanKey struct{}
+
+func (t *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	span := &recordedSpan{name: name, attributes: map[string]interface{}{}}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return context.WithValue(ctx, recordedSpanKey{}, span), &recordingSpan{tracer: t, span: span}
+}
+
+// ended returns the spans that have ended, in the order they were started.
+func (t *recordingTracer) ended() []recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spans []recordedSpan
+	for _, span := range t.spans {
+		if span.ended {
+			spans = append(spans, *span)
+		}
+	}
+	return spans
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.attributes[key] = value
+}
+
+func (s *recordingSpan) RecordError(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.err = err
+}
+
+func (s *recordingSpan) End() {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.span.ended = true
+}
+
+func TestVerifyAttestationTracing(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	tcs := []struct {
+		name          string
+		att           *Attestation
+		expectedSpans []recordedSpan
+		expectedErr   error
+	}{
+		{
+			name: "verified",
+			att:  &Attestation{PublicKeyID: "signing-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expectedSpans: []recordedSpan{
+				{
+					name:       SpanVerifyAttestation,
+					attributes: map[string]interface{}{AttributeKeyID: "signing-key", AttributeKeyType: "ed25519", AttributeOutcome: "success"},
+				},
+				{
+					name:       SpanVerifySignature,
+					parent:     SpanVerifyAttestation,
+					attributes: map[string]interface{}{AttributeKeyID: "signing-key", AttributeKeyType: "ed25519"},
+				},
+			},
+		},
+		{
+			name: "bad signature",
+			att:  &Attestation{PublicKeyID: "signing-key", Signature: signature, SerializedPayload: []byte(otherDigestPayload)},
+			expectedSpans: []recordedSpan{
+				{
+					name:       SpanVerifyAttestation,
+					attributes: map[string]interface{}{AttributeKeyType: "ed25519", AttributeOutcome: "bad-signature"},
+				},
+				{
+					name:       SpanVerifySignature,
+					parent:     SpanVerifyAttestation,
+					attributes: map[string]interface{}{AttributeKeyID: "signing-key", AttributeKeyType: "ed25519"},
+				},
+			},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name: "no matching key",
+			att:  &Attestation{PublicKeyID: "other-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			expectedSpans: []recordedSpan{
+				{
+					name:       SpanVerifyAttestation,
+					attributes: map[string]interface{}{AttributeKeyType: "unknown", AttributeOutcome: "no-key"},
+				},
+			},
+			expectedErr: ErrNoMatchingKey,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tracer := &recordingTracer{}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithTracer(tracer))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+			spans := tracer.ended()
+			if len(spans) != len(tc.expectedSpans) {
+				t.Fatalf("got %d ended spans %+v, expected %d", len(spans), spans, len(tc.expectedSpans))
+			}
+			for i, expected := range tc.expectedSpans {
+				span := spans[i]
+				if span.name != expected.name || span.parent != expected.parent {
+					t.Errorf("span %d is %q with parent %q, expected %q with parent %q", i, span.name, span.parent, expected.name, expected.parent)
+				}
+				if !reflect.DeepEqual(span.attributes, expected.attributes) {
+					t.Errorf("span %q has attributes %v, expected %v", span.name, span.attributes, expected.attributes)
+				}
+				if (span.err != nil) != (tc.expectedErr != nil) {
+					t.Errorf("span %q recorded error %v, expected error: %v", span.name, span.err, tc.expectedErr != nil)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationTracingKeyFetch(t *testing.T) {
+	client := &fakeKmsClient{key: ec256KmsKey(), errs: []error{status.Error(codes.Unavailable, "try again")}}
+	signer, err := NewPkixSigner([]byte(ec256PrivateKey), EcdsaP256Sha256, kmsKeyName)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := CreateImageAttestation(signer, helloAppImage)
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	publicKey, err := NewPublicKey(Kms, EcdsaP256Sha256, []byte(kmsKeyName), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	tracer := &recordingTracer{}
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithKmsClient(client), WithTracer(tracer), WithKeyFetchRetry(3, 0))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+
+	var fetch *recordedSpan
+	for _, span := range tracer.ended() {
+		if span.name == SpanFetchKey {
+			span := span
+			fetch = &span
+		}
+	}
+	if fetch == nil {
+		t.Fatalf("no %q span recorded", SpanFetchKey)
+	}
+	if fetch.parent != SpanVerifySignature {
+		t.Errorf("%q span has parent %q, expected %q", SpanFetchKey, fetch.parent, SpanVerifySignature)
+	}
+	if got := fetch.attributes[AttributeAttempts]; got != 2 {
+		t.Errorf("%q span has %v attempts, expected 2", SpanFetchKey, got)
+	}
+	if fetch.err != nil {
+		t.Errorf("%q span recorded error %v, expected nil", SpanFetchKey, fetch.err)
+	}
+}
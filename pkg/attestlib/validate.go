@@ -0,0 +1,103 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// AttestationValidator reports every problem of an Attestation rather than
+// only the first, e.g. for operator tooling that validates a batch of
+// Attestations. It is meant for diagnostics: use a Verifier to admit images.
+type AttestationValidator interface {
+	// ValidateAttestation runs every check of VerifyAttestation on an
+	// Attestation, continuing after a failed check, and returns the problems
+	// found in the order of the checks: the public key match and the
+	// signature, the validity period of the public key, the payload and image
+	// digest, the age of the payload, and the policy set with WithPolicy. It
+	// returns nil if the Attestation would be verified. The detached payload of an Attestation whose
+	// signature does not verify is still checked, but the payload of other
+	// Attestations is only known once their signature is verified. The policy
+	// is only evaluated on payloads that passed every other check. Validations
+	// are not recorded by metrics, traces or OnVerify callbacks.
+	ValidateAttestation(att *Attestation) []error
+}
+
+// NewAttestationValidator creates an AttestationValidator for the image
+// `image`, whose arguments are those of NewVerifier.
+func NewAttestationValidator(image string, publicKeySet []PublicKey, opts ...VerifierOption) (AttestationValidator, error) {
+	imageName, imageDigest, err := parseImageName(image)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image name: %v", err)
+	}
+	return newVerifier(imageName, imageDigest, publicKeySet, opts...)
+}
+
+// ValidateAttestation reports every problem of an Attestation. See
+// AttestationValidator for more details.
+func (v *verifier) ValidateAttestation(att *Attestation) []error {
+	v = v.current()
+	if att == nil {
+		return []error{errors.New("attestation is nil")}
+	}
+	ctx := context.Background()
+	decoded, err := v.decodeAttestation(att)
+	if err != nil {
+		return []error{err}
+	}
+	var problems []error
+	signed, err := v.verifyAttestationSignature(ctx, decoded)
+	publicKeys := []PublicKey{signed.publicKey}
+	if err != nil {
+		problems = append(problems, err)
+		// Check the keys the Attestation names and its unverified detached
+		// payload, which are known without a verified signature. Signature
+		// verification may already have checked the validity of the keys.
+		publicKeys = nil
+		if !errors.Is(err, ErrKeyNotValid) {
+			publicKeys = v.publicKeysByID(decoded.PublicKeyID)
+		}
+		if decoded.EnvelopeType == NoEnvelope && decoded.SigstoreBundle == nil {
+			signed.payload = decoded.SerializedPayload
+		}
+	}
+	for _, publicKey := range publicKeys {
+		if err := publicKey.checkValidityPeriod(v.currentTime()); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if len(signed.payload) > 0 {
+		authAtt, err := v.checkPayload(ctx, signed.payload, signed.payloadType)
+		if err != nil {
+			problems = append(problems, err)
+		}
+		if authAtt != nil {
+			if err := v.checkFreshness(authAtt); err != nil {
+				problems = append(problems, err)
+			}
+		}
+		// Policies must only see verified payloads.
+		if len(problems) == 0 {
+			if err := v.evaluatePolicy(ctx, signed.payload); err != nil {
+				problems = append(problems, err)
+			}
+		}
+	}
+	return problems
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidateAttestation(t *testing.T) {
+	now := time.Now()
+	validKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	expiredKey := validKey
+	expiredKey.NotAfter = now.Add(-time.Hour)
+	sign := func(payload string) []byte {
+		return ed25519.Sign(ed25519PrivateKey, []byte(payload))
+	}
+	corrupt := func(signature []byte) []byte {
+		signature = append([]byte{}, signature...)
+		signature[0] ^= 0xff
+		return signature
+	}
+
+	tcs := []struct {
+		name           string
+		publicKey      PublicKey
+		opts           []VerifierOption
+		att            *Attestation
+		expectedErrors []error
+	}{
+		{
+			name:      "valid attestation",
+			publicKey: validKey,
+			att:       &Attestation{PublicKeyID: "ed25519-key", Signature: sign(validPayload), SerializedPayload: []byte(validPayload)},
+		},
+		{
+			name:           "invalid signature",
+			publicKey:      validKey,
+			att:            &Attestation{PublicKeyID: "ed25519-key", Signature: corrupt(sign(validPayload)), SerializedPayload: []byte(validPayload)},
+			expectedErrors: []error{ErrSignatureInvalid},
+		},
+		{
+			name:           "invalid signature and digest mismatch",
+			publicKey:      validKey,
+			att:            &Attestation{PublicKeyID: "ed25519-key", Signature: corrupt(sign(otherDigestPayload)), SerializedPayload: []byte(otherDigestPayload)},
+			expectedErrors: []error{ErrSignatureInvalid, ErrPayloadMismatch},
+		},
+		{
+			name:           "no matching key and invalid payload",
+			publicKey:      validKey,
+			att:            &Attestation{PublicKeyID: "other-key", Signature: sign(invalidPayload), SerializedPayload: []byte(invalidPayload)},
+			expectedErrors: []error{ErrNoMatchingKey, ErrInvalidPayload},
+		},
+		{
+			name:           "expired key, digest mismatch and stale payload",
+			publicKey:      expiredKey,
+			opts:           []VerifierOption{WithMaxAge(time.Hour)},
+			att:            &Attestation{PublicKeyID: "ed25519-key", Signature: sign(otherDigestPayload), SerializedPayload: []byte(otherDigestPayload)},
+			expectedErrors: []error{ErrKeyNotValid, ErrPayloadMismatch, ErrAttestationStale},
+		},
+		{
+			name:           "every check fails",
+			publicKey:      expiredKey,
+			opts:           []VerifierOption{WithMaxAge(time.Hour)},
+			att:            &Attestation{PublicKeyID: "ed25519-key", Signature: corrupt(sign(otherDigestPayload)), SerializedPayload: []byte(otherDigestPayload)},
+			expectedErrors: []error{ErrSignatureInvalid, ErrKeyNotValid, ErrPayloadMismatch, ErrAttestationStale},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]VerifierOption{WithClock(ClockFunc(func() time.Time { return now }))}, tc.opts...)
+			validator, err := NewAttestationValidator(helloAppImage, []PublicKey{tc.publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating validator: %v", err)
+			}
+			problems := validator.ValidateAttestation(tc.att)
+			if len(problems) != len(tc.expectedErrors) {
+				t.Fatalf("ValidateAttestation(_) = %v, expected %d problems matching %v", problems, len(tc.expectedErrors), tc.expectedErrors)
+			}
+			for i, expected := range tc.expectedErrors {
+				if !errors.Is(problems[i], expected) {
+					t.Errorf("ValidateAttestation(_)[%d] = %v, want error matching %v", i, problems[i], expected)
+				}
+			}
+
+			// VerifyAttestation stops at the first problem.
+			v, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if len(tc.expectedErrors) == 0 {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErrors[0]) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErrors[0])
+			}
+		})
+	}
+}
+
+func TestValidateAttestationNil(t *testing.T) {
+	validator, err := NewAttestationValidator(helloAppImage, nil)
+	if err != nil {
+		t.Fatalf("error creating validator: %v", err)
+	}
+	if problems := validator.ValidateAttestation(nil); len(problems) != 1 {
+		t.Errorf("ValidateAttestation(nil) = %v, expected one problem", problems)
+	}
+}
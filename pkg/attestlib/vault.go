@@ -0,0 +1,241 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// VaultClient reads secrets from HashiCorp Vault. It returns the "data" field
+// of the response to a read of `path`, e.g. the result of
+// `client.Logical().ReadWithContext(ctx, path)` from
+// github.com/hashicorp/vault/api.
+type VaultClient interface {
+	Read(ctx context.Context, path string) (map[string]interface{}, error)
+}
+
+// vaultTransitKey is the response of the Vault transit engine to a read of
+// transit/keys/<name>.
+type vaultTransitKey struct {
+	Type          string                         `json:"type"`
+	LatestVersion int                            `json:"latest_version"`
+	Keys          map[string]vaultTransitVersion `json:"keys"`
+}
+
+type vaultTransitVersion struct {
+	PublicKey string `json:"public_key"`
+}
+
+// vaultKeyVersions holds the parsed public keys of a transit key by version.
+type vaultKeyVersions struct {
+	keys          map[int]crypto.PublicKey
+	latestVersion int
+	fetched       time.Time
+}
+
+type vaultVerifierImpl struct {
+	client VaultClient
+	// retry controls how errors reading transit keys are retried.
+	retry retryPolicy
+	// keyStrength is the minimum strength of the public keys.
+	keyStrength keyStrengthPolicy
+	// ttl is how long fetched public keys are cached.
+	ttl   time.Duration
+	clock Clock
+
+	mu sync.Mutex
+	// keys caches the public keys fetched from Vault by path.
+	keys map[string]*vaultKeyVersions
+}
+
+func newVaultVerifier(client VaultClient, ttl time.Duration) *vaultVerifierImpl {
+	return &vaultVerifierImpl{
+		client:      client,
+		retry:       defaultRetryPolicy,
+		keyStrength: defaultKeyStrength,
+		ttl:         ttl,
+		clock:       SystemClock,
+		keys:        map[string]*vaultKeyVersions{},
+	}
+}
+
+// verifyVault verifies a detached signature over `payload` with a public key
+// held in the Vault transit engine. `publicKey.KeyData` is the path of the
+// transit key, e.g. "transit/keys/my-key". `signature` is either a raw
+// signature, which is verified with the latest version of the key, or a
+// signature in Vault's "vault:v<version>:<base64 signature>" format. Keys
+// weaker than `v.keyStrength` are rejected with ErrKeyTooWeak.
+func (v *vaultVerifierImpl) verifyVault(ctx context.Context, signature []byte, payload []byte, publicKey PublicKey) error {
+	version, signature, err := parseVaultSignature(signature)
+	if err != nil {
+		return err
+	}
+	path := string(publicKey.KeyData)
+	versions, err := v.keyVersions(ctx, path)
+	if err != nil {
+		return err
+	}
+	if version == 0 {
+		version = versions.latestVersion
+	}
+	pub, ok := versions.keys[version]
+	if !ok {
+		return fmt.Errorf("Vault transit key %q has no version %d", path, version)
+	}
+
+	if edKey, ok := pub.(ed25519.PublicKey); ok {
+		if publicKey.SignatureAlgorithm != EddsaEd25519 {
+			return fmt.Errorf("Vault transit key %q is an Ed25519 key, but public key %q expects %v", path, publicKey.ID, publicKey.SignatureAlgorithm)
+		}
+		if !ed25519.Verify(edKey, payload, signature) {
+			return errors.New("failed to verify Ed25519 signature")
+		}
+		return nil
+	}
+	if err := v.keyStrength.check(pub); err != nil {
+		return fmt.Errorf("%w: Vault transit key %q: %v", ErrKeyTooWeak, path, err)
+	}
+	if err := verifyDetachedWithKey(signature, pub, publicKey.SignatureAlgorithm, payload); err != nil {
+		return errors.Wrapf(err, "error verifying signature with Vault transit key %q", path)
+	}
+	return nil
+}
+
+// parseVaultSignature splits a signature in Vault's
+// "vault:v<version>:<base64 signature>" format into its version and raw
+// signature. Other signatures are returned as is, with version 0.
+func parseVaultSignature(signature []byte) (int, []byte, error) {
+	parts := strings.SplitN(string(signature), ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return 0, signature, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil || version <= 0 {
+		return 0, nil, fmt.Errorf("invalid Vault signature version %q", parts[1])
+	}
+	raw, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "error decoding Vault signature")
+	}
+	return version, raw, nil
+}
+
+// keyVersions returns the cached public keys of the transit key at `path`,
+// fetching them from Vault if they are missing or older than the TTL.
+func (v *vaultVerifierImpl) keyVersions(ctx context.Context, path string) (*vaultKeyVersions, error) {
+	v.mu.Lock()
+	versions, ok := v.keys[path]
+	v.mu.Unlock()
+	if ok && v.clock.Now().Sub(versions.fetched) < v.ttl {
+		return versions, nil
+	}
+	return v.fetchKeyVersions(ctx, path)
+}
+
+// checkKey reads the transit key of `publicKey` from Vault, even if it is
+// cached.
+func (v *vaultVerifierImpl) checkKey(ctx context.Context, publicKey PublicKey) error {
+	_, err := v.fetchKeyVersions(ctx, string(publicKey.KeyData))
+	return err
+}
+
+// fetchKeyVersions reads the public keys of the transit key at `path` from
+// Vault and caches them.
+func (v *vaultVerifierImpl) fetchKeyVersions(ctx context.Context, path string) (*vaultKeyVersions, error) {
+	var data map[string]interface{}
+	// Errors of VaultClient are opaque, so every failed read is retried.
+	attempts, err := v.retry.do(ctx, func(error) bool { return true }, func() error {
+		var err error
+		data, err = v.client.Read(ctx, path)
+		return err
+	})
+	if err != nil && err == ctx.Err() {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading Vault transit key %q after %d attempts: %v", ErrRetriesExhausted, path, attempts, err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("Vault transit key %q not found", path)
+	}
+	versions, err := parseVaultTransitKey(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing Vault transit key %q", path)
+	}
+	versions.fetched = v.clock.Now()
+
+	v.mu.Lock()
+	v.keys[path] = versions
+	v.mu.Unlock()
+	return versions, nil
+}
+
+// parseVaultTransitKey parses the public keys in the response to a read of a
+// transit key. Ed25519 public keys are base64 encoded, while ECDSA and RSA
+// public keys are PEM encoded.
+func parseVaultTransitKey(data map[string]interface{}) (*vaultKeyVersions, error) {
+	// Round trip through JSON, since Vault clients decode responses into
+	// generic maps.
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	transitKey := vaultTransitKey{}
+	if err := json.Unmarshal(encoded, &transitKey); err != nil {
+		return nil, err
+	}
+
+	versions := &vaultKeyVersions{keys: map[int]crypto.PublicKey{}, latestVersion: transitKey.LatestVersion}
+	for versionStr, key := range transitKey.Keys {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key version %q", versionStr)
+		}
+		var pub crypto.PublicKey
+		if transitKey.Type == "ed25519" {
+			raw, err := base64.StdEncoding.DecodeString(key.PublicKey)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error decoding version %d", version)
+			}
+			pub, err = parseEd25519PublicKey(raw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error parsing version %d", version)
+			}
+		} else {
+			pub, err = parsePkixPublicKey([]byte(key.PublicKey))
+			if err != nil {
+				return nil, errors.Wrapf(err, "error parsing version %d", version)
+			}
+		}
+		versions.keys[version] = pub
+	}
+	if _, ok := versions.keys[versions.latestVersion]; !ok {
+		return nil, fmt.Errorf("latest version %d has no public key", versions.latestVersion)
+	}
+	return versions, nil
+}
@@ -0,0 +1,213 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+const vaultKeyPath = "transit/keys/attestor"
+
+// fakeVaultClient returns `data` for reads of vaultKeyPath, or `err` if set.
+type fakeVaultClient struct {
+	data  map[string]interface{}
+	err   error
+	calls int
+}
+
+func (c *fakeVaultClient) Read(ctx context.Context, path string) (map[string]interface{}, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	if path != vaultKeyPath {
+		return nil, nil
+	}
+	return c.data, nil
+}
+
+// vaultTransitKeyData builds a transit key read response. Versions are
+// numbered from 1 in the order of `publicKeys`.
+func vaultTransitKeyData(keyType string, publicKeys ...string) map[string]interface{} {
+	keys := map[string]interface{}{}
+	for i, publicKey := range publicKeys {
+		keys[fmt.Sprint(i+1)] = map[string]interface{}{"public_key": publicKey}
+	}
+	return map[string]interface{}{
+		"type":           keyType,
+		"latest_version": len(publicKeys),
+		"keys":           keys,
+	}
+}
+
+func vaultSignature(version int, signature []byte) []byte {
+	return []byte(fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString(signature)))
+}
+
+func TestVerifyVault(t *testing.T) {
+	ecSignature, err := ecSignForTest([]byte(ec256PrivateKey), EcdsaP256Sha256)
+	if err != nil {
+		t.Fatalf("error signing payload: %v", err)
+	}
+	edSignature := ed25519.Sign(ed25519PrivateKey, []byte(payload))
+	edKeyData := base64.StdEncoding.EncodeToString(ed25519PubKey)
+	otherEdKeyData := base64.StdEncoding.EncodeToString(otherEd25519PubKey)
+	tcs := []struct {
+		name        string
+		data        map[string]interface{}
+		alg         SignatureAlgorithm
+		signature   []byte
+		expectedErr bool
+	}{
+		{
+			name:      "ecdsa key with raw signature",
+			data:      vaultTransitKeyData("ecdsa-p256", ec256PubKey),
+			alg:       EcdsaP256Sha256,
+			signature: ecSignature,
+		},
+		{
+			name:      "ecdsa key with vault signature",
+			data:      vaultTransitKeyData("ecdsa-p256", ec256PubKey),
+			alg:       EcdsaP256Sha256,
+			signature: vaultSignature(1, ecSignature),
+		},
+		{
+			name:      "ed25519 key signed with older version",
+			data:      vaultTransitKeyData("ed25519", edKeyData, otherEdKeyData),
+			alg:       EddsaEd25519,
+			signature: vaultSignature(1, edSignature),
+		},
+		{
+			name:        "raw signature verified with latest version",
+			data:        vaultTransitKeyData("ed25519", edKeyData, otherEdKeyData),
+			alg:         EddsaEd25519,
+			signature:   edSignature,
+			expectedErr: true,
+		},
+		{
+			name:        "unknown version",
+			data:        vaultTransitKeyData("ed25519", edKeyData),
+			alg:         EddsaEd25519,
+			signature:   vaultSignature(2, edSignature),
+			expectedErr: true,
+		},
+		{
+			name:        "ed25519 key with ecdsa algorithm",
+			data:        vaultTransitKeyData("ed25519", edKeyData),
+			alg:         EcdsaP256Sha256,
+			signature:   edSignature,
+			expectedErr: true,
+		},
+		{
+			name:        "malformed public key",
+			data:        vaultTransitKeyData("ecdsa-p256", badKey),
+			alg:         EcdsaP256Sha256,
+			signature:   ecSignature,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := newVaultVerifier(&fakeVaultClient{data: tc.data}, time.Minute)
+			publicKey := PublicKey{AuthenticatorType: Vault, SignatureAlgorithm: tc.alg, KeyData: []byte(vaultKeyPath), ID: "vault-key"}
+			err := v.verifyVault(context.Background(), tc.signature, []byte(payload), publicKey)
+			if tc.expectedErr {
+				if err == nil {
+					t.Errorf("verifyVault(...) = nil, expected non nil")
+				}
+			} else if err != nil {
+				t.Errorf("verifyVault(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestVerifyVaultCache(t *testing.T) {
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(payload))
+	publicKey := PublicKey{AuthenticatorType: Vault, SignatureAlgorithm: EddsaEd25519, KeyData: []byte(vaultKeyPath), ID: "vault-key"}
+	client := &fakeVaultClient{data: vaultTransitKeyData("ed25519", base64.StdEncoding.EncodeToString(ed25519PubKey))}
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	v := newVaultVerifier(client, time.Minute)
+	v.clock = ClockFunc(func() time.Time { return now })
+
+	verify := func(expectedCalls int) {
+		t.Helper()
+		if err := v.verifyVault(context.Background(), signature, []byte(payload), publicKey); err != nil {
+			t.Errorf("verifyVault(...) = %v, expected nil", err)
+		}
+		if client.calls != expectedCalls {
+			t.Errorf("Read called %d times, want %d", client.calls, expectedCalls)
+		}
+	}
+	verify(1)
+	// Cache hit.
+	now = now.Add(30 * time.Second)
+	verify(1)
+	// Cache expiry.
+	now = now.Add(time.Minute)
+	verify(2)
+
+	// Fetch failure once the cache has expired again.
+	now = now.Add(2 * time.Minute)
+	client.err = errors.New("vault sealed")
+	if err := v.verifyVault(context.Background(), signature, []byte(payload), publicKey); err == nil {
+		t.Errorf("verifyVault(...) = nil, expected non nil")
+	}
+}
+
+func TestVerifyVaultAttestation(t *testing.T) {
+	client := &fakeVaultClient{data: vaultTransitKeyData("ed25519", base64.StdEncoding.EncodeToString(ed25519PubKey))}
+	publicKey, err := NewPublicKey(Vault, EddsaEd25519, []byte(vaultKeyPath), "")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	att := &Attestation{PublicKeyID: vaultKeyPath, Signature: vaultSignature(1, ed25519.Sign(ed25519PrivateKey, []byte(validPayload))), SerializedPayload: []byte(validPayload)}
+
+	v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithVaultClient(client, time.Minute))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(att); err != nil {
+		t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+	}
+
+	v, err = NewVerifier(helloAppImage, []PublicKey{*publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	if err := v.VerifyAttestation(att); !errors.Is(err, ErrUnsupportedKeyType) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrUnsupportedKeyType)
+	}
+}
+
+func ecSignForTest(privateKey []byte, alg SignatureAlgorithm) ([]byte, error) {
+	signer, err := NewPkixSigner(privateKey, alg, "")
+	if err != nil {
+		return nil, err
+	}
+	att, err := signer.CreateAttestation([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+	return att.Signature, nil
+}
@@ -17,10 +17,16 @@ limitations under the License.
 package attestlib
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"github.com/golang/glog"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 )
 
@@ -29,39 +35,332 @@ type Verifier interface {
 	// VerifyAttestation verifies whether an Attestation satisfies at least one
 	// of the public keys under an image. This function finds the public key
 	// whose ID matches the attestation's PublicKeyID, and uses this key to
-	// verify the signature.
+	// verify the signature. The key must be within its validity period.
 	VerifyAttestation(att *Attestation) error
+	// VerifyAttestationContext is like VerifyAttestation, but stops verifying
+	// and returns ctx.Err() once `ctx` is cancelled or its deadline passes.
+	VerifyAttestationContext(ctx context.Context, att *Attestation) error
+	// VerifyAttestationWithResult is like VerifyAttestation, but also returns
+	// details about the successful verification, such as the ID of the
+	// public key that verified the Attestation.
+	VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error)
+	// VerifyAttestationStream is like VerifyAttestationWithResult, but reads
+	// the payload of a Pkix or Ed25519 Attestation from `payload` instead of
+	// SerializedPayload, which must be empty. Pkix signatures are checked
+	// against a digest computed as the payload is read. The payload must be
+	// a JSON object; the predicate of an in-toto Statement is skipped rather
+	// than buffered, so the result has no predicate.
+	VerifyAttestationStream(att *Attestation, payload io.Reader) (*VerificationResult, error)
+	// VerifyOrExplain is like VerifyAttestation, but reports whether the
+	// Attestation was verified and, if it was not, a human-readable
+	// explanation for debugging admission denials: whether a public key was
+	// found, which key types were tried, whether the signature decoded and
+	// verified, and whether the image digest matched. The explanation names
+	// public keys by ID, but never contains key material or the payload.
+	VerifyOrExplain(att *Attestation) (bool, string)
+	// VerifyAttestations verifies several Attestations for the same image and
+	// returns one result per Attestation, which is nil if it was verified. It
+	// returns an error unless the Attestations were verified by at least
+	// `minVerified` distinct public keys.
+	VerifyAttestations(atts []*Attestation, minVerified int) ([]error, error)
+	// VerifyQuorum verifies Attestations for the same image and returns nil
+	// only if at least `threshold` distinct public keys verified them, e.g.
+	// to require Attestations from two of three signers.
+	VerifyQuorum(atts []*Attestation, threshold int) error
+	// SelfTest checks, without verifying an Attestation, that the Verifier
+	// can be used, e.g. for readiness probes: that its public keys are valid
+	// and its key backends, such as Cloud KMS, Vault or a JWKS source, are
+	// reachable. It returns an error wrapping ErrSelfTestFailed that lists
+	// every failure.
+	SelfTest(ctx context.Context) error
+	// RegisteredKeys returns the ID and AuthenticatorType of each public key
+	// the Verifier holds, e.g. for diagnostics. It never returns key
+	// material. Public keys fetched from a JWKS source are not included.
+	RegisteredKeys() []KeyInfo
+}
+
+// VerificationResult describes a successfully verified Attestation.
+type VerificationResult struct {
+	// KeyID is the ID of the public key that verified the Attestation.
+	KeyID string
+	// KeyType is the AuthenticatorType of the public key that verified the
+	// Attestation.
+	KeyType AuthenticatorType
+	// ImageDigest is the digest of the image the verifier was created for.
+	// The verified payload contains it, or one of the verifier's acceptable
+	// digests.
+	ImageDigest string
+	// PredicateType is the predicate type of a verified in-toto Statement.
+	PredicateType string
+	// SubjectDigests holds the digests of every subject of a verified in-toto
+	// Statement, in order, including those of images other than the one the
+	// verifier was created for, followed by the digests of its build inputs
+	// if it is parsed by ProvenancePayloadParser. It is empty for other
+	// payloads.
+	SubjectDigests []string
+	// PayloadType is the payloadType of a verified DSSE envelope, e.g.
+	// InTotoPayloadType. It is empty for other Attestations.
+	PayloadType string
+	// Signatures holds the result of each signature of an Attestation that is
+	// not wrapped in an envelope, in order. An Attestation without
+	// Signatures has a single result for its Signature.
+	Signatures []SignatureResult
+	// ValidUntil is the time at which the verification stops being valid
+	// because a public key that verified it passes its NotAfter, the
+	// Attestation exceeds the maximum age set by WithMaxAge, or a verified JWT
+	// expires. It is zero if none of these apply.
+	ValidUntil time.Time
+
+	// predicate holds the authenticated JSON predicate of a verified in-toto
+	// Statement. It is only exposed through Predicate and UnmarshalPredicate,
+	// so that callers cannot mistake unverified data for it. A string keeps
+	// it immutable.
+	predicate string
+	// claims holds the JSON claims of a verified JWT, once its signature and
+	// registered claims have been validated. It is only exposed through
+	// Claims and UnmarshalClaims.
+	claims string
+}
+
+// VerifiedKeyIDs returns the distinct IDs of the public keys that verified a
+// signature of the Attestation, in the order of the signatures.
+func (r *VerificationResult) VerifiedKeyIDs() []string {
+	return verifiedKeyIDs(r.KeyID, r.Signatures)
+}
+
+// Predicate returns a copy of the predicate of the verified in-toto Statement
+// as raw JSON, or nil if the payload has no predicate.
+func (r *VerificationResult) Predicate() []byte {
+	if r.predicate == "" {
+		return nil
+	}
+	return []byte(r.predicate)
+}
+
+// Claims returns the claims of the verified JWT, including custom claims, or
+// nil if the Attestation was not verified by a Jwt key. JSON numbers are
+// decoded as float64. Each call returns a new map.
+func (r *VerificationResult) Claims() map[string]interface{} {
+	if r.claims == "" {
+		return nil
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(r.claims), &claims); err != nil {
+		return nil
+	}
+	return claims
+}
+
+// UnmarshalClaims parses the claims of the verified JWT into `v`.
+func (r *VerificationResult) UnmarshalClaims(v interface{}) error {
+	if r.claims == "" {
+		return errors.New("verified attestation has no JWT claims")
+	}
+	if err := json.Unmarshal([]byte(r.claims), v); err != nil {
+		return errors.Wrap(err, "error parsing JWT claims")
+	}
+	return nil
+}
+
+// UnmarshalPredicate parses the predicate of the verified in-toto Statement
+// into `v`, e.g. a vulnerability scan result or provenance.
+func (r *VerificationResult) UnmarshalPredicate(v interface{}) error {
+	if r.predicate == "" {
+		return errors.New("verified attestation has no predicate")
+	}
+	if err := json.Unmarshal([]byte(r.predicate), v); err != nil {
+		return errors.Wrap(err, "error parsing predicate")
+	}
+	return nil
 }
 
 type pkixVerifier interface {
-	verifyPkix(signature []byte, payload []byte, publicKey []byte) error
+	verifyPkix(signature []byte, payload []byte, publicKey PublicKey) error
 }
 
 type pgpVerifier interface {
-	verifyPgp(signature, publicKey []byte) ([]byte, error)
+	verifyPgp(signature []byte, publicKey PublicKey, now time.Time) ([]byte, string, error)
+	verifyPgpDetached(signature []byte, payload []byte, publicKey PublicKey, now time.Time) (string, error)
 }
 
 type jwtVerifier interface {
-	verifyJwt(signature []byte, publicKey PublicKey) ([]byte, error)
+	verifyJwt(signature []byte, publicKey PublicKey, now time.Time) ([]byte, error)
+	verifyJwtDetached(signature []byte, payload []byte, publicKey PublicKey, now time.Time) error
+}
+
+type ed25519Verifier interface {
+	verifyEd25519(signature []byte, payload []byte, publicKey PublicKey) error
+}
+
+type kmsVerifier interface {
+	verifyKms(ctx context.Context, signature []byte, payload []byte, publicKey PublicKey) error
+}
+
+type vaultVerifier interface {
+	verifyVault(ctx context.Context, signature []byte, payload []byte, publicKey PublicKey) error
 }
 
-type convertFunc func(payload []byte) (*authenticatedAttestation, error)
+// ConvertFunc extracts an AuthenticatedAttestation from a verified payload
+// with the Verifier's PayloadParser.
+type ConvertFunc func(payload []byte) (*AuthenticatedAttestation, error)
 
-type authenticatedAttChecker interface {
-	checkAuthenticatedAttestation(payload []byte, imageName string, imageDigest string, convert convertFunc) error
+// AuthenticatedAttChecker decides whether a payload whose signature has been
+// verified is acceptable for the image being verified. `imageDigests` are the
+// equivalent digests of the image. Implementations should extract the payload
+// with `convert`, which also makes the AuthenticatedAttestation available to
+// the VerificationResult, and return an error to reject it.
+type AuthenticatedAttChecker interface {
+	CheckAuthenticatedAttestation(payload []byte, imageName string, imageDigests []string, convert ConvertFunc) error
 }
 
+// DefaultAuthenticatedAttChecker accepts payloads whose image digest, or one
+// of whose in-toto subject digests, is a digest of the image. It is used
+// unless the Verifier is created with WithAuthenticatedAttChecker, and custom
+// checkers can call it before applying their own conditions.
+var DefaultAuthenticatedAttChecker AuthenticatedAttChecker = authenticatedAttCheckerImpl{}
+
 type verifier struct {
 	ImageName   string
 	ImageDigest string
-	// PublicKeys is an index of public keys by their ID.
-	PublicKeys map[string]PublicKey
+	// PublicKeys is an index of public keys by their ID. Several keys may
+	// share an ID unless the verifier is strict about key IDs.
+	PublicKeys map[string][]PublicKey
+	// maxGzipPayloadSize is the size limit of decompressed gzip payloads. If
+	// zero, payloads are not decompressed.
+	maxGzipPayloadSize int64
+	// maxSignatureSize, maxPayloadSize, maxDecodedPayloadSize and
+	// maxStreamedPayloadSize are the size limits of signatures, serialized
+	// payloads, payloads decoded from verified signatures and payloads read by
+	// VerifyAttestationStream. Zero or less means no limit.
+	maxSignatureSize       int64
+	maxPayloadSize         int64
+	maxDecodedPayloadSize  int64
+	maxStreamedPayloadSize int64
+	// extractOnly is set for verifiers created without an image digest. They
+	// only extract the digests of verified payloads, which the caller then
+	// compares.
+	extractOnly bool
+	// acceptableDigests are digests equivalent to ImageDigest, e.g. of a
+	// rebuilt manifest, that verified payloads may contain instead.
+	acceptableDigests []string
+	// onVerify are the callbacks called after every verification.
+	onVerify []func(VerificationEvent)
+	// timeout bounds the time a verification waits for remote backends. Zero
+	// means no bound.
+	timeout time.Duration
+	// imageIndex is the multi-arch image index that ImageDigest belongs to,
+	// if any.
+	imageIndex *imageIndex
+	// keyTrialLimit is the maximum number of candidate keys tried when no
+	// public key matches an Attestation's PublicKeyID. Zero or less disables
+	// key trial.
+	keyTrialLimit int
+	// keyTrialWorkers is the maximum number of candidate keys tried
+	// concurrently during key trial. One or less tries them serially.
+	keyTrialWorkers int
+	// clock returns the time at which public key validity periods, freshness,
+	// JWT claims and certificates are checked.
+	clock Clock
+	// roots are the trust roots for PKIX public keys given as certificates.
+	roots *x509.CertPool
+	// cmsRoots are the trust roots for the signers of Cms Attestations, whose
+	// certificates must have one of cmsKeyUsages, or code signing if it is
+	// empty, as an extended key usage.
+	cmsRoots     *x509.CertPool
+	cmsKeyUsages []x509.ExtKeyUsage
+	// allowedAlgorithms is the set of signature algorithms the verifier
+	// accepts. If nil, all algorithms are accepted.
+	allowedAlgorithms map[SignatureAlgorithm]bool
+	// strictKeyIDs makes NewVerifier fail if several public keys share an ID.
+	strictKeyIDs bool
+	// strictKeyIDMatching makes the verifier reject Attestations whose
+	// PublicKeyID is empty or matches none of its public keys, instead of
+	// trying other keys.
+	strictKeyIDMatching bool
+	// keyIdentityMatching makes the verifier reject Attestations verified by
+	// a public key that their PublicKeyID does not identify.
+	keyIdentityMatching bool
+	// keyUpdates holds the public keys set by UpdateKeys, which replace
+	// PublicKeys and keyGroups. It is nil unless the verifier was created by
+	// NewUpdatableVerifier.
+	keyUpdates *keyUpdates
+	// keyAliases maps the aliases set with WithKeyAlias to the IDs of the
+	// public keys in their group.
+	keyAliases map[string][]string
+	// keyGroups maps each alias, and the ID of each public key in an alias
+	// group, to the IDs of the public keys in the group.
+	keyGroups map[string][]string
+	// keyMatcher maps an Attestation's PublicKeyID to public keys whose ID it
+	// does not exactly name. If nil, only exact matches are used.
+	keyMatcher KeyMatcher
+	// metrics receives the outcome and latency of every verification.
+	metrics MetricsRecorder
+	// logger receives the diagnostic messages of the verifier.
+	logger Logger
+	// revokedKeys holds the lowercased IDs of revoked public keys.
+	revokedKeys map[string]bool
+	// policy decides whether verified payloads are acceptable, after every
+	// other check has passed. If nil, no policy is evaluated.
+	policy PolicyEvaluator
+	// maxAge is the maximum age of a verified payload. Zero disables the
+	// freshness check.
+	maxAge time.Duration
+	// payloadParser extracts the AuthenticatedAttestation from verified
+	// payloads.
+	payloadParser PayloadParser
+	// payloadTypeParsers holds the PayloadParsers of verified payloads by
+	// DSSE payloadType, which take precedence over payloadParser.
+	payloadTypeParsers map[string]PayloadParser
+	// rejectUnknownPayloadTypes makes the verifier reject verified payloads
+	// whose payloadType has no registered PayloadParser.
+	rejectUnknownPayloadTypes bool
+	// softMissingKeyTypes holds the key types whose Attestations are
+	// accepted by VerifyAttestation if their public key is not registered.
+	softMissingKeyTypes map[AuthenticatorType]bool
+	// digestResolver resolves the tag of payloads that reference the image
+	// by tag. If nil, such payloads are rejected.
+	digestResolver DigestResolver
+	// cosignCompatibility makes the verifier decode base64 encoded
+	// signatures, as created by cosign, before verifying them.
+	cosignCompatibility bool
+	// canonicalPayloads makes PKIX signatures verify over the RFC 8785
+	// canonical form of JSON payloads.
+	canonicalPayloads bool
+	// rejectNonJSONPayloads makes canonicalPayloads reject payloads that are
+	// not JSON instead of verifying them as is.
+	rejectNonJSONPayloads bool
+	// jwksSource provides the Jwt public keys whose ID matches none of the
+	// static public keys. If nil, only static public keys are used.
+	jwksSource *JwksSource
+	// spiffe holds the trust bundle and allowed SPIFFE IDs of PKIX public
+	// keys given as X.509 SVIDs. If nil, such keys are validated against
+	// roots instead.
+	spiffe *spiffeConfig
+	// sigstore holds the trust roots for Attestations with a SigstoreBundle.
+	// If nil, such Attestations are rejected.
+	sigstore *sigstoreConfig
+	// anySigstoreIdentity allows sigstore to be configured without allowed
+	// identities.
+	anySigstoreIdentity bool
+	// tracer starts the spans of verifications. If nil, they are not traced.
+	tracer Tracer
+	// allowWeakPgpDigests makes the verifier accept PGP signatures with SHA-1
+	// digests.
+	allowWeakPgpDigests bool
+	// keyStrength is the minimum strength of RSA and ECDSA public keys.
+	keyStrength keyStrengthPolicy
+	// keyFetchRetry controls how fetches of public keys from Cloud KMS, Vault
+	// and the JWKS source are retried.
+	keyFetchRetry retryPolicy
 
 	// Interfaces for testing
 	pkixVerifier
 	pgpVerifier
 	jwtVerifier
-	authenticatedAttChecker
+	ed25519Verifier
+	kmsVerifier
+	vaultVerifier
+	AuthenticatedAttChecker
 }
 
 // NewVerifier creates a Verifier interface for verifying Attestations.
@@ -70,73 +369,1027 @@ type verifier struct {
 // NOT by the Attestation.
 // `publicKeySet` contains a list of PublicKeys that the Verifier will use to
 // try to verify an Attestation.
-func NewVerifier(image string, publicKeySet []PublicKey) (Verifier, error) {
+// `opts` contains optional VerifierOptions that change the Verifier's
+// behavior.
+func NewVerifier(image string, publicKeySet []PublicKey, opts ...VerifierOption) (Verifier, error) {
 	// TODO(https://github.com/grafeas/kritis/issues/503): Move this check to
 	// the call where the user supplies the image name.
-	digest, err := name.NewDigest(image, name.StrictValidation)
+	imageName, imageDigest, err := parseImageName(image)
 	if err != nil {
 		return nil, errors.Wrap(err, "invalid image name")
 	}
+	return newVerifier(imageName, imageDigest, publicKeySet, opts...)
+}
+
+// newVerifier creates a verifier for the image `imageName` with the digest
+// `imageDigest`. If `imageDigest` is empty, the verifier only extracts the
+// digests of verified payloads, see NewExtractingVerifier.
+func newVerifier(imageName, imageDigest string, publicKeySet []PublicKey, opts ...VerifierOption) (*verifier, error) {
+	parsedKeySet, err := parsePublicKeySet(publicKeySet)
+	if err != nil {
+		return nil, err
+	}
 
-	keyMap := indexPublicKeysByID(publicKeySet)
-	return &verifier{
-		ImageName:               digest.Repository.Name(),
-		ImageDigest:             digest.DigestStr(),
-		PublicKeys:              keyMap,
+	v := &verifier{
+		ImageName:               imageName,
+		ImageDigest:             imageDigest,
+		extractOnly:             imageDigest == "",
+		clock:                   SystemClock,
+		keyFetchRetry:           defaultRetryPolicy,
+		logger:                  nopLogger{},
+		metrics:                 nopMetricsRecorder{},
+		payloadParser:           DefaultPayloadParser,
+		keyStrength:             defaultKeyStrength,
 		pkixVerifier:            pkixVerifierImpl{},
 		pgpVerifier:             pgpVerifierImpl{},
 		jwtVerifier:             jwtVerifierImpl{},
-		authenticatedAttChecker: authenticatedAttCheckerImpl{},
-	}, nil
+		ed25519Verifier:         ed25519VerifierImpl{},
+		AuthenticatedAttChecker: DefaultAuthenticatedAttChecker,
+		maxSignatureSize:        defaultMaxSignatureSize,
+		maxPayloadSize:          defaultMaxPayloadSize,
+		maxDecodedPayloadSize:   defaultMaxDecodedPayloadSize,
+		maxStreamedPayloadSize:  defaultMaxStreamedPayloadSize,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.extractOnly && (len(v.acceptableDigests) > 0 || v.imageIndex != nil) {
+		return nil, errors.New("acceptable digests and image indexes cannot be set without an image digest")
+	}
+	if kms, ok := v.kmsVerifier.(*kmsVerifierImpl); ok {
+		kms.retry = v.keyFetchRetry
+		kms.keyStrength = v.keyStrength
+	}
+	if vault, ok := v.vaultVerifier.(*vaultVerifierImpl); ok {
+		vault.retry = v.keyFetchRetry
+		vault.keyStrength = v.keyStrength
+	}
+	if pgp, ok := v.pgpVerifier.(pgpVerifierImpl); ok {
+		pgp.allowWeakDigests = v.allowWeakPgpDigests
+		pgp.logger = v.log()
+		pgp.maxPayloadSize = v.maxDecodedPayloadSize
+		v.pgpVerifier = pgp
+	}
+	if pkix, ok := v.pkixVerifier.(pkixVerifierImpl); ok {
+		pkix.keyStrength = v.keyStrength
+		v.pkixVerifier = pkix
+	}
+	if jwt, ok := v.jwtVerifier.(jwtVerifierImpl); ok {
+		jwt.keyStrength = v.keyStrength
+		v.jwtVerifier = jwt
+	}
+	v.warnWeakKeys(parsedKeySet)
+	for i, digest := range v.acceptableDigests {
+		parsedDigest, err := parseDigest(digest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid acceptable digest %q", digest)
+		}
+		v.acceptableDigests[i] = parsedDigest.String()
+	}
+	if v.imageIndex != nil {
+		if err := v.addImageIndexDigests(); err != nil {
+			return nil, err
+		}
+	}
+	if v.sigstore != nil {
+		if err := v.sigstore.checkConfig(v.anySigstoreIdentity); err != nil {
+			return nil, err
+		}
+		if err := v.sigstore.parseRekorKey(); err != nil {
+			return nil, err
+		}
+		if err := v.keyStrength.check(v.sigstore.rekorKey); err != nil {
+			return nil, fmt.Errorf("%w: Rekor public key: %v", ErrKeyTooWeak, err)
+		}
+	}
+	if v.spiffe != nil {
+		if err := v.spiffe.checkIDs(); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.checkSoftMissingKeyTypes(); err != nil {
+		return nil, err
+	}
+	if v.PublicKeys, v.keyGroups, err = v.indexPublicKeys(parsedKeySet); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parsePublicKeySet parses and validates the key material of each of
+// `publicKeySet`, and returns the keys with their parsed key material.
+func parsePublicKeySet(publicKeySet []PublicKey) ([]PublicKey, error) {
+	parsedKeySet := make([]PublicKey, 0, len(publicKeySet))
+	var invalidKeys []string
+	for _, publicKey := range publicKeySet {
+		parsedKey, err := validateKeyData(publicKey)
+		if err != nil {
+			invalidKeys = append(invalidKeys, fmt.Sprintf("key %q: %v", publicKey.ID, err))
+			continue
+		}
+		if fingerprint, ok := parseSPKIFingerprint(publicKey.ID); ok && publicKey.AuthenticatorType == Pkix {
+			// The ID is only trusted if it is the fingerprint of the key.
+			actual, err := SPKIFingerprint(publicKey.KeyData)
+			if err != nil || actual != fingerprint {
+				invalidKeys = append(invalidKeys, fmt.Sprintf("key %q: ID is an SPKI fingerprint, but does not match the key material", publicKey.ID))
+				continue
+			}
+			publicKey.ID = fingerprint
+		}
+		publicKey.parsedKey = parsedKey
+		parsedKeySet = append(parsedKeySet, publicKey)
+	}
+	if len(invalidKeys) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPublicKey, strings.Join(invalidKeys, "; "))
+	}
+	return parsedKeySet, nil
+}
+
+// indexPublicKeys indexes the parsed `publicKeySet` by ID, and groups the
+// keys of the verifier's key aliases.
+func (v *verifier) indexPublicKeys(publicKeySet []PublicKey) (map[string][]PublicKey, map[string][]string, error) {
+	keyMap := indexPublicKeysByID(publicKeySet, v.logger)
+	if v.strictKeyIDs {
+		for _, publicKey := range publicKeySet {
+			if len(keyMap[publicKey.ID]) > 1 {
+				return nil, nil, fmt.Errorf("%d public keys share the ID %q", len(keyMap[publicKey.ID]), publicKey.ID)
+			}
+		}
+	}
+	keyGroups, err := groupKeyAliases(v.keyAliases, keyMap)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keyMap, keyGroups, nil
+}
+
+// groupKeyAliases maps each alias in `aliases`, and the ID of each public key
+// in its group, to the IDs of the keys in the group. Every ID must name a key
+// in `keyMap`, no key may be in several groups, and an alias may not be the ID
+// of a key outside its group.
+func groupKeyAliases(aliases map[string][]string, keyMap map[string][]PublicKey) (map[string][]string, error) {
+	if len(aliases) == 0 {
+		return nil, nil
+	}
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	groups := map[string][]string{}
+	for _, alias := range names {
+		keyIDs := aliases[alias]
+		if _, ok := groups[alias]; ok {
+			return nil, fmt.Errorf("key alias %q is the ID of a public key in another alias group", alias)
+		}
+		if _, ok := keyMap[alias]; ok && !containsString(keyIDs, alias) {
+			return nil, fmt.Errorf("key alias %q is the ID of a public key outside its group", alias)
+		}
+		for _, keyID := range keyIDs {
+			if len(keyMap[keyID]) == 0 {
+				return nil, fmt.Errorf("key alias %q names unknown public key %q", alias, keyID)
+			}
+			if _, ok := groups[keyID]; ok && keyID != alias {
+				return nil, fmt.Errorf("public key %q is in several alias groups", keyID)
+			}
+		}
+		groups[alias] = keyIDs
+		for _, keyID := range keyIDs {
+			groups[keyID] = keyIDs
+		}
+	}
+	return groups, nil
+}
+
+// KeyMatcher reports whether an Attestation's PublicKeyID `keyID` names
+// `publicKey`, e.g. because it is a short form of the key's ID. It is only
+// consulted for public keys whose ID is not exactly `keyID`.
+type KeyMatcher func(keyID string, publicKey PublicKey) bool
+
+// publicKeysByID returns the public keys with ID `keyID`, followed by the
+// other keys of its alias group, if any. `keyID` may also be an alias. SPKI
+// fingerprints match regardless of case. If no key has ID `keyID`, the keys
+// accepted by the verifier's KeyMatcher are returned, ordered by ID, unless
+// the verifier is strict about key ID matching.
+func (v *verifier) publicKeysByID(keyID string) []PublicKey {
+	if fingerprint, ok := parseSPKIFingerprint(keyID); ok {
+		keyID = fingerprint
+	}
+	keyIDs, ok := v.keyGroups[keyID]
+	if !ok {
+		if publicKeys, ok := v.PublicKeys[keyID]; ok || v.keyMatcher == nil || v.strictKeyIDMatching {
+			return publicKeys
+		}
+		return v.matchPublicKeys(keyID)
+	}
+	publicKeys := append([]PublicKey(nil), v.PublicKeys[keyID]...)
+	for _, id := range keyIDs {
+		if id != keyID {
+			publicKeys = append(publicKeys, v.PublicKeys[id]...)
+		}
+	}
+	return publicKeys
 }
 
-func indexPublicKeysByID(publicKeyset []PublicKey) map[string]PublicKey {
-	keyMap := map[string]PublicKey{}
+// matchPublicKeys returns the public keys that the verifier's KeyMatcher
+// accepts for `keyID`, ordered by ID.
+func (v *verifier) matchPublicKeys(keyID string) []PublicKey {
+	ids := make([]string, 0, len(v.PublicKeys))
+	for id := range v.PublicKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var publicKeys []PublicKey
+	for _, id := range ids {
+		for _, publicKey := range v.PublicKeys[id] {
+			if v.keyMatcher(keyID, publicKey) {
+				publicKeys = append(publicKeys, publicKey)
+			}
+		}
+	}
+	return publicKeys
+}
+
+// indexPublicKeysByID maps the ID of each key in `publicKeyset` to the keys
+// with that ID, in the order of `publicKeyset`, so that they are always tried
+// in the same order. A key listed again under the same ID with the same key
+// material is only indexed once.
+func indexPublicKeysByID(publicKeyset []PublicKey, logger Logger) map[string][]PublicKey {
+	keyMap := map[string][]PublicKey{}
 	for _, publicKey := range publicKeyset {
 		if _, ok := keyMap[publicKey.ID]; ok {
-			glog.Warningf("Key with ID %q already exists in publicKeySet. Overwriting previous key.", publicKey.ID)
+			if containsKeyMaterial(keyMap[publicKey.ID], publicKey) {
+				logger.Warningf("Key with ID %q is listed more than once in publicKeySet. The duplicate will be ignored.", publicKey.ID)
+				continue
+			}
+			logger.Warningf("Key with ID %q already exists in publicKeySet. All keys with this ID will be tried.", publicKey.ID)
 		}
-		keyMap[publicKey.ID] = publicKey
+		keyMap[publicKey.ID] = append(keyMap[publicKey.ID], publicKey)
 	}
 	return keyMap
 }
 
+// containsKeyMaterial reports whether one of `publicKeys` has the key
+// material of `publicKey`.
+func containsKeyMaterial(publicKeys []PublicKey, publicKey PublicKey) bool {
+	for _, k := range publicKeys {
+		if k.materialKey() == publicKey.materialKey() {
+			return true
+		}
+	}
+	return false
+}
+
 // VerifyAttestation verifies an Attestation. See Verifier for more details.
 func (v *verifier) VerifyAttestation(att *Attestation) error {
-	// Extract the public key from `publicKeySet` whose ID matches the one in
+	return v.VerifyAttestationContext(context.Background(), att)
+}
+
+// VerifyAttestationContext verifies an Attestation, honoring cancellation of
+// `ctx`. See Verifier for more details.
+func (v *verifier) VerifyAttestationContext(ctx context.Context, att *Attestation) error {
+	_, err := v.verifyAttestationUntil(ctx, att)
+	return err
+}
+
+// verifyAttestationUntil verifies an Attestation like
+// VerifyAttestationContext, and returns the ValidUntil time of the
+// verification if it succeeds.
+func (v *verifier) verifyAttestationUntil(ctx context.Context, att *Attestation) (time.Time, error) {
+	v = v.current()
+	verified, err := v.verify(ctx, att, v.verifySoftMissingKey)
+	if err == errSoftPassed {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return v.validUntil(verified), nil
+}
+
+// VerifyAttestationWithResult verifies an Attestation and reports which public
+// key verified it. See Verifier for more details.
+func (v *verifier) VerifyAttestationWithResult(att *Attestation) (*VerificationResult, error) {
+	v = v.current()
+	verified, err := v.verify(context.Background(), att, v.verifyAttestation)
+	if err != nil {
+		return nil, err
+	}
+	return v.newVerificationResult(verified), nil
+}
+
+// newVerificationResult creates the VerificationResult of a verified
+// Attestation.
+func (v *verifier) newVerificationResult(verified verifiedAttestation) *VerificationResult {
+	result := &VerificationResult{
+		KeyID:   verified.publicKey.ID,
+		KeyType: verified.publicKey.AuthenticatorType,
+		// The payload was checked to contain the verifier's image digest.
+		ImageDigest: v.ImageDigest,
+		PayloadType: verified.payloadType,
+		Signatures:  verified.signatures,
+		ValidUntil:  v.validUntil(verified),
+	}
+	if authAtt := verified.authAtt; authAtt != nil {
+		result.PredicateType = authAtt.PredicateType
+		result.SubjectDigests = append([]string(nil), authAtt.SubjectDigests...)
+		result.predicate = string(authAtt.Predicate)
+	}
+	if verified.publicKey.AuthenticatorType == Jwt {
+		result.claims = string(verified.payload)
+	}
+	return result
+}
+
+// verifiedAttestation describes a successfully verified Attestation.
+type verifiedAttestation struct {
+	// publicKey is the public key that verified the Attestation, or its
+	// first verified signature.
+	publicKey PublicKey
+	// authAtt holds the verified payload's contents.
+	authAtt *AuthenticatedAttestation
+	// signatures holds the result of each signature of an Attestation that
+	// is not wrapped in an envelope.
+	signatures []SignatureResult
+	// payload is the verified payload.
+	payload []byte
+	// payloadType is the payloadType of a verified DSSE envelope.
+	payloadType string
+}
+
+// verify decodes the signatures of an Attestation, verifies it with
+// `verifyFunc` and records the outcome with the verifier's MetricsRecorder
+// and Tracer, and its OnVerify callbacks.
+func (v *verifier) verify(ctx context.Context, att *Attestation, verifyFunc func(context.Context, *Attestation) (verifiedAttestation, error)) (verifiedAttestation, error) {
+	start := time.Now()
+	ctx, span := startSpan(withTracer(ctx, v.tracer), SpanVerifyAttestation)
+	ctx, timer := v.startTimer(ctx)
+	var verified verifiedAttestation
+	decoded, err := v.decodeAttestation(att)
+	if err == nil {
+		verified, err = verifyFunc(ctx, decoded)
+		err = v.checkTimeout(timer, err)
+	}
+	metrics := v.metrics
+	if metrics == nil {
+		metrics = nopMetricsRecorder{}
+	}
+	duration := time.Since(start)
+	metrics.ObserveLatency(duration)
+	keyType := verified.publicKey.AuthenticatorType
+	if err != nil && att != nil {
+		if publicKeys := v.publicKeysByID(att.PublicKeyID); len(publicKeys) > 0 {
+			keyType = publicKeys[0].AuthenticatorType
+		}
+	}
+	outcome := verificationOutcome(err)
+	metrics.IncVerification(keyType, outcome)
+	if err == nil {
+		span.SetAttribute(AttributeKeyID, verified.publicKey.ID)
+	}
+	span.SetAttribute(AttributeKeyType, keyType.String())
+	span.SetAttribute(AttributeOutcome, string(outcome))
+	endSpan(span, err)
+	if len(v.onVerify) > 0 {
+		event := VerificationEvent{
+			AttestationID: attestationID(att),
+			KeyID:         verified.publicKey.ID,
+			KeyType:       keyType,
+			Outcome:       outcome,
+			Duration:      duration,
+			Err:           err,
+		}
+		if err == errSoftPassed {
+			event.Err = nil
+		} else if err != nil && att != nil {
+			event.KeyID = att.PublicKeyID
+		}
+		v.emitEvent(event)
+	}
+	return verified, err
+}
+
+// verifyAttestation checks the signature and payload of an Attestation.
+func (v *verifier) verifyAttestation(ctx context.Context, att *Attestation) (verifiedAttestation, error) {
+	signed, err := v.verifyAttestationSignature(ctx, att)
+	if err != nil {
+		return verifiedAttestation{}, err
+	}
+	return v.checkVerifiedPayload(ctx, signed.payload, signed.payloadType, signed.publicKey, signed.signatures)
+}
+
+// signedPayload is a payload whose signature has been verified.
+type signedPayload struct {
+	payload []byte
+	// payloadType is the payloadType of a verified DSSE envelope.
+	payloadType string
+	publicKey   PublicKey
+	signatures  []SignatureResult
+}
+
+// verifyAttestationSignature checks the signature of an Attestation, and
+// returns the payload it signs, without checking the payload.
+func (v *verifier) verifyAttestationSignature(ctx context.Context, att *Attestation) (signedPayload, error) {
+	if err := ctx.Err(); err != nil {
+		return signedPayload{}, err
+	}
+	if att.PublicKeyID != "" && v.isRevoked(att.PublicKeyID) {
+		return signedPayload{}, fmt.Errorf("%w: %q", ErrKeyRevoked, att.PublicKeyID)
+	}
+	if len(att.Signatures) > 0 && (att.EnvelopeType != NoEnvelope || att.SigstoreBundle != nil) {
+		return signedPayload{}, errors.New("attestations with several signatures cannot be combined with an envelope or a sigstore bundle")
+	}
+	var signed signedPayload
+	var err error
+	switch att.EnvelopeType {
+	case NoEnvelope:
+		if att.SigstoreBundle != nil {
+			signed.payload, signed.publicKey, err = v.verifySigstoreBundle(ctx, att)
+			break
+		}
+		signed.payload, signed.publicKey, signed.signatures, err = v.verifySignatures(ctx, att)
+	case Dsse:
+		if att.SigstoreBundle != nil {
+			return signedPayload{}, errors.New("sigstore bundles cannot be combined with a DSSE envelope")
+		}
+		if att.DetachedSignature {
+			return signedPayload{}, errors.New("DSSE envelopes cannot carry a detached signature")
+		}
+		signed.payload, signed.payloadType, signed.publicKey, err = v.verifyDsse(ctx, att)
+	case Cms:
+		if att.SigstoreBundle != nil {
+			return signedPayload{}, errors.New("sigstore bundles cannot be combined with a CMS SignedData")
+		}
+		signed.payload, signed.publicKey, err = v.verifyCms(ctx, att)
+	case CoseSign1:
+		if att.SigstoreBundle != nil {
+			return signedPayload{}, errors.New("sigstore bundles cannot be combined with a COSE_Sign1 message")
+		}
+		signed.payload, signed.publicKey, err = v.verifyCoseSign1(ctx, att)
+	default:
+		return signedPayload{}, errors.New("attestation uses an unsupported envelope type")
+	}
+	if err != nil {
+		return signedPayload{}, err
+	}
+	return signed, nil
+}
+
+// checkVerifiedPayload checks that the public key that verified the signature
+// over `payload` is valid, and that the payload is acceptable for the image.
+// `payloadType` is the payloadType of a DSSE envelope, or empty.
+func (v *verifier) checkVerifiedPayload(ctx context.Context, payload []byte, payloadType string, publicKey PublicKey, signatures []SignatureResult) (verifiedAttestation, error) {
+	if err := ctx.Err(); err != nil {
+		return verifiedAttestation{}, err
+	}
+	if err := publicKey.checkValidityPeriod(v.currentTime()); err != nil {
+		return verifiedAttestation{}, err
+	}
+	authAtt, err := v.checkPayload(ctx, payload, payloadType)
+	if err != nil {
+		return verifiedAttestation{}, err
+	}
+	if err := v.checkFreshness(authAtt); err != nil {
+		return verifiedAttestation{}, err
+	}
+	if err := v.evaluatePolicy(ctx, payload); err != nil {
+		return verifiedAttestation{}, err
+	}
+	return verifiedAttestation{publicKey: publicKey, authAtt: authAtt, signatures: signatures, payload: payload, payloadType: payloadType}, nil
+}
+
+// checkPayload parses `payload`, whose signature has been verified, and
+// checks that it is acceptable for the image. The parsed payload is returned
+// even if it is not acceptable.
+func (v *verifier) checkPayload(ctx context.Context, payload []byte, payloadType string) (*AuthenticatedAttestation, error) {
+	if err := v.checkDecodedPayloadSize(payload); err != nil {
+		return nil, err
+	}
+	parser, err := v.parserFor(payloadType)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO(https://github.com/grafeas/kritis/issues/503): Determine whose
+	// responsibility it is to check the payload. If cryptolib is responsible
+	// determine an API for checking the payload.
+	// Extract the payload into an AuthenticatedAttestation, whose contents we
+	// can trust.
+	var authAtt *AuthenticatedAttestation
+	// resolveErr is kept apart, since the checker reports every error of
+	// `parse` as an invalid payload.
+	var resolveErr error
+	parse := func(payload []byte) (*AuthenticatedAttestation, error) {
+		payload, err := v.decompressPayload(payload)
+		if err != nil {
+			return nil, err
+		}
+		if authAtt, err = parser.Parse(payload); err != nil {
+			return nil, err
+		}
+		if authAtt.ImageTag != "" && authAtt.ImageDigest == "" {
+			if v.digestResolver == nil {
+				return nil, errors.New("attestation payload references the image by tag, but the verifier has no DigestResolver")
+			}
+			if authAtt.ImageDigest, resolveErr = v.resolveImageTag(ctx, authAtt); resolveErr != nil {
+				return nil, resolveErr
+			}
+		}
+		return authAtt, nil
+	}
+	if v.extractOnly {
+		err = checkExtractedPayload(payload, parse)
+	} else {
+		err = v.CheckAuthenticatedAttestation(payload, v.ImageName, v.imageDigests(), parse)
+	}
+	if resolveErr != nil {
+		return authAtt, resolveErr
+	}
+	return authAtt, err
+}
+
+// imageDigests returns the digests a verified payload may contain: the image
+// digest followed by the acceptable digests.
+func (v *verifier) imageDigests() []string {
+	return append([]string{v.ImageDigest}, v.acceptableDigests...)
+}
+
+// checkFreshness checks that `authAtt` was created within the maximum age of
+// the verifier, if one is set.
+func (v *verifier) checkFreshness(authAtt *AuthenticatedAttestation) error {
+	if v.maxAge <= 0 {
+		return nil
+	}
+	if authAtt == nil || authAtt.Timestamp.IsZero() {
+		return fmt.Errorf("%w: attestation payload has no timestamp", ErrAttestationStale)
+	}
+	if age := v.currentTime().Sub(authAtt.Timestamp); age > v.maxAge {
+		return fmt.Errorf("%w: attestation was created %v ago, maximum age is %v", ErrAttestationStale, age, v.maxAge)
+	}
+	return nil
+}
+
+// validUntil returns the ValidUntil time of the verification of `verified`,
+// see VerificationResult.
+func (v *verifier) validUntil(verified verifiedAttestation) time.Time {
+	var deadline time.Time
+	earliest := func(t time.Time) {
+		if !t.IsZero() && (deadline.IsZero() || t.Before(deadline)) {
+			deadline = t
+		}
+	}
+	earliest(verified.publicKey.NotAfter)
+	for _, signature := range verified.signatures {
+		if signature.KeyID == "" {
+			continue
+		}
+		for _, publicKey := range v.publicKeysByID(signature.KeyID) {
+			earliest(publicKey.NotAfter)
+		}
+	}
+	if v.maxAge > 0 && verified.authAtt != nil && !verified.authAtt.Timestamp.IsZero() {
+		earliest(verified.authAtt.Timestamp.Add(v.maxAge))
+	}
+	if verified.publicKey.AuthenticatorType == Jwt {
+		earliest(jwtExpiry(verified.payload))
+	}
+	return deadline
+}
+
+// log returns the Logger of the verifier.
+func (v *verifier) log() Logger {
+	if v.logger == nil {
+		return nopLogger{}
+	}
+	return v.logger
+}
+
+// parser returns the PayloadParser of the verifier.
+func (v *verifier) parser() PayloadParser {
+	if v.payloadParser == nil {
+		return DefaultPayloadParser
+	}
+	return v.payloadParser
+}
+
+// parserFor returns the PayloadParser registered for `payloadType`. Payloads
+// of other types are parsed with the PayloadParser of the verifier, unless
+// the verifier rejects unknown payload types.
+func (v *verifier) parserFor(payloadType string) (PayloadParser, error) {
+	if parser, ok := v.payloadTypeParsers[payloadType]; ok {
+		return parser, nil
+	}
+	if payloadType != "" && v.rejectUnknownPayloadTypes {
+		return nil, fmt.Errorf("%w: no PayloadParser is registered for payloadType %q", ErrInvalidPayload, payloadType)
+	}
+	return v.parser(), nil
+}
+
+// currentTime returns the time at which public key validity periods,
+// attestation freshness, JWT claims and certificates are checked.
+func (v *verifier) currentTime() time.Time {
+	if v.clock == nil {
+		return time.Now()
+	}
+	return v.clock.Now()
+}
+
+// verifyBareSignature verifies an Attestation whose Signature is not wrapped
+// in an envelope, and returns the payload that was signed and the public key
+// that verified it.
+func (v *verifier) verifyBareSignature(ctx context.Context, att *Attestation) ([]byte, PublicKey, error) {
+	if v.strictKeyIDMatching && att.PublicKeyID == "" {
+		return nil, PublicKey{}, fmt.Errorf("%w: attestation has no public key ID", ErrKeyIDMismatch)
+	}
+	// Extract the public keys from `publicKeySet` whose ID matches the one in
 	// `att`.
-	publicKey, ok := v.PublicKeys[att.PublicKeyID]
-	if !ok {
-		return fmt.Errorf("no public key with ID %q found", att.PublicKeyID)
+	publicKeys := v.publicKeysByID(att.PublicKeyID)
+	if len(publicKeys) == 0 && v.jwksSource != nil && att.PublicKeyID != "" {
+		var jwksKeys []PublicKey
+		err := callBackend(ctx, func(ctx context.Context) error {
+			var err error
+			jwksKeys, err = v.jwksSource.publicKeys(ctx, att.PublicKeyID, v.keyFetchRetry)
+			return err
+		})
+		if err != nil {
+			return nil, PublicKey{}, err
+		}
+		publicKeys = jwksKeys
 	}
+	if len(publicKeys) == 1 {
+		payload, err := v.verifyWithKey(ctx, att, publicKeys[0])
+		return payload, publicKeys[0], err
+	}
+	if len(publicKeys) > 1 {
+		var failures []string
+		for i, publicKey := range publicKeys {
+			if err := ctx.Err(); err != nil {
+				return nil, PublicKey{}, err
+			}
+			payload, err := v.verifyWithKey(ctx, att, publicKey)
+			if err == nil {
+				return payload, publicKey, nil
+			}
+			failures = append(failures, fmt.Sprintf("key %d: %v", i, err))
+		}
+		return nil, PublicKey{}, fmt.Errorf("%w: none of the %d public keys with ID %q verified the attestation: %s", ErrSignatureInvalid, len(publicKeys), att.PublicKeyID, strings.Join(failures, "; "))
+	}
+	if v.strictKeyIDMatching {
+		return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found", ErrKeyIDMismatch, att.PublicKeyID)
+	}
+	if v.keyTrialLimit <= 0 {
+		return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found", ErrNoMatchingKey, att.PublicKeyID)
+	}
+	return v.verifyWithCandidateKeys(ctx, att)
+}
 
+// verifyWithKey verifies an Attestation's bare signature with `publicKey` in
+// a SpanVerifySignature span.
+func (v *verifier) verifyWithKey(ctx context.Context, att *Attestation, publicKey PublicKey) ([]byte, error) {
+	var payload []byte
+	err := traceSignature(ctx, publicKey, func(ctx context.Context) error {
+		var err error
+		payload, err = v.verifySignatureWithKey(ctx, att, publicKey)
+		return err
+	})
+	return payload, err
+}
+
+// verifySignatureWithKey verifies an Attestation's bare signature with
+// `publicKey`.
+func (v *verifier) verifySignatureWithKey(ctx context.Context, att *Attestation, publicKey PublicKey) ([]byte, error) {
+	if err := v.checkRevoked(publicKey); err != nil {
+		return nil, err
+	}
+	if err := v.checkAlgorithm(att, publicKey); err != nil {
+		return nil, err
+	}
 	var err error
 	payload := []byte{}
+	signature := att.Signature
+	if v.cosignCompatibility {
+		signature = decodeCosignSignature(signature)
+	}
 	switch publicKey.AuthenticatorType {
 	case Pkix:
-		err = v.verifyPkix(att.Signature, att.SerializedPayload, publicKey.KeyData)
+		if err := v.checkCertificateChain(publicKey); err != nil {
+			return nil, err
+		}
+		if err := v.keyStrength.checkPublicKey(publicKey); err != nil {
+			return nil, err
+		}
 		payload = att.SerializedPayload
+		if v.canonicalPayloads {
+			if payload, err = canonicalizePayload(payload, v.rejectNonJSONPayloads); err != nil {
+				return nil, err
+			}
+		}
+		err = v.verifyPkix(signature, payload, publicKey.withDeclaredAlgorithm(att))
 	case Pgp:
-		payload, err = v.verifyPgp(att.Signature, publicKey.KeyData)
+		var fingerprint string
+		if att.DetachedSignature {
+			fingerprint, err = v.verifyPgpDetached(att.Signature, att.SerializedPayload, publicKey, v.currentTime())
+			payload = att.SerializedPayload
+		} else {
+			payload, fingerprint, err = v.verifyPgp(att.Signature, publicKey, v.currentTime())
+		}
+		if isPgpExpirationError(err) {
+			// The signature is valid, so report the expiration as is.
+			return nil, err
+		}
+		if err == nil && !strings.EqualFold(fingerprint, publicKey.ID) {
+			v.log().Infof("Attestation was signed by subkey %s of PGP key %q.", fingerprint, publicKey.ID)
+			// A signing subkey may be revoked on its own.
+			if v.isRevoked(fingerprint) {
+				return nil, fmt.Errorf("%w: %q is a subkey of PGP key %q", ErrKeyRevoked, fingerprint, publicKey.ID)
+			}
+		}
 	case Jwt:
-		payload, err = v.verifyJwt(att.Signature, publicKey)
+		if att.DetachedSignature {
+			err = v.verifyJwtDetached(att.Signature, att.SerializedPayload, publicKey, v.currentTime())
+			payload = att.SerializedPayload
+		} else {
+			payload, err = v.verifyJwt(att.Signature, publicKey, v.currentTime())
+		}
+	case Ed25519:
+		err = v.verifyEd25519(signature, att.SerializedPayload, publicKey)
+		payload = att.SerializedPayload
+	case Ed448:
+		err = verifyEd448(signature, att.SerializedPayload, publicKey)
+		payload = att.SerializedPayload
+	case Hmac:
+		err = verifyHmac(signature, att.SerializedPayload, publicKey)
+		payload = att.SerializedPayload
+	case Kms:
+		if v.kmsVerifier == nil {
+			return nil, fmt.Errorf("%w: key %q is held in Cloud KMS, but no Cloud KMS client is configured", ErrKeyTypeNotImplemented, publicKey.ID)
+		}
+		err = callBackend(ctx, func(ctx context.Context) error {
+			return v.verifyKms(ctx, signature, att.SerializedPayload, publicKey)
+		})
+		payload = att.SerializedPayload
+	case Vault:
+		if v.vaultVerifier == nil {
+			return nil, fmt.Errorf("%w: key %q is held in Vault, but no Vault client is configured", ErrKeyTypeNotImplemented, publicKey.ID)
+		}
+		err = callBackend(ctx, func(ctx context.Context) error {
+			return v.verifyVault(ctx, signature, att.SerializedPayload, publicKey)
+		})
+		payload = att.SerializedPayload
 	default:
-		return errors.New("signature uses an unsupported key mode")
+		if publicKey.AuthenticatorType.known() {
+			return nil, fmt.Errorf("%w: key %q has type %v, which the verifier cannot verify", ErrKeyTypeNotImplemented, publicKey.ID, publicKey.AuthenticatorType)
+		}
+		return nil, fmt.Errorf("%w: key %q has type %d", ErrUnknownKeyType, publicKey.ID, publicKey.AuthenticatorType)
+	}
+	if isKeyTooWeak(err) {
+		// The key is rejected whether or not the signature is valid.
+		return nil, err
+	}
+	if isInputTooLarge(err) {
+		// The payload was not read to its end, so its signature was not
+		// checked.
+		return nil, err
+	}
+	if isRetriesExhausted(err) {
+		// The key could not be fetched, so the signature was not checked.
+		return nil, err
 	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
 	}
+	return payload, nil
+}
 
-	// TODO(https://github.com/grafeas/kritis/issues/503): Determine whose
-	// responsibility it is to check the payload. If cryptolib is responsible
-	// determine an API for checking the payload.
-	// Extract the payload into an AuthenticatedAttestation, whose contents we
-	// can trust.
-	return v.checkAuthenticatedAttestation(payload, v.ImageName, v.ImageDigest, convertAuthenticatedAttestation)
+// isRevoked reports whether `keyID` is in the verifier's set of revoked keys.
+// Key IDs are compared case-insensitively, since PGP fingerprints may be
+// written in either case.
+func (v *verifier) isRevoked(keyID string) bool {
+	return v.revokedKeys[strings.ToLower(keyID)]
+}
+
+// checkRevoked checks that `publicKey` has not been revoked.
+func (v *verifier) checkRevoked(publicKey PublicKey) error {
+	if v.isRevoked(publicKey.ID) {
+		return fmt.Errorf("%w: %q", ErrKeyRevoked, publicKey.ID)
+	}
+	return nil
+}
+
+// checkAlgorithm checks that the SignatureAlgorithm declared by an
+// Attestation, if any, is the one `publicKey` verifies or one of its
+// AllowedAlgorithms, and that the algorithm is allowed by the verifier.
+func (v *verifier) checkAlgorithm(att *Attestation, publicKey PublicKey) error {
+	alg := publicKey.SignatureAlgorithm
+	switch {
+	case att.SignatureAlgorithm == UnknownSigningAlgorithm || att.SignatureAlgorithm == alg:
+	case publicKey.allowsAlgorithm(att.SignatureAlgorithm):
+		alg = att.SignatureAlgorithm
+	case len(publicKey.AllowedAlgorithms) > 0:
+		return fmt.Errorf("%w: attestation declares signature algorithm %v, which is not allowed for key %q", ErrAlgorithmNotAllowed, att.SignatureAlgorithm, publicKey.ID)
+	default:
+		return fmt.Errorf("%w: attestation declares signature algorithm %v, but key %q uses %v", ErrSignatureInvalid, att.SignatureAlgorithm, publicKey.ID, publicKey.SignatureAlgorithm)
+	}
+	if v.allowedAlgorithms != nil && !v.allowedAlgorithms[alg] {
+		return fmt.Errorf("%w: signature algorithm %v of key %q", ErrAlgorithmNotAllowed, alg, publicKey.ID)
+	}
+	return nil
+}
+
+// checkCertificateChain validates the certificate chain of a PKIX public key
+// given as a certificate against the verifier's trust roots, or, if SPIFFE is
+// configured, checks the SPIFFE ID of the X.509 SVID and validates it against
+// the trust bundle. The leaf must be
+// valid at the current time and allow digital signatures. Public keys that are
+// not certificates are not checked.
+func (v *verifier) checkCertificateChain(publicKey PublicKey) error {
+	chain, ok := publicKey.parsedKey.(*pkixCertificateChain)
+	if !ok {
+		if publicKey.parsedKey != nil || !isPkixCertificate(publicKey.KeyData) {
+			return nil
+		}
+		var err error
+		if chain, err = parsePkixCertificateChain(publicKey.KeyData); err != nil {
+			return fmt.Errorf("%w: key %q: %v", ErrCertificateNotTrusted, publicKey.ID, err)
+		}
+	}
+	roots := v.roots
+	if v.spiffe != nil {
+		// The certificate is an X.509 SVID.
+		if _, err := v.spiffe.checkSpiffeID(chain.leaf); err != nil {
+			return fmt.Errorf("key %q: %w", publicKey.ID, err)
+		}
+		roots = v.spiffe.bundle
+	}
+	if roots == nil {
+		return fmt.Errorf("%w: key %q is a certificate but no trust roots are configured", ErrCertificateNotTrusted, publicKey.ID)
+	}
+	if chain.leaf.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("%w: certificate for key %q does not allow digital signatures", ErrCertificateNotTrusted, publicKey.ID)
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: chain.intermediates,
+		CurrentTime:   v.currentTime(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	if _, err := chain.leaf.Verify(opts); err != nil {
+		return fmt.Errorf("%w: key %q: %v", ErrCertificateNotTrusted, publicKey.ID, err)
+	}
+	return nil
 }
 
-type pkixVerifierImpl struct{}
+// verifyWithCandidateKeys tries each public key that could verify the
+// Attestation, in order of key ID, and returns the payload verified by the
+// first successful key. At most keyTrialLimit keys are tried.
+func (v *verifier) verifyWithCandidateKeys(ctx context.Context, att *Attestation) ([]byte, PublicKey, error) {
+	candidates := candidateKeys(v.PublicKeys, att)
+	if len(candidates) == 0 {
+		return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found and no candidate keys to try", ErrNoMatchingKey, att.PublicKeyID)
+	}
+	var failures []string
+	if v.keyTrialWorkers > 1 && v.keyTrialLimit > 1 {
+		tried := candidates
+		if len(tried) > v.keyTrialLimit {
+			tried = tried[:v.keyTrialLimit]
+		}
+		payload, publicKey, results, err := v.verifyWithKeysInParallel(ctx, att, tried)
+		if err != nil || results == nil {
+			return payload, publicKey, err
+		}
+		for i, err := range results {
+			failures = append(failures, fmt.Sprintf("key %q: %v", tried[i].ID, err))
+		}
+		if len(candidates) > len(tried) {
+			failures = append(failures, fmt.Sprintf("%d remaining candidate keys not tried", len(candidates)-len(tried)))
+		}
+		return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found and no candidate key verified the attestation: %s", ErrSignatureInvalid, att.PublicKeyID, strings.Join(failures, "; "))
+	}
+	for i, publicKey := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, PublicKey{}, err
+		}
+		if i == v.keyTrialLimit {
+			failures = append(failures, fmt.Sprintf("%d remaining candidate keys not tried", len(candidates)-i))
+			break
+		}
+		payload, err := v.verifyWithKey(ctx, att, publicKey)
+		if err == nil {
+			return payload, publicKey, nil
+		}
+		failures = append(failures, fmt.Sprintf("key %q: %v", publicKey.ID, err))
+	}
+	return nil, PublicKey{}, fmt.Errorf("%w: no public key with ID %q found and no candidate key verified the attestation: %s", ErrSignatureInvalid, att.PublicKeyID, strings.Join(failures, "; "))
+}
+
+// verifyWithKeysInParallel tries `keys` with up to v.keyTrialWorkers
+// goroutines. Keys are started in order, and once a key verifies the
+// Attestation, no later key is started and the contexts of later keys still
+// being tried are cancelled. Earlier keys are still waited for, so that the
+// verifying key with the lowest index wins regardless of timing. If no key
+// verifies the Attestation, the error of every key is returned by index.
+func (v *verifier) verifyWithKeysInParallel(ctx context.Context, att *Attestation, keys []PublicKey) ([]byte, PublicKey, []error, error) {
+	var (
+		mu sync.Mutex
+		// best is the lowest index of a key that verified the Attestation.
+		best     = len(keys)
+		payloads = make([][]byte, len(keys))
+		errs     = make([]error, len(keys))
+		// cancels holds the cancel functions of the keys being tried.
+		cancels = map[int]context.CancelFunc{}
+	)
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	workers := v.keyTrialWorkers
+	if workers > len(keys) {
+		workers = len(keys)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				mu.Lock()
+				if i > best {
+					mu.Unlock()
+					continue
+				}
+				keyCtx, cancel := context.WithCancel(ctx)
+				cancels[i] = cancel
+				mu.Unlock()
+
+				payload, err := v.verifyWithKey(keyCtx, att, keys[i])
+
+				mu.Lock()
+				cancel()
+				delete(cancels, i)
+				payloads[i], errs[i] = payload, err
+				if err == nil && i < best {
+					best = i
+					for j, cancel := range cancels {
+						if j > i {
+							cancel()
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range keys {
+		mu.Lock()
+		done := i > best
+		mu.Unlock()
+		if done {
+			break
+		}
+		select {
+		case indices <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
 
-func (v pkixVerifierImpl) verifyPkix(signature []byte, payload []byte, publicKey []byte) error {
-	return errors.New("verify pkix not implemented")
+	if best < len(keys) {
+		return payloads[best], keys[best], nil, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, PublicKey{}, nil, err
+	}
+	return nil, PublicKey{}, errs, nil
+}
+
+// candidateKeys returns the public keys whose type could verify the
+// Attestation, sorted by key ID. Keys sharing an ID keep the order in which
+// they were registered. PKIX, Ed25519, Ed448, Cloud KMS and Vault signatures
+// and HMACs are detached from the SerializedPayload, while PGP and JWT
+// signatures embed the payload unless the Attestation has a
+// DetachedSignature.
+func candidateKeys(publicKeys map[string][]PublicKey, att *Attestation) []PublicKey {
+	ids := make([]string, 0, len(publicKeys))
+	for id := range publicKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	detached := len(att.SerializedPayload) != 0
+	candidates := []PublicKey{}
+	for _, id := range ids {
+		for _, publicKey := range publicKeys[id] {
+			switch publicKey.AuthenticatorType {
+			case Pkix, Ed25519, Ed448, Hmac, Kms, Vault:
+				if detached {
+					candidates = append(candidates, publicKey)
+				}
+			case Pgp, Jwt:
+				if !detached || att.DetachedSignature {
+					candidates = append(candidates, publicKey)
+				}
+			}
+		}
+	}
+	return candidates
 }
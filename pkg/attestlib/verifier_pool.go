@@ -0,0 +1,72 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/pkg/errors"
+)
+
+// VerifierPool creates Verifiers for the digests of one image that share the
+// public keys and options of the pool, e.g. for admission webhooks that
+// verify many digests of an image: the public keys are parsed and indexed
+// once by NewVerifierPool rather than by every NewVerifier, and the keys
+// fetched from Cloud KMS or Vault are cached across digests.
+type VerifierPool interface {
+	// WithImageDigest returns a Verifier for the image of the pool with the
+	// digest `digest`. The Verifier shares the public keys of the pool, so
+	// creating it is cheap.
+	WithImageDigest(digest string) (Verifier, error)
+}
+
+// verifierPool is a VerifierPool whose Verifiers are copies of a verifier
+// without an image digest.
+type verifierPool struct {
+	base *verifier
+}
+
+// NewVerifierPool creates a VerifierPool for the image `imageName`, without a
+// digest, e.g. "gcr.io/my-project/my-image". `publicKeySet` and `opts` are
+// the public keys and VerifierOptions of NewVerifier, except for
+// WithAcceptableDigests and WithImageIndex, which need an image digest.
+func NewVerifierPool(imageName string, publicKeySet []PublicKey, opts ...VerifierOption) (VerifierPool, error) {
+	repository, err := name.NewRepository(imageName, name.StrictValidation)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid image name")
+	}
+	base, err := newVerifier(repository.Name(), "", publicKeySet, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return verifierPool{base: base}, nil
+}
+
+// WithImageDigest returns a Verifier for `digest`. See VerifierPool for more
+// details.
+func (p verifierPool) WithImageDigest(digest string) (Verifier, error) {
+	imageName, imageDigest, err := parseImageName(p.base.ImageName + "@" + digest)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid image digest")
+	}
+	// The verifier is not modified after NewVerifierPool, so the copy can
+	// share its public key index, caches and backends.
+	v := *p.base
+	v.ImageName = imageName
+	v.ImageDigest = imageDigest
+	v.extractOnly = false
+	return &v, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attestlib
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"testing"
+)
+
+func TestVerifierPool(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	pool, err := NewVerifierPool("gcr.io/google-samples/hello-app", []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("NewVerifierPool(...) = %v, expected nil", err)
+	}
+	helloAppAtt := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	otherAtt := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(otherDigestPayload)), SerializedPayload: []byte(otherDigestPayload)}
+
+	tcs := []struct {
+		name        string
+		digest      string
+		att         *Attestation
+		expectedErr error
+	}{
+		{
+			name:   "attestation for the digest",
+			digest: helloAppDigest,
+			att:    helloAppAtt,
+		},
+		{
+			name:   "attestation for another digest",
+			digest: otherHelloAppDigest,
+			att:    otherAtt,
+		},
+		{
+			name:        "attestation for the digest of another verifier",
+			digest:      otherHelloAppDigest,
+			att:         helloAppAtt,
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := pool.WithImageDigest(tc.digest)
+			if err != nil {
+				t.Fatalf("WithImageDigest(%q) = %v, expected nil", tc.digest, err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil && err != nil {
+				t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+			if tc.expectedErr != nil && !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifierPoolErrors(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	if _, err := NewVerifierPool("gcr.io/google-samples/hello-app@"+helloAppDigest, []PublicKey{publicKey}); err == nil {
+		t.Errorf("NewVerifierPool(...) with a digest = nil, expected non nil")
+	}
+	if _, err := NewVerifierPool("gcr.io/google-samples/hello-app", []PublicKey{publicKey}, WithAcceptableDigests(otherHelloAppDigest)); err == nil {
+		t.Errorf("NewVerifierPool(...) with acceptable digests = nil, expected non nil")
+	}
+	pool, err := NewVerifierPool("gcr.io/google-samples/hello-app", []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("NewVerifierPool(...) = %v, expected nil", err)
+	}
+	for _, digest := range []string{"", "sha256:1234", "SHA256:" + helloAppDigest[len("sha256:"):]} {
+		if _, err := pool.WithImageDigest(digest); err == nil {
+			t.Errorf("WithImageDigest(%q) = nil, expected non nil", digest)
+		}
+	}
+}
+
+func BenchmarkVerifierPool(b *testing.B) {
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec256-key"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte(rsa2048PubKey), ID: "rsa-key"},
+		{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(gpgPublicKey), ID: gpgPublicKeyID},
+	}
+	att := &Attestation{PublicKeyID: "ed25519-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+
+	b.Run("NewVerifier", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			v, err := NewVerifier(helloAppImage, publicKeys)
+			if err != nil {
+				b.Fatalf("error creating verifier: %v", err)
+			}
+			if err := v.VerifyAttestation(att); err != nil {
+				b.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+		}
+	})
+	b.Run("VerifierPool", func(b *testing.B) {
+		pool, err := NewVerifierPool("gcr.io/google-samples/hello-app", publicKeys)
+		if err != nil {
+			b.Fatalf("NewVerifierPool(...) = %v, expected nil", err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			v, err := pool.WithImageDigest(helloAppDigest)
+			if err != nil {
+				b.Fatalf("WithImageDigest(_) = %v, expected nil", err)
+			}
+			if err := v.VerifyAttestation(att); err != nil {
+				b.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+			}
+		}
+	})
+}
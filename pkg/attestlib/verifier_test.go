@@ -17,13 +17,31 @@ limitations under the License.
 package attestlib
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
-
-	"github.com/pkg/errors"
+	"time"
 )
 
 const qualifiedImage = "gcr.io/image/digest@sha256:0000000000000000000000000000000000000000000000000000000000000000"
 
+// helloAppImage is the image described by validPayload.
+const helloAppImage = "gcr.io/google-samples/hello-app@sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988"
+
 // This key was generated by the following commands:
 // `gpg --quick-generate-key --yes verifier@cryptolib.com`
 // `gpg --export --armor verifier@cryptolib.com > verifierPublicKey`
@@ -129,6 +147,36 @@ func TestNewPublicKey(t *testing.T) {
 			keyID:              ":{invalid-key-id}",
 			expectedErr:        true,
 		},
+		{
+			name:               "valid Ed25519 key ID",
+			authenticatorType:  Ed25519,
+			signatureAlgorithm: EddsaEd25519,
+			keyID:              "valid-key-id",
+			expectedErr:        false,
+			expectedID:         "valid-key-id",
+		},
+		{
+			name:               "Ed25519 key with ECDSA signature algorithm",
+			authenticatorType:  Ed25519,
+			signatureAlgorithm: EcdsaP256Sha256,
+			keyID:              "valid-key-id",
+			expectedErr:        true,
+		},
+		{
+			name:               "PKIX key with Ed25519 signature algorithm",
+			authenticatorType:  Pkix,
+			signatureAlgorithm: EddsaEd25519,
+			keyID:              "valid-key-id",
+			expectedErr:        true,
+		},
+		{
+			name:               "JWT key with EdDSA signature algorithm",
+			authenticatorType:  Jwt,
+			signatureAlgorithm: EddsaEd25519,
+			keyID:              "valid-key-id",
+			expectedErr:        false,
+			expectedID:         "valid-key-id",
+		},
 		{
 			name:              "unknown authenticator type",
 			authenticatorType: UnknownAuthenticatorType,
@@ -219,9 +267,9 @@ func TestVerifyAttestation(t *testing.T) {
 	}
 	for _, tc := range tcs {
 		t.Run(tc.name, func(t *testing.T) {
-			v := verifier{ImageDigest: qualifiedImage, PublicKeys: indexPublicKeysByID(tc.publicKeys)}
+			v := verifier{ImageDigest: qualifiedImage, PublicKeys: indexPublicKeysByID(tc.publicKeys, nopLogger{})}
 			v.pkixVerifier = mockPkixVerifier{shouldErr: tc.verifyErr}
-			v.authenticatedAttChecker = mockAuthAttChecker{}
+			v.AuthenticatedAttChecker = mockAuthAttChecker{}
 
 			err := v.VerifyAttestation(tc.att)
 			if tc.expectedErr != (err != nil) {
@@ -231,19 +279,1720 @@ func TestVerifyAttestation(t *testing.T) {
 	}
 }
 
-type mockPkixVerifier struct {
-	shouldErr bool
+func TestDuplicateKeyIDs(t *testing.T) {
+	signingKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "shared-id"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "shared-id"}
+	att := &Attestation{PublicKeyID: "shared-id", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	tcs := []struct {
+		name          string
+		publicKeys    []PublicKey
+		opts          []VerifierOption
+		expectNewErr  bool
+		expectedError error
+	}{
+		{
+			name:       "lenient with signing key registered first",
+			publicKeys: []PublicKey{signingKey, otherKey},
+		},
+		{
+			name:       "lenient with signing key registered last",
+			publicKeys: []PublicKey{otherKey, signingKey},
+		},
+		{
+			name:          "lenient with no key verifying",
+			publicKeys:    []PublicKey{otherKey, otherKey},
+			expectedError: ErrSignatureInvalid,
+		},
+		{
+			name:         "strict with duplicate ID",
+			publicKeys:   []PublicKey{signingKey, otherKey},
+			opts:         []VerifierOption{WithStrictKeyIDs()},
+			expectNewErr: true,
+		},
+		{
+			name:       "strict with unique IDs",
+			publicKeys: []PublicKey{signingKey},
+			opts:       []VerifierOption{WithStrictKeyIDs()},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, tc.publicKeys, tc.opts...)
+			if tc.expectNewErr {
+				if err == nil {
+					t.Fatalf("NewVerifier(...) = nil, expected non nil")
+				}
+				if !strings.Contains(err.Error(), `"shared-id"`) {
+					t.Errorf("NewVerifier(...) = %v, expected error naming the duplicated ID", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewVerifier(...) = %v, expected nil", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedError == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedError) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedError)
+			}
+		})
+	}
 }
 
-func (v mockPkixVerifier) verifyPkix([]byte, []byte, []byte) error {
-	if v.shouldErr {
-		return errors.New("error verifying PKIX")
+func TestDedupePublicKeys(t *testing.T) {
+	edKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed-key"}
+	renamedEdKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: append([]byte(nil), ed25519PubKey...), ID: "merged-ed-key"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "ed-key"}
+	ecKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	ecJwtKey := PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec-key"}
+	tcs := []struct {
+		name       string
+		publicKeys []PublicKey
+		expected   []PublicKey
+	}{
+		{
+			name:       "no keys",
+			publicKeys: nil,
+			expected:   []PublicKey{},
+		},
+		{
+			name:       "identical keys with identical IDs",
+			publicKeys: []PublicKey{edKey, ecKey, edKey},
+			expected:   []PublicKey{edKey, ecKey},
+		},
+		{
+			name:       "identical material under different IDs keeps the first ID",
+			publicKeys: []PublicKey{renamedEdKey, ecKey, edKey},
+			expected:   []PublicKey{renamedEdKey, ecKey},
+		},
+		{
+			name:       "different material under identical IDs",
+			publicKeys: []PublicKey{edKey, otherKey},
+			expected:   []PublicKey{edKey, otherKey},
+		},
+		{
+			name:       "identical material of different key types",
+			publicKeys: []PublicKey{ecKey, ecJwtKey},
+			expected:   []PublicKey{ecKey, ecJwtKey},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := DedupePublicKeys(tc.publicKeys); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("DedupePublicKeys(%v) = %v, expected %v", tc.publicKeys, got, tc.expected)
+			}
+		})
 	}
-	return nil
 }
 
-type mockAuthAttChecker struct{}
+func TestIndexPublicKeysByIDKeepsOrder(t *testing.T) {
+	edKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "shared-id"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "shared-id"}
+	ecKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "shared-id"}
+	logger := &capturingLogger{}
+	keyMap := indexPublicKeysByID([]PublicKey{otherKey, edKey, otherKey, ecKey, edKey}, logger)
+	expected := []PublicKey{otherKey, edKey, ecKey}
+	if !reflect.DeepEqual(keyMap["shared-id"], expected) {
+		t.Errorf("indexPublicKeysByID(...)[%q] = %v, expected %v", "shared-id", keyMap["shared-id"], expected)
+	}
+	if len(logger.warnings) != 4 {
+		t.Errorf("got warnings %q, expected 4", logger.warnings)
+	}
+}
 
-func (c mockAuthAttChecker) checkAuthenticatedAttestation(payload []byte, imageName string, imageDigest string, convert convertFunc) error {
-	return nil
+// capturingLogger records the messages passed to it.
+type capturingLogger struct {
+	infos    []string
+	warnings []string
+}
+
+func (l *capturingLogger) Infof(format string, args ...interface{}) {
+	l.infos = append(l.infos, fmt.Sprintf(format, args...))
+}
+
+func (l *capturingLogger) Warningf(format string, args ...interface{}) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestDuplicateKeyIDsLogged(t *testing.T) {
+	signingKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "shared-id"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "other-id"}
+	tcs := []struct {
+		name             string
+		publicKeys       []PublicKey
+		expectedWarnings int
+	}{
+		{
+			name:             "duplicate ID",
+			publicKeys:       []PublicKey{signingKey, signingKey},
+			expectedWarnings: 1,
+		},
+		{
+			name:       "unique IDs",
+			publicKeys: []PublicKey{signingKey, otherKey},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &capturingLogger{}
+			if _, err := NewVerifier(helloAppImage, tc.publicKeys, WithLogger(logger)); err != nil {
+				t.Fatalf("NewVerifier(...) = %v, expected nil", err)
+			}
+			if len(logger.warnings) != tc.expectedWarnings {
+				t.Fatalf("got warnings %q, expected %d", logger.warnings, tc.expectedWarnings)
+			}
+			for _, warning := range logger.warnings {
+				if !strings.Contains(warning, `"shared-id"`) {
+					t.Errorf("warning %q does not name the duplicated ID", warning)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationPayload(t *testing.T) {
+	publicKey, err := NewPublicKey(Pkix, EcdsaP256Sha256, []byte("key-data"), "key-id")
+	if err != nil {
+		t.Fatalf("error creating public key: %v", err)
+	}
+	tcs := []struct {
+		name        string
+		payload     []byte
+		expectedErr bool
+	}{
+		{
+			name:        "well-formed payload",
+			payload:     []byte(validPayload),
+			expectedErr: false,
+		},
+		{
+			name:        "malformed payload",
+			payload:     []byte(invalidPayload),
+			expectedErr: true,
+		},
+		{
+			name:        "payload missing digest",
+			payload:     []byte(missingDigestPayload),
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v := verifier{
+				ImageName:               "gcr.io/google-samples/hello-app",
+				ImageDigest:             "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988",
+				PublicKeys:              indexPublicKeysByID([]PublicKey{*publicKey}, nopLogger{}),
+				pkixVerifier:            mockPkixVerifier{},
+				AuthenticatedAttChecker: authenticatedAttCheckerImpl{},
+			}
+			err := v.VerifyAttestation(&Attestation{PublicKeyID: "key-id", Signature: []byte("signature"), SerializedPayload: tc.payload})
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestation(_) got %v, wanted error? = %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationAcceptableDigests(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	// The payload holds otherHelloAppDigest rather than the digest of
+	// helloAppImage.
+	att := &Attestation{
+		PublicKeyID:       "ed25519-key",
+		Signature:         ed25519.Sign(ed25519PrivateKey, []byte(otherDigestPayload)),
+		SerializedPayload: []byte(otherDigestPayload),
+	}
+	tcs := []struct {
+		name        string
+		digests     []string
+		expectedErr error
+	}{
+		{
+			name:    "payload matches second acceptable digest",
+			digests: []string{"sha256:" + strings.Repeat("1", 64), strings.ToUpper(otherHelloAppDigest)},
+		},
+		{
+			name:        "payload matches no acceptable digest",
+			digests:     []string{"sha256:" + strings.Repeat("1", 64), "sha512:" + strings.Repeat("ab", 64)},
+			expectedErr: ErrPayloadMismatch,
+		},
+		{
+			name:        "no acceptable digests",
+			expectedErr: ErrPayloadMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithAcceptableDigests(tc.digests...))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewVerifierInvalidAcceptableDigest(t *testing.T) {
+	if _, err := NewVerifier(helloAppImage, nil, WithAcceptableDigests("sha256:1234")); err == nil {
+		t.Errorf("NewVerifier(...) = nil, expected non nil")
+	}
+}
+
+func TestNewVerifierEmptyImageDigest(t *testing.T) {
+	tcs := []struct {
+		name  string
+		image string
+		opts  []VerifierOption
+	}{
+		{name: "empty image digest", image: "gcr.io/google-samples/hello-app@"},
+		{name: "empty image digest with acceptable digests", image: "gcr.io/google-samples/hello-app@", opts: []VerifierOption{WithAcceptableDigests(helloAppDigest)}},
+		{name: "empty acceptable digest", image: helloAppImage, opts: []VerifierOption{WithAcceptableDigests("")}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewVerifier(tc.image, nil, tc.opts...); err == nil {
+				t.Errorf("NewVerifier(%q, ...) = nil, expected non nil", tc.image)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationKeyTrial(t *testing.T) {
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	signingKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "other-key"}
+	pgpKey := PublicKey{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(verifierPublicKey), ID: verifierPublicKeyID}
+
+	tcs := []struct {
+		name        string
+		publicKeyID string
+		publicKeys  []PublicKey
+		limit       int
+		expectedErr error
+	}{
+		{
+			name:        "empty ID",
+			publicKeyID: "",
+			publicKeys:  []PublicKey{otherKey, signingKey, pgpKey},
+			limit:       10,
+		},
+		{
+			name:        "stale ID",
+			publicKeyID: "rotated-key",
+			publicKeys:  []PublicKey{otherKey, signingKey, pgpKey},
+			limit:       10,
+		},
+		{
+			name:        "all candidate keys fail",
+			publicKeyID: "rotated-key",
+			publicKeys:  []PublicKey{otherKey, pgpKey},
+			limit:       10,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "no candidate keys",
+			publicKeyID: "rotated-key",
+			publicKeys:  []PublicKey{pgpKey},
+			limit:       10,
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "verifying key beyond limit",
+			publicKeyID: "rotated-key",
+			publicKeys:  []PublicKey{otherKey, signingKey},
+			limit:       1,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "key trial disabled",
+			publicKeyID: "rotated-key",
+			publicKeys:  []PublicKey{otherKey, signingKey},
+			limit:       0,
+			expectedErr: ErrNoMatchingKey,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, tc.publicKeys, WithKeyTrial(tc.limit))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: tc.publicKeyID, Signature: signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestKeyTrialAggregatesFailures(t *testing.T) {
+	keys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-a"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-b"},
+	}
+	v, err := NewVerifier(helloAppImage, keys, WithKeyTrial(10))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	err = v.VerifyAttestation(&Attestation{Signature: []byte("signature"), SerializedPayload: []byte(validPayload)})
+	if err == nil {
+		t.Fatalf("VerifyAttestation(_) = nil, expected non nil")
+	}
+	for _, id := range []string{"key-a", "key-b"} {
+		if !strings.Contains(err.Error(), fmt.Sprintf("key %q", id)) {
+			t.Errorf("VerifyAttestation(_) = %v, expected failure for %q", err, id)
+		}
+	}
+}
+
+func TestVerifyAttestationStrictKeyIDMatching(t *testing.T) {
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	signingKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	unnamedKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: ""}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "other-key"}
+	bare := func(id string) *Attestation {
+		return &Attestation{PublicKeyID: id, Signature: signature, SerializedPayload: []byte(validPayload)}
+	}
+	dsse := func(keyID, publicKeyID string) *Attestation {
+		envelope := createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{keyID: ed25519PrivateKey})
+		return &Attestation{PublicKeyID: publicKeyID, Signature: envelope, EnvelopeType: Dsse}
+	}
+
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		publicKeys  []PublicKey
+		expectedErr error
+	}{
+		{
+			name:       "exact ID",
+			att:        bare("signing-key"),
+			publicKeys: []PublicKey{otherKey, signingKey},
+		},
+		{
+			name:        "empty ID with single key",
+			att:         bare(""),
+			publicKeys:  []PublicKey{signingKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "empty ID with key registered without ID",
+			att:         bare(""),
+			publicKeys:  []PublicKey{unnamedKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "mismatched ID",
+			att:         bare("rotated-key"),
+			publicKeys:  []PublicKey{otherKey, signingKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "ID differing in case",
+			att:         bare("Signing-Key"),
+			publicKeys:  []PublicKey{signingKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:       "DSSE signature with exact keyid",
+			att:        dsse("signing-key", ""),
+			publicKeys: []PublicKey{signingKey},
+		},
+		{
+			name:       "DSSE signature without keyid uses attestation ID",
+			att:        dsse("", "signing-key"),
+			publicKeys: []PublicKey{signingKey},
+		},
+		{
+			name:        "DSSE signature without any key ID",
+			att:         dsse("", ""),
+			publicKeys:  []PublicKey{unnamedKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+		{
+			name:        "DSSE signature with mismatched keyid",
+			att:         dsse("rotated-key", ""),
+			publicKeys:  []PublicKey{signingKey},
+			expectedErr: ErrKeyIDMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			// Key trial would verify all of the attestations above; strict
+			// key ID matching must take precedence over it.
+			v, err := NewVerifier(helloAppImage, tc.publicKeys, WithStrictKeyIDMatching(), WithKeyTrial(10))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationKeyAlias(t *testing.T) {
+	newPubKey, newPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	oldKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "old-key"}
+	newKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: newPubKey, ID: "new-key"}
+	otherKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "other-key"}
+	oldSignature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	newSignature := ed25519.Sign(newPrivateKey, []byte(validPayload))
+	alias := WithKeyAlias("signer", "old-key", "new-key")
+
+	tcs := []struct {
+		name          string
+		keyID         string
+		signature     []byte
+		opts          []VerifierOption
+		expectedKeyID string
+		expectedErr   error
+	}{
+		{
+			name:          "signed by old key, referencing old key",
+			keyID:         "old-key",
+			signature:     oldSignature,
+			opts:          []VerifierOption{alias},
+			expectedKeyID: "old-key",
+		},
+		{
+			name:          "signed by old key, referencing new key",
+			keyID:         "new-key",
+			signature:     oldSignature,
+			opts:          []VerifierOption{alias},
+			expectedKeyID: "old-key",
+		},
+		{
+			name:          "signed by new key, referencing old key",
+			keyID:         "old-key",
+			signature:     newSignature,
+			opts:          []VerifierOption{alias},
+			expectedKeyID: "new-key",
+		},
+		{
+			name:          "signed by new key, referencing alias",
+			keyID:         "signer",
+			signature:     newSignature,
+			opts:          []VerifierOption{alias},
+			expectedKeyID: "new-key",
+		},
+		{
+			name:          "strict key ID matching accepts alias",
+			keyID:         "signer",
+			signature:     oldSignature,
+			opts:          []VerifierOption{alias, WithStrictKeyIDMatching()},
+			expectedKeyID: "old-key",
+		},
+		{
+			name:        "signed by new key, referencing old key without alias",
+			keyID:       "old-key",
+			signature:   newSignature,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "signed by key outside the group",
+			keyID:       "other-key",
+			signature:   newSignature,
+			opts:        []VerifierOption{alias},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "unknown alias",
+			keyID:       "other-signer",
+			signature:   oldSignature,
+			opts:        []VerifierOption{alias},
+			expectedErr: ErrNoMatchingKey,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{oldKey, newKey, otherKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: tc.keyID, Signature: tc.signature, SerializedPayload: []byte(validPayload)}
+			result, err := v.VerifyAttestationWithResult(att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if result.KeyID != tc.expectedKeyID {
+				t.Errorf("VerifyAttestationWithResult(_) verified with key %q, expected %q", result.KeyID, tc.expectedKeyID)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationKeyMatcher(t *testing.T) {
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "9f2c4a7e1b3d5f60a1b2c3d4e5f60718293a4b5c"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "0d1e2f3a4b5c6d7e8f90a1b2c3d4e5f6a7b8c9d0"},
+	}
+	suffixMatcher := func(keyID string, publicKey PublicKey) bool {
+		return keyID != "" && strings.HasSuffix(strings.ToLower(publicKey.ID), strings.ToLower(keyID))
+	}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+
+	tcs := []struct {
+		name          string
+		keyID         string
+		opts          []VerifierOption
+		expectedKeyID string
+		expectedErr   error
+	}{
+		{
+			name:          "full fingerprint without matcher",
+			keyID:         publicKeys[0].ID,
+			expectedKeyID: publicKeys[0].ID,
+		},
+		{
+			name:        "short key ID without matcher",
+			keyID:       "293A4B5C",
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:          "short key ID with suffix matcher",
+			keyID:         "293A4B5C",
+			opts:          []VerifierOption{WithKeyMatcher(suffixMatcher)},
+			expectedKeyID: publicKeys[0].ID,
+		},
+		{
+			name:          "exact match takes precedence over matcher",
+			keyID:         publicKeys[0].ID,
+			opts:          []VerifierOption{WithKeyMatcher(func(string, PublicKey) bool { return false })},
+			expectedKeyID: publicKeys[0].ID,
+		},
+		{
+			name:          "matcher accepting every key",
+			keyID:         "any",
+			opts:          []VerifierOption{WithKeyMatcher(func(string, PublicKey) bool { return true })},
+			expectedKeyID: publicKeys[0].ID,
+		},
+		{
+			name:        "short key ID of another key",
+			keyID:       "a7b8c9d0",
+			opts:        []VerifierOption{WithKeyMatcher(suffixMatcher)},
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "short key ID matching no key",
+			keyID:       "deadbeef",
+			opts:        []VerifierOption{WithKeyMatcher(suffixMatcher)},
+			expectedErr: ErrNoMatchingKey,
+		},
+		{
+			name:        "strict key ID matching ignores matcher",
+			keyID:       "293a4b5c",
+			opts:        []VerifierOption{WithKeyMatcher(suffixMatcher), WithStrictKeyIDMatching()},
+			expectedErr: ErrKeyIDMismatch,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, publicKeys, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: tc.keyID, Signature: signature, SerializedPayload: []byte(validPayload)}
+			result, err := v.VerifyAttestationWithResult(att)
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			if result.KeyID != tc.expectedKeyID {
+				t.Errorf("VerifyAttestationWithResult(_) verified with key %q, expected %q", result.KeyID, tc.expectedKeyID)
+			}
+		})
+	}
+}
+
+func TestNewVerifierKeyAliasErrors(t *testing.T) {
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-a"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-b"},
+	}
+	tcs := []struct {
+		name      string
+		opts      []VerifierOption
+		expectErr bool
+	}{
+		{
+			name: "valid alias",
+			opts: []VerifierOption{WithKeyAlias("signer", "key-a", "key-b")},
+		},
+		{
+			name: "alias that is a key ID in its group",
+			opts: []VerifierOption{WithKeyAlias("key-a", "key-a", "key-b")},
+		},
+		{
+			name:      "unknown key ID",
+			opts:      []VerifierOption{WithKeyAlias("signer", "key-a", "key-c")},
+			expectErr: true,
+		},
+		{
+			name:      "key in several groups",
+			opts:      []VerifierOption{WithKeyAlias("signer-1", "key-a"), WithKeyAlias("signer-2", "key-a", "key-b")},
+			expectErr: true,
+		},
+		{
+			name:      "alias that is the ID of a key outside its group",
+			opts:      []VerifierOption{WithKeyAlias("key-b", "key-a")},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewVerifier(helloAppImage, publicKeys, tc.opts...)
+			if tc.expectErr && err == nil {
+				t.Errorf("NewVerifier(...) = nil, expected non nil")
+			}
+			if !tc.expectErr && err != nil {
+				t.Errorf("NewVerifier(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierParsesKeys(t *testing.T) {
+	tcs := []struct {
+		name           string
+		publicKey      PublicKey
+		expectErr      bool
+		expectedDetail string
+	}{
+		{
+			name:      "valid pkix key",
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "good-key"},
+			expectErr: false,
+		},
+		{
+			name:      "malformed pkix key",
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(badKey), ID: "bad-key"},
+			expectErr: true,
+		},
+		{
+			name:      "malformed jwt key",
+			publicKey: PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(badKey), ID: "bad-key"},
+			expectErr: true,
+		},
+		{
+			name:      "malformed pgp key",
+			publicKey: PublicKey{AuthenticatorType: Pgp, KeyData: []byte(badKey), ID: "bad-key"},
+			expectErr: true,
+		},
+		{
+			name:      "malformed ed25519 key",
+			publicKey: PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey[:8], ID: "bad-key"},
+			expectErr: true,
+		},
+		{
+			name:           "pgp key declared as pkix",
+			publicKey:      PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(gpgPublicKey), ID: "bad-key"},
+			expectErr:      true,
+			expectedDetail: "is a pgp key, but the key is declared as pkix",
+		},
+		{
+			name:           "pkix key declared as pgp",
+			publicKey:      PublicKey{AuthenticatorType: Pgp, SignatureAlgorithm: PGPUnused, KeyData: []byte(ec256PubKey), ID: "bad-key"},
+			expectErr:      true,
+			expectedDetail: "is a pkix key, but the key is declared as pgp",
+		},
+		{
+			name:           "rsa key with ecdsa algorithm",
+			publicKey:      PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(rsa2048PubKey), ID: "bad-key"},
+			expectErr:      true,
+			expectedDetail: "requires an ECDSA key, got an RSA key",
+		},
+		{
+			name:           "ecdsa key on the wrong curve",
+			publicKey:      PublicKey{AuthenticatorType: Jwt, SignatureAlgorithm: EcdsaP384Sha384, KeyData: []byte(ec256PubKey), ID: "bad-key"},
+			expectErr:      true,
+			expectedDetail: "requires an ECDSA key on curve P-384, got P-256",
+		},
+		{
+			name:      "garbage key",
+			publicKey: PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte{0xde, 0xad, 0xbe, 0xef}, ID: "bad-key"},
+			expectErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewVerifier(helloAppImage, []PublicKey{tc.publicKey})
+			if tc.expectErr {
+				if !errors.Is(err, ErrInvalidPublicKey) {
+					t.Fatalf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+				}
+				if !strings.Contains(err.Error(), `"bad-key"`) {
+					t.Errorf("NewVerifier(...) = %v, expected error naming the key", err)
+				}
+				if !strings.Contains(err.Error(), tc.expectedDetail) {
+					t.Errorf("NewVerifier(...) = %v, expected error containing %q", err, tc.expectedDetail)
+				}
+			} else if err != nil {
+				t.Errorf("NewVerifier(...) = %v, expected nil", err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierNamesAllInvalidKeys(t *testing.T) {
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "good-key"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(gpgPublicKey), ID: "mislabeled-key"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: []byte("garbage"), ID: "garbage-key"},
+	}
+	_, err := NewVerifier(helloAppImage, publicKeys)
+	if !errors.Is(err, ErrInvalidPublicKey) {
+		t.Fatalf("NewVerifier(...) = %v, want error matching %v", err, ErrInvalidPublicKey)
+	}
+	for _, keyID := range []string{"mislabeled-key", "garbage-key"} {
+		if !strings.Contains(err.Error(), fmt.Sprintf("%q", keyID)) {
+			t.Errorf("NewVerifier(...) = %v, expected error naming key %q", err, keyID)
+		}
+	}
+	if strings.Contains(err.Error(), `"good-key"`) {
+		t.Errorf("NewVerifier(...) = %v, expected error not to name the valid key", err)
+	}
+}
+
+func TestVerifyAttestationKeyValidity(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	tcs := []struct {
+		name        string
+		notBefore   time.Time
+		notAfter    time.Time
+		expectedErr error
+	}{
+		{
+			name: "no validity period",
+		},
+		{
+			name:      "in window",
+			notBefore: now.Add(-time.Hour),
+			notAfter:  now.Add(time.Hour),
+		},
+		{
+			name:        "before window",
+			notBefore:   now.Add(time.Hour),
+			notAfter:    now.Add(2 * time.Hour),
+			expectedErr: ErrKeyNotValid,
+		},
+		{
+			name:        "after window",
+			notBefore:   now.Add(-2 * time.Hour),
+			notAfter:    now.Add(-time.Hour),
+			expectedErr: ErrKeyNotValid,
+		},
+		{
+			name:        "after open ended window",
+			notAfter:    now.Add(-time.Hour),
+			expectedErr: ErrKeyNotValid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey, err := NewPublicKey(Ed25519, EddsaEd25519, ed25519PubKey, "signing-key", WithNotBefore(tc.notBefore), WithNotAfter(tc.notAfter))
+			if err != nil {
+				t.Fatalf("error creating public key: %v", err)
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{*publicKey}, WithClock(ClockFunc(func() time.Time { return now })))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationFreshness(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	newPayload := func(timestamp time.Time) string {
+		payload, err := newAtomicContainerPayload("gcr.io/google-samples/hello-app", helloAppDigest, timestamp)
+		if err != nil {
+			t.Fatalf("error creating payload: %v", err)
+		}
+		return string(payload)
+	}
+	tcs := []struct {
+		name        string
+		payload     string
+		maxAge      time.Duration
+		expectedErr error
+	}{
+		{
+			name:    "fresh attestation",
+			payload: newPayload(now.Add(-time.Minute)),
+			maxAge:  time.Hour,
+		},
+		{
+			name:        "stale attestation",
+			payload:     newPayload(now.Add(-2 * time.Hour)),
+			maxAge:      time.Hour,
+			expectedErr: ErrAttestationStale,
+		},
+		{
+			name:        "missing timestamp",
+			payload:     validPayload,
+			maxAge:      time.Hour,
+			expectedErr: ErrAttestationStale,
+		},
+		{
+			name:    "stale attestation without max age",
+			payload: newPayload(now.Add(-2 * time.Hour)),
+		},
+		{
+			name:    "missing timestamp without max age",
+			payload: validPayload,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, WithMaxAge(tc.maxAge), WithClock(ClockFunc(func() time.Time { return now })))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(tc.payload)), SerializedPayload: []byte(tc.payload)}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationRevokedKeys(t *testing.T) {
+	publicKeys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "revoked-key"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "trusted-key"},
+	}
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	revokedEnvelope := createDsseEnvelope(t, dssePayloadType, []byte(validPayload), map[string]ed25519.PrivateKey{"revoked-key": ed25519PrivateKey})
+	tcs := []struct {
+		name        string
+		att         *Attestation
+		revokedKeys []string
+		expectedErr error
+	}{
+		{
+			name:        "revoked key",
+			att:         &Attestation{PublicKeyID: "revoked-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			revokedKeys: []string{"revoked-key"},
+			expectedErr: ErrKeyRevoked,
+		},
+		{
+			name:        "revoked key in different case",
+			att:         &Attestation{PublicKeyID: "revoked-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			revokedKeys: []string{"REVOKED-KEY"},
+			expectedErr: ErrKeyRevoked,
+		},
+		{
+			name:        "revoked key checked before signature",
+			att:         &Attestation{PublicKeyID: "revoked-key", Signature: []byte("invalid-signature"), SerializedPayload: []byte(validPayload)},
+			revokedKeys: []string{"revoked-key"},
+			expectedErr: ErrKeyRevoked,
+		},
+		{
+			name:        "revoked key in DSSE envelope",
+			att:         &Attestation{Signature: revokedEnvelope, EnvelopeType: Dsse},
+			revokedKeys: []string{"revoked-key"},
+			expectedErr: ErrKeyRevoked,
+		},
+		{
+			name:        "non-revoked key",
+			att:         &Attestation{PublicKeyID: "trusted-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+			revokedKeys: []string{"revoked-key"},
+		},
+		{
+			name: "no revoked keys",
+			att:  &Attestation{PublicKeyID: "revoked-key", Signature: signature, SerializedPayload: []byte(validPayload)},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, publicKeys, WithRevokedKeys(tc.revokedKeys...))
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(tc.att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestNewPublicKeyInvalidValidityPeriod(t *testing.T) {
+	now := time.Now()
+	if _, err := NewPublicKey(Ed25519, EddsaEd25519, ed25519PubKey, "signing-key", WithNotBefore(now), WithNotAfter(now.Add(-time.Hour))); err == nil {
+		t.Errorf("NewPublicKey(...) = nil, expected non nil")
+	}
+}
+
+func TestVerifyAttestationCertificateChain(t *testing.T) {
+	now := time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC)
+	rootKey, root := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "root"},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	intermediateKey, intermediate := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "intermediate"},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, root, rootKey)
+	newLeaf := func(notAfter time.Time, keyUsage x509.KeyUsage) (*ecdsa.PrivateKey, *x509.Certificate) {
+		return newTestCertificate(t, &x509.Certificate{
+			SerialNumber: big.NewInt(3),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			NotBefore:    now.Add(-2 * time.Hour),
+			NotAfter:     notAfter,
+			KeyUsage:     keyUsage,
+		}, intermediate, intermediateKey)
+	}
+	_, otherRoot := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(4),
+		Subject:               pkix.Name{CommonName: "other root"},
+		NotBefore:             now.Add(-24 * time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	otherRoots := x509.NewCertPool()
+	otherRoots.AddCert(otherRoot)
+
+	tcs := []struct {
+		name        string
+		notAfter    time.Time
+		keyUsage    x509.KeyUsage
+		roots       *x509.CertPool
+		expectedErr error
+	}{
+		{
+			name:     "valid chain",
+			notAfter: now.Add(time.Hour),
+			keyUsage: x509.KeyUsageDigitalSignature,
+			roots:    roots,
+		},
+		{
+			name:        "expired leaf",
+			notAfter:    now.Add(-time.Hour),
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			roots:       roots,
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "untrusted root",
+			notAfter:    now.Add(time.Hour),
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			roots:       otherRoots,
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "no roots configured",
+			notAfter:    now.Add(time.Hour),
+			keyUsage:    x509.KeyUsageDigitalSignature,
+			expectedErr: ErrCertificateNotTrusted,
+		},
+		{
+			name:        "leaf without digital signature usage",
+			notAfter:    now.Add(time.Hour),
+			keyUsage:    x509.KeyUsageKeyEncipherment,
+			roots:       roots,
+			expectedErr: ErrCertificateNotTrusted,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			leafKey, leaf := newLeaf(tc.notAfter, tc.keyUsage)
+			signature, err := ecSign(leafKey, []byte(validPayload), EcdsaP256Sha256)
+			if err != nil {
+				t.Fatalf("error signing payload: %v", err)
+			}
+			keyData := append(encodeTestCertificate(leaf), encodeTestCertificate(intermediate)...)
+			publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: keyData, ID: "leaf-key"}
+			opts := []VerifierOption{WithClock(ClockFunc(func() time.Time { return now }))}
+			if tc.roots != nil {
+				opts = append(opts, WithRoots(tc.roots))
+			}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(&Attestation{PublicKeyID: "leaf-key", Signature: signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+// newTestCertificate creates a certificate from `template` with a new P-256
+// key. The certificate is self-signed if `parent` is nil.
+func newTestCertificate(t *testing.T, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return key, cert
+}
+
+func encodeTestCertificate(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func TestVerifyAttestationDeclaredAlgorithm(t *testing.T) {
+	signer, err := NewPkixSigner([]byte(rsa2048PrivateKey), RsaPss2048Sha256, "rsa-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := signer.CreateAttestation([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	tcs := []struct {
+		name        string
+		declaredAlg SignatureAlgorithm
+		keyAlg      SignatureAlgorithm
+		expectedErr error
+	}{
+		{
+			name:        "declared algorithm matches key",
+			declaredAlg: RsaPss2048Sha256,
+			keyAlg:      RsaPss2048Sha256,
+		},
+		{
+			name:        "no declared algorithm",
+			declaredAlg: UnknownSigningAlgorithm,
+			keyAlg:      RsaPss2048Sha256,
+		},
+		{
+			name:        "declared PSS with PKCS1 key",
+			declaredAlg: RsaPss2048Sha256,
+			keyAlg:      RsaSignPkcs12048Sha256,
+			expectedErr: ErrSignatureInvalid,
+		},
+		{
+			name:        "undeclared PSS with PKCS1 key",
+			declaredAlg: UnknownSigningAlgorithm,
+			keyAlg:      RsaSignPkcs12048Sha256,
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: tc.keyAlg, KeyData: []byte(rsa2048PubKey), ID: "rsa-key"}
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			declared := *att
+			declared.SignatureAlgorithm = tc.declaredAlg
+			err = v.VerifyAttestation(&declared)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationAllowedAlgorithms(t *testing.T) {
+	signer, err := NewPkixSigner([]byte(rsa2048PrivateKey), RsaSignPkcs12048Sha256, "rsa-key")
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	att, err := signer.CreateAttestation([]byte(validPayload))
+	if err != nil {
+		t.Fatalf("error creating attestation: %v", err)
+	}
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte(rsa2048PubKey), ID: "rsa-key"}
+	tcs := []struct {
+		name        string
+		opts        []VerifierOption
+		expectedErr error
+	}{
+		{
+			name: "no allow-list",
+		},
+		{
+			name: "algorithm allowed",
+			opts: []VerifierOption{WithAllowedAlgorithms(RsaSignPkcs12048Sha256, EcdsaP256Sha256)},
+		},
+		{
+			name:        "algorithm not allowed",
+			opts:        []VerifierOption{WithAllowedAlgorithms(RsaPss2048Sha256, EcdsaP256Sha256)},
+			expectedErr: ErrAlgorithmNotAllowed,
+		},
+		{
+			name:        "empty allow-list",
+			opts:        []VerifierOption{WithAllowedAlgorithms()},
+			expectedErr: ErrAlgorithmNotAllowed,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewVerifier(helloAppImage, []PublicKey{publicKey}, tc.opts...)
+			if err != nil {
+				t.Fatalf("error creating verifier: %v", err)
+			}
+			err = v.VerifyAttestation(att)
+			if tc.expectedErr == nil {
+				if err != nil {
+					t.Errorf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			} else if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestAllowedAlgorithmsCheckedBeforeSignature(t *testing.T) {
+	pkix := &cancellingPkixVerifier{cancel: func() {}}
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: []byte(rsa2048PubKey), ID: "rsa-key"}
+	v := verifier{
+		PublicKeys:              indexPublicKeysByID([]PublicKey{publicKey}, nopLogger{}),
+		pkixVerifier:            pkix,
+		AuthenticatedAttChecker: mockAuthAttChecker{},
+	}
+	WithAllowedAlgorithms(EcdsaP256Sha256)(&v)
+	err := v.VerifyAttestation(&Attestation{PublicKeyID: "rsa-key", Signature: []byte("signature"), SerializedPayload: []byte("payload")})
+	if !errors.Is(err, ErrAlgorithmNotAllowed) {
+		t.Errorf("VerifyAttestation(_) = %v, want error matching %v", err, ErrAlgorithmNotAllowed)
+	}
+	if pkix.calls != 0 {
+		t.Errorf("verifyPkix called %d times, want 0", pkix.calls)
+	}
+}
+
+func TestVerifyAttestationWithResult(t *testing.T) {
+	signature := ed25519.Sign(ed25519PrivateKey, []byte(validPayload))
+	keys := []PublicKey{
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: otherEd25519PubKey, ID: "key-a"},
+		{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "key-b"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "key-c"},
+	}
+	tcs := []struct {
+		name          string
+		publicKeyID   string
+		expectedKeyID string
+		expectErr     bool
+	}{
+		{
+			name:          "matching key id",
+			publicKeyID:   "key-b",
+			expectedKeyID: "key-b",
+		},
+		{
+			name:          "key found by key trial",
+			publicKeyID:   "",
+			expectedKeyID: "key-b",
+		},
+		{
+			name:        "wrong key id",
+			publicKeyID: "key-a",
+			expectErr:   true,
+		},
+	}
+	v, err := NewVerifier(helloAppImage, keys, WithKeyTrial(len(keys)))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := v.VerifyAttestationWithResult(&Attestation{PublicKeyID: tc.publicKeyID, Signature: signature, SerializedPayload: []byte(validPayload)})
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("VerifyAttestationWithResult(_) = %v, expected non nil", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			}
+			expected := VerificationResult{
+				KeyID:       tc.expectedKeyID,
+				KeyType:     Ed25519,
+				ImageDigest: "sha256:bedb3feb23e81d162e33976fd7b245adff00379f4755c0213e84405e5b1e0988",
+				Signatures:  []SignatureResult{{PublicKeyID: tc.publicKeyID, KeyID: tc.expectedKeyID, KeyType: Ed25519}},
+			}
+			if !reflect.DeepEqual(*result, expected) {
+				t.Errorf("VerifyAttestationWithResult(_) = %+v, expected %+v", *result, expected)
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationContext(t *testing.T) {
+	publicKey := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "signing-key"}
+	att := &Attestation{PublicKeyID: "signing-key", Signature: ed25519.Sign(ed25519PrivateKey, []byte(validPayload)), SerializedPayload: []byte(validPayload)}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+
+	if err := v.VerifyAttestationContext(context.Background(), att); err != nil {
+		t.Errorf("VerifyAttestationContext(_) = %v, expected nil", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := v.VerifyAttestationContext(cancelled, att); !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want %v", err, context.Canceled)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := v.VerifyAttestationContext(expired, att); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestVerifyAttestationContextCancelledDuringKeyTrial(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	keys := []PublicKey{
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte("key-data"), ID: "key-a"},
+		{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte("key-data"), ID: "key-b"},
+	}
+	pkix := &cancellingPkixVerifier{cancel: cancel}
+	v := verifier{
+		PublicKeys:              indexPublicKeysByID(keys, nopLogger{}),
+		keyTrialLimit:           len(keys),
+		pkixVerifier:            pkix,
+		AuthenticatedAttChecker: mockAuthAttChecker{},
+	}
+	err := v.VerifyAttestationContext(ctx, &Attestation{Signature: []byte("signature"), SerializedPayload: []byte("payload")})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want %v", err, context.Canceled)
+	}
+	if pkix.calls != 1 {
+		t.Errorf("verifyPkix called %d times, want 1", pkix.calls)
+	}
+}
+
+// cancellingPkixVerifier fails verification and cancels a context the first
+// time it is called.
+type cancellingPkixVerifier struct {
+	cancel context.CancelFunc
+	calls  int
+}
+
+func (v *cancellingPkixVerifier) verifyPkix([]byte, []byte, PublicKey) error {
+	v.calls++
+	v.cancel()
+	return errors.New("error verifying PKIX")
+}
+
+type mockPkixVerifier struct {
+	shouldErr bool
+}
+
+func (v mockPkixVerifier) verifyPkix([]byte, []byte, PublicKey) error {
+	if v.shouldErr {
+		return errors.New("error verifying PKIX")
+	}
+	return nil
+}
+
+type mockAuthAttChecker struct{}
+
+func (c mockAuthAttChecker) CheckAuthenticatedAttestation(payload []byte, imageName string, imageDigests []string, convert ConvertFunc) error {
+	return nil
+}
+
+// BenchmarkVerifyWithKey compares verification with a key parsed once by
+// NewVerifier against re-parsing KeyData on every call.
+func BenchmarkVerifyWithKey(b *testing.B) {
+	signature, err := base64.RawURLEncoding.DecodeString(ec256Sig)
+	if err != nil {
+		b.Fatalf("error base64 decoding signature: %v", err)
+	}
+	att := &Attestation{Signature: signature, SerializedPayload: []byte(goodPayload)}
+	publicKey := PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: EcdsaP256Sha256, KeyData: []byte(ec256PubKey), ID: "ec256-key"}
+	v, err := NewVerifier(helloAppImage, []PublicKey{publicKey})
+	if err != nil {
+		b.Fatalf("error creating verifier: %v", err)
+	}
+	impl := v.(*verifier)
+
+	b.Run("cached", func(b *testing.B) {
+		cached := impl.PublicKeys[publicKey.ID][0]
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := impl.verifyWithKey(context.Background(), att, cached); err != nil {
+				b.Fatalf("verifyWithKey(...) = %v, expected nil", err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := impl.verifyWithKey(context.Background(), att, publicKey); err != nil {
+				b.Fatalf("verifyWithKey(...) = %v, expected nil", err)
+			}
+		}
+	})
+}
+
+// parallelKmsVerifier is a concurrency-safe kmsVerifier that verifies the
+// keys in `valid` after `delays`, and blocks on keys in `block` until their
+// context is cancelled.
+type parallelKmsVerifier struct {
+	valid  map[string]bool
+	delays map[string]time.Duration
+	block  map[string]bool
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	cancelled   map[string]bool
+}
+
+func (v *parallelKmsVerifier) verifyKms(ctx context.Context, _ []byte, _ []byte, publicKey PublicKey) error {
+	v.mu.Lock()
+	v.inFlight++
+	if v.inFlight > v.maxInFlight {
+		v.maxInFlight = v.inFlight
+	}
+	v.mu.Unlock()
+	defer func() {
+		v.mu.Lock()
+		v.inFlight--
+		v.mu.Unlock()
+	}()
+
+	if v.block[publicKey.ID] {
+		<-ctx.Done()
+		v.mu.Lock()
+		v.cancelled[publicKey.ID] = true
+		v.mu.Unlock()
+		return ctx.Err()
+	}
+	time.Sleep(v.delays[publicKey.ID])
+	if !v.valid[publicKey.ID] {
+		return errors.New("error verifying KMS signature")
+	}
+	return nil
+}
+
+func newParallelKeyTrialVerifier(keyIDs []string, workers int, kms *parallelKmsVerifier) *verifier {
+	keys := []PublicKey{}
+	for _, id := range keyIDs {
+		keys = append(keys, PublicKey{AuthenticatorType: Kms, SignatureAlgorithm: EcdsaP256Sha256, ID: id})
+	}
+	kms.cancelled = map[string]bool{}
+	return &verifier{
+		PublicKeys:              indexPublicKeysByID(keys, nopLogger{}),
+		keyTrialLimit:           len(keys),
+		keyTrialWorkers:         workers,
+		kmsVerifier:             kms,
+		AuthenticatedAttChecker: mockAuthAttChecker{},
+	}
+}
+
+func TestVerifyAttestationParallelKeyTrial(t *testing.T) {
+	keyIDs := []string{"key-0", "key-1", "key-2", "key-3", "key-4", "key-5", "key-6", "key-7"}
+	tcs := []struct {
+		name          string
+		workers       int
+		valid         map[string]bool
+		delays        map[string]time.Duration
+		expectedKeyID string
+		expectedErr   error
+	}{
+		{
+			name:    "lowest index key wins over faster later key",
+			workers: 4,
+			valid:   map[string]bool{"key-2": true, "key-3": true},
+			delays: map[string]time.Duration{
+				"key-2": 50 * time.Millisecond,
+			},
+			expectedKeyID: "key-2",
+		},
+		{
+			name:          "single verifying key",
+			workers:       3,
+			valid:         map[string]bool{"key-6": true},
+			expectedKeyID: "key-6",
+		},
+		{
+			name:          "more workers than keys",
+			workers:       16,
+			valid:         map[string]bool{"key-7": true},
+			expectedKeyID: "key-7",
+		},
+		{
+			name:        "no verifying key",
+			workers:     4,
+			valid:       map[string]bool{},
+			expectedErr: ErrSignatureInvalid,
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			kms := &parallelKmsVerifier{valid: tc.valid, delays: tc.delays}
+			v := newParallelKeyTrialVerifier(keyIDs, tc.workers, kms)
+			result, err := v.VerifyAttestationWithResult(&Attestation{Signature: []byte("signature"), SerializedPayload: []byte("payload")})
+			if tc.expectedErr != nil {
+				if !errors.Is(err, tc.expectedErr) {
+					t.Fatalf("VerifyAttestationWithResult(_) = %v, want error matching %v", err, tc.expectedErr)
+				}
+				for _, id := range keyIDs {
+					if !strings.Contains(err.Error(), id) {
+						t.Errorf("VerifyAttestationWithResult(_) = %v, expected failure of %q", err, id)
+					}
+				}
+			} else if err != nil {
+				t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+			} else if result.KeyID != tc.expectedKeyID {
+				t.Errorf("VerifyAttestationWithResult(_) verified with %q, expected %q", result.KeyID, tc.expectedKeyID)
+			}
+			if kms.maxInFlight > tc.workers {
+				t.Errorf("%d keys tried concurrently, expected at most %d", kms.maxInFlight, tc.workers)
+			}
+		})
+	}
+}
+
+func TestParallelKeyTrialCancelsLaterKeys(t *testing.T) {
+	kms := &parallelKmsVerifier{
+		valid:  map[string]bool{"key-0": true},
+		delays: map[string]time.Duration{"key-0": 10 * time.Millisecond},
+		block:  map[string]bool{"key-1": true, "key-2": true},
+	}
+	v := newParallelKeyTrialVerifier([]string{"key-0", "key-1", "key-2", "key-3"}, 3, kms)
+	result, err := v.VerifyAttestationWithResult(&Attestation{Signature: []byte("signature"), SerializedPayload: []byte("payload")})
+	if err != nil {
+		t.Fatalf("VerifyAttestationWithResult(_) = %v, expected nil", err)
+	}
+	if result.KeyID != "key-0" {
+		t.Errorf("VerifyAttestationWithResult(_) verified with %q, expected %q", result.KeyID, "key-0")
+	}
+	if !kms.cancelled["key-1"] || !kms.cancelled["key-2"] {
+		t.Errorf("keys cancelled: %v, expected key-1 and key-2", kms.cancelled)
+	}
+}
+
+func TestParallelKeyTrialContextCancelled(t *testing.T) {
+	kms := &parallelKmsVerifier{block: map[string]bool{"key-0": true, "key-1": true}}
+	v := newParallelKeyTrialVerifier([]string{"key-0", "key-1", "key-2"}, 2, kms)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := v.VerifyAttestationContext(ctx, &Attestation{Signature: []byte("signature"), SerializedPayload: []byte("payload")})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("VerifyAttestationContext(_) = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// BenchmarkKeyTrial measures key trial over RSA keys where only the last
+// candidate key verifies the Attestation.
+func BenchmarkKeyTrial(b *testing.B) {
+	const numKeys = 16
+	var keys []PublicKey
+	var signer *rsa.PrivateKey
+	for i := 0; i < numKeys; i++ {
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			b.Fatalf("error generating key: %v", err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+		if err != nil {
+			b.Fatalf("error marshaling public key: %v", err)
+		}
+		keyData := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+		keys = append(keys, PublicKey{AuthenticatorType: Pkix, SignatureAlgorithm: RsaSignPkcs12048Sha256, KeyData: keyData, ID: fmt.Sprintf("key-%02d", i)})
+		signer = privateKey
+	}
+	signature, err := rsaSign(signer, []byte(validPayload), RsaSignPkcs12048Sha256)
+	if err != nil {
+		b.Fatalf("error signing payload: %v", err)
+	}
+	att := &Attestation{Signature: signature, SerializedPayload: []byte(validPayload)}
+
+	for _, workers := range []int{1, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			v, err := NewVerifier(helloAppImage, keys, WithKeyTrial(numKeys), WithParallelKeyTrial(workers))
+			if err != nil {
+				b.Fatalf("error creating verifier: %v", err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := v.VerifyAttestation(att); err != nil {
+					b.Fatalf("VerifyAttestation(_) = %v, expected nil", err)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyAttestationDetachedSignature(t *testing.T) {
+	pgpKey := PublicKey{AuthenticatorType: Pgp, KeyData: []byte(gpgPublicKey), ID: gpgPublicKeyID}
+	ed25519Key := PublicKey{AuthenticatorType: Ed25519, SignatureAlgorithm: EddsaEd25519, KeyData: ed25519PubKey, ID: "ed25519-key"}
+	jwt := string(createJwt(t, validHeader, validPayload, ec256PrivateKey, EcdsaP256Sha256))
+	parts := strings.Split(jwt, ".")
+	detachedJwt := []byte(parts[0] + ".." + parts[2])
+	tcs := []struct {
+		name        string
+		att         Attestation
+		expectedErr bool
+	}{
+		{
+			name: "detached PGP signature",
+			att: Attestation{
+				PublicKeyID:       gpgPublicKeyID,
+				Signature:         newGpgDetachedSignature(t, validPayload, true),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+		},
+		{
+			name: "detached PGP signature over another payload",
+			att: Attestation{
+				PublicKeyID:       gpgPublicKeyID,
+				Signature:         newGpgDetachedSignature(t, testPayload, true),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+			expectedErr: true,
+		},
+		{
+			name: "detached PGP signature without DetachedSignature",
+			att: Attestation{
+				PublicKeyID:       gpgPublicKeyID,
+				Signature:         newGpgDetachedSignature(t, validPayload, true),
+				SerializedPayload: []byte(validPayload),
+			},
+			expectedErr: true,
+		},
+		{
+			name: "detached Ed25519 signature",
+			att: Attestation{
+				PublicKeyID:       "ed25519-key",
+				Signature:         ed25519.Sign(ed25519PrivateKey, []byte(validPayload)),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+		},
+		{
+			name: "detached Ed25519 signature over another payload",
+			att: Attestation{
+				PublicKeyID:       "ed25519-key",
+				Signature:         ed25519.Sign(ed25519PrivateKey, []byte(testPayload)),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+			expectedErr: true,
+		},
+		{
+			name: "JWT with detached content",
+			att: Attestation{
+				PublicKeyID:       ec256JwtPubKey.ID,
+				Signature:         detachedJwt,
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+		},
+		{
+			name: "JWT with attached content",
+			att: Attestation{
+				PublicKeyID:       ec256JwtPubKey.ID,
+				Signature:         []byte(jwt),
+				SerializedPayload: []byte(validPayload),
+				DetachedSignature: true,
+			},
+			expectedErr: true,
+		},
+	}
+	v, err := NewVerifier(helloAppImage, []PublicKey{pgpKey, ed25519Key, ec256JwtPubKey}, WithClock(ClockFunc(func() time.Time { return gpgSignatureTime })))
+	if err != nil {
+		t.Fatalf("error creating verifier: %v", err)
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := v.VerifyAttestation(&tc.att)
+			if tc.expectedErr != (err != nil) {
+				t.Errorf("VerifyAttestation(_) = %v, expected error: %v", err, tc.expectedErr)
+			}
+		})
+	}
 }
@@ -19,102 +19,172 @@ package attestlib
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/sha512"
-	"crypto/x509"
 	"encoding/asn1"
-	"encoding/pem"
+	"fmt"
 	"github.com/pkg/errors"
 	"math/big"
 )
 
 // hashPayload returns the hash function, the hashed payload and an error.
 func hashPayload(payload []byte, signingAlg SignatureAlgorithm) (crypto.Hash, []byte, error) {
-	switch signingAlg {
-	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, EcdsaP256Sha256:
-		hashedPayload := sha256.Sum256(payload)
-		return crypto.SHA256, hashedPayload[:], nil
-	case EcdsaP384Sha384:
-		hashedPayload := sha512.Sum384(payload)
-		return crypto.SHA384, hashedPayload[:], nil
-	case RsaSignPkcs14096Sha512, RsaPss4096Sha512, EcdsaP521Sha512:
-		hashedPayload := sha512.Sum512(payload)
-		return crypto.SHA512, hashedPayload[:], nil
-	default:
-		return 0, nil, errors.New("invalid signature algorithm")
+	hash, err := signatureHash(signingAlg)
+	if err != nil {
+		return 0, nil, err
 	}
+	h := hash.New()
+	h.Write(payload)
+	return hash, h.Sum(nil), nil
+}
+
+// signatureHash returns the hash function of an RSA or ECDSA signature
+// algorithm, which may be registered with RegisterSignatureHash.
+func signatureHash(signingAlg SignatureAlgorithm) (crypto.Hash, error) {
+	_, hash, err := resolveSignatureAlgorithm(signingAlg)
+	return hash, err
 }
 
 // This function will be used to verify PKIX and JWT signatures. PGP detached signatures are not supported by this function.
 // Signature is the raw byte signature.
-// PublicKey is the PEM encoded public key that will be used to verify the signature.
+// PublicKey is the PEM or DER encoded public key that will be used to verify the signature.
 // Payload is the plaintext that was hashed and then signed.
 func verifyDetached(signature []byte, publicKey []byte, signingAlg SignatureAlgorithm, payload []byte) error {
 	// Decode public key to der and parse for key type.
 	// This is needed to create PublicKey type needed for the verify functions.
-	der, rest := pem.Decode(publicKey)
-	if der == nil {
-		return errors.New("failed to decode PEM")
-	}
-	if len(rest) != 0 {
-		return errors.New("more than one public key given")
-	}
-	pub, err := x509.ParsePKIXPublicKey(der.Bytes)
+	pub, err := parsePkixPublicKey(publicKey)
 	if err != nil {
-		return err
+		return errors.Wrap(err, "error parsing public key")
 	}
+	return verifyDetachedWithKey(signature, pub, signingAlg, payload)
+}
 
+// verifyDetachedWithKey is like verifyDetached, but receives an already
+// parsed public key.
+func verifyDetachedWithKey(signature []byte, pub crypto.PublicKey, signingAlg SignatureAlgorithm, payload []byte) error {
 	switch signingAlg {
-	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha512:
-		rsaKey, ok := pub.(*rsa.PublicKey)
+	case EddsaEd25519:
+		edKey, ok := pub.(ed25519.PublicKey)
 		if !ok {
-			return errors.New("expected rsa key")
+			return fmt.Errorf("expected ed25519 key for signature algorithm %v, got %T", signingAlg, pub)
+		}
+		// ed25519.Verify panics on keys of the wrong size.
+		if len(edKey) != ed25519.PublicKeySize {
+			return fmt.Errorf("expected %d byte ed25519 key, got %d bytes", ed25519.PublicKeySize, len(edKey))
 		}
-		hash, hashedPayload, err := hashPayload(payload, signingAlg)
+		if !ed25519.Verify(edKey, payload, signature) {
+			return errors.New("failed to verify ed25519 signature")
+		}
+		return nil
+	default:
+		_, hashedPayload, err := hashPayload(payload, signingAlg)
 		if err != nil {
-			return err
+			return fmt.Errorf("signature algorithm %v not supported", signingAlg)
+		}
+		return verifyDigestWithKey(signature, pub, signingAlg, hashedPayload)
+	}
+}
+
+// verifyDigestWithKey verifies an RSA or ECDSA signature over a payload whose
+// digest, computed with the hash function of `signingAlg`, is
+// `hashedPayload`. Registered algorithms are verified like the algorithm they
+// are based on, with their own hash function.
+func verifyDigestWithKey(signature []byte, pub crypto.PublicKey, signingAlg SignatureAlgorithm, hashedPayload []byte) error {
+	base, hash, err := resolveSignatureAlgorithm(signingAlg)
+	if err != nil {
+		return fmt.Errorf("signature algorithm %v not supported", signingAlg)
+	}
+	switch base {
+	case RsaSignPkcs12048Sha256, RsaSignPkcs13072Sha256, RsaSignPkcs14096Sha256, RsaSignPkcs14096Sha384, RsaSignPkcs14096Sha512:
+		rsaKey, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("expected rsa key for signature algorithm %v, got %T", signingAlg, pub)
 		}
 		err = rsa.VerifyPKCS1v15(rsaKey, hash, hashedPayload, signature)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "failed to verify rsa signature")
 		}
 		return nil
 	case RsaPss2048Sha256, RsaPss3072Sha256, RsaPss4096Sha256, RsaPss4096Sha512:
 		rsaKey, ok := pub.(*rsa.PublicKey)
 		if !ok {
-			return errors.New("expected ecdsa key")
-		}
-		hash, hashedPayload, err := hashPayload(payload, signingAlg)
-		if err != nil {
-			return err
+			return fmt.Errorf("expected rsa key for signature algorithm %v, got %T", signingAlg, pub)
 		}
 		err = rsa.VerifyPSS(rsaKey, hash, hashedPayload, signature, nil)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "failed to verify rsa-pss signature")
 		}
 		return nil
 	case EcdsaP256Sha256, EcdsaP384Sha384, EcdsaP521Sha512:
 		ecKey, ok := pub.(*ecdsa.PublicKey)
 		if !ok {
-			return errors.New("expected ecdsa key")
-		}
-		var sigStruct struct {
-			R, S *big.Int
+			return fmt.Errorf("expected ecdsa key for signature algorithm %v, got %T", signingAlg, pub)
 		}
-		if _, err := asn1.Unmarshal(signature, &sigStruct); err != nil {
-			return err
+		if curve := ecdsaCurve(base); ecKey.Curve != curve {
+			return fmt.Errorf("expected ecdsa key on curve %s, got %s", curve.Params().Name, ecKey.Curve.Params().Name)
 		}
-		// The hash function is not needed for ecdsa.Verify.
-		_, hashedPayload, err := hashPayload(payload, signingAlg)
-		if err != nil {
-			return err
+		// Signers encode ECDSA signatures either in ASN.1 DER or, like JWS and
+		// WebCrypto, as the fixed-width concatenation r||s. A signature is
+		// tried as DER first, and as r||s if it has the size of one.
+		r, s, derErr := decodeDerEcdsaSignature(signature)
+		if derErr == nil && ecdsa.Verify(ecKey, hashedPayload, r, s) {
+			return nil
 		}
-		if !ecdsa.Verify(ecKey, hashedPayload, sigStruct.R, sigStruct.S) {
-			return errors.New("failed to verify ecdsa signature")
+		if r, s, err := decodeRawEcdsaSignature(signature, base); err == nil {
+			if ecdsa.Verify(ecKey, hashedPayload, r, s) {
+				return nil
+			}
+		} else if derErr != nil {
+			return errors.Wrap(derErr, "error decoding ecdsa signature")
 		}
-		return nil
+		return errors.New("failed to verify ecdsa signature")
+	default:
+		return fmt.Errorf("signature algorithm %v not supported", signingAlg)
+	}
+}
+
+// decodeDerEcdsaSignature decodes an ASN.1 DER encoded ECDSA signature.
+func decodeDerEcdsaSignature(signature []byte) (*big.Int, *big.Int, error) {
+	var sigStruct struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(signature, &sigStruct)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rest) != 0 {
+		return nil, nil, errors.New("unexpected data after ecdsa signature")
+	}
+	return sigStruct.R, sigStruct.S, nil
+}
+
+// decodeRawEcdsaSignature decodes an ECDSA signature encoded as the
+// fixed-width concatenation r||s, whose halves have the byte size of the
+// curve of `signingAlg`.
+func decodeRawEcdsaSignature(signature []byte, signingAlg SignatureAlgorithm) (*big.Int, *big.Int, error) {
+	size := ecdsaSignatureSize(signingAlg)
+	if len(signature) != 2*size {
+		return nil, nil, fmt.Errorf("expected %d byte ecdsa signature, got %d", 2*size, len(signature))
+	}
+	return new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:]), nil
+}
+
+// ecdsaSignatureSize returns the byte size of r and s in an ECDSA signature
+// of `signingAlg`.
+func ecdsaSignatureSize(signingAlg SignatureAlgorithm) int {
+	return (ecdsaCurve(signingAlg).Params().BitSize + 7) / 8
+}
+
+// ecdsaCurve returns the elliptic curve expected by an ECDSA signature
+// algorithm.
+func ecdsaCurve(signingAlg SignatureAlgorithm) elliptic.Curve {
+	switch signingAlg {
+	case EcdsaP384Sha384:
+		return elliptic.P384()
+	case EcdsaP521Sha512:
+		return elliptic.P521()
 	default:
-		return errors.New("signature algorithm not supported")
+		return elliptic.P256()
 	}
 }
@@ -17,6 +17,7 @@ limitations under the License.
 package attestlib
 
 import (
+	"crypto/ed25519"
 	"encoding/base64"
 	"testing"
 )
@@ -254,3 +255,10 @@ func TestVerifyDetached(t *testing.T) {
 		})
 	}
 }
+
+func TestVerifyDetachedWithKeyInvalidEd25519Key(t *testing.T) {
+	signature := make([]byte, 64)
+	if err := verifyDetachedWithKey(signature, ed25519.PublicKey(ed25519PubKey[:16]), EddsaEd25519, []byte(goodPayload)); err == nil {
+		t.Errorf("verifyDetachedWithKey(...) = nil, expected error")
+	}
+}